@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,12 +31,17 @@ import (
 	"github.com/mzyy94/airscap/internal/webui"
 )
 
+// debugLogLines is how many recent log lines the Web UI debug bundle includes.
+const debugLogLines = 500
+
 // Version is set at build time via -ldflags "-X main.version=..."
 var version = "dev"
 
 func main() {
+	scanner.Version = version
 	logLevel := parseLogLevel(envStr("AIRSCAP_LOG_LEVEL", "info"))
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+	logBuffer := webui.NewLogBuffer(debugLogLines)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.MultiWriter(os.Stderr, logBuffer), &slog.HandlerOptions{Level: logLevel})))
 
 	// Parse configuration from environment variables
 	scannerIP := os.Getenv("AIRSCAP_SCANNER_IP")
@@ -39,6 +50,31 @@ func main() {
 	listenPort := envInt("AIRSCAP_LISTEN_PORT", 8080)
 	deviceName := os.Getenv("AIRSCAP_DEVICE_NAME")
 	dataDir := envStr("AIRSCAP_DATA_DIR", os.Getenv("STATE_DIRECTORY"))
+	strictPairing := envBool("AIRSCAP_STRICT_PAIRING", false)
+	shutdownTimeout := parseShutdownTimeout(os.Getenv("AIRSCAP_SHUTDOWN_TIMEOUT"))
+	devInfoRetries := envInt("AIRSCAP_DEVICE_INFO_RETRIES", scanner.DefaultDeviceInfoRetries)
+	devInfoRetryDelay := envDuration("AIRSCAP_DEVICE_INFO_RETRY_DELAY", scanner.DefaultDeviceInfoRetryDelay)
+	transferChunkKB := envInt("AIRSCAP_TRANSFER_CHUNK_KB", 0)
+	pipelinedTransfer := envBool("AIRSCAP_PIPELINED_TRANSFER", false)
+	shortResponseRetries := envInt("AIRSCAP_SHORT_RESPONSE_RETRIES", vens.DefaultShortResponseRetries)
+	scanTimeoutLimit := envInt("AIRSCAP_SCAN_TIMEOUT_RECONNECT", scanner.DefaultScanTimeoutLimit)
+	healthFailures := envInt("AIRSCAP_HEALTH_FAILURES", scanner.DefaultHealthFailureLimit)
+	reclaimReservation := envBool("AIRSCAP_RECLAIM_RESERVATION", false)
+	checkAdvertisers := envBool("AIRSCAP_CHECK_ADVERTISERS", true)
+	discoveryCache := envBool("AIRSCAP_DISCOVERY_CACHE", true)
+	skipDiscovery := envBool("AIRSCAP_SKIP_DISCOVERY", false)
+	wifiModeSwitch := envBool("AIRSCAP_EXPERIMENTAL_WIFI_MODE", false)
+	startModeControl := envBool("AIRSCAP_EXPERIMENTAL_START_MODE", false)
+	webuiMaxConns := envInt("AIRSCAP_WEBUI_MAX_CONNS", defaultWebUIMaxConns)
+	uiUser := envStr("AIRSCAP_UI_USER", defaultUIUser)
+	uiPassword := os.Getenv("AIRSCAP_UI_PASSWORD")
+	scanner.TesseractPath = envStr("AIRSCAP_TESSERACT", scanner.TesseractPath)
+	scanner.OCRFontPath = os.Getenv("AIRSCAP_OCR_FONT")
+	trustedProxies, err := parseTrustedProxies(os.Getenv("AIRSCAP_TRUSTED_PROXIES"))
+	if err != nil {
+		slog.Error("invalid AIRSCAP_TRUSTED_PROXIES", "err", err)
+		os.Exit(1)
+	}
 
 	// Resolve password
 	if password == "" && passwordFile != "" {
@@ -83,7 +119,30 @@ func main() {
 
 	// Create and connect scanner
 	sc := scanner.New(scannerIP, vens.DefaultDataPort, vens.DefaultControlPort, identity)
+	sc.SetDeviceInfoRetry(devInfoRetries, devInfoRetryDelay)
+	if transferChunkKB > 0 {
+		sc.SetTransferChunkSize(uint32(transferChunkKB) * 1024)
+	}
+	sc.SetPipelinedTransfer(pipelinedTransfer)
+	sc.SetShortResponseRetries(shortResponseRetries)
+	sc.SetScanTimeoutLimit(scanTimeoutLimit)
+	sc.SetHealthFailureLimit(healthFailures)
+	sc.SetReclaimReservation(reclaimReservation)
+	sc.SetWifiModeSwitch(wifiModeSwitch)
+	sc.SetStartModeControl(startModeControl)
+	if discoveryCache {
+		sc.SetDiscoveryCache(scanner.NewDiscoveryCache())
+	}
+	if skipDiscovery && scannerIP == "" {
+		slog.Warn("AIRSCAP_SKIP_DISCOVERY needs AIRSCAP_SCANNER_IP, discovering the scanner instead")
+	} else {
+		sc.SetSkipDiscovery(skipDiscovery)
+	}
 	if err := sc.Connect(ctx); err != nil {
+		if fatal := startupConnectError(err, strictPairing); fatal != nil {
+			slog.Error("scanner pairing failed, check AIRSCAP_PASSWORD", "err", fatal)
+			os.Exit(1)
+		}
 		slog.Warn("initial scanner connection failed, will retry in background", "err", err)
 	}
 	defer sc.Disconnect()
@@ -115,11 +174,18 @@ func main() {
 		slog.Info("settings store initialized (memory-only, set AIRSCAP_DATA_DIR to persist)")
 	}
 
+	if err := sc.SetStartMode(settingsStore.Get().StartMode); err != nil {
+		slog.Warn("set start mode failed", "err", err)
+	}
+	sc.SetEcoMode(scanner.EcoIdleTimeout(settingsStore.Get()))
+	sc.SetBlankThreshold(settingsStore.Get().BlankThreshold)
+
 	// Create eSCL adapter
 	adapter := scanner.NewESCLAdapter(sc, listenPort, settingsStore)
 
 	// Scan job status (shared with WebUI)
 	scanStatus := &scanner.ScanJobStatus{}
+	scanStatus.SetHistory(scanner.NewJobHistory(settingsStore.DataDir(), scanner.DefaultHistoryLimit))
 
 	// Button listener: trigger scan on physical button press
 	var scanMu sync.Mutex
@@ -130,41 +196,47 @@ func main() {
 		}
 		go func() {
 			defer scanMu.Unlock()
-			s := settingsStore.Get()
+			s := settingsStore.ButtonSettings()
 			if s.SaveType == "none" || s.SaveType == "" {
 				slog.Info("save type is 'none', ignoring button press")
 				return
 			}
-			if s.SaveType == "local" && s.SavePath == "" {
-				slog.Warn("save path not configured, ignoring button press")
+			if !scanner.DestinationEnabled(s) {
+				slog.Info("save destination is disabled, ignoring button press", "saveType", s.SaveType)
 				return
 			}
-			if s.SaveType == "ftp" && s.FTPHost == "" {
-				slog.Warn("FTP host not configured, ignoring button press")
-				return
-			}
-			if s.SaveType == "paperless" && s.PaperlessURL == "" {
-				slog.Warn("Paperless-ngx URL not configured, ignoring button press")
+			if err := scanner.CheckDestination(s); err != nil {
+				slog.Warn(err.Error() + ", ignoring button press")
 				return
 			}
 			cfg := scanner.SettingsToScanConfig(s)
+			cfg.Model = sc.Model()
 			scanStatus.SetScanning(true)
-			var pages int
-			var err error
-			switch s.SaveType {
-			case "local":
-				pages, err = scanner.RunSaveJob(sc, cfg, s.Format, s.SavePath)
-				scanStatus.SetResult(err, pages, s.SavePath)
-			case "ftp":
-				pages, err = scanner.RunFTPJob(sc, cfg, s.Format, s)
-				scanStatus.SetResult(err, pages, s.FTPHost)
-			case "paperless":
-				pages, err = scanner.RunPaperlessJob(sc, cfg, s.Format, s)
-				scanStatus.SetResult(err, pages, s.PaperlessURL)
+			pages, target, err := scanner.RunDestinationJob(sc, cfg, s, scanStatus)
+			if !scanStatus.SetJobResult(s, err, pages, target) {
+				slog.Info("nothing scanned, ignoring button press", "err", err)
+				return
 			}
 			if err != nil {
 				slog.Error("button scan failed", "err", err)
 			}
+			if s.WebhookURL != "" {
+				ev := scanner.NewScanEvent(s.SaveType, target, pages, err)
+				go func() {
+					if err := scanner.SendWebhook(s.WebhookURL, ev); err != nil {
+						slog.Warn("webhook notification failed", "err", err)
+					}
+				}()
+			}
+			if s.PushService != "" && s.PushURL != "" {
+				ev := scanner.NewScanEvent(s.SaveType, target, pages, err)
+				name, doc, _, _ := scanStatus.LastDocument()
+				go func() {
+					if err := scanner.RunNotify(s, ev, name, doc); err != nil {
+						slog.Warn("push notification failed", "service", s.PushService, "err", err)
+					}
+				}()
+			}
 		}()
 	}
 
@@ -200,14 +272,34 @@ func main() {
 			OnScannerCapabilitiesResponse: func(_ *transport.ServerQuery, caps *escl.ScannerCapabilities) *escl.ScannerCapabilities {
 				if caps.ADF != nil {
 					caps.ADF.ADFOptions = append(caps.ADF.ADFOptions, escl.DetectPaperLoaded)
+					// Multiple regions are cropped server-side (see ESCLAdapter.SetScanRegions)
+					for _, in := range []*escl.InputSourceCaps{caps.ADF.ADFSimplexInputCaps, caps.ADF.ADFDuplexInputCaps} {
+						if in != nil {
+							in.MaxScanRegions = optional.New(scanner.MaxScanRegions)
+						}
+					}
 				}
 				caps.BlankPageDetectionAndRemoval = optional.New(true)
+				adapter.AdvertiseColorSpace(caps)
+				adapter.AdvertiseColorModes(caps)
+				adapter.AdvertiseMaxResolution(caps)
 				return caps
 			},
 			OnScanJobsRequest: func(_ *transport.ServerQuery, ss *escl.ScanSettings) *escl.ScanSettings {
-				adapter.SetBlankPageRemoval(ss.BlankPageDetectionAndRemoval == nil || *ss.BlankPageDetectionAndRemoval)
+				adapter.SetScanOverrides(scanner.ScanOverrides{BlankPageRemoval: ss.BlankPageDetectionAndRemoval})
+				adapter.SetScanRegions(ss.ScanRegions)
 				return ss
 			},
+			OnScanJobsResponse: func(_ *transport.ServerQuery, _ *escl.ScanSettings, joburi string) string {
+				adapter.SetJobURI(joburi)
+				return ""
+			},
+			OnDeleteRequest: func(_ *transport.ServerQuery, joburi string) string {
+				// Abort a page transfer in progress; it would otherwise hold up
+				// the job cancellation until the page is complete
+				adapter.CancelJob(joburi)
+				return ""
+			},
 			OnScannerStatusResponse: func(_ *transport.ServerQuery, status *escl.ScannerStatus) *escl.ScannerStatus {
 				state := adapter.ScannerState()
 				status.State = state
@@ -216,8 +308,8 @@ func main() {
 				}
 				// Fix error job state: go-mfp uses JobCanceled+AbortedBySystem,
 				// but eSCL spec requires JobAborted for fatal errors.
-				// Also inject ImagesCompleted so macOS shows scan progress.
-				pagesCompleted := adapter.PagesCompleted()
+				// Also inject ImagesCompleted so macOS shows scan progress,
+				// counted per job so each client sees its own.
 				for i := range status.Jobs {
 					job := &status.Jobs[i]
 					if job.JobState == escl.JobCanceled &&
@@ -226,7 +318,9 @@ func main() {
 						job.JobState = escl.JobAborted
 					}
 					if job.JobState == escl.JobProcessing || job.JobState == escl.JobCompleted {
-						job.ImagesCompleted = optional.New(pagesCompleted)
+						if images, ok := adapter.JobImagesCompleted(optional.Get(job.JobUUID)); ok {
+							job.ImagesCompleted = optional.New(images)
+						}
 					}
 				}
 				// Query live ADF status for paper presence
@@ -255,19 +349,25 @@ func main() {
 	mux := http.NewServeMux()
 	// Serve at /eSCL/ for clients using the rs TXT record (sane-airscan, macOS)
 	mux.Handle("/eSCL/", http.StripPrefix("/eSCL", esclServer))
-	// Web UI for status and settings
-	mux.Handle("/ui/", http.StripPrefix("/ui", webui.NewHandler(sc, adapter, listenPort, settingsStore, scanStatus, version, &scanMu)))
+	// Web UI for status and settings, limited so it cannot starve eSCL clients.
+	// eSCL stays unauthenticated so scanning clients keep working.
+	ui := webui.NewHandler(sc, adapter, listenPort, settingsStore, scanStatus, version, &scanMu, logBuffer, uiPassword != "")
+	mux.Handle("/ui/", limitMiddleware(basicAuthMiddleware(http.StripPrefix("/ui", ui), uiUser, uiPassword), webuiMaxConns))
+	if uiPassword == "" {
+		slog.Info("Web UI is not password protected, set AIRSCAP_UI_PASSWORD to require a login and allow POST /ui/api/scan")
+	}
 	// Also serve at root for clients that ignore rs (sane-escl)
 	mux.Handle("/", esclServer)
 
 	addr := fmt.Sprintf(":%d", listenPort)
 	httpServer := &http.Server{
 		Addr:    addr,
-		Handler: logMiddleware(mux),
+		Handler: logMiddleware(mux, trustedProxies),
 	}
 
-	// Start mDNS advertisement
-	adminURL := fmt.Sprintf("http://%s:%d/ui/", vens.GetLocalIP(scannerIP), listenPort)
+	// Start mDNS advertisement, on both the IPv4 and IPv6 multicast groups
+	// with A and AAAA records for every interface address
+	adminURL := fmt.Sprintf("http://%s/ui/", net.JoinHostPort(vens.GetLocalIP(scannerIP), strconv.Itoa(listenPort)))
 	mdnsServer, err := zeroconf.Register(
 		deviceName,
 		"_uscan._tcp",
@@ -291,6 +391,9 @@ func main() {
 	}
 	defer mdnsServer.Shutdown()
 	slog.Info("mDNS registered", "name", deviceName, "service", "_uscan._tcp")
+	if checkAdvertisers {
+		go warnConflictingAdvertisers(ctx, deviceName, sc.Serial(), listenPort)
+	}
 
 	// Start HTTP server
 	go func() {
@@ -307,16 +410,88 @@ func main() {
 	<-ctx.Done()
 	slog.Info("shutting down...")
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// One deadline covers both the HTTP drain and the button-scan drain so
+	// the total shutdown time never exceeds AIRSCAP_SHUTDOWN_TIMEOUT.
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
+	slog.Info("waiting for HTTP requests to finish", "timeout", shutdownTimeout)
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		slog.Error("HTTP shutdown error", "err", err)
 	}
+	if !scanMu.TryLock() {
+		slog.Info("waiting for in-progress scan to finish")
+		if err := waitForScan(shutdownCtx, &scanMu); err != nil {
+			slog.Warn("scan still running at shutdown deadline, abandoning it", "err", err)
+		}
+	}
 
 	slog.Info("shutdown complete")
 }
 
+// advertiserBrowseTimeout is how long the startup check listens for other
+// eSCL advertisers.
+const advertiserBrowseTimeout = 5 * time.Second
+
+// warnConflictingAdvertisers browses for _uscan._tcp services and logs a
+// warning for each one that advertises the same scanner as AirScap, such as
+// a second AirScap instance. eSCL clients then list the scanner twice and
+// may pick the wrong one.
+func warnConflictingAdvertisers(ctx context.Context, deviceName, serial string, port int) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		slog.Debug("mDNS browse unavailable, skipping advertiser check", "err", err)
+		return
+	}
+	var own []net.IP
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				own = append(own, ipnet.IP)
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, advertiserBrowseTimeout)
+	defer cancel()
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, "_uscan._tcp", "local.", entries); err != nil {
+		slog.Debug("mDNS browse failed, skipping advertiser check", "err", err)
+		return
+	}
+	for e := range entries {
+		if conflictingAdvertiser(e, deviceName, serial, port, own) {
+			slog.Warn("another eSCL service advertises this scanner; clients may show it twice",
+				"name", e.Instance, "host", e.HostName, "port", e.Port, "addrs", e.AddrIPv4)
+		}
+	}
+}
+
+// conflictingAdvertiser reports whether e, a _uscan._tcp service found on
+// the network, advertises the same scanner as AirScap: the same name or
+// model (ty), or the scanner serial in its name or TXT record. AirScap's own
+// advertisement, on port at one of the own addresses, is not a conflict.
+func conflictingAdvertiser(e *zeroconf.ServiceEntry, deviceName, serial string, port int, own []net.IP) bool {
+	if e.Port == port {
+		for _, ip := range append(append([]net.IP{}, e.AddrIPv4...), e.AddrIPv6...) {
+			if slices.ContainsFunc(own, ip.Equal) {
+				return false
+			}
+		}
+	}
+	if strings.EqualFold(e.Instance, deviceName) {
+		return true
+	}
+	for _, txt := range e.Text {
+		if ty, ok := strings.CutPrefix(txt, "ty="); ok && strings.EqualFold(ty, deviceName) {
+			return true
+		}
+		if serial != "" && strings.Contains(txt, serial) {
+			return true
+		}
+	}
+	return serial != "" && strings.Contains(e.Instance, serial)
+}
+
 func envStr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -333,6 +508,78 @@ func envInt(key string, fallback int) int {
 	return fallback
 }
 
+func envBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// envDuration reads a duration given as a Go duration ("500ms", "2s") or a
+// plain number of seconds. Invalid or negative values use the fallback.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d
+	}
+	return fallback
+}
+
+// defaultShutdownTimeout bounds graceful shutdown when AIRSCAP_SHUTDOWN_TIMEOUT is unset.
+const defaultShutdownTimeout = 5 * time.Second
+
+// parseShutdownTimeout parses AIRSCAP_SHUTDOWN_TIMEOUT, accepting either a Go
+// duration ("30s", "2m") or a plain number of seconds. Empty, invalid or
+// non-positive values fall back to defaultShutdownTimeout.
+func parseShutdownTimeout(s string) time.Duration {
+	if s == "" {
+		return defaultShutdownTimeout
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	slog.Warn("invalid AIRSCAP_SHUTDOWN_TIMEOUT, using default", "value", s, "default", defaultShutdownTimeout)
+	return defaultShutdownTimeout
+}
+
+// waitForScan blocks until the scan lock can be taken or ctx expires. On
+// success the lock is kept so no new scan can start during shutdown.
+func waitForScan(ctx context.Context, mu *sync.Mutex) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !mu.TryLock() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// startupConnectError decides whether a failed initial connection is fatal.
+// In strict mode a rejected pairing aborts startup, since retrying with the
+// same identity can never succeed. Anything else (scanner off, network
+// hiccup) is left to the reconnect loop.
+func startupConnectError(err error, strict bool) error {
+	if strict && errors.Is(err, scanner.ErrPairingRejected) {
+		return fmt.Errorf("strict pairing: %w", err)
+	}
+	return nil
+}
+
 func parseLogLevel(s string) slog.Level {
 	switch strings.ToLower(s) {
 	case "debug":
@@ -357,7 +604,132 @@ func (r *responseRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
-func logMiddleware(next http.Handler) http.Handler {
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush Server-Sent Events.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// prefixes whose forwarding headers may be trusted.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			p, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the client address to log for r. Forwarding headers are
+// only honored when the direct peer is a trusted proxy; X-Forwarded-For is
+// walked right to left, skipping trusted hops, so a client cannot spoof its
+// address by prepending entries.
+func clientAddr(r *http.Request, trusted []netip.Prefix) string {
+	if len(trusted) == 0 {
+		return r.RemoteAddr
+	}
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrustedProxy(peer.Addr(), trusted) {
+		return r.RemoteAddr
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			if !isTrustedProxy(addr, trusted) || i == 0 {
+				return addr.String()
+			}
+		}
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		if addr, err := netip.ParseAddr(xri); err == nil {
+			return addr.String()
+		}
+	}
+	return r.RemoteAddr
+}
+
+// defaultWebUIMaxConns is the default number of Web UI requests served at once.
+const defaultWebUIMaxConns = 32
+
+// limitMiddleware serves at most max requests at a time and answers any
+// request beyond that with 503 Service Unavailable. max <= 0 disables the limit.
+func limitMiddleware(next http.Handler, max int) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	sem := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// defaultUIUser is the Web UI user name when AIRSCAP_UI_USER is unset.
+const defaultUIUser = "admin"
+
+// basicAuthMiddleware requires HTTP basic authentication with user and
+// password, answering other requests with 401 and a challenge. An empty
+// password disables authentication. Credentials are compared in constant
+// time, hashed first so their length does not leak either.
+func basicAuthMiddleware(next http.Handler, user, password string) http.Handler {
+	if password == "" {
+		return next
+	}
+	wantUser := sha256.Sum256([]byte(user))
+	wantPassword := sha256.Sum256([]byte(password))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		gotUser := sha256.Sum256([]byte(u))
+		gotPassword := sha256.Sum256([]byte(p))
+		userOK := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+		passwordOK := subtle.ConstantTimeCompare(gotPassword[:], wantPassword[:])
+		if !ok || userOK&passwordOK != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="AirScap", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func logMiddleware(next http.Handler, trustedProxies []netip.Prefix) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rec := &responseRecorder{ResponseWriter: w, status: 200}
 		start := time.Now()
@@ -366,7 +738,7 @@ func logMiddleware(next http.Handler) http.Handler {
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", rec.status,
-			"remote", r.RemoteAddr,
+			"remote", clientAddr(r, trustedProxies),
 			"duration", time.Since(start).Round(time.Millisecond),
 		)
 	})
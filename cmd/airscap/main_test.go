@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+
+	"github.com/mzyy94/airscap/internal/scanner"
+)
+
+func TestStartupConnectError(t *testing.T) {
+	rejected := scanner.ErrPairingRejected
+	unreachable := fmt.Errorf("discovery: %w: %w", scanner.ErrUnreachable, errors.New("timeout"))
+
+	tests := []struct {
+		name    string
+		err     error
+		strict  bool
+		wantErr bool
+	}{
+		{"strict rejected exits", rejected, true, true},
+		{"strict unreachable retries", unreachable, true, false},
+		{"lenient rejected retries", rejected, false, false},
+		{"lenient unreachable retries", unreachable, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := startupConnectError(tt.err, tt.strict)
+			if (got != nil) != tt.wantErr {
+				t.Fatalf("startupConnectError() = %v, wantErr %v", got, tt.wantErr)
+			}
+			if got != nil && !errors.Is(got, scanner.ErrPairingRejected) {
+				t.Errorf("error %v does not wrap ErrPairingRejected", got)
+			}
+		})
+	}
+}
+
+func TestLogMiddlewareRemote(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "no trusted proxies ignores headers",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "192.168.1.50"},
+			want:    "10.0.0.2:5000",
+		},
+		{
+			name:    "trusted proxy uses X-Forwarded-For",
+			trusted: "10.0.0.0/8",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "192.168.1.50"},
+			want:    "192.168.1.50",
+		},
+		{
+			name:    "spoofed leading hop is skipped",
+			trusted: "10.0.0.2",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 192.168.1.50"},
+			want:    "192.168.1.50",
+		},
+		{
+			name:    "trusted proxy uses X-Real-IP",
+			trusted: "10.0.0.2",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Real-IP": "192.168.1.50"},
+			want:    "192.168.1.50",
+		},
+		{
+			name:    "untrusted peer cannot spoof",
+			trusted: "10.0.0.2",
+			remote:  "192.168.1.99:5000",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"},
+			want:    "192.168.1.99:5000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trusted, err := parseTrustedProxies(tt.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			prev := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+			defer slog.SetDefault(prev)
+
+			h := logMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), trusted)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if want := "remote=" + tt.want + " "; !strings.Contains(buf.String(), want) {
+				t.Errorf("log = %q, want %q", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestLimitMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	h := limitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+	}), 2)
+
+	var done sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("request within limit: status = %d, want 200", rec.Code)
+			}
+		}()
+	}
+	started.Wait()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over limit: status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("503 response has no Retry-After header")
+	}
+
+	close(release)
+	done.Wait()
+	rec = httptest.NewRecorder()
+	started.Add(1)
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("request after release: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	h := basicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("settings"))
+	}), "admin", "s3cret")
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		auth     bool
+		want     int
+	}{
+		{"authorized", "admin", "s3cret", true, http.StatusOK},
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong password", "admin", "guess", true, http.StatusUnauthorized},
+		{"wrong user", "root", "s3cret", true, http.StatusUnauthorized},
+		{"password prefix", "admin", "s3cre", true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ui/api/settings", nil)
+			if tt.auth {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusUnauthorized {
+				if !strings.HasPrefix(challenge, "Basic ") {
+					t.Errorf("WWW-Authenticate = %q, want a Basic challenge", challenge)
+				}
+				if strings.Contains(rec.Body.String(), "settings") {
+					t.Error("unauthorized request reached the handler")
+				}
+			} else if challenge != "" {
+				t.Errorf("authorized response has WWW-Authenticate %q", challenge)
+			}
+		})
+	}
+
+	// Without a password the Web UI stays open
+	rec := httptest.NewRecorder()
+	basicAuthMiddleware(http.NotFoundHandler(), "admin", "").ServeHTTP(rec, httptest.NewRequest("GET", "/ui/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("no password: status = %d, want the handler's 404", rec.Code)
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := parseTrustedProxies("10.0.0.0/8, not-an-ip"); err == nil {
+		t.Error("expected error for invalid entry")
+	}
+}
+
+func TestParseShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", defaultShutdownTimeout},
+		{"30", 30 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"500ms", 500 * time.Millisecond},
+		{"0", defaultShutdownTimeout},
+		{"-5s", defaultShutdownTimeout},
+		{"soon", defaultShutdownTimeout},
+	}
+	for _, tt := range tests {
+		if got := parseShutdownTimeout(tt.in); got != tt.want {
+			t.Errorf("parseShutdownTimeout(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForScan(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := waitForScan(ctx, &mu); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitForScan() = %v, want deadline exceeded", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		mu.Unlock()
+	}()
+	if err := waitForScan(context.Background(), &mu); err != nil {
+		t.Fatalf("waitForScan() = %v", err)
+	}
+	if mu.TryLock() {
+		t.Error("lock should be held after waitForScan returns")
+	}
+}
+
+func TestEnvDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 2 * time.Second},
+		{"0", 0},
+		{"3", 3 * time.Second},
+		{"500ms", 500 * time.Millisecond},
+		{"-1s", 2 * time.Second},
+		{"soon", 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Setenv("AIRSCAP_TEST_DURATION", tt.value)
+		if got := envDuration("AIRSCAP_TEST_DURATION", 2*time.Second); got != tt.want {
+			t.Errorf("envDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestConflictingAdvertiser(t *testing.T) {
+	own := []net.IP{net.ParseIP("192.168.1.10"), net.ParseIP("fe80::1")}
+	entry := func(instance string, port int, addr string, text ...string) *zeroconf.ServiceEntry {
+		e := zeroconf.NewServiceEntry(instance, "_uscan._tcp", "local.")
+		e.Port = port
+		e.AddrIPv4 = []net.IP{net.ParseIP(addr)}
+		e.Text = text
+		return e
+	}
+	tests := []struct {
+		name  string
+		entry *zeroconf.ServiceEntry
+		want  bool
+	}{
+		{"own advertisement", entry("ScanSnap iX500", 8080, "192.168.1.10", "ty=ScanSnap iX500"), false},
+		{"second instance on this host", entry("ScanSnap iX500", 8081, "192.168.1.10", "ty=ScanSnap iX500"), true},
+		{"same name elsewhere", entry("scansnap ix500", 8080, "192.168.1.20"), true},
+		{"same model", entry("Office scanner", 80, "192.168.1.20", "ty=ScanSnap iX500"), true},
+		{"serial in TXT", entry("Office scanner", 80, "192.168.1.20", "note=iX500-A1B2"), true},
+		{"serial in name", entry("iX500-A1B2 (2)", 80, "192.168.1.20"), true},
+		{"other scanner", entry("Brother MFC", 80, "192.168.1.30", "ty=Brother MFC-L2710DW"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conflictingAdvertiser(tt.entry, "ScanSnap iX500", "iX500-A1B2", 8080, own); got != tt.want {
+				t.Errorf("conflictingAdvertiser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,16 +6,20 @@ require (
 	codeberg.org/go-pdf/fpdf v0.11.1
 	github.com/OpenPrinting/go-mfp v0.0.0-20260213072225-403537e236b1
 	github.com/grandcat/zeroconf v1.0.0
+	github.com/hirochachacha/go-smb2 v1.1.0
 	github.com/jlaffaye/ftp v0.2.0
+	github.com/pkg/sftp v1.13.9
+	golang.org/x/crypto v0.33.0
 	golang.org/x/image v0.36.0
 )
 
 require (
 	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
+	github.com/geoffgarside/ber v1.2.0 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/miekg/dns v1.1.27 // indirect
-	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/term v0.29.0 // indirect
@@ -2,33 +2,115 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 )
 
 // Settings holds user-configurable scan defaults.
 type Settings struct {
-	ColorMode        string `json:"colorMode"`
-	Resolution       int    `json:"resolution"`
-	PaperSize        string `json:"paperSize"` // "auto", "a4", "a5", "business_card", "postcard"
-	Duplex           bool   `json:"duplex"`
-	Format           string `json:"format"`
-	BlankPageRemoval *bool  `json:"blankPageRemoval"` // nil = default (true)
-	BleedThrough     bool   `json:"bleedThrough"`
-	BWDensity        int    `json:"bwDensity"`    // -5 to +5, only for B&W mode
-	Compression      int    `json:"compression"` // 1(best quality)..5(most compressed), default 3
-	SaveType         string `json:"saveType"`    // "none", "local", "ftp", "paperless"
-	SavePath         string `json:"savePath"` // directory path when SaveType="local"
-	FTPHost          string `json:"ftpHost"`
-	FTPUser          string `json:"ftpUser"`
-	FTPPassword      string `json:"ftpPassword"`
-	PaperlessURL     string `json:"paperlessUrl"`
-	PaperlessToken   string `json:"paperlessToken"`
-	AirscanForcePaperAuto bool   `json:"airscanForcePaperAuto"` // AirScan: force paper auto-detect for eSCL clients
-	AirscanBleedThrough   bool   `json:"airscanBleedThrough"`   // AirScan: apply bleed-through reduction
-	AirscanBWDensity      int    `json:"airscanBwDensity"`      // AirScan: B&W density override (-5 to +5)
+	ColorMode                 string  `json:"colorMode"`
+	Resolution                int     `json:"resolution"`
+	FallbackDPIColor          int     `json:"fallbackDpiColor"` // DPI assumed for color and auto color pages without embedded DPI at auto resolution (0 = 300)
+	FallbackDPIGray           int     `json:"fallbackDpiGray"`  // likewise for grayscale pages
+	FallbackDPIBW             int     `json:"fallbackDpiBw"`    // likewise for B&W pages
+	MaxResolution             int     `json:"maxResolution"`    // host-side DPI cap for all scans, also on what eSCL clients are offered, e.g. 200 on a Raspberry Pi (0 = scanner max)
+	FastPreview               bool    `json:"fastPreview"`      // Web UI previews scan at 150 DPI single-sided instead of with these settings
+	PaperSize                 string  `json:"paperSize"`        // "auto", "a4", "a5", "business_card", "postcard", "letter", "legal", "a6", "b5"
+	Duplex                    bool    `json:"duplex"`
+	Format                    string  `json:"format"`           // "application/pdf", "image/jpeg", "image/png", "image/webp" (needs a libwebp build, else JPEG) or "image/tiff-multipage"
+	BlankPageRemoval          *bool   `json:"blankPageRemoval"` // nil = default (true)
+	BlankThreshold            float64 `json:"blankThreshold"`   // software blank page removal: drop pages with at least this % near-white pixels, e.g. 99.5 (0 = off)
+	BleedThrough              bool    `json:"bleedThrough"`
+	BWDensity                 int     `json:"bwDensity"`     // -5 to +5, only for B&W mode
+	AutoGrayscale             bool    `json:"autoGrayscale"` // auto color mode: store near-gray color pages as grayscale
+	FillBorders               bool    `json:"fillBorders"`   // whiten black deskew borders along the page edges
+	AutoRotate                bool    `json:"autoRotate"`    // turn landscape pages 90° clockwise so all pages are portrait
+	Compression               int     `json:"compression"`   // JPEG quality: 1(best quality)..5(most compressed), default 3
+	SaveType                  string  `json:"saveType"`      // "none", "local", "ftp", "paperless", "smb", "sftp", "email", "s3", "fifo"
+	SavePath                  string  `json:"savePath"`      // directory path when SaveType="local"
+	LocalEnabled              *bool   `json:"localEnabled"`  // nil = enabled; false skips the destination but keeps its settings (likewise below)
+	FTPHost                   string  `json:"ftpHost"`
+	FTPUser                   string  `json:"ftpUser"`
+	FTPPassword               string  `json:"ftpPassword"`
+	FTPEnabled                *bool   `json:"ftpEnabled"`
+	PaperlessURL              string  `json:"paperlessUrl"`
+	PaperlessToken            string  `json:"paperlessToken"`
+	PaperlessEnabled          *bool   `json:"paperlessEnabled"`
+	SMBHost                   string  `json:"smbHost"`  // host[:port] of the SMB/CIFS server (default port 445)
+	SMBShare                  string  `json:"smbShare"` // share name on SMBHost
+	SMBUser                   string  `json:"smbUser"`  // "user" or "DOMAIN\user"; empty = guest
+	SMBPassword               string  `json:"smbPassword"`
+	SMBPath                   string  `json:"smbPath"` // directory within the share, created if missing
+	SMBEnabled                *bool   `json:"smbEnabled"`
+	SFTPHost                  string  `json:"sftpHost"` // host[:port] of the SFTP server (default port 22)
+	SFTPUser                  string  `json:"sftpUser"`
+	SFTPPassword              string  `json:"sftpPassword"`              // password, or passphrase of an encrypted SFTPKeyPath
+	SFTPKeyPath               string  `json:"sftpKeyPath"`               // private key file for public-key authentication
+	SFTPPath                  string  `json:"sftpPath"`                  // upload directory, created if missing; empty = login directory
+	SFTPKnownHosts            string  `json:"sftpKnownHosts"`            // known_hosts file to verify the server (default ~/.ssh/known_hosts)
+	SFTPInsecureIgnoreHostKey bool    `json:"sftpInsecureIgnoreHostKey"` // skip host key verification
+	SFTPEnabled               *bool   `json:"sftpEnabled"`
+	SMTPHost                  string  `json:"smtpHost"`
+	SMTPPort                  int     `json:"smtpPort"` // 0 = 465 with SMTPUseTLS, otherwise 587
+	SMTPUser                  string  `json:"smtpUser"` // empty = no authentication
+	SMTPPassword              string  `json:"smtpPassword"`
+	SMTPFrom                  string  `json:"smtpFrom"`
+	SMTPTo                    string  `json:"smtpTo"`     // comma-separated recipients
+	SMTPUseTLS                bool    `json:"smtpUseTls"` // implicit TLS (SMTPS); otherwise STARTTLS is used when offered
+	EmailEnabled              *bool   `json:"emailEnabled"`
+	S3Endpoint                string  `json:"s3Endpoint"` // S3-compatible endpoint URL; empty = AWS (s3.<region>.amazonaws.com)
+	S3Bucket                  string  `json:"s3Bucket"`
+	S3Region                  string  `json:"s3Region"` // empty = us-east-1
+	S3AccessKey               string  `json:"s3AccessKey"`
+	S3SecretKey               string  `json:"s3SecretKey"`
+	S3Prefix                  string  `json:"s3Prefix"`       // key prefix, e.g. "scans/"
+	S3UsePathStyle            bool    `json:"s3UsePathStyle"` // endpoint/bucket/key addressing (MinIO) instead of bucket.endpoint/key
+	S3Enabled                 *bool   `json:"s3Enabled"`
+	FIFOPath                  string  `json:"fifoPath"` // existing named pipe (mkfifo) each scan is written to as a PDF
+	FIFOEnabled               *bool   `json:"fifoEnabled"`
+	MaxPDFBytes               int64   `json:"maxPdfBytes"`    // 0 = no limit; larger PDFs are recompressed to fit
+	PDFMargin                 float64 `json:"pdfMargin"`      // blank border around each PDF page image in mm (0 = none)
+	BWPDFEmbedding            string  `json:"bwPdfEmbedding"` // "png" (default), "g4" (CCITT Group 4) or "smallest" (of G4, PNG and JPEG)
+	PDFA                      bool    `json:"pdfA"`           // write PDF/A-2b for long-term archiving
+	LongPageSplit             int     `json:"longPageSplit"`  // split PDF pages longer than this many mm into pages of this length (0 = off)
+	PDFTitle                  string  `json:"pdfTitle"`       // PDF document title; empty = file name
+	PDFAuthor                 string  `json:"pdfAuthor"`
+	PDFSubject                string  `json:"pdfSubject"`
+	PDFKeywords               string  `json:"pdfKeywords"`             // space-separated
+	OCR                       bool    `json:"ocr"`                     // add a searchable text layer to PDFs with tesseract
+	OCRLanguage               string  `json:"ocrLanguage"`             // tesseract languages, e.g. "eng+jpn"; empty = eng
+	OCRDualPDF                bool    `json:"ocrDualPdf"`              // with OCR, also save an image-only PDF; the searchable one is named <base>_ocr.pdf
+	IncludeSerialInFilename   bool    `json:"includeSerialInFilename"` // prefix saved file names with the scanner serial
+	FilenameTemplate          string  `json:"filenameTemplate"`        // e.g. "{date}/{host}/page-{n}"; "/" creates subdirectories; empty = scan_<datetime>
+	OriginalPageNumbers       bool    `json:"originalPageNumbers"`     // number page files by sheet and side as fed, keeping the gaps of removed blank pages
+	SaveRetries               int     `json:"saveRetries"`             // extra attempts for a failed save/upload of a button scan
+	UploadConcurrency         int     `json:"uploadConcurrency"`       // page images uploaded at once to FTP/Paperless-ngx (0 = 4)
+	RequireCompleteScan       *bool   `json:"requireCompleteScan"`     // discard partial pages of a failed scan; nil = on, false keeps them
+	StartMode                 string  `json:"startMode"`               // what the scan button starts: "normal", "quick", or "" to leave the scanner's setting
+	EcoMode                   bool    `json:"ecoMode"`                 // release the scanner when idle so it can sleep; the next scan pairs again
+	EcoIdleMinutes            int     `json:"ecoIdleMinutes"`          // idle time before eco mode releases the scanner (0 = 10 minutes)
+	IgnoreEmptyScan           bool    `json:"ignoreEmptyScan"`         // a button press without paper is a no-op instead of an error
+	ProgressEstimate          bool    `json:"progressEstimate"`        // report an estimated scan progress based on ADF capacity
+	WebhookURL                string  `json:"webhookUrl"`              // POST a JSON event here when a button scan completes or fails
+	PushService               string  `json:"pushService"`             // push notification after a button scan: "", "ntfy" or "gotify"
+	PushURL                   string  `json:"pushUrl"`                 // ntfy topic URL or Gotify server URL
+	PushToken                 string  `json:"pushToken"`               // ntfy access token (optional) or Gotify application token
+	PushTitle                 string  `json:"pushTitle"`               // title template (text/template over the scan event); empty = default
+	PushMessage               string  `json:"pushMessage"`             // message template; empty = default
+	PushAttachPDF             bool    `json:"pushAttachPdf"`           // attach the generated PDF (ntfy only)
+	AirscanForcePaperAuto     bool    `json:"airscanForcePaperAuto"`   // AirScan: force paper auto-detect for eSCL clients
+	AirscanBleedThrough       bool    `json:"airscanBleedThrough"`     // AirScan: apply bleed-through reduction
+	AirscanBWDensity          int     `json:"airscanBwDensity"`        // AirScan: B&W density override (-5 to +5)
+	AirscanColorSpace         string  `json:"airscanColorSpace"`       // AirScan: "srgb" (default) advertises and tags color pages as sRGB; "raw" leaves them untagged
+	AirscanForceColorMode     string  `json:"airscanForceColorMode"`   // AirScan: "auto", "color", "grayscale" or "bw" overrides the requested color mode; empty = use the request
+	DefaultDuplex             bool    `json:"defaultDuplex"`           // AirScan: scan duplex when the eSCL request does not set an ADF mode
 }
 
 // DefaultSettings returns the default scan settings.
@@ -43,44 +125,143 @@ func DefaultSettings() Settings {
 	}
 }
 
-// Store provides thread-safe settings persistence backed by a JSON file.
+// DefaultProfile is the profile created for a new store, and the one
+// settings saved before profiles existed are loaded into.
+const DefaultProfile = "default"
+
+// Errors returned by SetProfiles.
+var (
+	ErrNoProfiles      = errors.New("at least one profile is required")
+	ErrProfileName     = errors.New("invalid profile name")
+	ErrNoActiveProfile = errors.New("active profile does not exist")
+	ErrNoButtonProfile = errors.New("button profile does not exist")
+)
+
+// ProfileList names the saved scan profiles: the active one, which the Web
+// UI edits and eSCL scans use, and the one the scanner button uses.
+type ProfileList struct {
+	Active string   `json:"active"`
+	Button string   `json:"button"` // "" = the active profile
+	Names  []string `json:"names"`  // sorted
+}
+
+// Store provides thread-safe persistence of named settings profiles
+// backed by a JSON file. Get and Update work on the active profile.
 type Store struct {
 	mu       sync.RWMutex
-	settings Settings
+	profiles map[string]Settings
+	active   string
+	button   string
 	path     string
 }
 
+// storeFile is the JSON layout of settings.json.
+type storeFile struct {
+	Active   string              `json:"active"`
+	Button   string              `json:"button,omitempty"`
+	Profiles map[string]Settings `json:"profiles"`
+}
+
 // NewStore creates a Store that persists settings to dataDir/settings.json.
 // If the file does not exist or is invalid, default settings are used.
+// A settings.json from before profiles is loaded as DefaultProfile.
 func NewStore(dataDir string) (*Store, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, err
 	}
-	s := &Store{
-		path:     filepath.Join(dataDir, "settings.json"),
-		settings: DefaultSettings(),
-	}
+	s := newStore()
+	s.path = filepath.Join(dataDir, "settings.json")
 	s.load()
 	return s, nil
 }
 
 // NewMemoryStore creates a Store that keeps settings in memory only (no file persistence).
 func NewMemoryStore() *Store {
-	return &Store{settings: DefaultSettings()}
+	return newStore()
+}
+
+func newStore() *Store {
+	return &Store{
+		profiles: map[string]Settings{DefaultProfile: DefaultSettings()},
+		active:   DefaultProfile,
+	}
+}
+
+// DataDir returns the directory the settings are saved in, or "" for a
+// memory-only store.
+func (s *Store) DataDir() string {
+	if s.path == "" {
+		return ""
+	}
+	return filepath.Dir(s.path)
 }
 
-// Get returns a copy of the current settings.
+// Get returns a copy of the settings of the active profile.
 func (s *Store) Get() Settings {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.settings
+	return s.profiles[s.active]
+}
+
+// ButtonSettings returns a copy of the settings of the profile used by the
+// scanner button.
+func (s *Store) ButtonSettings() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if settings, ok := s.profiles[s.button]; ok {
+		return settings
+	}
+	return s.profiles[s.active]
 }
 
-// Update replaces the settings and persists to disk.
+// Update replaces the settings of the active profile and persists to disk.
 func (s *Store) Update(settings Settings) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.settings = settings
+	s.profiles[s.active] = settings
+	return s.save()
+}
+
+// Profiles returns the profile names and selections.
+func (s *Store) Profiles() ProfileList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := slices.Sorted(maps.Keys(s.profiles))
+	return ProfileList{Active: s.active, Button: s.button, Names: names}
+}
+
+// SetProfiles makes p.Names the saved profiles and selects p.Active and
+// p.Button. Profiles missing from p.Names are deleted; new names start as a
+// copy of the currently active profile. It persists to disk.
+func (s *Store) SetProfiles(p ProfileList) error {
+	if len(p.Names) == 0 {
+		return ErrNoProfiles
+	}
+	for _, name := range p.Names {
+		if name == "" || strings.TrimSpace(name) != name {
+			return fmt.Errorf("%w: %q", ErrProfileName, name)
+		}
+	}
+	if !slices.Contains(p.Names, p.Active) {
+		return fmt.Errorf("%w: %q", ErrNoActiveProfile, p.Active)
+	}
+	if p.Button != "" && !slices.Contains(p.Names, p.Button) {
+		return fmt.Errorf("%w: %q", ErrNoButtonProfile, p.Button)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profiles := make(map[string]Settings, len(p.Names))
+	for _, name := range p.Names {
+		settings, ok := s.profiles[name]
+		if !ok {
+			settings = s.profiles[s.active]
+		}
+		profiles[name] = settings
+	}
+	s.profiles = profiles
+	s.active = p.Active
+	s.button = p.Button
 	return s.save()
 }
 
@@ -89,19 +270,34 @@ func (s *Store) load() {
 	if err != nil {
 		return // file missing is OK, use defaults
 	}
-	var settings Settings
-	if err := json.Unmarshal(data, &settings); err != nil {
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
 		slog.Warn("invalid settings file, using defaults", "path", s.path, "err", err)
 		return
 	}
-	s.settings = settings
+	if f.Profiles == nil {
+		// settings.json from before profiles: a single Settings object
+		var settings Settings
+		json.Unmarshal(data, &settings)
+		s.profiles = map[string]Settings{DefaultProfile: settings}
+		slog.Info("migrated settings to profile", "path", s.path, "profile", DefaultProfile)
+		return
+	}
+	if _, ok := f.Profiles[f.Active]; !ok {
+		slog.Warn("active profile missing from settings file, using defaults", "path", s.path, "profile", f.Active)
+		return
+	}
+	if _, ok := f.Profiles[f.Button]; !ok {
+		f.Button = ""
+	}
+	s.profiles, s.active, s.button = f.Profiles, f.Active, f.Button
 }
 
 func (s *Store) save() error {
 	if s.path == "" {
 		return nil // memory-only mode
 	}
-	data, err := json.MarshalIndent(s.settings, "", "  ")
+	data, err := json.MarshalIndent(storeFile{Active: s.active, Button: s.button, Profiles: s.profiles}, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStoreMigratesLegacySettings(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"colorMode":"bw","resolution":150,"format":"image/tiff-multipage","saveType":"local","savePath":"/scans"}`
+	if err := os.WriteFile(filepath.Join(dir, "settings.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := store.Get()
+	if got.ColorMode != "bw" || got.Resolution != 150 || got.SavePath != "/scans" {
+		t.Errorf("migrated settings = %+v", got)
+	}
+	p := store.Profiles()
+	if p.Active != DefaultProfile || p.Button != "" || !slices.Equal(p.Names, []string{DefaultProfile}) {
+		t.Errorf("Profiles() = %+v, want only the active %q profile", p, DefaultProfile)
+	}
+}
+
+func TestStoreProfiles(t *testing.T) {
+	store := NewMemoryStore()
+	s := store.Get()
+	s.ColorMode = "color"
+	s.Resolution = 300
+	store.Update(s)
+
+	// New profiles start as a copy of the active one
+	err := store.SetProfiles(ProfileList{Active: "Receipts", Button: "Receipts", Names: []string{DefaultProfile, "Receipts"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts := store.Get()
+	if receipts.ColorMode != "color" || receipts.Resolution != 300 {
+		t.Errorf("new profile = %+v, want a copy of the active profile", receipts)
+	}
+	receipts.ColorMode = "bw"
+	receipts.Resolution = 150
+	store.Update(receipts)
+
+	if err := store.SetProfiles(ProfileList{Active: DefaultProfile, Button: "Receipts", Names: []string{DefaultProfile, "Receipts"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Get(); got.ColorMode != "color" {
+		t.Errorf("Get() after selecting %q: colorMode %q, want color", DefaultProfile, got.ColorMode)
+	}
+	if got := store.ButtonSettings(); got.ColorMode != "bw" || got.Resolution != 150 {
+		t.Errorf("ButtonSettings() = colorMode %q, resolution %d, want the Receipts profile", got.ColorMode, got.Resolution)
+	}
+
+	// Deleting the button profile falls back to the active one
+	if err := store.SetProfiles(ProfileList{Active: DefaultProfile, Names: []string{DefaultProfile}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.ButtonSettings(); got.ColorMode != "color" {
+		t.Errorf("ButtonSettings() after delete: colorMode %q, want the active profile", got.ColorMode)
+	}
+
+	tests := []struct {
+		p    ProfileList
+		want error
+	}{
+		{ProfileList{Active: DefaultProfile}, ErrNoProfiles},
+		{ProfileList{Active: "", Names: []string{""}}, ErrProfileName},
+		{ProfileList{Active: " x", Names: []string{" x"}}, ErrProfileName},
+		{ProfileList{Active: "Photos", Names: []string{DefaultProfile}}, ErrNoActiveProfile},
+		{ProfileList{Active: DefaultProfile, Button: "Photos", Names: []string{DefaultProfile}}, ErrNoButtonProfile},
+	}
+	for _, tt := range tests {
+		if err := store.SetProfiles(tt.p); !errors.Is(err, tt.want) {
+			t.Errorf("SetProfiles(%+v) = %v, want %v", tt.p, err, tt.want)
+		}
+	}
+	if p := store.Profiles(); !slices.Equal(p.Names, []string{DefaultProfile}) {
+		t.Errorf("rejected changes modified the profiles: %+v", p)
+	}
+}
+
+func TestStoreProfilesPersist(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetProfiles(ProfileList{Active: "Photos", Button: DefaultProfile, Names: []string{DefaultProfile, "Photos"}}); err != nil {
+		t.Fatal(err)
+	}
+	s := store.Get()
+	s.ColorMode = "color"
+	store.Update(s)
+
+	reopened, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := reopened.Profiles()
+	if p.Active != "Photos" || p.Button != DefaultProfile || !slices.Equal(p.Names, []string{"Photos", DefaultProfile}) {
+		t.Errorf("reloaded Profiles() = %+v", p)
+	}
+	if got := reopened.Get(); got.ColorMode != "color" {
+		t.Errorf("reloaded active profile colorMode = %q, want color", got.ColorMode)
+	}
+	if got := reopened.ButtonSettings(); got.ColorMode != "auto" {
+		t.Errorf("reloaded button profile colorMode = %q, want auto", got.ColorMode)
+	}
+}
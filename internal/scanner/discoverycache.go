@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"sync"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// cachedDevice is what the discovery cache keeps of a scanner's device info.
+type cachedDevice struct {
+	dataPort    uint16
+	controlPort uint16
+	serial      string
+	name        string
+	token       [8]byte // token the scanner learned from the discovery
+}
+
+// DiscoveryCache keeps the ports and identity of scanners that were last
+// connected to, by IP address, so Connect can skip the UDP discovery round
+// trip. Discovery is also how the scanner learns the client token, so an
+// entry is only used with the token it was discovered with; the token is
+// new on every start, which is why the cache is kept in memory only.
+// A nil cache is empty and ignores updates.
+type DiscoveryCache struct {
+	mu      sync.Mutex
+	devices map[string]cachedDevice
+}
+
+// NewDiscoveryCache creates an empty discovery cache.
+func NewDiscoveryCache() *DiscoveryCache {
+	return &DiscoveryCache{devices: map[string]cachedDevice{}}
+}
+
+// get returns the cached device info of the scanner at host, if it was
+// discovered with token.
+func (c *DiscoveryCache) get(host string, token [8]byte) (*vens.DeviceInfo, bool) {
+	if c == nil || host == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.devices[host]
+	if !ok || d.dataPort == 0 || d.controlPort == 0 || d.token != token {
+		return nil, false
+	}
+	return &vens.DeviceInfo{DeviceIP: host, DataPort: d.dataPort, ControlPort: d.controlPort, Serial: d.serial, Name: d.name}, true
+}
+
+// put records the device info discovered with token for the scanner at host.
+func (c *DiscoveryCache) put(host string, token [8]byte, info *vens.DeviceInfo) {
+	if c == nil || host == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devices[host] = cachedDevice{dataPort: info.DataPort, controlPort: info.ControlPort, serial: info.Serial, name: info.Name, token: token}
+}
+
+// drop forgets the scanner at host, e.g. after connecting with the cached
+// entry failed.
+func (c *DiscoveryCache) drop(host string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.devices, host)
+}
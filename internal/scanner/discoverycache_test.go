@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// closedPort returns a TCP port nothing listens on.
+func closedPort(t *testing.T) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestConnectDiscoveryCache(t *testing.T) {
+	controlPort := fakeDataServer(t, fakeReply(32))
+	dataPort := fakeDataServer(t, fakeReply(vens.DeviceInfoRespLen))
+	cache := NewDiscoveryCache()
+
+	discoveries := 0
+	newScanner := func() *Scanner {
+		sc := New("127.0.0.1", vens.DefaultDataPort, vens.DefaultControlPort, "")
+		sc.SetDeviceInfoRetry(0, 0)
+		sc.SetDiscoveryCache(cache)
+		sc.findScanner = func(context.Context, vens.DiscoveryOptions) (*vens.DeviceInfo, error) {
+			discoveries++
+			return &vens.DeviceInfo{DeviceIP: "127.0.0.1", DataPort: dataPort, ControlPort: controlPort, Serial: "AAAA000001", Name: "ScanSnap iX500"}, nil
+		}
+		return sc
+	}
+	sc := newScanner()
+	connect := func() {
+		t.Helper()
+		if err := sc.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		sc.heartbeat.Stop()
+		sc.heartbeat = nil
+	}
+
+	// Nothing cached: full discovery, then the result is cached
+	connect()
+	if discoveries != 1 {
+		t.Fatalf("discoveries = %d, want 1 on a cache miss", discoveries)
+	}
+	if info, ok := cache.get("127.0.0.1", sc.token); !ok || info.DataPort != dataPort || info.Serial != "AAAA000001" {
+		t.Fatalf("cached = %+v, %v, want the discovered ports", info, ok)
+	}
+
+	// Cached: discovery is skipped
+	connect()
+	if discoveries != 1 {
+		t.Errorf("discoveries = %d, want the cached ports used", discoveries)
+	}
+	if sc.Serial() != "AAAA000001" {
+		t.Errorf("Serial() = %q after a cached connect, want AAAA000001", sc.Serial())
+	}
+
+	// Stale entry: the cached ports fail, so discovery runs and replaces it
+	cache.put("127.0.0.1", sc.token, &vens.DeviceInfo{DataPort: closedPort(t), ControlPort: closedPort(t)})
+	connect()
+	if discoveries != 2 {
+		t.Errorf("discoveries = %d, want a fallback to discovery", discoveries)
+	}
+	if info, ok := cache.get("127.0.0.1", sc.token); !ok || info.ControlPort != controlPort {
+		t.Errorf("cached = %+v, %v, want the working ports", info, ok)
+	}
+
+	// A new token, as after a restart, has to reach the scanner by discovery
+	sc = newScanner()
+	connect()
+	if discoveries != 3 {
+		t.Errorf("discoveries = %d, want discovery for a new token", discoveries)
+	}
+}
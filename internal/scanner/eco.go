@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// Eco mode states reported by Scanner.EcoState.
+const (
+	EcoOff      = "off"      // eco mode disabled
+	EcoActive   = "active"   // a scan ran within ecoActiveWindow
+	EcoIdle     = "idle"     // paired and waiting for the idle timeout
+	EcoReleased = "released" // reservation released; the next scan re-acquires it
+)
+
+// DefaultEcoIdleTimeout is the idle time before eco mode releases the
+// scanner when Settings.EcoIdleMinutes is unset.
+const DefaultEcoIdleTimeout = 10 * time.Minute
+
+// ecoActiveWindow is how long after a scan the scanner counts as active.
+const ecoActiveWindow = time.Minute
+
+// EcoIdleTimeout returns the eco mode idle timeout configured in settings,
+// or 0 if eco mode is off.
+func EcoIdleTimeout(s config.Settings) time.Duration {
+	if !s.EcoMode {
+		return 0
+	}
+	if s.EcoIdleMinutes <= 0 {
+		return DefaultEcoIdleTimeout
+	}
+	return time.Duration(s.EcoIdleMinutes) * time.Minute
+}
+
+// SetEcoMode enables eco mode: after idle without a scan, the reservation
+// is released and heartbeats stop so the scanner can go to sleep on its own
+// timer. The next scan pairs again. 0 disables eco mode and, if the scanner
+// was released, lets the reconnect loop pair again.
+func (s *Scanner) SetEcoMode(idle time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ecoIdle = max(0, idle)
+	if s.ecoIdle == 0 {
+		s.ecoReleased = false
+	}
+	if s.lastActivity.IsZero() {
+		s.lastActivity = s.clock()
+	}
+}
+
+// EcoState returns the eco mode state: EcoOff, EcoActive, EcoIdle or
+// EcoReleased.
+func (s *Scanner) EcoState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.ecoIdle == 0:
+		return EcoOff
+	case s.ecoReleased:
+		return EcoReleased
+	case s.clock().Sub(s.lastActivity) < ecoActiveWindow:
+		return EcoActive
+	}
+	return EcoIdle
+}
+
+// Sleeping reports whether eco mode released the scanner. It is offline
+// then, but the next scan pairs again.
+func (s *Scanner) Sleeping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ecoReleased
+}
+
+// clock returns the current time; s.mu must be held.
+func (s *Scanner) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// markActive records scanner use, restarting the eco idle timer.
+func (s *Scanner) markActive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastActivity = s.clock()
+}
+
+// beginScan records the start of a scan session, which keeps eco mode from
+// releasing the scanner until endScan.
+func (s *Scanner) beginScan() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeScans++
+	s.lastActivity = s.clock()
+}
+
+// endScan records the end of a scan session started with beginScan.
+func (s *Scanner) endScan() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeScans--
+	s.lastActivity = s.clock()
+}
+
+// ecoCheck releases the reservation once the scanner has been idle for the
+// eco timeout. It is called by the reconnect loop while online; a running
+// scan is never cut off, however long it takes.
+func (s *Scanner) ecoCheck() {
+	s.mu.Lock()
+	idle := s.ecoIdle
+	due := idle > 0 && !s.ecoReleased && s.activeScans == 0 && s.clock().Sub(s.lastActivity) >= idle
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	slog.Info("eco mode: releasing idle scanner", "host", s.host, "idle", idle)
+	s.Disconnect()
+	s.mu.Lock()
+	s.ecoReleased = true
+	s.mu.Unlock()
+}
+
+// wake pairs again with a scanner released by eco mode. If that fails, the
+// reconnect loop keeps trying.
+func (s *Scanner) wake(ctx context.Context) error {
+	s.mu.Lock()
+	released := s.ecoReleased
+	s.ecoReleased = false
+	s.lastActivity = s.clock()
+	s.mu.Unlock()
+	if !released {
+		return nil
+	}
+	slog.Info("eco mode: re-acquiring scanner", "host", s.host)
+	return s.Connect(ctx)
+}
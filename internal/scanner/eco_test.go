@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func TestEcoIdleTimeout(t *testing.T) {
+	tests := []struct {
+		settings config.Settings
+		want     time.Duration
+	}{
+		{config.Settings{}, 0},
+		{config.Settings{EcoIdleMinutes: 5}, 0},
+		{config.Settings{EcoMode: true}, DefaultEcoIdleTimeout},
+		{config.Settings{EcoMode: true, EcoIdleMinutes: 3}, 3 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := EcoIdleTimeout(tt.settings); got != tt.want {
+			t.Errorf("EcoIdleTimeout(%+v) = %v, want %v", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestEcoStateTransitions(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.connected = true
+	sc.now = func() time.Time { return now }
+	var finds atomic.Int32
+	sc.findScanner = func(context.Context, vens.DiscoveryOptions) (*vens.DeviceInfo, error) {
+		finds.Add(1)
+		return nil, errors.New("timeout")
+	}
+
+	if got := sc.EcoState(); got != EcoOff {
+		t.Fatalf("state = %s, want %s", got, EcoOff)
+	}
+	sc.SetEcoMode(10 * time.Minute)
+	if got := sc.EcoState(); got != EcoActive {
+		t.Errorf("after enabling: state = %s, want %s", got, EcoActive)
+	}
+
+	now = now.Add(2 * time.Minute)
+	sc.ecoCheck()
+	if got := sc.EcoState(); got != EcoIdle || !sc.Online() {
+		t.Errorf("idle 2m: state = %s, online = %v, want %s and online", got, sc.Online(), EcoIdle)
+	}
+
+	now = now.Add(8 * time.Minute)
+	sc.ecoCheck()
+	if got := sc.EcoState(); got != EcoReleased || sc.Online() || !sc.Sleeping() {
+		t.Errorf("idle 10m: state = %s, online = %v, sleeping = %v, want %s, offline and sleeping", got, sc.Online(), sc.Sleeping(), EcoReleased)
+	}
+
+	// A scan re-acquires the reservation (Connect fails here at discovery,
+	// leaving the reconnect loop to keep trying)
+	if _, err := sc.StartScan(context.Background(), vens.DefaultScanConfig()); err == nil {
+		t.Error("StartScan succeeded without a scanner")
+	}
+	if n := finds.Load(); n != 1 {
+		t.Errorf("Connect ran discovery %d times, want 1", n)
+	}
+	if got := sc.EcoState(); got != EcoActive || sc.Sleeping() {
+		t.Errorf("after scan request: state = %s, sleeping = %v, want %s and awake", got, sc.Sleeping(), EcoActive)
+	}
+
+	// Disabling eco mode while released hands the scanner back to the
+	// reconnect loop
+	sc.ecoReleased = true
+	sc.SetEcoMode(0)
+	if got := sc.EcoState(); got != EcoOff || sc.Sleeping() {
+		t.Errorf("disabled: state = %s, sleeping = %v", got, sc.Sleeping())
+	}
+}
+
+func TestEcoCheckWaitsForScan(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.connected = true
+	sc.now = func() time.Time { return now }
+	sc.SetEcoMode(time.Minute)
+
+	// A scan running well past the idle timeout is not cut off, even
+	// between pages
+	sc.beginScan()
+	now = now.Add(5 * time.Minute)
+	sc.ecoCheck()
+	if !sc.Online() || sc.Sleeping() {
+		t.Fatalf("released during a scan: online = %v, sleeping = %v", sc.Online(), sc.Sleeping())
+	}
+	sc.markActive() // a page arrived
+	now = now.Add(5 * time.Minute)
+	sc.ecoCheck()
+	if !sc.Online() {
+		t.Fatal("released during a scan after a page")
+	}
+
+	// The idle timer restarts when the scan ends
+	sc.endScan()
+	now = now.Add(30 * time.Second)
+	sc.ecoCheck()
+	if !sc.Online() {
+		t.Error("released right after the scan ended")
+	}
+	now = now.Add(30 * time.Second)
+	sc.ecoCheck()
+	if sc.Online() || !sc.Sleeping() {
+		t.Errorf("idle 1m after the scan: online = %v, sleeping = %v, want released", sc.Online(), sc.Sleeping())
+	}
+}
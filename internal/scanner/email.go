@@ -0,0 +1,196 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// emailTarget is an SMTP server and the recipients button scans are mailed to.
+type emailTarget struct {
+	host        string // host:port
+	implicitTLS bool   // TLS from the first byte (SMTPS); otherwise STARTTLS when offered
+	user        string
+	password    string
+	from        *mail.Address
+	to          []*mail.Address
+}
+
+// newEmailTarget builds the SMTP destination configured in settings. The
+// port defaults to 465 with Settings.SMTPUseTLS and 587 otherwise; port 465
+// always uses implicit TLS. SMTPTo may list several comma-separated
+// recipients.
+func newEmailTarget(s config.Settings) (emailTarget, error) {
+	port := s.SMTPPort
+	if port <= 0 {
+		port = 587
+		if s.SMTPUseTLS {
+			port = 465
+		}
+	}
+	from, err := mail.ParseAddress(s.SMTPFrom)
+	if err != nil {
+		return emailTarget{}, fmt.Errorf("invalid sender %q: %w", s.SMTPFrom, err)
+	}
+	to, err := mail.ParseAddressList(s.SMTPTo)
+	if err != nil {
+		return emailTarget{}, fmt.Errorf("invalid recipients %q: %w", s.SMTPTo, err)
+	}
+	return emailTarget{
+		host:        net.JoinHostPort(s.SMTPHost, strconv.Itoa(port)),
+		implicitTLS: s.SMTPUseTLS || port == 465,
+		user:        s.SMTPUser,
+		password:    s.SMTPPassword,
+		from:        from,
+		to:          to,
+	}, nil
+}
+
+// emailSubject returns the subject line for a scan finished at t.
+func emailSubject(t time.Time, pages int) string {
+	return fmt.Sprintf("Scan %s (%d pages)", t.Format("2006-01-02 15:04"), pages)
+}
+
+// send mails files as attachments of a single message.
+func (t emailTarget) send(subject string, files []outputFile) error {
+	msg, err := buildEmail(t.from, t.to, subject, files, time.Now())
+	if err != nil {
+		return fmt.Errorf("build email: %w", err)
+	}
+
+	serverName, _, _ := net.SplitHostPort(t.host)
+	tlsConfig := &tls.Config{ServerName: serverName}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	if t.implicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.host, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", t.host)
+	}
+	if err != nil {
+		return fmt.Errorf("SMTP connect: %w", err)
+	}
+	c, err := smtp.NewClient(conn, serverName)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP greeting: %w", err)
+	}
+	defer c.Close()
+
+	if !t.implicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("SMTP STARTTLS: %w", err)
+			}
+		}
+	}
+	if t.user != "" {
+		if err := c.Auth(smtp.PlainAuth("", t.user, t.password, serverName)); err != nil {
+			return fmt.Errorf("SMTP auth: %w", err)
+		}
+	}
+	if err := c.Mail(t.from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM: %w", err)
+	}
+	for _, rcpt := range t.to {
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s: %w", rcpt.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("SMTP send: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP send: %w", err)
+	}
+	if err := c.Quit(); err != nil {
+		slog.Debug("SMTP QUIT failed", "err", err)
+	}
+	slog.Info("scan sent via email", "host", t.host, "to", len(t.to), "files", len(files))
+	return nil
+}
+
+// buildEmail builds a multipart/mixed message with a short text body and
+// files attached as base64.
+func buildEmail(from *mail.Address, to []*mail.Address, subject string, files []outputFile, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	recipients := make([]string, len(to))
+	for i, a := range to {
+		recipients[i] = a.String()
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"7bit"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(text, "%s\r\n\r\nSent by AirScap.\r\n", subject)
+
+	for _, f := range files {
+		name := path.Base(f.Name) // attachments have no directories
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(ctype, map[string]string{"name": name})},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(part, f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64Lines writes data base64-encoded in 76-character lines as
+// required by RFC 2045.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", enc[:76]); err != nil {
+			return err
+		}
+		enc = enc[76:]
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", enc)
+	return err
+}
@@ -0,0 +1,206 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// smtpSession is what a fakeSMTPServer received in one session.
+type smtpSession struct {
+	auth string // decoded AUTH PLAIN credentials ("\x00user\x00pass")
+	from string
+	rcpt []string
+	data string
+}
+
+// fakeSMTPServer accepts one plaintext SMTP session with optional AUTH PLAIN
+// and sends what it received on the returned channel.
+func fakeSMTPServer(t *testing.T) (port int, got <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { fmt.Fprintf(conn, "%s\r\n", s) }
+
+		var sess smtpSession
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-fake")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(cmd, "AUTH PLAIN "):
+				dec, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+				sess.auth = string(dec)
+				reply("235 ok")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				sess.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				sess.rcpt = append(sess.rcpt, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				reply("250 ok")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(l, "."))
+				}
+				sess.data = data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				ch <- sess
+				return
+			default:
+				reply("502 unsupported")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, ch
+}
+
+func TestEmailSend(t *testing.T) {
+	port, got := fakeSMTPServer(t)
+	target, err := newEmailTarget(config.Settings{
+		SMTPHost:     "127.0.0.1",
+		SMTPPort:     port,
+		SMTPUser:     "scanner",
+		SMTPPassword: "secret",
+		SMTPFrom:     "AirScap <scanner@example.com>",
+		SMTPTo:       "alice@example.com, Bob <bob@example.com>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []outputFile{
+		{Name: "scan_001.jpg", Data: bytes.Repeat([]byte{0xFF, 0xD8, 0x01}, 100)},
+		{Name: "scan_002.jpg", Data: []byte{0xFF, 0xD8, 0x02}},
+	}
+	subject := emailSubject(time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC), 2)
+	if err := target.send(subject, files); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	sess := <-got
+	if sess.auth != "\x00scanner\x00secret" {
+		t.Errorf("auth = %q", sess.auth)
+	}
+	if sess.from != "scanner@example.com" {
+		t.Errorf("MAIL FROM = %q", sess.from)
+	}
+	if want := []string{"alice@example.com", "bob@example.com"}; !slices.Equal(sess.rcpt, want) {
+		t.Errorf("RCPT TO = %v, want %v", sess.rcpt, want)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(sess.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := msg.Header.Get("Subject"); s != "Scan 2025-03-04 05:06 (2 pages)" {
+		t.Errorf("Subject = %q", s)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var attached []outputFile
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		attached = append(attached, outputFile{Name: part.FileName(), Data: data})
+	}
+	if len(attached) != len(files) {
+		t.Fatalf("attachments = %d, want %d", len(attached), len(files))
+	}
+	for i, f := range files {
+		if attached[i].Name != f.Name || !bytes.Equal(attached[i].Data, f.Data) {
+			t.Errorf("attachment %d = %s (%d bytes), want %s (%d bytes)", i, attached[i].Name, len(attached[i].Data), f.Name, len(f.Data))
+		}
+	}
+}
+
+func TestNewEmailTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     int
+		useTLS   bool
+		wantHost string
+		wantTLS  bool
+	}{
+		{"default STARTTLS", 0, false, "mail.example.com:587", false},
+		{"default implicit TLS", 0, true, "mail.example.com:465", true},
+		{"port 465", 465, false, "mail.example.com:465", true},
+		{"plain port 25", 25, false, "mail.example.com:25", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := newEmailTarget(config.Settings{
+				SMTPHost:   "mail.example.com",
+				SMTPPort:   tt.port,
+				SMTPUseTLS: tt.useTLS,
+				SMTPFrom:   "scanner@example.com",
+				SMTPTo:     "me@example.com",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target.host != tt.wantHost || target.implicitTLS != tt.wantTLS {
+				t.Errorf("host, implicitTLS = %q, %v, want %q, %v", target.host, target.implicitTLS, tt.wantHost, tt.wantTLS)
+			}
+		})
+	}
+
+	if _, err := newEmailTarget(config.Settings{SMTPHost: "mail", SMTPFrom: "scanner@example.com", SMTPTo: "not an address"}); err == nil {
+		t.Error("newEmailTarget accepted an invalid recipient")
+	}
+}
@@ -9,7 +9,12 @@ import (
 	_ "image/jpeg"
 	"io"
 	"log/slog"
+	"net"
+	"path"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/OpenPrinting/go-mfp/abstract"
 	"github.com/OpenPrinting/go-mfp/proto/escl"
@@ -23,35 +28,186 @@ import (
 
 // ESCLAdapter implements abstract.Scanner for ScanSnap hardware.
 type ESCLAdapter struct {
-	mu               sync.Mutex
-	scanner          *Scanner
-	listenPort       int
-	settings         *config.Store
-	caps             *abstract.ScannerCapabilities
-	adfEmpty         bool              // true after a scan session completes (ADF likely exhausted)
-	blankPageRemoval bool              // controlled by eSCL BlankPageDetectionAndRemoval
-	lastScanErr      *vens.ScanError   // last scan error (for ADF state reporting)
-	scanning         bool              // true while a scan session is active
-	lastImageWidth   int               // actual width (pixels) of last scanned page
-	lastImageHeight  int               // actual height (pixels) of last scanned page
-	lastImageBPL     int               // actual bytes per line of last scanned page
-	pagesCompleted   int               // pages delivered via NextDocument (for ImagesCompleted)
+	mu              sync.Mutex
+	scanner         *Scanner
+	listenPort      int
+	settings        *config.Store
+	caps            *abstract.ScannerCapabilities
+	adfEmpty        bool               // true after a scan session completes (ADF likely exhausted)
+	overrides       ScanOverrides      // per-job options from eSCL ScanSettings, e.g. BlankPageDetectionAndRemoval
+	lastScanErr     *vens.ScanError    // last scan error (for ADF state reporting)
+	scanning        bool               // true while a scan session is active
+	cancelScan      context.CancelFunc // cancels the active scan session; nil when idle
+	lastImageWidth  int                // actual width (pixels) of last scanned page
+	lastImageHeight int                // actual height (pixels) of last scanned page
+	lastImageBPL    int                // actual bytes per line of last scanned page
+	jobs            []esclJob          // recent eSCL jobs, newest last; the last one is the running job while scanning
+	scanRegions     []abstract.Region  // eSCL ScanRegions for the next job when more than one is requested
+}
+
+// esclJob tracks an eSCL scan job by the UUID the server assigned to it, so
+// status for several clients can be reported per job.
+type esclJob struct {
+	uuid   string
+	images int // pages delivered via NextDocument (for ImagesCompleted)
 }
 
 // NewESCLAdapter creates an eSCL adapter wrapping the given Scanner.
 func NewESCLAdapter(s *Scanner, listenPort int, settings *config.Store) *ESCLAdapter {
-	a := &ESCLAdapter{scanner: s, listenPort: listenPort, settings: settings, blankPageRemoval: true}
+	a := &ESCLAdapter{scanner: s, listenPort: listenPort, settings: settings}
 	a.caps = a.buildCapabilities()
 	return a
 }
 
-// SetBlankPageRemoval sets whether blank page removal is active for the next scan.
-func (a *ESCLAdapter) SetBlankPageRemoval(enabled bool) {
+// SetScanOverrides sets the per-job options of the next scan. They take
+// precedence over the AirScan settings.
+func (a *ESCLAdapter) SetScanOverrides(ov ScanOverrides) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.overrides = ov
+}
+
+// srgb reports whether pages are advertised and tagged as sRGB, see
+// Settings.AirscanColorSpace.
+func srgb(s config.Settings) bool {
+	return s.AirscanColorSpace != ColorSpaceRaw
+}
+
+// AdvertiseColorSpace sets the color spaces of every eSCL setting profile
+// in caps to match the scanned pages: sRGB, or none with the "raw" color
+// space setting.
+func (a *ESCLAdapter) AdvertiseColorSpace(caps *escl.ScannerCapabilities) {
+	var spaces []escl.ColorSpace
+	if a.settings == nil || srgb(a.settings.Get()) {
+		spaces = []escl.ColorSpace{escl.SRGB}
+	}
+	if caps.ADF == nil {
+		return
+	}
+	for _, in := range []*escl.InputSourceCaps{caps.ADF.ADFSimplexInputCaps, caps.ADF.ADFDuplexInputCaps} {
+		if in == nil {
+			continue
+		}
+		for i := range in.SettingProfiles {
+			in.SettingProfiles[i].ColorSpaces = spaces
+		}
+	}
+}
+
+// forcedColorMode returns the color mode set by Settings.AirscanForceColorMode,
+// or false when eSCL requests choose their own color mode.
+func forcedColorMode(s config.Settings) (vens.ColorMode, bool) {
+	switch s.AirscanForceColorMode {
+	case "auto":
+		return vens.ColorAuto, true
+	case "color":
+		return vens.ColorColor, true
+	case "grayscale":
+		return vens.ColorGray, true
+	case "bw":
+		return vens.ColorBW, true
+	}
+	return 0, false
+}
+
+// AdvertiseColorModes removes the setting profiles of the color modes that
+// Settings.AirscanForceColorMode would override, so clients only offer the
+// mode that is actually scanned. A forced "auto" keeps every profile, as the
+// scanner may return any of them.
+func (a *ESCLAdapter) AdvertiseColorModes(caps *escl.ScannerCapabilities) {
+	if a.settings == nil || caps.ADF == nil {
+		return
+	}
+	var keep escl.ColorMode
+	switch mode, _ := forcedColorMode(a.settings.Get()); mode {
+	case vens.ColorColor:
+		keep = escl.RGB24
+	case vens.ColorGray:
+		keep = escl.Grayscale8
+	case vens.ColorBW:
+		keep = escl.BlackAndWhite1
+	default:
+		return
+	}
+	for _, in := range []*escl.InputSourceCaps{caps.ADF.ADFSimplexInputCaps, caps.ADF.ADFDuplexInputCaps} {
+		if in == nil {
+			continue
+		}
+		in.SettingProfiles = slices.DeleteFunc(in.SettingProfiles, func(p escl.SettingProfile) bool {
+			return !slices.Contains(p.ColorModes, keep)
+		})
+	}
+}
+
+// AdvertiseMaxResolution removes the resolutions above Settings.MaxResolution
+// from every eSCL setting profile in caps, keeping at least the lowest one.
+// Requests for more are still accepted and scanned at the cap (see
+// capQuality); the optical resolution stays that of the scanner.
+func (a *ESCLAdapter) AdvertiseMaxResolution(caps *escl.ScannerCapabilities) {
+	if a.settings == nil || caps.ADF == nil {
+		return
+	}
+	limit := a.settings.Get().MaxResolution
+	if limit <= 0 {
+		return
+	}
+	for _, in := range []*escl.InputSourceCaps{caps.ADF.ADFSimplexInputCaps, caps.ADF.ADFDuplexInputCaps} {
+		if in == nil {
+			continue
+		}
+		for i := range in.SettingProfiles {
+			for j := range in.SettingProfiles[i].SupportedResolutions {
+				sr := &in.SettingProfiles[i].SupportedResolutions[j]
+				if len(sr.DiscreteResolutions) == 0 {
+					continue
+				}
+				lowest := sr.DiscreteResolutions[0] // listed in ascending order
+				sr.DiscreteResolutions = slices.DeleteFunc(sr.DiscreteResolutions, func(r escl.DiscreteResolution) bool {
+					return r.XResolution > limit || r.YResolution > limit
+				})
+				if len(sr.DiscreteResolutions) == 0 {
+					sr.DiscreteResolutions = append(sr.DiscreteResolutions, lowest)
+				}
+			}
+		}
+	}
+}
+
+// SetScanRegions records the eSCL ScanRegions of the next job. go-mfp only
+// forwards the first region in the ScannerRequest, so when a client sends
+// several, the job scans the full page and crops it into each region.
+// A single region is handled by the regular paper-size path.
+func (a *ESCLAdapter) SetScanRegions(regs []escl.ScanRegion) {
+	var regions []abstract.Region
+	if len(regs) > 1 {
+		if len(regs) > MaxScanRegions {
+			slog.Warn("too many scan regions, ignoring extras", "requested", len(regs), "max", MaxScanRegions)
+			regs = regs[:MaxScanRegions]
+		}
+		for _, r := range regs {
+			regions = append(regions, abstract.Region{
+				XOffset: abstract.DimensionFromDots(300, r.XOffset),
+				YOffset: abstract.DimensionFromDots(300, r.YOffset),
+				Width:   abstract.DimensionFromDots(300, r.Width),
+				Height:  abstract.DimensionFromDots(300, r.Height),
+			})
+		}
+	}
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	a.blankPageRemoval = enabled
+	a.scanRegions = regions
 }
 
+// ADFCapacity is the document feeder capacity in sheets of the ADF models,
+// used to estimate the progress of a scan.
+const ADFCapacity = vens.ADFCapacity
+
+// InteractiveStartTimeout is how long eSCL and WebUI preview scans wait for
+// the first sheet to feed. The client starts these scans with paper already
+// loaded, so a scanner that does not start soon is reported rather than
+// waited on for the button-scan default (vens.DefaultStartTimeout).
+const InteractiveStartTimeout = 20 * time.Second
+
 func (a *ESCLAdapter) buildCapabilities() *abstract.ScannerCapabilities {
 	params := a.scanner.ScanParams()
 
@@ -74,17 +230,6 @@ func (a *ESCLAdapter) buildCapabilities() *abstract.ScannerCapabilities {
 		resolutions = []abstract.Resolution{{XResolution: 300, YResolution: 300}}
 	}
 
-	profile := abstract.SettingsProfile{
-		ColorModes: generic.MakeBitset(
-			abstract.ColorModeBinary,
-			abstract.ColorModeMono,
-			abstract.ColorModeColor,
-		),
-		Depths:           generic.MakeBitset(abstract.ColorDepth8),
-		BinaryRenderings: generic.MakeBitset(abstract.BinaryRenderingThreshold),
-		Resolutions:      resolutions,
-	}
-
 	// Max dimensions from scanner params, with fallbacks
 	maxWidth := 216 * abstract.Millimeter
 	maxHeight := 360 * abstract.Millimeter
@@ -115,12 +260,9 @@ func (a *ESCLAdapter) buildCapabilities() *abstract.ScannerCapabilities {
 			abstract.IntentPhoto,
 			abstract.IntentTextAndGraphic,
 		),
-		Profiles: []abstract.SettingsProfile{profile},
+		Profiles: settingsProfiles(resolutions),
 	}
 
-	// Generate deterministic UUID from scanner host
-	deviceUUID := uuid.SHA1(uuid.NameSpaceDNS, "airscap."+a.scanner.Host())
-
 	name := a.scanner.MakeAndModel()
 	if name == "" {
 		name = "Unknown"
@@ -131,45 +273,137 @@ func (a *ESCLAdapter) buildCapabilities() *abstract.ScannerCapabilities {
 		serial = a.scanner.Host()
 	}
 
+	// Generate deterministic UUID from the serial, so clients keep seeing the
+	// same device when the scanner's IP address changes
+	deviceUUID := uuid.SHA1(uuid.NameSpaceDNS, "airscap."+serial)
+
+	// Simplex-only models, like the sheet-fed iX100, advertise no duplex
+	model := a.scanner.Model()
+	var duplexCaps *abstract.InputCapabilities
+	if model.HasDuplex() {
+		duplexCaps = adfCaps
+	}
+
 	return &abstract.ScannerCapabilities{
 		UUID:             deviceUUID,
 		MakeAndModel:     name,
 		SerialNumber:     serial,
-		AdminURI:         fmt.Sprintf("http://%s:%d/ui/", vens.GetLocalIP(a.scanner.Host()), a.listenPort),
-		DocumentFormats:  []string{"image/jpeg", "image/tiff", "application/pdf"},
+		AdminURI:         fmt.Sprintf("http://%s/ui/", net.JoinHostPort(vens.GetLocalIP(a.scanner.Host()), strconv.Itoa(a.listenPort))),
+		DocumentFormats:  []string{"image/jpeg", "image/tiff", FormatPNG, "application/pdf"},
 		CompressionRange: abstract.Range{Min: 1, Max: 5, Normal: 3, Step: 1},
 		ThresholdRange:   abstract.Range{Min: -5, Max: 5, Normal: 0, Step: 1},
-		ADFCapacity:      50,
+		BrightnessRange:  abstract.Range{Min: -5, Max: 5, Normal: 0, Step: 1},
+		ContrastRange:    abstract.Range{Min: -5, Max: 5, Normal: 0, Step: 1},
+		ADFCapacity:      model.FeederCapacity(),
 		ADFSimplex:       adfCaps,
-		ADFDuplex:        adfCaps,
+		ADFDuplex:        duplexCaps,
+	}
+}
+
+// settingsProfiles returns one eSCL SettingProfile per supported color mode,
+// each carrying only the depth or rendering valid for that mode, so clients
+// can offer the matching options per mode.
+func settingsProfiles(resolutions []abstract.Resolution) []abstract.SettingsProfile {
+	return []abstract.SettingsProfile{
+		{
+			ColorModes:       generic.MakeBitset(abstract.ColorModeBinary),
+			BinaryRenderings: generic.MakeBitset(abstract.BinaryRenderingThreshold),
+			Resolutions:      resolutions,
+		},
+		{
+			ColorModes:  generic.MakeBitset(abstract.ColorModeMono),
+			Depths:      generic.MakeBitset(abstract.ColorDepth8),
+			Resolutions: resolutions,
+		},
+		{
+			ColorModes:  generic.MakeBitset(abstract.ColorModeColor),
+			Depths:      generic.MakeBitset(abstract.ColorDepth8),
+			Resolutions: resolutions,
+		},
 	}
 }
 
 // Capabilities returns the scanner capabilities.
 func (a *ESCLAdapter) Capabilities() *abstract.ScannerCapabilities {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return a.caps
 }
 
+// RefreshCapabilities re-fetches the scanner parameters and rebuilds the
+// advertised capabilities. It returns the capabilities before and after the
+// refresh so callers can report what changed.
+func (a *ESCLAdapter) RefreshCapabilities() (before, after *abstract.ScannerCapabilities, err error) {
+	before = a.Capabilities()
+	if _, err := a.scanner.RefreshScanParams(); err != nil {
+		return before, before, err
+	}
+	after = a.buildCapabilities()
+	a.mu.Lock()
+	a.caps = after
+	a.mu.Unlock()
+	slog.Info("scanner capabilities refreshed",
+		"maxResolution", after.ADFSimplex.MaxOpticalXResolution,
+		"maxWidth", after.ADFSimplex.MaxWidth,
+		"maxHeight", after.ADFSimplex.MaxHeight,
+	)
+	return before, after, nil
+}
+
+// RequestError is returned by ESCLAdapter.Scan for a request that does not
+// match the advertised capabilities, before the scanner is touched. Its
+// message is sent to the eSCL client.
+type RequestError struct {
+	Err abstract.ErrParam
+}
+
+func (e *RequestError) Error() string {
+	switch {
+	case e.Err.Name == "Input" && e.Err.Value == abstract.InputPlaten:
+		return "input source Platen is not supported: this scanner only has a document feeder (Feeder)"
+	case e.Err.Name == "Input":
+		return fmt.Sprintf("input source %v is not supported: use Feeder", e.Err.Value)
+	case e.Err.Err == abstract.ErrUnsupportedParam:
+		return fmt.Sprintf("%s %v is not supported by this scanner", e.Err.Name, e.Err.Value)
+	}
+	return fmt.Sprintf("invalid %s: %v", e.Err.Name, e.Err.Value)
+}
+
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// validateRequest checks req against the advertised capabilities.
+func validateRequest(req abstract.ScannerRequest, caps *abstract.ScannerCapabilities) error {
+	err := req.Validate(caps)
+	var pe abstract.ErrParam
+	if errors.As(err, &pe) {
+		return &RequestError{Err: pe}
+	}
+	return err
+}
+
 // Scan converts an eSCL request to VENS parameters and starts a lazy scan session.
 // Pages are pulled one at a time, enabling SelectSinglePage support.
 func (a *ESCLAdapter) Scan(ctx context.Context, req abstract.ScannerRequest) (abstract.Document, error) {
-	if err := req.Validate(a.caps); err != nil {
+	if err := validateRequest(req, a.Capabilities()); err != nil {
+		slog.Warn("scan request rejected", "err", err)
 		return nil, err
 	}
 
-	forcePaperAuto := a.settings != nil && a.settings.Get().AirscanForcePaperAuto
-	cfg := mapScanConfig(req, forcePaperAuto)
+	var s config.Settings
+	if a.settings != nil {
+		s = a.settings.Get()
+	}
 	a.mu.Lock()
-	cfg.BlankPageRemoval = a.blankPageRemoval
+	cfg := mapScanConfig(req, s, a.overrides)
+	cfg.Model = a.scanner.Model()
+	regions := a.scanRegions
+	a.scanRegions = nil
 	a.mu.Unlock()
-
-	// Apply server-side AirScan overrides from settings
-	if a.settings != nil {
-		s := a.settings.Get()
-		cfg.BleedThrough = s.AirscanBleedThrough
-		if req.Threshold == nil {
-			cfg.BWDensity = s.AirscanBWDensity
-		}
+	if len(regions) > 1 {
+		// Scan the whole sheet; regions are cropped out of each page afterwards
+		cfg.PaperSize = vens.PaperAuto
+		cfg.PaperWidth = 0
+		cfg.PaperHeight = 0
 	}
 
 	slog.Info("scan requested",
@@ -183,6 +417,9 @@ func (a *ESCLAdapter) Scan(ctx context.Context, req abstract.ScannerRequest) (ab
 		"paperWidth", cfg.PaperWidth,
 		"paperHeight", cfg.PaperHeight,
 		"compression", cfg.CompressionArg,
+		"brightness", cfg.Brightness,
+		"contrast", cfg.Contrast,
+		"regions", len(regions),
 	)
 
 	a.mu.Lock()
@@ -191,11 +428,18 @@ func (a *ESCLAdapter) Scan(ctx context.Context, req abstract.ScannerRequest) (ab
 	a.lastImageWidth = 0
 	a.lastImageHeight = 0
 	a.lastImageBPL = 0
-	a.pagesCompleted = 0
+	a.jobs = slices.DeleteFunc(a.jobs, func(j esclJob) bool { return j.uuid == "" })
+	a.jobs = append(a.jobs, esclJob{}) // identified by SetJobURI once the job is created
 	a.mu.Unlock()
 
-	session, err := a.scanner.StartScan(cfg)
+	// The session outlives the ScanJobs request, so it gets its own context;
+	// the request context only covers starting the scan
+	scanCtx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, cancel)
+	session, err := a.scanner.StartScan(scanCtx, cfg)
+	stop()
 	if err != nil {
+		cancel()
 		a.mu.Lock()
 		a.scanning = false
 		a.adfEmpty = true
@@ -209,11 +453,11 @@ func (a *ESCLAdapter) Scan(ctx context.Context, req abstract.ScannerRequest) (ab
 	}
 
 	res := req.Resolution
+	if dpi := vens.QualityDPI[cfg.Quality]; dpi > 0 && dpi < res.XResolution {
+		res = abstract.Resolution{XResolution: dpi, YResolution: dpi} // lowered by Settings.MaxResolution
+	}
 	if res.IsZero() {
-		dpi := vens.QualityDPI[cfg.Quality]
-		if dpi == 0 {
-			dpi = 300
-		}
+		dpi := fallbackDPI(cfg, s)
 		res = abstract.Resolution{XResolution: dpi, YResolution: dpi}
 	}
 
@@ -222,23 +466,62 @@ func (a *ESCLAdapter) Scan(ctx context.Context, req abstract.ScannerRequest) (ab
 	format := "image/jpeg"
 	if isBW {
 		format = "image/tiff"
+	} else if req.DocumentFormat == FormatPNG {
+		format = FormatPNG // pages are re-encoded
 	}
+	a.mu.Lock()
+	a.cancelScan = cancel
+	a.mu.Unlock()
+
 	// PDF output: collect all pages and generate a single PDF document
 	if req.DocumentFormat == "application/pdf" {
-		return &pdfDocument{res: res, session: session, adapter: a, colorMode: cfg.ColorMode}, nil
+		return &pdfDocument{res: res, session: session, adapter: a, colorMode: cfg.ColorMode, regions: regions,
+			brightness: cfg.Brightness, contrast: cfg.Contrast, srgb: srgb(s)}, nil
 	}
 
 	// Reject incompatible format+colorMode combinations (eSCL spec: 409 Conflict)
-	// TIFF is only valid for BW; JPEG is only valid for color/grayscale
+	// TIFF is only valid for BW; JPEG and PNG are only valid for color/grayscale
 	if req.DocumentFormat != "" && req.DocumentFormat != format {
 		session.Close()
 		a.mu.Lock()
 		a.scanning = false
+		a.cancelScan = nil
 		a.mu.Unlock()
+		cancel()
 		return nil, fmt.Errorf("%s is not supported with the requested color mode", req.DocumentFormat)
 	}
 
-	return &scanDocument{res: res, session: session, format: format, adapter: a, colorMode: cfg.ColorMode}, nil
+	return &scanDocument{res: res, session: session, format: format, adapter: a, colorMode: cfg.ColorMode, regions: regions,
+		brightness: cfg.Brightness, contrast: cfg.Contrast, srgb: srgb(s)}, nil
+}
+
+// CancelScan aborts the active eSCL scan session, e.g. on a DELETE of the
+// scan job: a page transfer in progress fails at once, so the job can be
+// finished and the session closed, which ends the scan on the scanner. The
+// adapter accepts a new scan right away. It is a no-op without a session.
+func (a *ESCLAdapter) CancelScan() {
+	a.mu.Lock()
+	cancel := a.cancelScan
+	a.cancelScan = nil
+	a.scanning = false
+	a.mu.Unlock()
+	if cancel != nil {
+		slog.Info("eSCL scan canceled")
+		cancel()
+	}
+}
+
+// endScan marks the active scan session as finished.
+func (a *ESCLAdapter) endScan() {
+	a.mu.Lock()
+	cancel := a.cancelScan
+	a.cancelScan = nil
+	a.scanning = false
+	a.adfEmpty = true
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
 }
 
 // CheckADFStatus queries the scanner for paper presence and error conditions.
@@ -289,7 +572,7 @@ func (a *ESCLAdapter) CheckADFStatus() (bool, error) {
 		a.lastScanErr = &vens.ScanError{Kind: vens.ScanErrPaperJam, Msg: "paper jam"}
 	} else if status.ErrorCode != 0 {
 		// Error from GET_STATUS offset 44 (scan-time errors)
-		kind := errorCodeToKind(status.ErrorCode)
+		kind := vens.ErrorCodeKind(status.ErrorCode)
 		if a.lastScanErr == nil || a.lastScanErr.Kind != kind {
 			slog.Warn("scanner error detected", "errorCode", fmt.Sprintf("0x%04X", status.ErrorCode), "kind", kind)
 		}
@@ -304,7 +587,7 @@ func (a *ESCLAdapter) CheckADFStatus() (bool, error) {
 
 // ScannerState returns the current eSCL scanner state based on connection status.
 func (a *ESCLAdapter) ScannerState() escl.ScannerState {
-	if !a.scanner.Online() {
+	if !a.scanner.Online() && !a.scanner.Sleeping() {
 		return escl.ScannerDown
 	}
 	a.mu.Lock()
@@ -363,12 +646,44 @@ func (a *ESCLAdapter) ImageInfo() (width, height, bytesPerLine int) {
 	return a.lastImageWidth, a.lastImageHeight, a.lastImageBPL
 }
 
-// PagesCompleted returns the number of pages delivered via NextDocument
-// in the current scan session.
-func (a *ESCLAdapter) PagesCompleted() int {
+// SetJobURI identifies the scan started by the last Scan call with the
+// eSCL JobUri the server assigned to it, whose last element is the job UUID
+// that clients poll in ScannerStatus. It is called as the ScanJobs response
+// is sent.
+func (a *ESCLAdapter) SetJobURI(jobURI string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	return a.pagesCompleted
+	if n := len(a.jobs); n > 0 && a.jobs[n-1].uuid == "" {
+		a.jobs[n-1].uuid = path.Base(jobURI)
+	}
+	if n := len(a.jobs); n > escl.AbstractServerHistorySize {
+		a.jobs = slices.Delete(a.jobs, 0, n-escl.AbstractServerHistorySize)
+	}
+}
+
+// JobImagesCompleted returns the number of pages delivered to the client
+// for the job with the given UUID, and whether the job is known.
+func (a *ESCLAdapter) JobImagesCompleted(jobUUID string) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, j := range a.jobs {
+		if j.uuid == jobUUID {
+			return j.images, true
+		}
+	}
+	return 0, false
+}
+
+// CancelJob is CancelScan for a DELETE of the job at jobURI: the scan is
+// only aborted while that job is the running one, so deleting a finished
+// job does not cancel another client's scan.
+func (a *ESCLAdapter) CancelJob(jobURI string) {
+	a.mu.Lock()
+	running := a.scanning && len(a.jobs) > 0 && a.jobs[len(a.jobs)-1].uuid == path.Base(jobURI)
+	a.mu.Unlock()
+	if running {
+		a.CancelScan()
+	}
 }
 
 // Close closes the scanner connection.
@@ -377,21 +692,16 @@ func (a *ESCLAdapter) Close() error {
 	return nil
 }
 
-// errorCodeToKind maps GET_STATUS error codes (offset 44) to ScanErrorKind.
-func errorCodeToKind(code uint16) vens.ScanErrorKind {
-	switch code {
-	case 0x0155:
-		return vens.ScanErrMultiFeed
-	default:
-		// Unknown error code — log it so we can add mappings later
-		return vens.ScanErrGeneric
-	}
-}
-
-// mapScanConfig converts an eSCL ScannerRequest to VENS ScanConfig.
-// When forcePaperAuto is true, paper size override is skipped (always auto-detect).
-func mapScanConfig(req abstract.ScannerRequest, forcePaperAuto bool) vens.ScanConfig {
+// mapScanConfig converts an eSCL ScannerRequest to VENS ScanConfig, applying
+// the AirScan settings in s. Options are taken from the request, then ov,
+// then the settings, then the defaults. With s.AirscanForcePaperAuto the
+// paper size override is skipped (always auto-detect), and
+// s.AirscanForceColorMode replaces the requested color mode.
+func mapScanConfig(req abstract.ScannerRequest, s config.Settings, ov ScanOverrides) vens.ScanConfig {
 	cfg := vens.DefaultScanConfig()
+	cfg.StartTimeout = InteractiveStartTimeout
+	cfg.BleedThrough = s.AirscanBleedThrough
+	cfg.BWDensity = s.AirscanBWDensity
 
 	// Color mode
 	switch req.ColorMode {
@@ -404,6 +714,9 @@ func mapScanConfig(req abstract.ScannerRequest, forcePaperAuto bool) vens.ScanCo
 	default:
 		cfg.ColorMode = vens.ColorAuto
 	}
+	if mode, ok := forcedColorMode(s); ok {
+		cfg.ColorMode = mode
+	}
 
 	// Resolution → Quality
 	dpi := req.Resolution.XResolution
@@ -417,9 +730,14 @@ func mapScanConfig(req abstract.ScannerRequest, forcePaperAuto bool) vens.ScanCo
 	default:
 		cfg.Quality = vens.QualitySuperFine
 	}
+	cfg.Quality = capQuality(cfg.Quality, s)
 
-	// ADF mode → Duplex
-	cfg.Duplex = req.ADFMode == abstract.ADFModeDuplex
+	// ADF mode → Duplex; an unset mode uses the configured default
+	if req.ADFMode == abstract.ADFModeUnset {
+		cfg.Duplex = s.DefaultDuplex
+	} else {
+		cfg.Duplex = req.ADFMode == abstract.ADFModeDuplex
+	}
 
 	// Threshold → BW Density (B&W mode only, -5 to +5)
 	if req.Threshold != nil {
@@ -435,20 +753,58 @@ func mapScanConfig(req abstract.ScannerRequest, forcePaperAuto bool) vens.ScanCo
 		}
 	}
 
+	// Brightness / Contrast (-5..+5, applied to the received JPEG pages)
+	if req.Brightness != nil {
+		cfg.Brightness = min(max(*req.Brightness, -5), 5)
+	}
+	if req.Contrast != nil {
+		cfg.Contrast = min(max(*req.Contrast, -5), 5)
+	}
+
 	// Region → Paper size (1/100 mm → 1/1200 inch)
 	// When Region matches max scan area, treat as auto (don't override).
-	// When forcePaperAuto is enabled, always skip paper override (auto-detect).
-	if !forcePaperAuto {
+	// When AirscanForcePaperAuto is enabled, always skip paper override (auto-detect).
+	if !s.AirscanForcePaperAuto {
 		maxRegion := req.Region.Width >= 216*abstract.Millimeter && req.Region.Height >= 360*abstract.Millimeter
 		if !req.Region.IsZero() && !maxRegion {
-			cfg.PaperWidth = dimToInch1200(req.Region.Width)
-			cfg.PaperHeight = dimToInch1200(req.Region.Height)
+			if ps, ok := matchPaperSize(req.Region.Width, req.Region.Height); ok {
+				// The scanner only fixes the paper size when given its
+				// dimensions; the size alone is scanned with auto-detect
+				dim := vens.PaperDimensions[ps]
+				cfg.PaperSize = ps
+				cfg.PaperWidth = dim.Width
+				cfg.PaperHeight = dim.Height
+			} else {
+				cfg.PaperWidth = dimToInch1200(req.Region.Width)
+				cfg.PaperHeight = dimToInch1200(req.Region.Height)
+			}
 		}
 	}
 
+	ov.Apply(&cfg)
 	return cfg
 }
 
+// namedPaperSizes are the fixed-size papers an eSCL region is matched against.
+var namedPaperSizes = []vens.PaperSize{
+	vens.PaperA4, vens.PaperA5, vens.PaperA6, vens.PaperB5,
+	vens.PaperPostcard, vens.PaperLetter, vens.PaperLegal,
+}
+
+// matchPaperSize returns the named paper size within 1mm of width × height.
+func matchPaperSize(width, height abstract.Dimension) (vens.PaperSize, bool) {
+	near := func(a, b abstract.Dimension) bool {
+		return a-b <= abstract.Millimeter && b-a <= abstract.Millimeter
+	}
+	for _, ps := range namedPaperSizes {
+		dim := vens.PaperDimensions[ps]
+		if near(width, inch1200ToDim(dim.Width)) && near(height, inch1200ToDim(dim.Height)) {
+			return ps, true
+		}
+	}
+	return vens.PaperAuto, false
+}
+
 // dimToInch1200 converts abstract.Dimension (1/100 mm) to 1/1200 inch.
 func dimToInch1200(d abstract.Dimension) uint16 {
 	// 1 inch = 25.4 mm = 2540 (1/100 mm)
@@ -468,17 +824,29 @@ func inch1200ToDim(v uint16) abstract.Dimension {
 // Pages are pulled lazily from the scanner one at a time.
 type scanDocument struct {
 	res       abstract.Resolution
-	session   *vens.ScanSession
-	format    string // "image/jpeg" or "image/tiff"
+	session   *ScanSession
+	format    string // "image/jpeg", "image/tiff" or FormatPNG
 	adapter   *ESCLAdapter
-	colorMode vens.ColorMode // for ActualBytesPerLine calculation
+	colorMode vens.ColorMode    // for ActualBytesPerLine calculation
+	regions   []abstract.Region // multi-region crop; nil for a single region
+	pending   []vens.Page       // cropped regions not yet returned
+	srgb      bool              // tag color JPEG pages with the sRGB profile
+
+	brightness, contrast int // applied to each JPEG page; 0 = as scanned
 }
 
 func (d *scanDocument) Resolution() abstract.Resolution { return d.res }
 
 func (d *scanDocument) Next() (abstract.DocumentFile, error) {
+	if len(d.pending) > 0 {
+		page := d.pending[0]
+		d.pending = d.pending[1:]
+		return d.file(page)
+	}
+
 	page, err := d.session.NextPage()
 	if err != nil {
+		d.adapter.scanner.noteScanResult(err)
 		d.adapter.mu.Lock()
 		d.adapter.scanning = false
 		d.adapter.adfEmpty = true
@@ -497,37 +865,76 @@ func (d *scanDocument) Next() (abstract.DocumentFile, error) {
 		// Skip empty pages (blank page removal filtered them out)
 		return d.Next()
 	}
+	if page, err = adjustPage(page, d.brightness, d.contrast, d.res.XResolution); err != nil {
+		return nil, err
+	}
+
+	if len(d.regions) > 0 {
+		crops, err := cropPageRegions(page, d.regions, d.res.XResolution)
+		if err != nil {
+			return nil, err
+		}
+		d.pending = crops
+		return d.Next()
+	}
+
+	return d.file(page)
+}
+
+// file converts, tags and records a page being delivered.
+func (d *scanDocument) file(page vens.Page) (*scanFile, error) {
+	if d.format == FormatPNG {
+		var err error
+		if page, err = encodePNGPage(page, d.res.XResolution, d.srgb); err != nil {
+			return nil, err
+		}
+	} else if d.srgb {
+		page.JPEG = tagSRGB(page.JPEG)
+	}
+	d.adapter.recordPage(page.JPEG, d.colorMode)
+	return &scanFile{Reader: bytes.NewReader(page.JPEG), format: d.format}, nil
+}
 
-	// Capture actual image dimensions for ScanImageInfo
+// recordPage counts a delivered page for the running job and captures its actual image
+// dimensions for ScanImageInfo.
+func (a *ESCLAdapter) recordPage(data []byte, colorMode vens.ColorMode) {
 	var w, h int
-	if cfg, _, err := image.DecodeConfig(bytes.NewReader(page.JPEG)); err == nil {
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
 		w, h = cfg.Width, cfg.Height
 	}
-	d.adapter.mu.Lock()
-	d.adapter.pagesCompleted++
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n := len(a.jobs); n > 0 {
+		a.jobs[n-1].images++
+	}
 	if w > 0 {
 		bpl := w * 3 // color (RGB)
-		switch d.colorMode {
+		switch colorMode {
 		case vens.ColorGray:
 			bpl = w
 		case vens.ColorBW:
 			bpl = (w + 7) / 8
 		}
-		d.adapter.lastImageWidth = w
-		d.adapter.lastImageHeight = h
-		d.adapter.lastImageBPL = bpl
+		a.lastImageWidth = w
+		a.lastImageHeight = h
+		a.lastImageBPL = bpl
 	}
-	d.adapter.mu.Unlock()
+}
 
-	return &scanFile{Reader: bytes.NewReader(page.JPEG), format: d.format}, nil
+// unrecordPages takes n pages recorded with recordPage off the count of the
+// running job, for pages that were left out of its document.
+func (a *ESCLAdapter) unrecordPages(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if i := len(a.jobs) - 1; i >= 0 {
+		a.jobs[i].images = max(0, a.jobs[i].images-n)
+	}
 }
 
 func (d *scanDocument) Close() error {
-	d.adapter.mu.Lock()
-	d.adapter.scanning = false
-	d.adapter.adfEmpty = true
-	d.adapter.mu.Unlock()
-	return d.session.Close()
+	err := d.session.Close()
+	d.adapter.endScan()
+	return err
 }
 
 // scanFile wraps a single scanned page as an abstract.DocumentFile.
@@ -547,10 +954,14 @@ func (f *scanFile) Format() string { return f.format }
 // generates a PDF in memory, and returns it as a single DocumentFile.
 type pdfDocument struct {
 	res       abstract.Resolution
-	session   *vens.ScanSession
+	session   *ScanSession
 	adapter   *ESCLAdapter
 	colorMode vens.ColorMode
+	regions   []abstract.Region // multi-region crop; nil for a single region
+	srgb      bool              // tag color JPEG pages with the sRGB profile
 	done      bool
+
+	brightness, contrast int // applied to each JPEG page; 0 = as scanned
 }
 
 func (d *pdfDocument) Resolution() abstract.Resolution { return d.res }
@@ -566,6 +977,7 @@ func (d *pdfDocument) Next() (abstract.DocumentFile, error) {
 	for {
 		page, err := d.session.NextPage()
 		if err != nil {
+			d.adapter.scanner.noteScanResult(err)
 			if err == io.EOF {
 				break
 			}
@@ -582,24 +994,29 @@ func (d *pdfDocument) Next() (abstract.DocumentFile, error) {
 		if len(page.JPEG) == 0 {
 			continue // blank page removal
 		}
+		if page, err = adjustPage(page, d.brightness, d.contrast, d.res.XResolution); err != nil {
+			return nil, err
+		}
 
-		// Update image info for ScanImageInfo
-		if cfg, _, err := image.DecodeConfig(bytes.NewReader(page.JPEG)); err == nil {
-			bpl := cfg.Width * 3
-			switch d.colorMode {
-			case vens.ColorGray:
-				bpl = cfg.Width
-			case vens.ColorBW:
-				bpl = (cfg.Width + 7) / 8
+		if len(d.regions) > 0 {
+			crops, err := cropPageRegions(page, d.regions, d.res.XResolution)
+			if err != nil {
+				return nil, err
 			}
-			d.adapter.mu.Lock()
-			d.adapter.pagesCompleted++
-			d.adapter.lastImageWidth = cfg.Width
-			d.adapter.lastImageHeight = cfg.Height
-			d.adapter.lastImageBPL = bpl
-			d.adapter.mu.Unlock()
+			for _, c := range crops {
+				if d.srgb {
+					c.JPEG = tagSRGB(c.JPEG)
+				}
+				d.adapter.recordPage(c.JPEG, d.colorMode)
+				pages = append(pages, c)
+			}
+			continue
 		}
 
+		if d.srgb {
+			page.JPEG = tagSRGB(page.JPEG)
+		}
+		d.adapter.recordPage(page.JPEG, d.colorMode)
 		pages = append(pages, page)
 	}
 
@@ -615,9 +1032,11 @@ func (d *pdfDocument) Next() (abstract.DocumentFile, error) {
 	if dpi <= 0 {
 		dpi = 300
 	}
-	isBW := d.colorMode == vens.ColorBW
-
-	data, err := GeneratePDF(pages, dpi, isBW)
+	// Pages are decoded by their own format; the color mode is only a hint.
+	// A page corrupted in transfer is left out rather than failing the job,
+	// as the paper cannot be scanned again; eSCL has no way to warn the
+	// client, but ImagesCompleted then counts only the pages in the PDF
+	data, skipped, err := GeneratePDFWithSkipped(pages, PDFOptions{DPI: dpi, IsBW: d.colorMode == vens.ColorBW, BestEffort: true})
 	if err != nil {
 		d.adapter.mu.Lock()
 		d.adapter.scanning = false
@@ -626,15 +1045,17 @@ func (d *pdfDocument) Next() (abstract.DocumentFile, error) {
 		return nil, err
 	}
 
-	slog.Info("PDF generated for eSCL", "pages", len(pages), "size", len(data))
+	if len(skipped) > 0 {
+		slog.Warn("eSCL PDF lacks unreadable pages", "err", pagesLeftOutError(skipped))
+		d.adapter.unrecordPages(len(skipped))
+	}
+	slog.Info("PDF generated for eSCL", "pages", len(pages)-len(skipped), "size", len(data))
 
 	return &scanFile{Reader: bytes.NewReader(data), format: "application/pdf"}, nil
 }
 
 func (d *pdfDocument) Close() error {
-	d.adapter.mu.Lock()
-	d.adapter.scanning = false
-	d.adapter.adfEmpty = true
-	d.adapter.mu.Unlock()
-	return d.session.Close()
+	err := d.session.Close()
+	d.adapter.endScan()
+	return err
 }
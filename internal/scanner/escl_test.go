@@ -1,11 +1,21 @@
 package scanner
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"slices"
 	"testing"
 
 	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/proto/escl"
+	"github.com/OpenPrinting/go-mfp/util/generic"
 	"github.com/OpenPrinting/go-mfp/util/optional"
 
+	"github.com/mzyy94/airscap/internal/config"
 	"github.com/mzyy94/airscap/internal/vens"
 )
 
@@ -102,7 +112,7 @@ func TestMapScanConfig_ColorModes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := abstract.ScannerRequest{ColorMode: tt.mode}
-			cfg := mapScanConfig(req, false)
+			cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 			if cfg.ColorMode != tt.wantVens {
 				t.Errorf("ColorMode = %d, want %d", cfg.ColorMode, tt.wantVens)
 			}
@@ -129,7 +139,7 @@ func TestMapScanConfig_Resolution(t *testing.T) {
 			req := abstract.ScannerRequest{
 				Resolution: abstract.Resolution{XResolution: tt.dpi, YResolution: tt.dpi},
 			}
-			cfg := mapScanConfig(req, false)
+			cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 			if cfg.Quality != tt.wantQ {
 				t.Errorf("Quality = %d, want %d", cfg.Quality, tt.wantQ)
 			}
@@ -140,21 +150,21 @@ func TestMapScanConfig_Resolution(t *testing.T) {
 func TestMapScanConfig_Duplex(t *testing.T) {
 	// Duplex
 	req := abstract.ScannerRequest{ADFMode: abstract.ADFModeDuplex}
-	cfg := mapScanConfig(req, false)
+	cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if !cfg.Duplex {
 		t.Error("Duplex = false, want true for ADFModeDuplex")
 	}
 
 	// Simplex
 	req = abstract.ScannerRequest{ADFMode: abstract.ADFModeSimplex}
-	cfg = mapScanConfig(req, false)
+	cfg = mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if cfg.Duplex {
 		t.Error("Duplex = true, want false for ADFModeSimplex")
 	}
 
 	// Unset
 	req = abstract.ScannerRequest{}
-	cfg = mapScanConfig(req, false)
+	cfg = mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if cfg.Duplex {
 		t.Error("Duplex = true, want false for ADFModeUnset")
 	}
@@ -177,7 +187,7 @@ func TestMapScanConfig_Threshold(t *testing.T) {
 				ColorMode: abstract.ColorModeBinary,
 				Threshold: optional.New(tt.val),
 			}
-			cfg := mapScanConfig(req, false)
+			cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 			if cfg.BWDensity != tt.wantBWD {
 				t.Errorf("BWDensity = %d, want %d", cfg.BWDensity, tt.wantBWD)
 			}
@@ -185,29 +195,73 @@ func TestMapScanConfig_Threshold(t *testing.T) {
 	}
 }
 
+func TestMapScanConfig_Compression(t *testing.T) {
+	tests := []struct {
+		name string
+		req  optional.Val[int]
+		want byte
+	}{
+		{"unset", nil, 0},
+		{"best quality", optional.New(1), 0x0D},
+		{"normal", optional.New(3), 0x0B},
+		{"most compressed", optional.New(5), 0x09},
+		{"out of range", optional.New(9), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := abstract.ScannerRequest{ColorMode: abstract.ColorModeColor, Compression: tt.req}
+			cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
+			if cfg.CompressionArg != tt.want {
+				t.Errorf("CompressionArg = 0x%02X, want 0x%02X", cfg.CompressionArg, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapScanConfig_BrightnessContrast(t *testing.T) {
+	tests := []struct {
+		name                 string
+		brightness, contrast optional.Val[int]
+		wantB, wantC         int
+	}{
+		{"unset", nil, nil, 0, 0},
+		{"set", optional.New(3), optional.New(-2), 3, -2},
+		{"clamped", optional.New(-9), optional.New(20), -5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := abstract.ScannerRequest{ColorMode: abstract.ColorModeColor, Brightness: tt.brightness, Contrast: tt.contrast}
+			cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
+			if cfg.Brightness != tt.wantB || cfg.Contrast != tt.wantC {
+				t.Errorf("Brightness, Contrast = %d, %d, want %d, %d", cfg.Brightness, cfg.Contrast, tt.wantB, tt.wantC)
+			}
+		})
+	}
+}
+
 func TestMapScanConfig_NoThreshold(t *testing.T) {
 	req := abstract.ScannerRequest{ColorMode: abstract.ColorModeBinary}
-	cfg := mapScanConfig(req, false)
+	cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if cfg.BWDensity != 0 {
 		t.Errorf("BWDensity = %d, want 0 when no threshold set", cfg.BWDensity)
 	}
 }
 
 func TestMapScanConfig_RegionToPaper(t *testing.T) {
-	// Specific region → paper override
+	// Non-standard region → paper override
 	req := abstract.ScannerRequest{
 		Region: abstract.Region{
-			Width:  210 * abstract.Millimeter,
-			Height: 297 * abstract.Millimeter,
+			Width:  200 * abstract.Millimeter,
+			Height: 250 * abstract.Millimeter,
 		},
 	}
-	cfg := mapScanConfig(req, false)
+	cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if cfg.PaperWidth == 0 || cfg.PaperHeight == 0 {
 		t.Error("expected paper override for specific region, got 0")
 	}
-	// Verify conversion: 210mm → 1/1200 inch
-	expectedW := dimToInch1200(210 * abstract.Millimeter)
-	expectedH := dimToInch1200(297 * abstract.Millimeter)
+	// Verify conversion: 200mm → 1/1200 inch
+	expectedW := dimToInch1200(200 * abstract.Millimeter)
+	expectedH := dimToInch1200(250 * abstract.Millimeter)
 	if cfg.PaperWidth != expectedW {
 		t.Errorf("PaperWidth = %d, want %d", cfg.PaperWidth, expectedW)
 	}
@@ -216,6 +270,43 @@ func TestMapScanConfig_RegionToPaper(t *testing.T) {
 	}
 }
 
+func TestMapScanConfig_RegionToNamedPaper(t *testing.T) {
+	// Regions matching a named size (within 1mm) select it and scan at its
+	// exact dimensions
+	tests := []struct {
+		name          string
+		width, height abstract.Dimension
+		want          vens.PaperSize
+	}{
+		{"A4", 210 * abstract.Millimeter, 297 * abstract.Millimeter, vens.PaperA4},
+		{"A5", 148 * abstract.Millimeter, 210 * abstract.Millimeter, vens.PaperA5},
+		{"A6", 105 * abstract.Millimeter, 148 * abstract.Millimeter, vens.PaperA6},
+		{"B5", 182 * abstract.Millimeter, 257 * abstract.Millimeter, vens.PaperB5},
+		{"Postcard", 100 * abstract.Millimeter, 148 * abstract.Millimeter, vens.PaperPostcard},
+		{"Letter", 21590, 27940, vens.PaperLetter},
+		{"Legal", 21590, 35560, vens.PaperLegal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := abstract.ScannerRequest{Region: abstract.Region{Width: tt.width, Height: tt.height}}
+			cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
+			if cfg.PaperSize != tt.want {
+				t.Errorf("PaperSize = %d, want %d", cfg.PaperSize, tt.want)
+			}
+			// The wire config has auto-detect off and the size's dimensions
+			pkt := vens.MarshalScanConfig([8]byte{}, cfg)
+			c := 64
+			if pkt[c+2] != 0x00 || pkt[c+3] != 0x00 || pkt[c+5] != 0x00 {
+				t.Errorf("auto-detect flags = %02X %02X %02X, want fixed size", pkt[c+2], pkt[c+3], pkt[c+5])
+			}
+			dim := vens.PaperDimensions[tt.want]
+			if w, h := binary.BigEndian.Uint16(pkt[c+44:]), binary.BigEndian.Uint16(pkt[c+48:]); w != dim.Width || h != dim.Height {
+				t.Errorf("wire paper = %dx%d, want %dx%d", w, h, dim.Width, dim.Height)
+			}
+		})
+	}
+}
+
 func TestMapScanConfig_MaxRegionIsAuto(t *testing.T) {
 	// Region >= max scan area (216mm × 360mm) → treated as auto, no override
 	req := abstract.ScannerRequest{
@@ -224,7 +315,7 @@ func TestMapScanConfig_MaxRegionIsAuto(t *testing.T) {
 			Height: 360 * abstract.Millimeter,
 		},
 	}
-	cfg := mapScanConfig(req, false)
+	cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if cfg.PaperWidth != 0 || cfg.PaperHeight != 0 {
 		t.Errorf("max region should not set paper override: width=%d, height=%d",
 			cfg.PaperWidth, cfg.PaperHeight)
@@ -233,7 +324,7 @@ func TestMapScanConfig_MaxRegionIsAuto(t *testing.T) {
 
 func TestMapScanConfig_ZeroRegionIsAuto(t *testing.T) {
 	req := abstract.ScannerRequest{} // zero region
-	cfg := mapScanConfig(req, false)
+	cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 	if cfg.PaperWidth != 0 || cfg.PaperHeight != 0 {
 		t.Errorf("zero region should not set paper override: width=%d, height=%d",
 			cfg.PaperWidth, cfg.PaperHeight)
@@ -248,16 +339,122 @@ func TestMapScanConfig_AirscanForcePaperAuto(t *testing.T) {
 			Height: 297 * abstract.Millimeter,
 		},
 	}
-	cfg := mapScanConfig(req, true)
+	cfg := mapScanConfig(req, config.Settings{AirscanForcePaperAuto: true}, ScanOverrides{})
 	if cfg.PaperWidth != 0 || cfg.PaperHeight != 0 {
 		t.Errorf("forcePaperAuto should skip paper override: width=%d, height=%d",
 			cfg.PaperWidth, cfg.PaperHeight)
 	}
 }
 
+func TestMapScanConfig_AirscanForceColorMode(t *testing.T) {
+	req := abstract.ScannerRequest{ColorMode: abstract.ColorModeColor}
+	tests := []struct {
+		force string
+		want  vens.ColorMode
+	}{
+		{"", vens.ColorColor},
+		{"auto", vens.ColorAuto},
+		{"color", vens.ColorColor},
+		{"grayscale", vens.ColorGray},
+		{"bw", vens.ColorBW},
+	}
+	for _, tt := range tests {
+		cfg := mapScanConfig(req, config.Settings{AirscanForceColorMode: tt.force}, ScanOverrides{})
+		if cfg.ColorMode != tt.want {
+			t.Errorf("force %q: ColorMode = %v, want %v", tt.force, cfg.ColorMode, tt.want)
+		}
+	}
+}
+
+func TestAdvertiseColorModes(t *testing.T) {
+	store := config.NewMemoryStore()
+	a := NewESCLAdapter(newTestScanner(nil), 8080, store)
+	modes := func() []escl.ColorMode {
+		caps := escl.FromAbstractScannerCapabilities(escl.MakeVersion(2, 63), a.Capabilities())
+		a.AdvertiseColorModes(caps)
+		var out []escl.ColorMode
+		for _, p := range caps.ADF.ADFDuplexInputCaps.SettingProfiles {
+			out = append(out, p.ColorModes...)
+		}
+		return out
+	}
+
+	if got := modes(); len(got) != 3 {
+		t.Errorf("no forced mode: advertised %v, want all three modes", got)
+	}
+	s := store.Get()
+	s.AirscanForceColorMode = "auto"
+	store.Update(s)
+	if got := modes(); len(got) != 3 {
+		t.Errorf("forced auto: advertised %v, want all three modes", got)
+	}
+	s.AirscanForceColorMode = "bw"
+	store.Update(s)
+	if got := modes(); len(got) != 1 || got[0] != escl.BlackAndWhite1 {
+		t.Errorf("forced bw: advertised %v, want [BlackAndWhite1]", got)
+	}
+}
+
+func TestMapScanConfig_MaxResolution(t *testing.T) {
+	tests := []struct {
+		max   int
+		dpi   int
+		wantQ vens.Quality
+	}{
+		{0, 300, vens.QualitySuperFine},
+		{300, 300, vens.QualitySuperFine},
+		{200, 300, vens.QualityFine},
+		{200, 150, vens.QualityNormal},
+		{200, 0, vens.QualityFine}, // auto could pick 300
+		{250, 300, vens.QualityFine},
+		{150, 200, vens.QualityNormal},
+		{100, 200, vens.QualityNormal}, // the scanner's lowest
+	}
+	for _, tt := range tests {
+		req := abstract.ScannerRequest{Resolution: abstract.Resolution{XResolution: tt.dpi, YResolution: tt.dpi}}
+		cfg := mapScanConfig(req, config.Settings{MaxResolution: tt.max}, ScanOverrides{})
+		if cfg.Quality != tt.wantQ {
+			t.Errorf("max %d, request %d dpi: Quality = %d, want %d", tt.max, tt.dpi, cfg.Quality, tt.wantQ)
+		}
+	}
+}
+
+func TestAdvertiseMaxResolution(t *testing.T) {
+	store := config.NewMemoryStore()
+	a := NewESCLAdapter(newTestScanner(nil), 8080, store)
+	resolutions := func() []int {
+		caps := escl.FromAbstractScannerCapabilities(escl.MakeVersion(2, 63), a.Capabilities())
+		a.AdvertiseMaxResolution(caps)
+		var out []int
+		for _, p := range caps.ADF.ADFSimplexInputCaps.SettingProfiles {
+			for _, sr := range p.SupportedResolutions {
+				for _, r := range sr.DiscreteResolutions {
+					out = append(out, r.XResolution)
+				}
+			}
+		}
+		return out
+	}
+
+	if got := resolutions(); slices.Max(got) != 300 {
+		t.Errorf("no cap: advertised %v, want up to 300 dpi", got)
+	}
+	s := store.Get()
+	s.MaxResolution = 200
+	store.Update(s)
+	if got := resolutions(); len(got) != 6 || slices.Max(got) != 200 {
+		t.Errorf("cap 200: advertised %v, want 150 and 200 dpi per profile", got)
+	}
+	s.MaxResolution = 100
+	store.Update(s)
+	if got := resolutions(); len(got) != 3 || slices.Max(got) != 150 {
+		t.Errorf("cap 100: advertised %v, want only 150 dpi per profile", got)
+	}
+}
+
 func TestMapScanConfig_Defaults(t *testing.T) {
 	req := abstract.ScannerRequest{}
-	cfg := mapScanConfig(req, false)
+	cfg := mapScanConfig(req, config.Settings{}, ScanOverrides{})
 
 	// mapScanConfig starts from DefaultScanConfig()
 	if !cfg.MultiFeed {
@@ -269,6 +466,68 @@ func TestMapScanConfig_Defaults(t *testing.T) {
 	if cfg.BleedThrough {
 		t.Error("BleedThrough should default to false")
 	}
+	if cfg.StartTimeout != InteractiveStartTimeout {
+		t.Errorf("StartTimeout = %v, want %v", cfg.StartTimeout, InteractiveStartTimeout)
+	}
+}
+
+func TestMapScanConfig_OverridePrecedence(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name      string
+		settings  config.Settings
+		ov        ScanOverrides
+		wantBlank bool
+		wantBleed bool
+	}{
+		{"default", config.Settings{}, ScanOverrides{}, true, false},
+		{"settings", config.Settings{AirscanBleedThrough: true}, ScanOverrides{}, true, true},
+		{"request over default", config.Settings{}, ScanOverrides{BlankPageRemoval: &off, BleedThrough: &on}, false, true},
+		{"request over settings", config.Settings{AirscanBleedThrough: true}, ScanOverrides{BleedThrough: &off}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mapScanConfig(abstract.ScannerRequest{}, tt.settings, tt.ov)
+			if cfg.BlankPageRemoval != tt.wantBlank || cfg.BleedThrough != tt.wantBleed {
+				t.Errorf("BlankPageRemoval, BleedThrough = %v, %v, want %v, %v",
+					cfg.BlankPageRemoval, cfg.BleedThrough, tt.wantBlank, tt.wantBleed)
+			}
+		})
+	}
+}
+
+func TestMapScanConfig_AirscanBWDensity(t *testing.T) {
+	s := config.Settings{AirscanBWDensity: 3}
+	if cfg := mapScanConfig(abstract.ScannerRequest{}, s, ScanOverrides{}); cfg.BWDensity != 3 {
+		t.Errorf("BWDensity = %d, want setting 3", cfg.BWDensity)
+	}
+	req := abstract.ScannerRequest{Threshold: optional.New(-2)}
+	if cfg := mapScanConfig(req, s, ScanOverrides{}); cfg.BWDensity != -2 {
+		t.Errorf("BWDensity = %d, want request threshold -2", cfg.BWDensity)
+	}
+}
+
+func TestMapScanConfig_DefaultDuplex(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          abstract.ADFMode
+		defaultDuplex bool
+		want          bool
+	}{
+		{"unset, default simplex", abstract.ADFModeUnset, false, false},
+		{"unset, default duplex", abstract.ADFModeUnset, true, true},
+		{"simplex overrides default", abstract.ADFModeSimplex, true, false},
+		{"duplex without default", abstract.ADFModeDuplex, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := abstract.ScannerRequest{ADFMode: tt.mode}
+			cfg := mapScanConfig(req, config.Settings{DefaultDuplex: tt.defaultDuplex}, ScanOverrides{})
+			if cfg.Duplex != tt.want {
+				t.Errorf("Duplex = %v, want %v", cfg.Duplex, tt.want)
+			}
+		})
+	}
 }
 
 // --------------------------------------------------------------------------
@@ -352,6 +611,12 @@ func TestBuildCapabilities_WithScanParams(t *testing.T) {
 	if caps.ThresholdRange.Min != -5 || caps.ThresholdRange.Max != 5 {
 		t.Errorf("ThresholdRange = [%d, %d], want [-5, 5]", caps.ThresholdRange.Min, caps.ThresholdRange.Max)
 	}
+	if caps.BrightnessRange.Min != -5 || caps.BrightnessRange.Max != 5 {
+		t.Errorf("BrightnessRange = [%d, %d], want [-5, 5]", caps.BrightnessRange.Min, caps.BrightnessRange.Max)
+	}
+	if caps.ContrastRange.Min != -5 || caps.ContrastRange.Max != 5 {
+		t.Errorf("ContrastRange = [%d, %d], want [-5, 5]", caps.ContrastRange.Min, caps.ContrastRange.Max)
+	}
 
 	// ADF capacity
 	if caps.ADFCapacity != 50 {
@@ -359,7 +624,7 @@ func TestBuildCapabilities_WithScanParams(t *testing.T) {
 	}
 
 	// Document formats
-	expectedFormats := []string{"image/jpeg", "image/tiff", "application/pdf"}
+	expectedFormats := []string{"image/jpeg", "image/tiff", "image/png", "application/pdf"}
 	if len(caps.DocumentFormats) != len(expectedFormats) {
 		t.Errorf("DocumentFormats count = %d, want %d", len(caps.DocumentFormats), len(expectedFormats))
 	}
@@ -370,6 +635,28 @@ func TestBuildCapabilities_WithScanParams(t *testing.T) {
 	}
 }
 
+func TestBuildCapabilities_UUIDStableAcrossHosts(t *testing.T) {
+	s := newTestScanner(nil)
+	a := &ESCLAdapter{scanner: s, listenPort: 8080}
+	before := a.buildCapabilities().UUID
+
+	s.host = "192.168.5.42"
+	if after := a.buildCapabilities().UUID; after != before {
+		t.Errorf("UUID changed with host: %v → %v", before, after)
+	}
+
+	// Without a serial the host identifies the device
+	s.serial = ""
+	byHost := a.buildCapabilities().UUID
+	if byHost == before {
+		t.Error("UUID without serial equals the serial-based UUID")
+	}
+	s.host = "192.168.5.3"
+	if a.buildCapabilities().UUID == byHost {
+		t.Error("host-based UUID did not change with host")
+	}
+}
+
 func TestBuildCapabilities_NilScanParams(t *testing.T) {
 	s := newTestScanner(nil)
 	a := &ESCLAdapter{scanner: s, listenPort: 8080}
@@ -410,6 +697,45 @@ func TestBuildCapabilities_EmptyName(t *testing.T) {
 	}
 }
 
+func TestBuildCapabilities_ProfilesPerColorMode(t *testing.T) {
+	s := newTestScanner(nil)
+	a := &ESCLAdapter{scanner: s, listenPort: 8080}
+	caps := a.buildCapabilities()
+
+	profiles := caps.ADFSimplex.Profiles
+	if len(profiles) != 3 {
+		t.Fatalf("profiles count = %d, want 3", len(profiles))
+	}
+
+	tests := []struct {
+		mode      abstract.ColorMode
+		depth     abstract.ColorDepth
+		rendering abstract.BinaryRendering
+	}{
+		{abstract.ColorModeBinary, abstract.ColorDepthUnset, abstract.BinaryRenderingThreshold},
+		{abstract.ColorModeMono, abstract.ColorDepth8, abstract.BinaryRenderingUnset},
+		{abstract.ColorModeColor, abstract.ColorDepth8, abstract.BinaryRenderingUnset},
+	}
+	for i, tt := range tests {
+		p := profiles[i]
+		if p.ColorModes != generic.MakeBitset(tt.mode) {
+			t.Errorf("profile[%d] color modes = %v, want only %v", i, p.ColorModes, tt.mode)
+		}
+		if !p.AllowsColorMode(tt.mode, tt.depth, tt.rendering) {
+			t.Errorf("profile[%d] rejects %v/%v/%v", i, tt.mode, tt.depth, tt.rendering)
+		}
+		if p.AllowsColorMode(tt.mode, abstract.ColorDepth16, abstract.BinaryRenderingHalftone) {
+			t.Errorf("profile[%d] allows unsupported depth/rendering for %v", i, tt.mode)
+		}
+		if len(p.Resolutions) != 3 {
+			t.Errorf("profile[%d] resolutions count = %d, want 3", i, len(p.Resolutions))
+		}
+	}
+	if profiles[0].Depths.Contains(abstract.ColorDepth8) {
+		t.Error("binary profile should not advertise an 8-bit depth")
+	}
+}
+
 func TestBuildCapabilities_SimplexDuplexSame(t *testing.T) {
 	s := newTestScanner(nil)
 	a := &ESCLAdapter{scanner: s, listenPort: 8080}
@@ -420,3 +746,117 @@ func TestBuildCapabilities_SimplexDuplexSame(t *testing.T) {
 		t.Error("ADFSimplex and ADFDuplex should share same capabilities")
 	}
 }
+
+func TestBuildCapabilities_SimplexOnlyModel(t *testing.T) {
+	s := newTestScanner(nil)
+	s.deviceName = "FUJITSU ScanSnap iX100"
+	s.model = vens.ModelFromDeviceName(s.deviceName)
+	a := &ESCLAdapter{scanner: s, listenPort: 8080}
+	caps := a.buildCapabilities()
+
+	if caps.ADFDuplex != nil {
+		t.Error("ADFDuplex advertised for the simplex-only iX100")
+	}
+	if caps.ADFSimplex == nil {
+		t.Error("ADFSimplex missing for the iX100")
+	}
+	if caps.ADFCapacity != 1 {
+		t.Errorf("ADFCapacity = %d, want 1 for the sheet-fed iX100", caps.ADFCapacity)
+	}
+}
+
+// --------------------------------------------------------------------------
+// Request validation tests
+// --------------------------------------------------------------------------
+
+func TestScan_UnsupportedInputSource(t *testing.T) {
+	s := newTestScanner(nil)
+	a := NewESCLAdapter(s, 8080, nil)
+	if a.Capabilities().Platen != nil {
+		t.Fatal("capabilities advertise a platen")
+	}
+
+	tests := []struct {
+		input abstract.Input
+		want  string
+	}{
+		{abstract.InputPlaten, "input source Platen is not supported: this scanner only has a document feeder (Feeder)"},
+		{abstract.InputCamera, "input source Camera is not supported: use Feeder"},
+	}
+	for _, tt := range tests {
+		// Validation must fail before the adapter dials the scanner
+		doc, err := a.Scan(context.Background(), abstract.ScannerRequest{Input: tt.input})
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) {
+			t.Fatalf("Input %v: err = %v (%T), want *RequestError", tt.input, err, err)
+		}
+		if doc != nil {
+			t.Errorf("Input %v: document = %v, want nil", tt.input, doc)
+		}
+		if err.Error() != tt.want {
+			t.Errorf("Input %v: err = %q, want %q", tt.input, err, tt.want)
+		}
+		if !errors.Is(err, abstract.ErrUnsupportedParam) && !errors.Is(err, abstract.ErrInvalidParam) {
+			t.Errorf("Input %v: err does not wrap the abstract parameter error", tt.input)
+		}
+	}
+	if a.scanning {
+		t.Error("rejected request started a scan session")
+	}
+}
+
+// --------------------------------------------------------------------------
+// Color space tests
+// --------------------------------------------------------------------------
+
+func TestAdvertiseColorSpace_MatchesEmbeddedProfile(t *testing.T) {
+	store := config.NewMemoryStore()
+	a := NewESCLAdapter(newTestScanner(nil), 8080, store)
+	spaces := func() [][]escl.ColorSpace {
+		caps := escl.FromAbstractScannerCapabilities(escl.MakeVersion(2, 63), a.Capabilities())
+		a.AdvertiseColorSpace(caps)
+		var out [][]escl.ColorSpace
+		for _, in := range []*escl.InputSourceCaps{caps.ADF.ADFSimplexInputCaps, caps.ADF.ADFDuplexInputCaps} {
+			for _, p := range in.SettingProfiles {
+				out = append(out, p.ColorSpaces)
+			}
+		}
+		return out
+	}
+
+	for i, cs := range spaces() {
+		if len(cs) != 1 || cs[0] != escl.SRGB {
+			t.Errorf("profile %d: color spaces = %v, want [sRGB]", i, cs)
+		}
+	}
+	page := noisyJPEG(t, 64, 48)
+	tagged := tagSRGB(page)
+	profile := jpegICCProfile(tagged)
+	if !bytes.Equal(profile, srgbProfile()) {
+		t.Fatal("tagged JPEG does not carry the sRGB profile")
+	}
+	if string(profile[16:20]) != "RGB " || !bytes.Contains(profile, []byte("sRGB IEC61966-2.1")) {
+		t.Errorf("embedded profile is not an sRGB profile: %q", profile[:40])
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(tagged)); err != nil {
+		t.Errorf("tagged JPEG does not decode: %v", err)
+	}
+	if again := tagSRGB(tagged); !bytes.Equal(again, tagged) {
+		t.Error("tagging twice embeds a second profile")
+	}
+
+	var gray bytes.Buffer
+	jpeg.Encode(&gray, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	if out := tagSRGB(gray.Bytes()); jpegICCProfile(out) != nil {
+		t.Error("grayscale JPEG tagged with an RGB profile")
+	}
+
+	s := store.Get()
+	s.AirscanColorSpace = ColorSpaceRaw
+	store.Update(s)
+	for i, cs := range spaces() {
+		if cs != nil {
+			t.Errorf("raw: profile %d: color spaces = %v, want none", i, cs)
+		}
+	}
+}
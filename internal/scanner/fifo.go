@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// errNoFIFOReader is returned when a scan is written to a named pipe that no
+// process has open for reading.
+var errNoFIFOReader = errors.New("no process is reading from the FIFO")
+
+// fifoWriteTimeout bounds how long a reader may take to drain a document
+// from the pipe before the delivery fails.
+var fifoWriteTimeout = time.Minute
+
+// RunFIFOJob executes a scan and writes the result as a single PDF to the
+// named pipe at Settings.FIFOPath, so a local process can consume scans as
+// they are made. Each document is written with its own open and close, so
+// the reader sees end of file after every scan. The format of s is ignored.
+// The generated document is recorded in status (which may be nil).
+func RunFIFOJob(sc PageSource, cfg vens.ScanConfig, s config.Settings, status *ScanJobStatus) (int, error) {
+	slog.Info("button scan starting (FIFO)", "path", s.FIFOPath)
+	return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, "application/pdf", s, status, func(files []outputFile) error {
+		f := files[0]
+		if err := writeFIFO(s.FIFOPath, f.Data); err != nil {
+			return err
+		}
+		slog.Info("scan written to FIFO", "path", s.FIFOPath, "bytes", len(f.Data))
+		return nil
+	})
+}
+
+// writeFIFO writes data to the named pipe at path. Opening a FIFO for
+// writing blocks until a reader opens the other end, which would hang the
+// job, so it is opened non-blocking instead and fails at once with
+// errNoFIFOReader when there is no reader. The pipe is not created: a
+// regular file at path is an error rather than silently filling the disk.
+func writeFIFO(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("fifo: %w", err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("fifo: %s is not a named pipe", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return fmt.Errorf("fifo %s: %w", path, errNoFIFOReader)
+	}
+	if err != nil {
+		return fmt.Errorf("fifo: %w", err)
+	}
+	// The write waits while the pipe is full; a reader that stops reading
+	// must not block the job forever
+	f.SetWriteDeadline(time.Now().Add(fifoWriteTimeout))
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("fifo %s: write: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func TestRunFIFOJob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scans.fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Skip("mkfifo not available:", err)
+	}
+	setSaveRetryDelay(t, 10*time.Millisecond)
+
+	// Without a reader the write fails at once instead of blocking
+	if err := writeFIFO(path, []byte("%PDF")); !errors.Is(err, errNoFIFOReader) {
+		t.Fatalf("writeFIFO() without a reader = %v, want errNoFIFOReader", err)
+	}
+
+	got := make(chan []byte, 1)
+	go func() {
+		f, err := os.Open(path) // blocks until the job opens the pipe
+		if err != nil {
+			got <- nil
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		got <- data
+	}()
+
+	// The job retries until the reader has the pipe open
+	s := config.Settings{SaveType: "fifo", FIFOPath: path, Format: "image/jpeg", SaveRetries: 100}
+	pages := []vens.Page{{JPEG: noisyJPEG(t, 32, 32)}, {Sheet: 1, JPEG: noisyJPEG(t, 32, 32)}}
+	status := &ScanJobStatus{}
+	n, target, err := RunDestinationJob(NewStagedPages(pages, "", ""), vens.DefaultScanConfig(), s, status)
+	if err != nil || n != 2 || target != path {
+		t.Fatalf("RunDestinationJob() = %d, %q, %v", n, target, err)
+	}
+	select {
+	case data := <-got:
+		if !bytes.HasPrefix(data, []byte("%PDF")) || !bytes.Contains(data, []byte("%%EOF")) {
+			t.Errorf("reader got %d bytes, want the whole PDF", len(data))
+		}
+		if doc := status.Snapshot().Document; doc == "" {
+			t.Error("the written PDF was not recorded in the job status")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader got nothing")
+	}
+
+	// A regular file is not written to
+	file := filepath.Join(t.TempDir(), "scans.pdf")
+	os.WriteFile(file, nil, 0644)
+	if err := writeFIFO(file, []byte("%PDF")); err == nil {
+		t.Error("writeFIFO() to a regular file succeeded")
+	}
+}
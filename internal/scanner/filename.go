@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// scanSource identifies the scanner a button scan came from, for file names.
+type scanSource struct {
+	Serial string
+	Host   string
+}
+
+// sourceOf returns the identity of sc used in file names.
+func sourceOf(sc PageSource) scanSource {
+	return scanSource{Serial: sc.Serial(), Host: sc.Host()}
+}
+
+// fileNamer names the files of one button scan. Without a template, pages
+// are named "<base>_001.jpg" and documents "<base>.pdf" (see scanBaseName);
+// otherwise Settings.FilenameTemplate is expanded, where these placeholders
+// are replaced:
+//
+//	{date}      scan date, 2006-01-02
+//	{time}      scan time, 150405
+//	{datetime}  both, 20060102_150405
+//	{n}         page number, 001 (1 for a PDF or multi-page TIFF); added as
+//	            "_{n}" to page names when the template has none, so pages do
+//	            not overwrite each other
+//	{total}     number of pages in the scan
+//	{host}      scanner host name or IP address
+//	{serial}    scanner serial number
+//	{ext}       file extension; appended when the template has none
+//
+// A "/" in the template creates subdirectories in the destination.
+type fileNamer struct {
+	template string
+	base     string
+	src      scanSource
+	time     time.Time
+}
+
+// newFileNamer returns the namer for a scan from src started at t.
+func newFileNamer(src scanSource, s config.Settings, t time.Time) fileNamer {
+	return fileNamer{
+		template: strings.TrimSpace(s.FilenameTemplate),
+		base:     scanBaseName(src.Serial, s, t),
+		src:      src,
+		time:     t,
+	}
+}
+
+// needsTotal reports whether names depend on the page count, which is only
+// known once the scan has finished.
+func (f fileNamer) needsTotal() bool {
+	return strings.Contains(f.template, "{total}")
+}
+
+// page returns the file name of the n-th of total pages.
+func (f fileNamer) page(n, total int, ext string) string {
+	name := f.expand(f.template, n, total, ext)
+	if name == "" {
+		return fmt.Sprintf("%s_%03d.%s", f.base, n, ext)
+	}
+	if !strings.Contains(f.template, "{n}") {
+		name = f.expand(numbered(f.template), n, total, ext)
+	}
+	return name
+}
+
+// numbered adds "_{n}" to tmpl, before its extension if it names one.
+func numbered(tmpl string) string {
+	if i := strings.LastIndex(tmpl, ".{ext}"); i >= 0 {
+		return tmpl[:i] + "_{n}" + tmpl[i:]
+	}
+	return tmpl + "_{n}"
+}
+
+// document returns the file name of a document holding all total pages.
+func (f fileNamer) document(total int, ext string) string {
+	if name := f.expand(f.template, 1, total, ext); name != "" {
+		return name
+	}
+	return f.base + "." + ext
+}
+
+// expand fills in tmpl. Each path element is sanitized with
+// sanitizeFilenamePart, and empty, "." and ".." elements are dropped so the
+// name stays inside the destination. It returns "" without a template or
+// when nothing is left.
+func (f fileNamer) expand(tmpl string, n, total int, ext string) string {
+	if tmpl == "" {
+		return ""
+	}
+	if !strings.Contains(tmpl, "{ext}") {
+		tmpl += ".{ext}"
+	}
+	name := strings.NewReplacer(
+		"{datetime}", f.time.Format("20060102_150405"),
+		"{date}", f.time.Format("2006-01-02"),
+		"{time}", f.time.Format("150405"),
+		"{n}", fmt.Sprintf("%03d", n),
+		"{total}", strconv.Itoa(total),
+		// Values must not add path elements of their own
+		"{host}", sanitizeFilenamePart(f.src.Host),
+		"{serial}", sanitizeFilenamePart(f.src.Serial),
+		"{ext}", ext,
+	).Replace(strings.ReplaceAll(tmpl, `\`, "/"))
+
+	var elems []string
+	for _, e := range strings.Split(name, "/") {
+		e = sanitizeFilenamePart(e)
+		if e == "" || e == "." || e == ".." || strings.Trim(e, "-") == "" {
+			continue
+		}
+		elems = append(elems, e)
+	}
+	if len(elems) == 0 || strings.HasPrefix(elems[len(elems)-1], ".") {
+		return ""
+	}
+	return path.Join(elems...)
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func TestFileNamer(t *testing.T) {
+	ts := time.Date(2026, 3, 9, 14, 5, 7, 0, time.Local)
+	ix500 := scanSource{Serial: "iX500-A1B2", Host: "192.168.5.3"}
+	tests := []struct {
+		template string
+		src      scanSource
+		n, total int
+		ext      string
+		page     string
+		document string
+	}{
+		{"", ix500, 2, 3, "jpg", "scan_20260309_140507_002.jpg", "scan_20260309_140507.jpg"},
+		{"{date}/{host}/page-{n}", ix500, 2, 3, "jpg", "2026-03-09/192.168.5.3/page-002.jpg", "2026-03-09/192.168.5.3/page-001.jpg"},
+		{"{serial}_{datetime}_{n}of{total}.{ext}", ix500, 1, 5, "tiff", "iX500-A1B2_20260309_140507_001of5.tiff", "iX500-A1B2_20260309_140507_001of5.tiff"},
+		{"{time}-{ext}", ix500, 4, 4, "pdf", "140507-pdf_004", "140507-pdf"},
+		// Pages get a number when the template has none
+		{"{datetime}", ix500, 2, 3, "jpg", "20260309_140507_002.jpg", "20260309_140507.jpg"},
+		{"scans/{date}.{ext}", ix500, 1, 3, "png", "scans/2026-03-09_001.png", "scans/2026-03-09.png"},
+		// Path elements cannot climb out of the destination
+		{"../{date}//./{n}", ix500, 7, 9, "png", "2026-03-09/007.png", "2026-03-09/001.png"},
+		{`C:\scans\{n}`, ix500, 1, 1, "jpg", "C-/scans/001.jpg", "C-/scans/001.jpg"},
+		// Placeholders do not add path elements
+		{"{host}/{n}", scanSource{Host: "a/b"}, 1, 1, "jpg", "a-b/001.jpg", "a-b/001.jpg"},
+		// Nothing usable left: fall back to the default scheme
+		{"../{serial}", scanSource{}, 3, 3, "jpg", "scan_20260309_140507_003.jpg", "scan_20260309_140507.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			f := newFileNamer(tt.src, config.Settings{FilenameTemplate: tt.template}, ts)
+			if got := f.page(tt.n, tt.total, tt.ext); got != tt.page {
+				t.Errorf("page(%d, %d) = %q, want %q", tt.n, tt.total, got, tt.page)
+			}
+			if got := f.document(tt.total, tt.ext); got != tt.document {
+				t.Errorf("document(%d) = %q, want %q", tt.total, got, tt.document)
+			}
+		})
+	}
+}
+
+func TestFilenameTemplateCreatesDirectories(t *testing.T) {
+	dir := t.TempDir()
+	pages := []vens.Page{{JPEG: []byte("a")}, {JPEG: []byte("b")}}
+	scan := func(onPage func(vens.Page) error) error { return feedPages(onPage, pages, nil) }
+	s := config.Settings{FilenameTemplate: "{date}/{host}/page-{n}"}
+	src := scanSource{Host: "192.168.5.3"}
+
+	n, err := runStreamingJob(scan, src, vens.DefaultScanConfig(), "image/jpeg", s, nil, localStore{dir: dir}, 1)
+	if err != nil || n != len(pages) {
+		t.Fatalf("runStreamingJob() = %d, %v", n, err)
+	}
+	sub := filepath.Join(dir, time.Now().Format("2006-01-02"), "192.168.5.3")
+	for i, want := range []string{"a", "b"} {
+		name := filepath.Join(sub, []string{"page-001.jpg", "page-002.jpg"}[i])
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("page %d not saved: %v", i+1, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+
+	// Removing an incomplete scan finds the files in their directories
+	store := localStore{dir: dir}
+	if err := store.remove(time.Now().Format("2006-01-02") + "/192.168.5.3/page-001.jpg"); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+)
+
+// encodeG4 encodes a bilevel image from toBitonalPNG (color index 1 is
+// black) as CCITT Group 4 (ITU-T T.6), MSB first and terminated by EOFB.
+// Each row is coded against the row above it, so text pages, whose rows
+// mostly repeat, come out far smaller than with Flate.
+func encodeG4(img *image.Paletted) []byte {
+	b := img.Bounds()
+	width := b.Dx()
+	var w g4Writer
+	ref := make([]byte, width) // imaginary white line above the first row
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cur := img.Pix[img.PixOffset(b.Min.X, y):][:width]
+		a0, black := 0, false
+		a1 := g4NextChange(cur, 0, false)
+		b1 := g4NextChange(ref, 0, false)
+		for {
+			b2 := width
+			if b1 < width {
+				b2 = g4NextChange(ref, b1, ref[b1] != 0)
+			}
+			switch {
+			case b2 < a1:
+				w.code(g4Pass)
+				a0 = b2
+			case a1-b1 >= -3 && a1-b1 <= 3:
+				w.code(g4Vertical[a1-b1+3])
+				a0 = a1
+				black = !black
+			default:
+				a2 := width
+				if a1 < width {
+					a2 = g4NextChange(cur, a1, !black)
+				}
+				w.code(g4Horizontal)
+				w.run(a1-a0, black)
+				w.run(a2-a1, !black)
+				a0 = a2
+			}
+			if a0 >= width {
+				break
+			}
+			a1 = g4NextChange(cur, a0, black)
+			b1 = g4NextChange(ref, g4NextChange(ref, a0, !black), black)
+		}
+		ref = cur
+	}
+	w.code(g4EOL)
+	w.code(g4EOL)
+	return w.bytes()
+}
+
+// g4NextChange returns the first position from x on in row whose color is
+// not black (color index 1) or white as given, or len(row) if there is none.
+func g4NextChange(row []byte, x int, black bool) int {
+	for ; x < len(row); x++ {
+		if (row[x] != 0) != black {
+			return x
+		}
+	}
+	return len(row)
+}
+
+// g4Writer packs CCITT codes into bytes, most significant bit first.
+type g4Writer struct {
+	buf  []byte
+	bits byte
+	n    uint
+}
+
+// code appends a code given as a string of '0' and '1'.
+func (w *g4Writer) code(c string) {
+	for i := range len(c) {
+		w.bits = w.bits<<1 | (c[i] - '0')
+		if w.n++; w.n == 8 {
+			w.buf = append(w.buf, w.bits)
+			w.bits, w.n = 0, 0
+		}
+	}
+}
+
+// run appends the make-up and terminating codes for a run of n pixels.
+func (w *g4Writer) run(n int, black bool) {
+	codes := &g4WhiteCodes
+	if black {
+		codes = &g4BlackCodes
+	}
+	for ; n >= 2560; n -= 2560 {
+		w.code(codes[len(codes)-1])
+	}
+	if n >= 64 {
+		w.code(codes[63+n/64])
+		n %= 64
+	}
+	w.code(codes[n])
+}
+
+// bytes returns the packed codes, padding the last byte with zeros.
+func (w *g4Writer) bytes() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, w.bits<<(8-w.n))
+		w.bits, w.n = 0, 0
+	}
+	return w.buf
+}
+
+// T.6 mode codes. g4Vertical is indexed by a1-b1+3.
+const (
+	g4Pass       = "0001"
+	g4Horizontal = "001"
+	g4EOL        = "000000000001"
+)
+
+var g4Vertical = [7]string{"0000010", "000010", "010", "1", "011", "000011", "0000011"}
+
+// g4WhiteCodes and g4BlackCodes are the run length codes of T.4 tables 2
+// and 3: the terminating codes for 0-63, then the make-up codes for 64,
+// 128, ... 2560.
+var g4WhiteCodes = [104]string{
+	"00110101", "000111", "0111", "1000", "1011", "1100", "1110", "1111",
+	"10011", "10100", "00111", "01000", "001000", "000011", "110100", "110101",
+	"101010", "101011", "0100111", "0001100", "0001000", "0010111", "0000011", "0000100",
+	"0101000", "0101011", "0010011", "0100100", "0011000", "00000010", "00000011", "00011010",
+	"00011011", "00010010", "00010011", "00010100", "00010101", "00010110", "00010111", "00101000",
+	"00101001", "00101010", "00101011", "00101100", "00101101", "00000100", "00000101", "00001010",
+	"00001011", "01010010", "01010011", "01010100", "01010101", "00100100", "00100101", "01011000",
+	"01011001", "01011010", "01011011", "01001010", "01001011", "00110010", "00110011", "00110100",
+	"11011", "10010", "010111", "0110111", "00110110", "00110111", "01100100", "01100101",
+	"01101000", "01100111", "011001100", "011001101", "011010010", "011010011", "011010100", "011010101",
+	"011010110", "011010111", "011011000", "011011001", "011011010", "011011011", "010011000", "010011001",
+	"010011010", "011000", "010011011", "00000001000", "00000001100", "00000001101", "000000010010", "000000010011",
+	"000000010100", "000000010101", "000000010110", "000000010111", "000000011100", "000000011101", "000000011110", "000000011111",
+}
+
+var g4BlackCodes = [104]string{
+	"0000110111", "010", "11", "10", "011", "0011", "0010", "00011",
+	"000101", "000100", "0000100", "0000101", "0000111", "00000100", "00000111", "000011000",
+	"0000010111", "0000011000", "0000001000", "00001100111", "00001101000", "00001101100", "00000110111", "00000101000",
+	"00000010111", "00000011000", "000011001010", "000011001011", "000011001100", "000011001101", "000001101000", "000001101001",
+	"000001101010", "000001101011", "000011010010", "000011010011", "000011010100", "000011010101", "000011010110", "000011010111",
+	"000001101100", "000001101101", "000011011010", "000011011011", "000001010100", "000001010101", "000001010110", "000001010111",
+	"000001100100", "000001100101", "000001010010", "000001010011", "000000100100", "000000110111", "000000111000", "000000100111",
+	"000000101000", "000001011000", "000001011001", "000000101011", "000000101100", "000001011010", "000001100110", "000001100111",
+	"0000001111", "000011001000", "000011001001", "000001011011", "000000110011", "000000110100", "000000110101", "0000001101100",
+	"0000001101101", "0000001001010", "0000001001011", "0000001001100", "0000001001101", "0000001110010", "0000001110011", "0000001110100",
+	"0000001110101", "0000001110110", "0000001110111", "0000001010010", "0000001010011", "0000001010100", "0000001010101", "0000001011010",
+	"0000001011011", "0000001100100", "0000001100101", "00000001000", "00000001100", "00000001101", "000000010010", "000000010011",
+	"000000010100", "000000010101", "000000010110", "000000010111", "000000011100", "000000011101", "000000011110", "000000011111",
+}
+
+// g4Image is the CCITT G4 data of a bilevel page and its size in pixels.
+type g4Image struct {
+	data          []byte
+	width, height int
+}
+
+// embedG4 rewrites a PDF written by fpdf so that the image streams keyed in
+// images are embedded as CCITT G4. fpdf cannot embed CCITT data, so these
+// pages are registered as 1-bit PNG; fpdf copies the PNG data into the image
+// stream as is, which identifies the stream to replace. The objects are
+// written back in file order and the cross-reference table rebuilt.
+func embedG4(pdf []byte, images map[string]g4Image) ([]byte, error) {
+	if len(images) == 0 {
+		return pdf, nil
+	}
+	offsets, xrefOffset, err := parseXref(pdf)
+	if err != nil {
+		return nil, fmt.Errorf("G4: %w", err)
+	}
+	trailer := bytes.Index(pdf[xrefOffset:], []byte("trailer\n"))
+	startxref := bytes.LastIndex(pdf, []byte("startxref\n"))
+	if trailer < 0 || startxref < xrefOffset+trailer || len(offsets) < 2 {
+		return nil, fmt.Errorf("G4: trailer not found")
+	}
+	order := make([]int, 0, len(offsets)-1)
+	for n := 1; n < len(offsets); n++ {
+		order = append(order, n)
+	}
+	slices.SortFunc(order, func(a, b int) int { return offsets[a] - offsets[b] })
+
+	var buf bytes.Buffer
+	buf.Write(pdf[:offsets[order[0]]])
+	moved := make([]int, len(offsets))
+	for i, n := range order {
+		end := xrefOffset
+		if i+1 < len(order) {
+			end = offsets[order[i+1]]
+		}
+		moved[n] = buf.Len()
+		buf.Write(g4Object(pdf[offsets[n]:end], images))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(moved))
+	for _, off := range moved[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	buf.Write(pdf[xrefOffset+trailer : startxref])
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes(), nil
+}
+
+// g4Object returns obj, an image object written by fpdf, with its stream
+// replaced by the matching G4 data, or obj unchanged if there is none. The
+// image becomes DeviceGray, where the CCITT decoder writes black as 0.
+func g4Object(obj []byte, images map[string]g4Image) []byte {
+	head, dict, ok := bytes.Cut(obj, []byte("<<"))
+	start := bytes.Index(dict, []byte(">>\nstream\n"))
+	end := bytes.LastIndex(dict, []byte("\nendstream"))
+	if !ok || start < 0 || end < start || !bytes.Contains(dict[:start], []byte("/Subtype /Image")) {
+		return obj
+	}
+	img, ok := images[string(dict[start+len(">>\nstream\n"):end])]
+	if !ok {
+		return obj
+	}
+	var entries []string
+	for _, line := range strings.Split(string(dict[:start]), "\n") {
+		switch {
+		case strings.HasPrefix(line, "/ColorSpace"), strings.HasPrefix(line, "/Filter"),
+			strings.HasPrefix(line, "/DecodeParms"), strings.HasPrefix(line, "/Length"):
+			continue
+		}
+		entries = append(entries, line)
+	}
+	var out bytes.Buffer
+	out.Write(head)
+	fmt.Fprintf(&out, "<<%s\n/ColorSpace /DeviceGray\n/Filter /CCITTFaxDecode\n/DecodeParms <</K -1 /Columns %d /Rows %d>>\n/Length %d>>\nstream\n",
+		strings.Join(entries, "\n"), img.width, img.height, len(img.data))
+	out.Write(img.data)
+	out.Write(dict[end:])
+	return out.Bytes()
+}
@@ -0,0 +1,86 @@
+package scanner
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/ccitt"
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// decodeG4 decodes CCITT G4 data into a bilevel image from toBitonalPNG.
+func decodeG4(t *testing.T, data []byte, w, h int) *image.Paletted {
+	t.Helper()
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	if err := ccitt.DecodeIntoGray(gray, bytes.NewReader(data), ccitt.MSB, ccitt.Group4, nil); err != nil {
+		t.Fatalf("decode G4: %v", err)
+	}
+	return toBitonalPNG(gray)
+}
+
+func TestEncodeG4RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	noise := toBitonalPNG(image.NewGray(image.Rect(0, 0, 203, 57)))
+	for i := range noise.Pix {
+		noise.Pix[i] = uint8(rng.Intn(2))
+	}
+	// Runs longer than the 2560 make-up code, and a black first pixel
+	wide := toBitonalPNG(image.NewGray(image.Rect(0, 0, 5300, 4)))
+	for x := range 5300 {
+		wide.Pix[x] = 1
+		if x > 2700 {
+			wide.Pix[2*wide.Stride+x] = 1
+		}
+	}
+	text, err := tiff.Decode(bytes.NewReader(bilevelTIFF(t, 620, 400)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, img := range map[string]*image.Paletted{
+		"noise": noise,
+		"wide":  wide,
+		"white": toBitonalPNG(image.NewGray(image.Rect(0, 0, 100, 10))),
+		"text":  toBitonalPNG(text),
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := img.Bounds()
+			got := decodeG4(t, encodeG4(img), b.Dx(), b.Dy())
+			if !bytes.Equal(got.Pix, img.Pix) {
+				t.Error("decoded image differs from the encoded one")
+			}
+		})
+	}
+}
+
+func TestGeneratePDFG4(t *testing.T) {
+	data := bilevelTIFF(t, 620, 400)
+	img, err := tiff.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pdfa := range []bool{false, true} {
+		pdf, err := GeneratePDFWithOptions([]vens.Page{{JPEG: data}}, PDFOptions{DPI: 150, IsBW: true, BWEmbedding: BWEmbedG4, PDFA: pdfa})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := parseXref(pdf); err != nil {
+			t.Fatalf("PDF/A %v: %v", pdfa, err)
+		}
+		if !strings.Contains(string(pdf), "/Filter /CCITTFaxDecode\n/DecodeParms <</K -1 /Columns 620 /Rows 400>>") {
+			t.Fatalf("PDF/A %v: no CCITT image", pdfa)
+		}
+		_, rest, _ := strings.Cut(string(pdf), "/CCITTFaxDecode")
+		_, rest, _ = strings.Cut(rest, "stream\n")
+		stream, _, _ := strings.Cut(rest, "\nendstream")
+		got := decodeG4(t, []byte(stream), 620, 400)
+		if !bytes.Equal(got.Pix, toBitonalPNG(img).Pix) {
+			t.Errorf("PDF/A %v: embedded G4 image differs from the page", pdfa)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultHistoryLimit is the number of jobs kept by the scan history.
+const DefaultHistoryLimit = 50
+
+// HistoryEntry is the result of one scan job in the history.
+type HistoryEntry struct {
+	Time        string `json:"time"` // RFC3339
+	Pages       int    `json:"pages"`
+	Format      string `json:"format,omitempty"`
+	Destination string `json:"destination,omitempty"` // Settings.SaveType
+	Target      string `json:"target,omitempty"`      // path, host or URL the pages were saved to
+	Error       string `json:"error,omitempty"`
+}
+
+// JobHistory keeps the results of the most recent scan jobs, newest first,
+// persisted to history.json in the data directory.
+type JobHistory struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	limit   int
+	path    string
+}
+
+// NewJobHistory creates a history of the last limit jobs (DefaultHistoryLimit
+// if limit <= 0), loading the entries saved in dataDir. With an empty
+// dataDir the history is kept in memory only.
+func NewJobHistory(dataDir string, limit int) *JobHistory {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	h := &JobHistory{limit: limit}
+	if dataDir != "" {
+		h.path = filepath.Join(dataDir, "history.json")
+		h.load()
+	}
+	return h
+}
+
+// Add records a job result, dropping the oldest entries beyond the limit.
+func (h *JobHistory) Add(e HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append([]HistoryEntry{e}, h.entries...)
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[:h.limit]
+	}
+	if err := h.save(); err != nil {
+		slog.Warn("scan history save failed", "path", h.path, "err", err)
+	}
+}
+
+// Entries returns a copy of the history, newest first. It is safe to call
+// on a nil receiver.
+func (h *JobHistory) Entries() []HistoryEntry {
+	if h == nil {
+		return []HistoryEntry{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]HistoryEntry{}, h.entries...)
+}
+
+func (h *JobHistory) load() {
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return // no history yet
+	}
+	var entries []HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		slog.Warn("invalid scan history file, starting empty", "path", h.path, "err", err)
+		return
+	}
+	if len(entries) > h.limit {
+		entries = entries[:h.limit]
+	}
+	h.entries = entries
+}
+
+func (h *JobHistory) save() error {
+	if h.path == "" {
+		return nil // memory-only mode
+	}
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+func TestJobHistoryLimit(t *testing.T) {
+	h := NewJobHistory("", 3)
+	for i := 1; i <= 5; i++ {
+		h.Add(HistoryEntry{Pages: i})
+	}
+	var pages []int
+	for _, e := range h.Entries() {
+		pages = append(pages, e.Pages)
+	}
+	if want := []int{5, 4, 3}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v (newest first)", pages, want)
+	}
+}
+
+func TestJobHistoryPersists(t *testing.T) {
+	dir := t.TempDir()
+	want := []HistoryEntry{
+		{Time: "2026-03-09T14:06:00Z", Pages: 0, Format: "application/pdf", Destination: "ftp", Target: "nas.local", Error: "paper jam"},
+		{Time: "2026-03-09T14:05:07Z", Pages: 4, Format: "image/jpeg", Destination: "local", Target: "/scans"},
+	}
+	h := NewJobHistory(dir, 10)
+	h.Add(want[1])
+	h.Add(want[0])
+
+	if got := NewJobHistory(dir, 10).Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded history = %+v, want %+v", got, want)
+	}
+	// A smaller limit truncates the saved history on load
+	if got := NewJobHistory(dir, 1).Entries(); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("reloaded with limit 1 = %+v, want %+v", got, want[:1])
+	}
+
+	// A corrupt file starts an empty history
+	if err := os.WriteFile(filepath.Join(dir, "history.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewJobHistory(dir, 10).Entries(); len(got) != 0 {
+		t.Errorf("corrupt file: entries = %+v, want none", got)
+	}
+}
+
+func TestSetJobResultRecordsHistory(t *testing.T) {
+	status := &ScanJobStatus{}
+	if got := status.History(); got == nil || len(got) != 0 {
+		t.Errorf("History() without history = %#v, want empty", got)
+	}
+	status.SetHistory(NewJobHistory("", 0))
+	s := config.Settings{Format: "application/pdf", SaveType: "smb"}
+
+	status.SetJobResult(s, errors.New("disk full"), 2, "smb://nas/scans")
+	got := status.History()
+	if len(got) != 1 {
+		t.Fatalf("history has %d entries, want 1", len(got))
+	}
+	e := got[0]
+	if e.Time == "" || e.Pages != 2 || e.Format != "application/pdf" || e.Destination != "smb" || e.Target != "smb://nas/scans" || e.Error != "disk full" {
+		t.Errorf("entry = %+v", e)
+	}
+
+	// An ignored empty scan is not a job result
+	s.IgnoreEmptyScan = true
+	status.SetJobResult(s, errNoPages, 0, "")
+	if n := len(status.History()); n != 1 {
+		t.Errorf("history has %d entries after an ignored empty scan, want 1", n)
+	}
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/jpeg"
+)
+
+// Values of Settings.AirscanColorSpace.
+const (
+	ColorSpaceSRGB = "srgb" // advertise sRGB and tag color JPEG pages with an sRGB profile (default)
+	ColorSpaceRaw  = "raw"  // advertise no color space and leave pages untagged
+)
+
+// iccMarker identifies the JPEG APP2 segment carrying an ICC profile.
+const iccMarker = "ICC_PROFILE\x00"
+
+// tagSRGB embeds the sRGB profile into a color JPEG page. Grayscale JPEGs,
+// TIFF pages and JPEGs that already carry a profile are returned unchanged.
+func tagSRGB(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) || jpegICCProfile(data) != nil {
+		return data
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.ColorModel == color.GrayModel {
+		return data
+	}
+	return embedJPEGICCProfile(data, srgbProfile())
+}
+
+// embedJPEGICCProfile inserts profile as a single APP2 segment after the
+// JFIF/Exif application segments at the start of data. The profile must be
+// smaller than 64 KiB.
+func embedJPEGICCProfile(data, profile []byte) []byte {
+	pos := 2 // after SOI
+	for pos+4 <= len(data) && data[pos] == 0xFF && (data[pos+1] == 0xE0 || data[pos+1] == 0xE1) {
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+	pos = min(pos, len(data))
+	seg := []byte{0xFF, 0xE2}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(2+len(iccMarker)+2+len(profile)))
+	seg = append(seg, iccMarker...)
+	seg = append(seg, 1, 1) // chunk 1 of 1
+	seg = append(seg, profile...)
+
+	out := make([]byte, 0, len(data)+len(seg))
+	out = append(out, data[:pos]...)
+	out = append(out, seg...)
+	return append(out, data[pos:]...)
+}
+
+// jpegICCProfile returns the ICC profile embedded in a JPEG, or nil. Only
+// single-chunk profiles, as written by embedJPEGICCProfile, are returned.
+func jpegICCProfile(data []byte) []byte {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			break
+		}
+		body := data[pos+4 : end]
+		if marker == 0xE2 && bytes.HasPrefix(body, []byte(iccMarker)) && len(body) > len(iccMarker)+2 {
+			if body[len(iccMarker)+1] == 1 {
+				return body[len(iccMarker)+2:]
+			}
+			return nil
+		}
+		pos = end
+	}
+	return nil
+}
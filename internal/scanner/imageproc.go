@@ -0,0 +1,559 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// MaxScanRegions is the number of eSCL scan regions advertised per job.
+// Extra regions are cropped out of a full-page scan.
+const MaxScanRegions = 4
+
+// cropJPEGQuality is the JPEG quality used when re-encoding cropped pages.
+const cropJPEGQuality = 90
+
+// regionToRect maps an eSCL scan region (1/100 mm, relative to the page
+// origin) to a pixel rectangle at the given DPI, clipped to bounds.
+// Returns an empty rectangle if the region lies outside the image.
+func regionToRect(reg abstract.Region, dpi int, bounds image.Rectangle) image.Rectangle {
+	x := reg.XOffset.Dots(dpi)
+	y := reg.YOffset.Dots(dpi)
+	r := image.Rect(x, y, x+reg.Width.Dots(dpi), y+reg.Height.Dots(dpi)).Add(bounds.Min)
+	return r.Intersect(bounds)
+}
+
+// cropPageRegions splits a scanned page into one page per region. JPEG pages
+// are re-encoded as JPEG and TIFF (B&W) pages as TIFF, so the output format
+// matches the input. Regions that fall entirely outside the page are skipped.
+func cropPageRegions(p vens.Page, regions []abstract.Region, dpi int) ([]vens.Page, error) {
+	return cropPage(p, dpi, func(bounds image.Rectangle, dpi int) []image.Rectangle {
+		rects := make([]image.Rectangle, 0, len(regions))
+		for _, reg := range regions {
+			rects = append(rects, regionToRect(reg, dpi, bounds))
+		}
+		return rects
+	})
+}
+
+// Long page splitting. Each part after the first repeats the bottom
+// longPageOverlapMM of the previous one, so a line cut at the boundary is
+// still readable on one of the pages.
+const longPageOverlapMM = 5
+
+// splitLongPage divides a page taller than lengthMM into pages of that
+// height, top to bottom; the last one holds the remainder. A page that fits,
+// or a lengthMM not longer than the overlap, is returned as the only page.
+func splitLongPage(p vens.Page, lengthMM float64, dpi int) ([]vens.Page, error) {
+	if lengthMM <= longPageOverlapMM {
+		return []vens.Page{p}, nil
+	}
+	if ps := p.PixelSize; ps != nil && ps.YRes > 0 && float64(ps.YPixels)*25.4/float64(ps.YRes) <= lengthMM {
+		return []vens.Page{p}, nil // fits, skip decoding
+	}
+	return cropPage(p, dpi, func(bounds image.Rectangle, dpi int) []image.Rectangle {
+		length := int(lengthMM * float64(dpi) / 25.4)
+		step := length - int(longPageOverlapMM*float64(dpi)/25.4)
+		if bounds.Dy() <= length || step <= 0 {
+			return []image.Rectangle{bounds}
+		}
+		var rects []image.Rectangle
+		for y := bounds.Min.Y; ; y += step {
+			r := image.Rect(bounds.Min.X, y, bounds.Max.X, y+length).Intersect(bounds)
+			rects = append(rects, r)
+			if r.Max.Y >= bounds.Max.Y {
+				return rects
+			}
+		}
+	})
+}
+
+// cropPage decodes p and re-encodes the pixel rectangles returned by rects
+// as pages. JPEG pages are re-encoded as JPEG and TIFF (B&W) pages as TIFF,
+// so the output format matches the input. Empty rectangles are skipped.
+func cropPage(p vens.Page, dpi int, rects func(bounds image.Rectangle, dpi int) []image.Rectangle) ([]vens.Page, error) {
+	isTIFF := DetectImageMIME(p.JPEG) == "image/tiff"
+	var img image.Image
+	var err error
+	if isTIFF {
+		img, err = tiff.Decode(bytes.NewReader(p.JPEG))
+	} else {
+		img, err = jpeg.Decode(bytes.NewReader(p.JPEG))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode page for crop: %w", err)
+	}
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("crop: unsupported image type %T", img)
+	}
+
+	dpi = pageDPI(p, dpi)
+	var out []vens.Page
+	for _, rect := range rects(img.Bounds(), dpi) {
+		if rect.Empty() {
+			continue
+		}
+		var buf bytes.Buffer
+		if isTIFF {
+			err = tiff.Encode(&buf, sub.SubImage(rect), &tiff.Options{Compression: tiff.Deflate})
+		} else {
+			err = jpeg.Encode(&buf, sub.SubImage(rect), &jpeg.Options{Quality: cropJPEGQuality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encode cropped region: %w", err)
+		}
+		cropped := p
+		cropped.JPEG = buf.Bytes()
+		cropped.PixelSize = &vens.PixelSizeInfo{XPixels: rect.Dx(), YPixels: rect.Dy(), XRes: dpi, YRes: dpi}
+		out = append(out, cropped)
+	}
+	return out, nil
+}
+
+// Near-grayscale detection thresholds. Chroma is max(R,G,B)-min(R,G,B) on a
+// 0-255 scale. A page counts as gray when chroma is low on average and does
+// not vary much, so a small colored stamp or logo keeps the page in color.
+const (
+	grayChromaMean   = 6.0
+	grayChromaStdDev = 10.0
+	graySampleTarget = 250000 // approximate number of pixels sampled per page
+	grayJPEGQuality  = 90
+)
+
+// isNearGrayscale reports whether a color image is effectively grayscale,
+// based on the mean and standard deviation of per-pixel chroma.
+func isNearGrayscale(img image.Image) bool {
+	b := img.Bounds()
+	if b.Empty() {
+		return true
+	}
+	step := max(1, int(math.Sqrt(float64(b.Dx()*b.Dy())/graySampleTarget)))
+	var n, sum, sumSq float64
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			hi := max(r, g, bl) >> 8
+			lo := min(r, g, bl) >> 8
+			c := float64(hi - lo)
+			sum += c
+			sumSq += c * c
+			n++
+		}
+	}
+	mean := sum / n
+	stddev := math.Sqrt(max(0, sumSq/n-mean*mean))
+	return mean < grayChromaMean && stddev < grayChromaStdDev
+}
+
+// autoGrayscalePage converts a color JPEG page to a grayscale JPEG when its
+// content is effectively gray. converted is false if the page was left as-is.
+func autoGrayscalePage(p vens.Page, dpi int) (out vens.Page, converted bool, err error) {
+	if DetectImageMIME(p.JPEG) != "image/jpeg" {
+		return p, false, nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return p, false, fmt.Errorf("decode page: %w", err)
+	}
+	if _, ok := img.(*image.Gray); ok || !isNearGrayscale(img) {
+		return p, false, nil
+	}
+
+	var gray *image.Gray
+	if ycc, ok := img.(*image.YCbCr); ok {
+		// The luma plane already is the grayscale image
+		gray = &image.Gray{Pix: ycc.Y, Stride: ycc.YStride, Rect: ycc.Rect}
+	} else {
+		gray = image.NewGray(img.Bounds())
+		for y := gray.Rect.Min.Y; y < gray.Rect.Max.Y; y++ {
+			for x := gray.Rect.Min.X; x < gray.Rect.Max.X; x++ {
+				gray.Set(x, y, color.GrayModel.Convert(img.At(x, y)))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gray, &jpeg.Options{Quality: grayJPEGQuality}); err != nil {
+		return p, false, fmt.Errorf("encode grayscale page: %w", err)
+	}
+	out = p
+	out.JPEG = buf.Bytes()
+	if p.PixelSize == nil {
+		// Re-encoded JPEGs carry no JFIF density, so keep the resolution here
+		res := pageDPI(p, dpi)
+		b := gray.Bounds()
+		out.PixelSize = &vens.PixelSizeInfo{XPixels: b.Dx(), YPixels: b.Dy(), XRes: res, YRes: res}
+	}
+	return out, true, nil
+}
+
+// Software blank page detection, see isBlankPage.
+const (
+	blankWhiteLevel = 220  // luma at or above which a pixel counts as white
+	blankEdgeMargin = 0.03 // fraction of each edge ignored: shadows and deskew borders
+)
+
+// whiteFraction returns the fraction of near-white pixels in img, sampling
+// about graySampleTarget pixels away from the edges.
+func whiteFraction(img image.Image) float64 {
+	b := img.Bounds()
+	b = b.Inset(int(float64(min(b.Dx(), b.Dy())) * blankEdgeMargin))
+	if b.Empty() {
+		return 1
+	}
+	step := max(1, int(math.Sqrt(float64(b.Dx()*b.Dy())/graySampleTarget)))
+	var n, white int
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y >= blankWhiteLevel {
+				white++
+			}
+			n++
+		}
+	}
+	return float64(white) / float64(n)
+}
+
+// isBlankPage reports whether at least threshold percent of a JPEG or TIFF
+// page is near-white. It catches blank pages the scanner's own blank page
+// removal keeps, such as the back of a slightly tinted sheet.
+func isBlankPage(p vens.Page, threshold float64) (bool, error) {
+	var img image.Image
+	var err error
+	if pageIsTIFF(p, false) {
+		img, err = tiff.Decode(bytes.NewReader(p.JPEG))
+	} else {
+		img, err = jpeg.Decode(bytes.NewReader(p.JPEG))
+	}
+	if err != nil {
+		return false, fmt.Errorf("decode page: %w", err)
+	}
+	return whiteFraction(img)*100 >= threshold, nil
+}
+
+// adjustLUT returns the 8-bit tone mapping for brightness and contrast
+// (-5 to +5 each). Contrast scales values around mid-gray by 10% per step;
+// brightness then shifts them by 1/20 of the full range per step.
+func adjustLUT(brightness, contrast int) [256]byte {
+	var lut [256]byte
+	for v := range lut {
+		out := (v-128)*(10+contrast)/10 + 128 + brightness*255/20
+		lut[v] = uint8(min(max(out, 0), 255))
+	}
+	return lut
+}
+
+// adjustPage applies brightness and contrast (-5 to +5 each) to a JPEG page.
+// Color pages are adjusted on the luma plane only, so hues are kept. TIFF
+// (B&W) pages and pages with both values 0 are returned as-is.
+func adjustPage(p vens.Page, brightness, contrast, dpi int) (vens.Page, error) {
+	brightness = min(max(brightness, -5), 5)
+	contrast = min(max(contrast, -5), 5)
+	if brightness == 0 && contrast == 0 || DetectImageMIME(p.JPEG) != "image/jpeg" {
+		return p, nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return p, fmt.Errorf("decode page: %w", err)
+	}
+
+	lut := adjustLUT(brightness, contrast)
+	apply := func(pix []byte) {
+		for i, v := range pix {
+			pix[i] = lut[v]
+		}
+	}
+	switch m := img.(type) {
+	case *image.YCbCr:
+		apply(m.Y)
+	case *image.Gray:
+		apply(m.Pix)
+	default:
+		rgba := image.NewRGBA(m.Bounds())
+		draw.Draw(rgba, rgba.Rect, m, m.Bounds().Min, draw.Src)
+		for i := range rgba.Pix {
+			if i%4 != 3 { // leave alpha
+				rgba.Pix[i] = lut[rgba.Pix[i]]
+			}
+		}
+		img = rgba
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: cropJPEGQuality}); err != nil {
+		return p, fmt.Errorf("encode adjusted page: %w", err)
+	}
+	out := p
+	out.JPEG = buf.Bytes()
+	if p.PixelSize == nil {
+		// Re-encoded JPEGs carry no JFIF density, so keep the resolution here
+		res := pageDPI(p, dpi)
+		b := img.Bounds()
+		out.PixelSize = &vens.PixelSizeInfo{XPixels: b.Dx(), YPixels: b.Dy(), XRes: res, YRes: res}
+	}
+	return out, nil
+}
+
+// Border fill parameters. Deskewing a crooked sheet leaves black wedges
+// along the page edges, no deeper than a few percent of the page. Only
+// near-black regions touching the image edge are filled, and only if they
+// stay within borderMaxDepth of it: a dark area reaching further in (a photo
+// or dark background printed to the edge) is left alone.
+const (
+	borderBlackLevel = 48   // luma at or below this counts as black
+	borderMaxDepth   = 0.10 // band along each edge, relative to the page size
+)
+
+// fillBorders whitens near-black regions connected to the edge of img that
+// fit in the border band, modifying img in place. It returns the number of
+// pixels filled.
+func fillBorders(img image.Image) int {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	var luma func(x, y int) uint8
+	var whiten func(x, y int)
+	switch m := img.(type) {
+	case *image.YCbCr:
+		luma = func(x, y int) uint8 { return m.Y[m.YOffset(b.Min.X+x, b.Min.Y+y)] }
+		whiten = func(x, y int) {
+			m.Y[m.YOffset(b.Min.X+x, b.Min.Y+y)] = 255
+			c := m.COffset(b.Min.X+x, b.Min.Y+y)
+			m.Cb[c], m.Cr[c] = 128, 128
+		}
+	case *image.Gray:
+		luma = func(x, y int) uint8 { return m.Pix[m.PixOffset(b.Min.X+x, b.Min.Y+y)] }
+		whiten = func(x, y int) { m.Pix[m.PixOffset(b.Min.X+x, b.Min.Y+y)] = 255 }
+	case *image.RGBA:
+		luma = func(x, y int) uint8 {
+			return color.GrayModel.Convert(m.RGBAAt(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+		}
+		whiten = func(x, y int) { m.SetRGBA(b.Min.X+x, b.Min.Y+y, color.RGBA{255, 255, 255, 255}) }
+	default:
+		return 0
+	}
+
+	depthX := int(float64(w) * borderMaxDepth)
+	depthY := int(float64(h) * borderMaxDepth)
+	inBand := func(x, y int) bool {
+		return x < depthX || x >= w-depthX || y < depthY || y >= h-depthY
+	}
+	dark := func(x, y int) bool { return luma(x, y) <= borderBlackLevel }
+
+	seen := make([]bool, w*h)
+	filled := 0
+	var region, stack [][2]int
+	fill := func(x0, y0 int) {
+		if seen[y0*w+x0] || !dark(x0, y0) {
+			return
+		}
+		seen[y0*w+x0] = true
+		region, stack = region[:0], append(stack[:0], [2]int{x0, y0})
+		escaped := false
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			region = append(region, p)
+			for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				x, y := p[0]+d[0], p[1]+d[1]
+				if x < 0 || y < 0 || x >= w || y >= h || seen[y*w+x] || !dark(x, y) {
+					continue
+				}
+				if !inBand(x, y) {
+					escaped = true
+					continue
+				}
+				seen[y*w+x] = true
+				stack = append(stack, [2]int{x, y})
+			}
+		}
+		if escaped {
+			return
+		}
+		for _, p := range region {
+			whiten(p[0], p[1])
+		}
+		filled += len(region)
+	}
+	for x := 0; x < w; x++ {
+		fill(x, 0)
+		fill(x, h-1)
+	}
+	for y := 0; y < h; y++ {
+		fill(0, y)
+		fill(w-1, y)
+	}
+	return filled
+}
+
+// fillBordersPage whitens the black deskew borders of a JPEG page (see
+// fillBorders). TIFF (B&W) pages are returned as-is, as is a page without
+// such borders; filled reports whether the page was changed.
+func fillBordersPage(p vens.Page, dpi int) (out vens.Page, filled bool, err error) {
+	if DetectImageMIME(p.JPEG) != "image/jpeg" {
+		return p, false, nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return p, false, fmt.Errorf("decode page: %w", err)
+	}
+	switch img.(type) {
+	case *image.YCbCr, *image.Gray:
+	default:
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+		img = rgba
+	}
+	if fillBorders(img) == 0 {
+		return p, false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: cropJPEGQuality}); err != nil {
+		return p, false, fmt.Errorf("encode filled page: %w", err)
+	}
+	out = p
+	out.JPEG = buf.Bytes()
+	if p.PixelSize == nil {
+		// Re-encoded JPEGs carry no JFIF density, so keep the resolution here
+		res := pageDPI(p, dpi)
+		b := img.Bounds()
+		out.PixelSize = &vens.PixelSizeInfo{XPixels: b.Dx(), YPixels: b.Dy(), XRes: res, YRes: res}
+	}
+	return out, true, nil
+}
+
+// rotate90 returns img turned 90° clockwise: pixel (x, y) moves to
+// (height-1-y, x). Gray and YCbCr images keep their type.
+func rotate90(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	switch m := img.(type) {
+	case *image.Gray:
+		dst := image.NewGray(image.Rect(0, 0, h, w))
+		for y := range h {
+			row := m.Pix[y*m.Stride : y*m.Stride+w]
+			for x, v := range row {
+				dst.Pix[x*dst.Stride+h-1-y] = v
+			}
+		}
+		return dst
+	case *image.YCbCr:
+		dst := image.NewYCbCr(image.Rect(0, 0, h, w), image.YCbCrSubsampleRatio444)
+		for y := range h {
+			for x := range w {
+				sx, sy := b.Min.X+x, b.Min.Y+y
+				di := x*dst.YStride + h - 1 - y
+				ci := m.COffset(sx, sy)
+				dst.Y[di] = m.Y[m.YOffset(sx, sy)]
+				dst.Cb[di] = m.Cb[ci]
+				dst.Cr[di] = m.Cr[ci]
+			}
+		}
+		return dst
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, h, w))
+	for y := range h {
+		for x := range w {
+			dst.Set(h-1-y, x, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// autoRotatePage turns a landscape page 90° clockwise so that every page of
+// a scan is portrait. Portrait and square pages are returned as-is; rotated
+// reports whether the page was changed.
+func autoRotatePage(p vens.Page, dpi int) (out vens.Page, rotated bool, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return p, false, fmt.Errorf("decode page config: %w", err)
+	}
+	if cfg.Width <= cfg.Height {
+		return p, false, nil
+	}
+	out, err = rotatePage(p, 1, dpi)
+	return out, err == nil, err
+}
+
+// rotatePage turns a page clockwise by turns quarter turns. JPEG pages are
+// re-encoded as JPEG and TIFF (B&W) pages as TIFF.
+func rotatePage(p vens.Page, turns, dpi int) (vens.Page, error) {
+	turns = (turns%4 + 4) % 4
+	if turns == 0 {
+		return p, nil
+	}
+	isTIFF := DetectImageMIME(p.JPEG) == "image/tiff"
+	var img image.Image
+	var err error
+	if isTIFF {
+		img, err = tiff.Decode(bytes.NewReader(p.JPEG))
+	} else {
+		img, err = jpeg.Decode(bytes.NewReader(p.JPEG))
+	}
+	if err != nil {
+		return p, fmt.Errorf("decode page: %w", err)
+	}
+	for range turns {
+		img = rotate90(img)
+	}
+
+	var buf bytes.Buffer
+	if isTIFF {
+		err = tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate})
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: cropJPEGQuality})
+	}
+	if err != nil {
+		return p, fmt.Errorf("encode rotated page: %w", err)
+	}
+	out := p
+	out.JPEG = buf.Bytes()
+	// Re-encoded pages carry no resolution, so keep it here
+	xRes, yRes := pageDPI(p, dpi), pageDPI(p, dpi)
+	if ps := p.PixelSize; ps != nil && ps.XRes > 0 && ps.YRes > 0 {
+		xRes, yRes = ps.XRes, ps.YRes
+		if turns%2 == 1 {
+			xRes, yRes = yRes, xRes
+		}
+	}
+	b := img.Bounds()
+	out.PixelSize = &vens.PixelSizeInfo{XPixels: b.Dx(), YPixels: b.Dy(), XRes: xRes, YRes: yRes}
+	return out, nil
+}
+
+// DetectImageMIME returns the MIME type of scanned page data based on magic bytes.
+// TIFF: 49 49 2A 00 (little-endian) or 4D 4D 00 2A (big-endian)
+// JPEG: FF D8 FF
+// PNG: 89 50 4E 47, WebP: RIFF....WEBP (re-encoded pages only)
+func DetectImageMIME(data []byte) string {
+	if bytes.HasPrefix(data, []byte(pngSignature)) {
+		return FormatPNG
+	}
+	if isWebP(data) {
+		return FormatWebP
+	}
+	if len(data) >= 4 {
+		if data[0] == 0x49 && data[1] == 0x49 && data[2] == 0x2A && data[3] == 0x00 {
+			return "image/tiff"
+		}
+		if data[0] == 0x4D && data[1] == 0x4D && data[2] == 0x00 && data[3] == 0x2A {
+			return "image/tiff"
+		}
+	}
+	return "image/jpeg"
+}
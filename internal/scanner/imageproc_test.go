@@ -0,0 +1,515 @@
+package scanner
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/proto/escl"
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// --------------------------------------------------------------------------
+// Multi-region crop tests
+// --------------------------------------------------------------------------
+
+func TestRegionToRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 2480, 3508) // A4 @ 300 DPI
+	tests := []struct {
+		name string
+		reg  abstract.Region
+		want image.Rectangle
+	}{
+		{
+			name: "one inch square at origin",
+			reg:  abstract.Region{Width: abstract.Inch, Height: abstract.Inch},
+			want: image.Rect(0, 0, 300, 300),
+		},
+		{
+			name: "offset region",
+			reg:  abstract.Region{XOffset: abstract.Inch, YOffset: 2 * abstract.Inch, Width: abstract.Inch, Height: abstract.Inch},
+			want: image.Rect(300, 600, 600, 900),
+		},
+		{
+			name: "clipped at page edge",
+			reg:  abstract.Region{XOffset: 8 * abstract.Inch, Width: abstract.Inch, Height: abstract.Inch},
+			want: image.Rect(2400, 0, 2480, 300),
+		},
+		{
+			name: "outside page",
+			reg:  abstract.Region{XOffset: 10 * abstract.Inch, Width: abstract.Inch, Height: abstract.Inch},
+			want: image.Rectangle{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := regionToRect(tt.reg, 300, bounds)
+			if got.Empty() && tt.want.Empty() {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("regionToRect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCropPageRegions(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 600, 900)) // 2x3 inch @ 300 DPI
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	page := vens.Page{Sheet: 0, Side: 1, JPEG: buf.Bytes()}
+	regions := []abstract.Region{
+		{Width: abstract.Inch, Height: abstract.Inch},
+		{XOffset: abstract.Inch, YOffset: abstract.Inch, Width: abstract.Inch, Height: 2 * abstract.Inch},
+		{XOffset: 5 * abstract.Inch, Width: abstract.Inch, Height: abstract.Inch}, // off-page
+	}
+
+	crops, err := cropPageRegions(page, regions, 300)
+	if err != nil {
+		t.Fatalf("cropPageRegions: %v", err)
+	}
+	if len(crops) != 2 {
+		t.Fatalf("got %d crops, want 2", len(crops))
+	}
+	wantSizes := [][2]int{{300, 300}, {300, 600}}
+	for i, c := range crops {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(c.JPEG))
+		if err != nil {
+			t.Fatalf("crop %d: %v", i, err)
+		}
+		if format != "jpeg" || cfg.Width != wantSizes[i][0] || cfg.Height != wantSizes[i][1] {
+			t.Errorf("crop %d = %s %dx%d, want jpeg %dx%d", i, format, cfg.Width, cfg.Height, wantSizes[i][0], wantSizes[i][1])
+		}
+		if c.Sheet != 0 || c.Side != 1 {
+			t.Errorf("crop %d lost sheet/side: %d/%d", i, c.Sheet, c.Side)
+		}
+		if c.PixelSize == nil || c.PixelSize.XRes != 300 {
+			t.Errorf("crop %d PixelSize = %+v, want 300 DPI", i, c.PixelSize)
+		}
+	}
+}
+
+func TestCropPageRegionsTIFF(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 300, 300))
+	img.SetGray(10, 10, color.Gray{Y: 0})
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	crops, err := cropPageRegions(vens.Page{JPEG: buf.Bytes()}, []abstract.Region{
+		{Width: abstract.Inch / 2, Height: abstract.Inch / 2},
+	}, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crops) != 1 || DetectImageMIME(crops[0].JPEG) != "image/tiff" {
+		t.Fatalf("expected one TIFF crop, got %d", len(crops))
+	}
+}
+
+func TestSplitLongPage(t *testing.T) {
+	// An 80 mm wide receipt about 1 m long at 200 DPI
+	page := vens.Page{JPEG: encodeTestJPEG(t, image.NewGray(image.Rect(0, 0, 630, 8000)))}
+
+	parts, err := splitLongPage(page, 297, 200)
+	if err != nil {
+		t.Fatalf("splitLongPage: %v", err)
+	}
+	// 2338 px pages advancing by 2299 px (297 mm minus 5 mm overlap)
+	wantHeights := []int{2338, 2338, 2338, 1103}
+	if len(parts) != len(wantHeights) {
+		t.Fatalf("got %d pages, want %d", len(parts), len(wantHeights))
+	}
+	for i, p := range parts {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(p.JPEG))
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		if cfg.Width != 630 || cfg.Height != wantHeights[i] {
+			t.Errorf("page %d = %dx%d, want 630x%d", i, cfg.Width, cfg.Height, wantHeights[i])
+		}
+	}
+
+	// The output PDF gets one page per part
+	s := config.Settings{LongPageSplit: 297}
+	cfg := vens.ScanConfig{Quality: vens.QualityFine}
+	files, _, err := renderOutputFiles([]vens.Page{page}, cfg, "application/pdf", s, fileNamer{base: "scan", time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(files[0].Data, []byte("/Type /Page\n")); n != len(wantHeights) {
+		t.Errorf("PDF pages = %d, want %d", n, len(wantHeights))
+	}
+
+	// A page that fits is not re-encoded
+	short := vens.Page{JPEG: encodeTestJPEG(t, image.NewGray(image.Rect(0, 0, 630, 2000)))}
+	if parts, err := splitLongPage(short, 297, 200); err != nil || len(parts) != 1 || !bytes.Equal(parts[0].JPEG, short.JPEG) {
+		t.Errorf("short page split into %d pages, err %v", len(parts), err)
+	}
+}
+
+func TestSetScanRegions(t *testing.T) {
+	a := &ESCLAdapter{}
+
+	a.SetScanRegions([]escl.ScanRegion{{Width: 300, Height: 300}})
+	if a.scanRegions != nil {
+		t.Errorf("single region should use the paper-size path, got %v", a.scanRegions)
+	}
+
+	a.SetScanRegions([]escl.ScanRegion{
+		{Width: 300, Height: 300},
+		{XOffset: 300, YOffset: 600, Width: 150, Height: 150},
+	})
+	if len(a.scanRegions) != 2 {
+		t.Fatalf("got %d regions, want 2", len(a.scanRegions))
+	}
+	want := abstract.Region{XOffset: abstract.Inch, YOffset: 2 * abstract.Inch, Width: abstract.Inch / 2, Height: abstract.Inch / 2}
+	if a.scanRegions[1] != want {
+		t.Errorf("region = %v, want %v", a.scanRegions[1], want)
+	}
+}
+
+// --------------------------------------------------------------------------
+// Auto grayscale tests
+// --------------------------------------------------------------------------
+
+func encodeTestJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAutoGrayscalePage(t *testing.T) {
+	// A "color" scan of a black-on-white document with slight sensor tint
+	gray := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := range 300 {
+		for x := range 400 {
+			v := uint8(240)
+			if (x/20+y/20)%2 == 0 {
+				v = 30
+			}
+			gray.Set(x, y, color.RGBA{v, v + 2, v, 255})
+		}
+	}
+	page := vens.Page{JPEG: encodeTestJPEG(t, gray)}
+	out, converted, err := autoGrayscalePage(page, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !converted {
+		t.Fatal("near-gray color page was not converted")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out.JPEG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*image.Gray); !ok {
+		t.Errorf("decoded %T, want *image.Gray", img)
+	}
+	if img.Bounds().Dx() != 400 || img.Bounds().Dy() != 300 {
+		t.Errorf("size = %v, want 400x300", img.Bounds())
+	}
+	if out.PixelSize == nil || out.PixelSize.XRes != 300 {
+		t.Errorf("PixelSize = %+v, want 300 DPI", out.PixelSize)
+	}
+}
+
+func TestAutoGrayscalePageKeepsColor(t *testing.T) {
+	// Gray document with a red logo in one corner
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := range 300 {
+		for x := range 400 {
+			c := color.RGBA{230, 230, 230, 255}
+			if x < 80 && y < 60 {
+				c = color.RGBA{220, 20, 20, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	page := vens.Page{JPEG: encodeTestJPEG(t, img)}
+	out, converted, err := autoGrayscalePage(page, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted || !bytes.Equal(out.JPEG, page.JPEG) {
+		t.Error("page with colored content should be kept as-is")
+	}
+}
+
+// meanLuma returns the average gray level of a JPEG.
+func meanLuma(t *testing.T, data []byte) float64 {
+	t.Helper()
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return sum / float64(b.Dx()*b.Dy())
+}
+
+func TestAdjustLUT(t *testing.T) {
+	lut := adjustLUT(0, 0)
+	for v := range lut {
+		if lut[v] != uint8(v) {
+			t.Fatalf("identity LUT[%d] = %d", v, lut[v])
+		}
+	}
+	if lut := adjustLUT(5, 0); lut[0] != 63 || lut[255] != 255 {
+		t.Errorf("brightness +5: LUT[0], LUT[255] = %d, %d, want 63, 255", lut[0], lut[255])
+	}
+	if lut := adjustLUT(0, 5); lut[64] != 32 || lut[128] != 128 || lut[192] != 224 {
+		t.Errorf("contrast +5: LUT[64,128,192] = %d, %d, %d, want 32, 128, 224", lut[64], lut[128], lut[192])
+	}
+	if lut := adjustLUT(0, -5); lut[0] != 64 || lut[255] != 191 {
+		t.Errorf("contrast -5: LUT[0], LUT[255] = %d, %d, want 64, 191", lut[0], lut[255])
+	}
+}
+
+func TestAdjustPage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := range 100 {
+		for x := range 200 {
+			img.Set(x, y, color.RGBA{100, 110, 120, 255})
+		}
+	}
+	page := vens.Page{JPEG: encodeTestJPEG(t, img)}
+	base := meanLuma(t, page.JPEG)
+
+	same, err := adjustPage(page, 0, 0, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(same.JPEG, page.JPEG) {
+		t.Error("page re-encoded without any adjustment")
+	}
+
+	brighter, err := adjustPage(page, 3, 0, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := meanLuma(t, brighter.JPEG); got < base+30 {
+		t.Errorf("brightness +3: mean luma %.1f, want about %.1f", got, base+38)
+	}
+	if brighter.PixelSize == nil || brighter.PixelSize.XRes != 300 || brighter.PixelSize.XPixels != 200 {
+		t.Errorf("PixelSize = %+v, want 200 px at 300 DPI", brighter.PixelSize)
+	}
+
+	tiffPage := vens.Page{JPEG: []byte{0x49, 0x49, 0x2A, 0x00}}
+	if out, err := adjustPage(tiffPage, 5, 5, 300); err != nil || !bytes.Equal(out.JPEG, tiffPage.JPEG) {
+		t.Errorf("TIFF page changed: err = %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+// Border fill tests
+// --------------------------------------------------------------------------
+
+func TestRotate90(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(gray.Pix, []byte{1, 2, 3, 4, 5, 6})
+	got := rotate90(gray).(*image.Gray)
+	// Clockwise: the left column becomes the top row
+	if got.Rect.Dx() != 2 || got.Rect.Dy() != 3 || !bytes.Equal(got.Pix, []byte{4, 1, 5, 2, 6, 3}) {
+		t.Errorf("rotate90 = %v %v, want 2x3 [4 1 5 2 6 3]", got.Rect, got.Pix)
+	}
+}
+
+func TestAutoRotatePage(t *testing.T) {
+	// Landscape color page with a dark block in the top-left corner
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{240, 230, 220, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 40, 40), image.NewUniform(color.RGBA{20, 20, 120, 255}), image.Point{}, draw.Src)
+	page := vens.Page{JPEG: encodeTestJPEG(t, img)}
+
+	out, rotated, err := autoRotatePage(page, 300)
+	if err != nil || !rotated {
+		t.Fatalf("autoRotatePage() rotated = %v, err = %v", rotated, err)
+	}
+	got, err := jpeg.Decode(bytes.NewReader(out.JPEG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := got.Bounds(); b.Dx() != 200 || b.Dy() != 300 {
+		t.Fatalf("rotated size = %dx%d, want 200x300", b.Dx(), b.Dy())
+	}
+	if ps := out.PixelSize; ps == nil || ps.XPixels != 200 || ps.YPixels != 300 || ps.XRes != 300 {
+		t.Errorf("PixelSize = %+v", out.PixelSize)
+	}
+	// The block moved to the top-right corner
+	if r, _, _, _ := got.At(185, 15).RGBA(); r>>8 > 80 {
+		t.Errorf("top-right pixel red = %d, want dark", r>>8)
+	}
+	if r, _, _, _ := got.At(15, 15).RGBA(); r>>8 < 200 {
+		t.Errorf("top-left pixel red = %d, want light", r>>8)
+	}
+
+	// Portrait pages are left alone
+	if _, rotated, err := autoRotatePage(out, 300); err != nil || rotated {
+		t.Errorf("portrait page rotated = %v, err = %v", rotated, err)
+	}
+
+	// B&W pages stay TIFF
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, image.NewGray(image.Rect(0, 0, 320, 240)), nil); err != nil {
+		t.Fatal(err)
+	}
+	out, rotated, err = autoRotatePage(vens.Page{JPEG: buf.Bytes()}, 300)
+	if err != nil || !rotated {
+		t.Fatalf("TIFF: rotated = %v, err = %v", rotated, err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out.JPEG))
+	if err != nil || format != "tiff" || cfg.Width != 240 || cfg.Height != 320 {
+		t.Errorf("TIFF rotated to %s %dx%d (%v), want tiff 240x320", format, cfg.Width, cfg.Height, err)
+	}
+}
+
+func TestCarrierSheetPageKept(t *testing.T) {
+	// A landscape photo in a carrier sheet, longer than the split length
+	page := vens.Page{JPEG: encodeTestJPEG(t, image.NewGray(image.Rect(0, 0, 3000, 2000))), CarrierSheet: true}
+	s := config.Settings{AutoRotate: true, LongPageSplit: 100}
+	cfg := vens.ScanConfig{Quality: vens.QualityFine}
+
+	out, _ := postProcessPage(page, 1, cfg, s)
+	if !bytes.Equal(out.JPEG, page.JPEG) {
+		t.Error("carrier sheet page was auto-rotated")
+	}
+	if parts := splitLongPages([]vens.Page{page}, cfg, s); len(parts) != 1 || !bytes.Equal(parts[0].JPEG, page.JPEG) {
+		t.Errorf("carrier sheet page split into %d pages", len(parts))
+	}
+
+	// The same page without a carrier sheet is rotated and split
+	page.CarrierSheet = false
+	if out, _ := postProcessPage(page, 1, cfg, s); bytes.Equal(out.JPEG, page.JPEG) {
+		t.Error("plain page was not auto-rotated")
+	}
+	if parts := splitLongPages([]vens.Page{page}, cfg, s); len(parts) < 2 {
+		t.Errorf("plain page split into %d pages, want several", len(parts))
+	}
+}
+
+func TestFillBordersPage(t *testing.T) {
+	// A deskewed page: black wedges along the top and left edges, widest at
+	// the top-left corner, black text in the middle and a dark photo
+	// printed to the right edge
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := range 300 {
+		for x := range 400 {
+			c := color.RGBA{250, 250, 250, 255}
+			switch {
+			case y < (400-x)/20, x < (300-y)/15:
+				c = color.RGBA{0, 0, 0, 255}
+			case x >= 160 && x < 240 && y >= 120 && y < 180:
+				c = color.RGBA{10, 10, 10, 255}
+			case x >= 320 && y >= 100 && y < 200:
+				c = color.RGBA{20, 20, 20, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	page := vens.Page{JPEG: encodeTestJPEG(t, img)}
+	out, filled, err := fillBordersPage(page, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filled {
+		t.Fatal("black borders were not filled")
+	}
+	got, err := jpeg.Decode(bytes.NewReader(out.JPEG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	luma := func(x, y int) uint8 { return color.GrayModel.Convert(got.At(x, y)).(color.Gray).Y }
+	for _, p := range [][2]int{{0, 0}, {5, 5}, {100, 5}, {5, 100}, {390, 0}, {0, 290}} {
+		if v := luma(p[0], p[1]); v < 200 {
+			t.Errorf("border pixel %v = %d, want white", p, v)
+		}
+	}
+	for _, p := range [][2]int{{200, 150}, {360, 150}, {399, 150}} {
+		if v := luma(p[0], p[1]); v > 60 {
+			t.Errorf("content pixel %v = %d, want dark", p, v)
+		}
+	}
+	if out.PixelSize == nil || out.PixelSize.XRes != 300 {
+		t.Errorf("PixelSize = %+v, want 300 DPI", out.PixelSize)
+	}
+
+	// A page without borders is kept as-is
+	clean := image.NewGray(image.Rect(0, 0, 100, 100))
+	draw.Draw(clean, clean.Rect, image.White, image.Point{}, draw.Src)
+	page = vens.Page{JPEG: encodeTestJPEG(t, clean)}
+	if out, filled, err := fillBordersPage(page, 300); err != nil || filled || !bytes.Equal(out.JPEG, page.JPEG) {
+		t.Errorf("clean page: filled = %v, err = %v", filled, err)
+	}
+}
+
+func TestIsBlankPage(t *testing.T) {
+	// The back of a slightly tinted sheet: a few specks of dust and a dark
+	// shadow along the left edge
+	blank := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := range 300 {
+		for x := range 400 {
+			c := color.RGBA{236, 234, 228, 255}
+			if x < 5 || (x%97 == 0 && y%89 == 0) {
+				c = color.RGBA{40, 40, 40, 255}
+			}
+			blank.Set(x, y, c)
+		}
+	}
+	// The same sheet with a few lines of text
+	text := image.NewRGBA(blank.Bounds())
+	draw.Draw(text, text.Bounds(), blank, image.Point{}, draw.Src)
+	for line := range 6 {
+		y := 40 + line*30
+		draw.Draw(text, image.Rect(40, y, 360, y+8), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	}
+	bwBlank := image.NewGray(image.Rect(0, 0, 400, 300))
+	draw.Draw(bwBlank, bwBlank.Bounds(), image.White, image.Point{}, draw.Src)
+	var white bytes.Buffer
+	if err := tiff.Encode(&white, bwBlank, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		page vens.Page
+		want bool
+	}{
+		{"blank", vens.Page{JPEG: encodeTestJPEG(t, blank)}, true},
+		{"text", vens.Page{JPEG: encodeTestJPEG(t, text)}, false},
+		{"blank TIFF", vens.Page{JPEG: white.Bytes()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isBlankPage(tt.page, 99.5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("isBlankPage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := isBlankPage(vens.Page{JPEG: []byte{0xFF, 0xD8, 0x00}}, 99.5); err == nil {
+		t.Error("corrupt page: expected error, got nil")
+	}
+}
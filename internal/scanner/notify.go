@@ -0,0 +1,209 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// Scan event results.
+const (
+	ScanResultSuccess = "success"
+	ScanResultFailure = "failure"
+)
+
+// ScanEvent describes the outcome of a button-scan job. It is the JSON body
+// posted to the notification webhook.
+type ScanEvent struct {
+	Result      string `json:"result"`           // ScanResultSuccess or ScanResultFailure
+	Pages       int    `json:"pages"`            // pages saved; unreadable pages left out of a PDF are not counted
+	Destination string `json:"destination"`      // save type: "local", "ftp", ...
+	Target      string `json:"target,omitempty"` // directory, host or URL the scan was delivered to
+	Error       string `json:"error,omitempty"`
+	Time        string `json:"time"` // RFC3339
+}
+
+// NewScanEvent builds the event for a finished button-scan job.
+func NewScanEvent(destination, target string, pages int, err error) ScanEvent {
+	ev := ScanEvent{
+		Result:      ScanResultSuccess,
+		Pages:       pages,
+		Destination: destination,
+		Target:      target,
+		Time:        time.Now().UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		ev.Result = ScanResultFailure
+		ev.Error = err.Error()
+	}
+	return ev
+}
+
+// SendWebhook posts ev as JSON to url. Any 2xx response is a success.
+func SendWebhook(url string, ev ScanEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AirScap")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// Push notification services for Settings.PushService.
+const (
+	PushNtfy   = "ntfy"
+	PushGotify = "gotify"
+)
+
+// Default push notification templates, executed with a ScanEvent.
+const (
+	DefaultPushTitle   = "AirScap: scan {{.Result}}"
+	DefaultPushMessage = "{{.Pages}} pages to {{.Destination}}{{if .Error}}: {{.Error}}{{end}}"
+)
+
+// RunNotify sends a push notification for ev to the ntfy topic or Gotify
+// server configured in settings. The title and message are rendered from
+// Settings.PushTitle and Settings.PushMessage. With Settings.PushAttachPDF,
+// doc (the generated PDF named docName, if any) is attached; Gotify does not
+// support attachments and only gets the message.
+func RunNotify(s config.Settings, ev ScanEvent, docName string, doc []byte) error {
+	title, err := renderPushTemplate(s.PushTitle, DefaultPushTitle, ev)
+	if err != nil {
+		return fmt.Errorf("push title: %w", err)
+	}
+	message, err := renderPushTemplate(s.PushMessage, DefaultPushMessage, ev)
+	if err != nil {
+		return fmt.Errorf("push message: %w", err)
+	}
+	failed := ev.Result != ScanResultSuccess
+
+	var req *http.Request
+	switch s.PushService {
+	case PushNtfy:
+		if !s.PushAttachPDF || len(doc) == 0 {
+			docName, doc = "", nil
+		}
+		req, err = ntfyRequest(s.PushURL, s.PushToken, title, message, failed, docName, doc)
+	case PushGotify:
+		req, err = gotifyRequest(s.PushURL, s.PushToken, title, message, failed)
+	default:
+		return fmt.Errorf("unknown push service %q", s.PushService)
+	}
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "AirScap")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// renderPushTemplate executes tmpl, or def if tmpl is empty, with ev.
+func renderPushTemplate(tmpl, def string, ev ScanEvent) (string, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		tmpl = def
+	}
+	t, err := template.New("push").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, ev); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ntfyRequest publishes to the ntfy topic URL. Title and message go in the
+// query so non-ASCII text survives; an attachment is sent as the PUT body.
+func ntfyRequest(topicURL, token, title, message string, failed bool, docName string, doc []byte) (*http.Request, error) {
+	u, err := url.Parse(topicURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("title", title)
+	if failed {
+		q.Set("priority", "high")
+		q.Set("tags", "warning")
+	} else {
+		q.Set("tags", "page_facing_up")
+	}
+
+	var req *http.Request
+	if doc != nil {
+		q.Set("message", message)
+		q.Set("filename", docName)
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequest("PUT", u.String(), bytes.NewReader(doc))
+	} else {
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequest("POST", u.String(), strings.NewReader(message))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// gotifyRequest creates a message on the Gotify server at baseURL using the
+// application token.
+func gotifyRequest(baseURL, token, title, message string, failed bool) (*http.Request, error) {
+	priority := 5
+	if failed {
+		priority = 8
+	}
+	body, err := json.Marshal(map[string]any{
+		"title":    title,
+		"message":  message,
+		"priority": priority,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(baseURL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
+	return req, nil
+}
@@ -0,0 +1,167 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+func TestSendWebhook(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   ScanEvent
+		want ScanEvent
+	}{
+		{
+			name: "success",
+			ev:   NewScanEvent("local", "/scans", 4, nil),
+			want: ScanEvent{Result: ScanResultSuccess, Pages: 4, Destination: "local", Target: "/scans"},
+		},
+		{
+			name: "failure",
+			ev:   NewScanEvent("ftp", "nas:21", 2, errors.New("FTP login: 530")),
+			want: ScanEvent{Result: ScanResultFailure, Pages: 2, Destination: "ftp", Target: "nas:21", Error: "FTP login: 530"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ScanEvent
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "POST" {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q, want application/json", ct)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decode body: %v", err)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			if err := SendWebhook(srv.URL, tt.ev); err != nil {
+				t.Fatalf("SendWebhook: %v", err)
+			}
+			if got.Time == "" {
+				t.Error("event time is empty")
+			}
+			got.Time = ""
+			if got != tt.want {
+				t.Errorf("payload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendWebhookErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if err := SendWebhook(srv.URL, NewScanEvent("local", "", 1, nil)); err == nil {
+		t.Fatal("SendWebhook succeeded on HTTP 404")
+	}
+}
+
+func TestRunNotifyNtfy(t *testing.T) {
+	type request struct {
+		method, title, message, filename, priority, auth string
+		body                                             string
+	}
+	var got request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+		got = request{
+			method:   r.Method,
+			title:    q.Get("title"),
+			message:  q.Get("message"),
+			filename: q.Get("filename"),
+			priority: q.Get("priority"),
+			auth:     r.Header.Get("Authorization"),
+			body:     string(body),
+		}
+		if r.URL.Path != "/scans" {
+			t.Errorf("path = %s, want /scans", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	s := config.Settings{PushService: PushNtfy, PushURL: srv.URL + "/scans", PushToken: "tk_1"}
+
+	t.Run("success", func(t *testing.T) {
+		if err := RunNotify(s, NewScanEvent("local", "/scans", 3, nil), "scan.pdf", []byte("%PDF")); err != nil {
+			t.Fatal(err)
+		}
+		want := request{method: "POST", title: "AirScap: scan success", auth: "Bearer tk_1", body: "3 pages to local"}
+		if got != want {
+			t.Errorf("request = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		if err := RunNotify(s, NewScanEvent("ftp", "nas", 0, errors.New("paper jam")), "", nil); err != nil {
+			t.Fatal(err)
+		}
+		want := request{method: "POST", title: "AirScap: scan failure", priority: "high", auth: "Bearer tk_1", body: "0 pages to ftp: paper jam"}
+		if got != want {
+			t.Errorf("request = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("attachment and templates", func(t *testing.T) {
+		s := s
+		s.PushAttachPDF = true
+		s.PushTitle = "スキャン {{.Pages}}"
+		s.PushMessage = "saved to {{.Target}}"
+		if err := RunNotify(s, NewScanEvent("local", "/scans", 2, nil), "scan.pdf", []byte("%PDF-1.3")); err != nil {
+			t.Fatal(err)
+		}
+		want := request{method: "PUT", title: "スキャン 2", message: "saved to /scans", filename: "scan.pdf", auth: "Bearer tk_1", body: "%PDF-1.3"}
+		if got != want {
+			t.Errorf("request = %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestRunNotifyGotify(t *testing.T) {
+	var got struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/message" {
+			t.Errorf("request = %s %s, want POST /message", r.Method, r.URL.Path)
+		}
+		if key := r.Header.Get("X-Gotify-Key"); key != "app-token" {
+			t.Errorf("X-Gotify-Key = %q, want app-token", key)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	s := config.Settings{PushService: PushGotify, PushURL: srv.URL + "/", PushToken: "app-token", PushAttachPDF: true}
+	if err := RunNotify(s, NewScanEvent("smb", "", 1, errors.New("upload failed")), "scan.pdf", []byte("%PDF")); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "AirScap: scan failure" || got.Message != "1 pages to smb: upload failed" || got.Priority != 8 {
+		t.Errorf("message = %+v", got)
+	}
+}
+
+func TestRunNotifyBadTemplate(t *testing.T) {
+	s := config.Settings{PushService: PushNtfy, PushURL: "http://127.0.0.1:1/x", PushTitle: "{{.Nope"}
+	if err := RunNotify(s, NewScanEvent("local", "", 1, nil), "", nil); err == nil {
+		t.Fatal("RunNotify succeeded with an invalid template")
+	}
+}
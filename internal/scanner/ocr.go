@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/go-pdf/fpdf"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// TesseractPath is the tesseract binary run for OCR. main sets it from
+// AIRSCAP_TESSERACT.
+var TesseractPath = "tesseract"
+
+// OCRFontPath is a TrueType font used for the OCR text layer, needed for
+// text outside Windows-1252 such as Japanese. When empty, the standard
+// Helvetica font is used and other characters are dropped. main sets it
+// from AIRSCAP_OCR_FONT.
+var OCRFontPath = ""
+
+// DefaultOCRLanguage is the tesseract language used when
+// Settings.OCRLanguage is empty.
+const DefaultOCRLanguage = "eng"
+
+// ocrTimeout limits the recognition of a single page.
+const ocrTimeout = 2 * time.Minute
+
+// ocrWord is a recognized word. The box is relative to the page image:
+// 0 is the left or top edge and 1 the right or bottom edge.
+type ocrWord struct {
+	Text       string
+	X, Y, W, H float64
+}
+
+// recognizePage runs OCR on a page image; replaced in tests.
+var recognizePage = tesseractWords
+
+// recognizePages returns the words of each page for the invisible text
+// layer of a searchable PDF. A missing tesseract binary skips OCR for the
+// whole document and a page that fails to recognize gets no text; neither
+// fails the PDF.
+func recognizePages(pages []vens.Page, lang string) [][]ocrWord {
+	if lang == "" {
+		lang = DefaultOCRLanguage
+	}
+	text := make([][]ocrWord, len(pages))
+	for i, p := range pages {
+		words, err := recognizePage(p.JPEG, lang)
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("OCR skipped: tesseract not found", "path", TesseractPath, "err", err)
+			return nil
+		}
+		if err != nil {
+			slog.Warn("OCR failed, page has no text layer", "page", i+1, "err", err)
+			continue
+		}
+		text[i] = words
+	}
+	return text
+}
+
+// tesseractWords recognizes a JPEG or TIFF image with tesseract and parses
+// its TSV output.
+func tesseractWords(img []byte, lang string) ([]ocrWord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, TesseractPath, "stdin", "stdout", "-l", lang, "tsv")
+	cmd.Stdin = bytes.NewReader(img)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return parseTesseractTSV(out)
+}
+
+// parseTesseractTSV reads the words (level 5 rows) of tesseract's TSV
+// output, scaling their boxes by the page size of the level 1 row.
+func parseTesseractTSV(data []byte) ([]ocrWord, error) {
+	var words []ocrWord
+	var pageW, pageH float64
+	for i, line := range strings.Split(string(data), "\n") {
+		f := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if i == 0 || len(f) < 12 {
+			continue // header or blank line
+		}
+		var n [10]float64
+		for j := range n {
+			v, err := strconv.ParseFloat(f[j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %q", i+1, f[j])
+			}
+			n[j] = v
+		}
+		level, left, top, width, height := n[0], n[6], n[7], n[8], n[9]
+		switch {
+		case level == 1:
+			pageW, pageH = width, height
+		case level == 5 && pageW > 0 && pageH > 0:
+			text := strings.TrimSpace(strings.Join(f[11:], "\t"))
+			if text == "" || width <= 0 || height <= 0 {
+				continue
+			}
+			words = append(words, ocrWord{
+				Text: text,
+				X:    left / pageW,
+				Y:    top / pageH,
+				W:    width / pageW,
+				H:    height / pageH,
+			})
+		}
+	}
+	return words, nil
+}
+
+// ocrLayer draws recognized words as invisible text over page images.
+type ocrLayer struct {
+	pdf       *fpdf.Fpdf
+	family    string
+	translate func(string) string
+}
+
+// newOCRLayer selects the text layer font: OCRFontPath when it loads,
+// otherwise Helvetica with Windows-1252 text.
+func newOCRLayer(pdf *fpdf.Fpdf) *ocrLayer {
+	if OCRFontPath != "" {
+		pdf.AddUTF8Font("ocr", "", OCRFontPath)
+		if pdf.Err() {
+			slog.Warn("OCR font not usable, falling back to Helvetica", "path", OCRFontPath, "err", pdf.Error())
+			pdf.ClearError()
+		} else {
+			return &ocrLayer{pdf: pdf, family: "ocr", translate: func(s string) string { return s }}
+		}
+	}
+	return &ocrLayer{pdf: pdf, family: "Helvetica", translate: pdf.UnicodeTranslatorFromDescriptor("")}
+}
+
+// draw places words over the image at (x, y) of size w x h mm. Each word is
+// scaled horizontally to cover its box, so selecting it highlights the
+// scanned word.
+func (l *ocrLayer) draw(words []ocrWord, x, y, w, h float64) {
+	if len(words) == 0 {
+		return
+	}
+	l.pdf.SetTextRenderingMode(3) // invisible
+	for _, word := range words {
+		text := l.translate(word.Text)
+		if text == "" {
+			continue
+		}
+		height := word.H * h
+		l.pdf.SetFont(l.family, "", height/25.4*72)
+		textW := l.pdf.GetStringWidth(text)
+		if textW <= 0 {
+			continue
+		}
+		left, baseline := x+word.X*w, y+(word.Y+word.H)*h
+		l.pdf.TransformBegin()
+		l.pdf.TransformScale(word.W*w/textW*100, 100, left, baseline)
+		l.pdf.Text(left, baseline, text)
+		l.pdf.TransformEnd()
+	}
+	l.pdf.SetTextRenderingMode(0)
+}
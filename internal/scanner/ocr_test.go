@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// pdfContent returns the decompressed streams of a PDF, which hold the page
+// content.
+func pdfContent(data []byte) []byte {
+	var out bytes.Buffer
+	for rest := data; ; {
+		i := bytes.Index(rest, []byte("stream\n"))
+		if i < 0 {
+			return out.Bytes()
+		}
+		rest = rest[i+len("stream\n"):]
+		end := bytes.Index(rest, []byte("endstream"))
+		if end < 0 {
+			return out.Bytes()
+		}
+		if zr, err := zlib.NewReader(bytes.NewReader(rest[:end])); err == nil {
+			io.Copy(&out, zr)
+		}
+		rest = rest[end+len("endstream"):]
+	}
+}
+
+func TestParseTesseractTSV(t *testing.T) {
+	tsv := "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"1\t1\t0\t0\t0\t0\t0\t0\t1000\t2000\t-1\t\n" +
+		"4\t1\t1\t1\t1\t0\t100\t200\t300\t40\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t100\t200\t120\t40\t96.5\tInvoice\n" +
+		"5\t1\t1\t1\t1\t2\t250\t200\t150\t40\t91\t  \n" +
+		"5\t1\t1\t1\t1\t3\t500\t1000\t200\t50\t88\tTotal\n"
+	words, err := parseTesseractTSV([]byte(tsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ocrWord{
+		{Text: "Invoice", X: 0.1, Y: 0.1, W: 0.12, H: 0.02},
+		{Text: "Total", X: 0.5, Y: 0.5, W: 0.2, H: 0.025},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("words = %+v, want %+v", words, want)
+	}
+	for i := range want {
+		if words[i] != want[i] {
+			t.Errorf("word %d = %+v, want %+v", i, words[i], want[i])
+		}
+	}
+
+	if _, err := parseTesseractTSV([]byte("header\n5\t1\t1\t1\t1\t1\tx\t0\t1\t1\t90\tbad\n")); err == nil {
+		t.Error("malformed TSV parsed without error")
+	}
+}
+
+func TestGeneratePDFOCR(t *testing.T) {
+	defer func(f func([]byte, string) ([]ocrWord, error)) { recognizePage = f }(recognizePage)
+	var calls []string
+	recognizePage = func(img []byte, lang string) ([]ocrWord, error) {
+		calls = append(calls, lang)
+		return []ocrWord{{Text: "Invoice", X: 0.1, Y: 0.1, W: 0.5, H: 0.1}}, nil
+	}
+	pages := []vens.Page{
+		{JPEG: noisyJPEG(t, 120, 160)},
+		{JPEG: bilevelTIFF(t, 240, 320)},
+	}
+
+	// Disabled: no OCR run and no text layer
+	data, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150})
+	if err != nil {
+		t.Fatalf("GeneratePDFWithOptions: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("OCR ran %d times with OCR disabled", len(calls))
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != len(pages) {
+		t.Errorf("pages = %d, want %d", n, len(pages))
+	}
+	if content := pdfContent(data); bytes.Contains(content, []byte("Tj")) {
+		t.Error("PDF without OCR has text")
+	}
+
+	// Enabled: each page gets invisible text
+	data, err = GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, OCR: true, OCRLanguage: "eng+jpn"})
+	if err != nil {
+		t.Fatalf("GeneratePDFWithOptions with OCR: %v", err)
+	}
+	if len(calls) != len(pages) || calls[0] != "eng+jpn" {
+		t.Errorf("OCR calls = %q, want %d with eng+jpn", calls, len(pages))
+	}
+	content := pdfContent(data)
+	if n := bytes.Count(content, []byte("(Invoice) Tj")); n != len(pages) {
+		t.Errorf("text layer has %d words, want %d", n, len(pages))
+	}
+	if !bytes.Contains(content, []byte("3 Tr")) {
+		t.Error("OCR text is not invisible")
+	}
+}
+
+func TestGeneratePDFOCRMissingTesseract(t *testing.T) {
+	defer func(p string) { TesseractPath = p }(TesseractPath)
+	TesseractPath = filepath.Join(t.TempDir(), "tesseract")
+
+	pages := []vens.Page{{JPEG: noisyJPEG(t, 120, 160)}}
+	data, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, OCR: true})
+	if err != nil {
+		t.Fatalf("GeneratePDFWithOptions: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Error("no PDF generated without tesseract")
+	}
+}
+
+func TestRunJobDualPDF(t *testing.T) {
+	defer func(f func([]byte, string) ([]ocrWord, error)) { recognizePage = f }(recognizePage)
+	recognizePage = func([]byte, string) ([]ocrWord, error) {
+		return []ocrWord{{Text: "Invoice", X: 0.1, Y: 0.1, W: 0.5, H: 0.1}}, nil
+	}
+	pages := []vens.Page{{JPEG: noisyJPEG(t, 120, 160)}, {JPEG: noisyJPEG(t, 120, 160)}}
+	scan := func(onPage func(vens.Page) error) error { return feedPages(onPage, pages, nil) }
+	var files []outputFile
+	deliver := func(f []outputFile) error { files = f; return nil }
+	fileNames := func(files []outputFile) []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	s := config.Settings{OCR: true, OCRDualPDF: true, FilenameTemplate: "doc"}
+	if _, err := runJob(scan, scanSource{}, vens.DefaultScanConfig(), "application/pdf", s, nil, deliver); err != nil {
+		t.Fatalf("runJob: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "doc_ocr.pdf" || files[1].Name != "doc.pdf" {
+		t.Fatalf("files = %v, want doc_ocr.pdf and doc.pdf", fileNames(files))
+	}
+	if !bytes.Contains(pdfContent(files[0].Data), []byte("(Invoice) Tj")) {
+		t.Error("doc_ocr.pdf has no text layer")
+	}
+	if bytes.Contains(pdfContent(files[1].Data), []byte("Tj")) {
+		t.Error("doc.pdf has a text layer, want image only")
+	}
+	for _, f := range files {
+		if n := bytes.Count(f.Data, []byte("/Type /Page\n")); n != len(pages) {
+			t.Errorf("%s has %d pages, want %d", f.Name, n, len(pages))
+		}
+	}
+
+	// Without OCR the option has no effect
+	s.OCR = false
+	if _, err := runJob(scan, scanSource{}, vens.DefaultScanConfig(), "application/pdf", s, nil, deliver); err != nil {
+		t.Fatalf("runJob without OCR: %v", err)
+	}
+	if len(files) != 1 || files[0].Name != "doc.pdf" {
+		t.Errorf("without OCR: files = %v, want doc.pdf", fileNames(files))
+	}
+}
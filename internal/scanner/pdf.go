@@ -6,81 +6,374 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	_ "image/jpeg"
+	"image/jpeg"
 	"image/png"
+	"log/slog"
+	"math"
 	"os"
+	"slices"
+	"time"
 
 	"codeberg.org/go-pdf/fpdf"
+	"golang.org/x/image/draw"
 	"golang.org/x/image/tiff"
 
 	"github.com/mzyy94/airscap/internal/vens"
 )
 
 // WritePDF combines scanned pages (JPEG or TIFF) into a single PDF file.
-// TIFF pages are converted to 1-bit paletted PNG before embedding.
-func WritePDF(pages []vens.Page, dpi int, isBW bool, outputPath string) error {
-	data, err := GeneratePDF(pages, dpi, isBW)
+// See GeneratePDF for how each page's format is determined.
+func WritePDF(pages []vens.Page, dpi int, bwHint bool, outputPath string) error {
+	data, err := GeneratePDF(pages, dpi, bwHint)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(outputPath, data, 0644)
 }
 
-// GeneratePDF combines scanned pages (JPEG or TIFF) into a PDF in memory.
-// TIFF pages are converted to 1-bit paletted PNG before embedding.
-func GeneratePDF(pages []vens.Page, dpi int, isBW bool) ([]byte, error) {
-	if len(pages) == 0 {
-		return nil, fmt.Errorf("no pages to write")
+// Bilevel page embeddings for PDFOptions.BWEmbedding.
+const (
+	BWEmbedPNG      = "png"      // lossless 1-bit PNG (Flate)
+	BWEmbedG4       = "g4"       // lossless CCITT Group 4, as fax and scanner TIFFs
+	BWEmbedSmallest = "smallest" // smallest of G4, 1-bit PNG and grayscale JPEG
+)
+
+// bwJPEGQuality is the JPEG quality tried for bilevel pages in BWEmbedSmallest.
+const bwJPEGQuality = 50
+
+// PDFOptions controls PDF generation.
+type PDFOptions struct {
+	DPI    int     // fallback resolution for pages without embedded DPI (default 300)
+	IsBW   bool    // treat pages of unrecognised format as bilevel TIFF
+	Margin float64 // blank border around each image in mm; the page grows to fit
+	// BWEmbedding selects how bilevel pages are embedded: BWEmbedPNG
+	// (default), BWEmbedG4 or BWEmbedSmallest.
+	BWEmbedding string
+	MaxBytes    int64 // size cap, see GeneratePDFWithOptions; 0 = no limit
+	PDFA        bool  // write PDF/A-2b for archiving
+	Metadata    PDFMetadata
+	OCR         bool   // add an invisible text layer recognized by tesseract
+	OCRLanguage string // tesseract language, e.g. "eng+jpn"; empty = DefaultOCRLanguage
+	// BestEffort leaves out pages that cannot be decoded or embedded
+	// instead of failing the whole PDF; see GeneratePDFWithSkipped.
+	BestEffort bool
+}
+
+// Version is the AirScap version written into the creator of generated
+// PDFs. main sets it from the build version.
+var Version = "dev"
+
+// PDFMetadata is the document information written into a PDF. Empty fields
+// are omitted; an empty Creator defaults to "AirScap <Version>" and a zero
+// CreationDate to the time the PDF is generated.
+type PDFMetadata struct {
+	Title        string
+	Author       string
+	Subject      string
+	Keywords     string
+	Creator      string
+	CreationDate time.Time
+}
+
+// isASCII reports whether s has only 7-bit characters.
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// withDefaults fills in the default creator and creation date.
+func (m PDFMetadata) withDefaults() PDFMetadata {
+	if m.Creator == "" {
+		m.Creator = "AirScap " + Version
 	}
-	if dpi <= 0 {
-		dpi = 300
+	if m.CreationDate.IsZero() {
+		m.CreationDate = time.Now()
 	}
+	return m
+}
 
-	pdf := fpdf.New("P", "mm", "", "")
-	pdf.SetAutoPageBreak(false, 0)
+// GeneratePDF combines scanned pages (JPEG or TIFF) into a PDF in memory.
+// Each page is decoded by its own format, sniffed from its magic bytes, so
+// a job may mix JPEG and TIFF pages; bwHint only decides for pages matching
+// neither. TIFF pages are converted to 1-bit paletted PNG before embedding.
+func GeneratePDF(pages []vens.Page, dpi int, bwHint bool) ([]byte, error) {
+	return GeneratePDFWithOptions(pages, PDFOptions{DPI: dpi, IsBW: bwHint})
+}
 
-	for i, p := range pages {
-		cfg, _, err := image.DecodeConfig(bytes.NewReader(p.JPEG))
+// GeneratePDFWithOptions is GeneratePDF with layout options and a size cap.
+// If the PDF exceeds opts.MaxBytes, JPEG pages are re-encoded at
+// progressively lower quality and resolution until it fits or the floor is
+// reached; the smallest attempt is returned either way.
+func GeneratePDFWithOptions(pages []vens.Page, opts PDFOptions) ([]byte, error) {
+	data, _, err := GeneratePDFWithSkipped(pages, opts)
+	return data, err
+}
+
+// GeneratePDFWithSkipped is GeneratePDFWithOptions that also returns the
+// indices of the pages left out of the PDF. Pages are only left out with
+// opts.BestEffort, so a page corrupted in transfer does not cost the rest of
+// the document; it is an error if no page is usable.
+func GeneratePDFWithSkipped(pages []vens.Page, opts PDFOptions) (data []byte, skipped []int, err error) {
+	if opts.DPI <= 0 {
+		opts.DPI = 300
+	}
+	var text [][]ocrWord
+	if opts.OCR {
+		text = recognizePages(pages, opts.OCRLanguage)
+	}
+	data, skipped, err = buildPDF(pages, opts, text)
+	if err != nil || opts.MaxBytes <= 0 || int64(len(data)) <= opts.MaxBytes {
+		return data, skipped, err
+	}
+	// Reductions decode every page again; leave out the unusable ones
+	pages, text = withoutPages(pages, text, skipped)
+	originalSize := len(data)
+	for _, step := range pdfReductionSteps {
+		reduced, err := recompressPages(pages, opts.DPI, step.quality, step.scale)
 		if err != nil {
-			return nil, fmt.Errorf("decode page %d image config: %w", i+1, err)
+			return nil, skipped, err
 		}
+		data, _, err = buildPDF(reduced, opts, text)
+		if err != nil {
+			return nil, skipped, err
+		}
+		if int64(len(data)) <= opts.MaxBytes {
+			slog.Info("PDF reduced to fit size limit", "original", originalSize, "size", len(data), "limit", opts.MaxBytes, "quality", step.quality, "scale", step.scale)
+			return data, skipped, nil
+		}
+	}
+	slog.Warn("PDF exceeds size limit at lowest quality", "original", originalSize, "size", len(data), "limit", opts.MaxBytes)
+	return data, skipped, nil
+}
 
-		// Use actual DPI embedded in the image data when available
-		pageDPI := dpi
-		if d := detectImageDPI(p.JPEG); d > 0 {
-			pageDPI = d
-		} else if p.PixelSize != nil && p.PixelSize.XRes > 0 {
-			pageDPI = p.PixelSize.XRes
+// withoutPages returns pages and their OCR text without the pages at the
+// given sorted indices.
+func withoutPages(pages []vens.Page, text [][]ocrWord, skip []int) ([]vens.Page, [][]ocrWord) {
+	if len(skip) == 0 {
+		return pages, text
+	}
+	var keptPages []vens.Page
+	var keptText [][]ocrWord
+	for i, p := range pages {
+		if slices.Contains(skip, i) {
+			continue
 		}
+		keptPages = append(keptPages, p)
+		if text != nil {
+			var t []ocrWord
+			if i < len(text) {
+				t = text[i]
+			}
+			keptText = append(keptText, t)
+		}
+	}
+	return keptPages, keptText
+}
 
-		widthMM := float64(cfg.Width) / float64(pageDPI) * 25.4
-		heightMM := float64(cfg.Height) / float64(pageDPI) * 25.4
+// pageLayout computes the PDF page size and image placement (all in mm) for
+// an image of widthPx x heightPx pixels at dpi, surrounded by margin mm.
+func pageLayout(widthPx, heightPx, dpi int, margin float64) (page fpdf.SizeType, x, y, w, h float64) {
+	margin = max(0, margin)
+	w = float64(widthPx) / float64(dpi) * 25.4
+	h = float64(heightPx) / float64(dpi) * 25.4
+	page = fpdf.SizeType{Wd: w + 2*margin, Ht: h + 2*margin}
+	return page, margin, margin, w, h
+}
 
-		pdf.AddPageFormat("P", fpdf.SizeType{Wd: widthMM, Ht: heightMM})
+// buildPDF lays out one page per image. text holds the recognized words of
+// each page for the OCR text layer; nil means none. With opts.BestEffort,
+// pages that cannot be embedded are left out and their indices returned.
+func buildPDF(pages []vens.Page, opts PDFOptions, text [][]ocrWord) ([]byte, []int, error) {
+	if len(pages) == 0 {
+		return nil, nil, fmt.Errorf("no pages to write")
+	}
 
-		name := fmt.Sprintf("page%d", i)
-		if isBW {
-			img, err := tiff.Decode(bytes.NewReader(p.JPEG))
-			if err != nil {
-				return nil, fmt.Errorf("decode page %d TIFF: %w", i+1, err)
+	meta := opts.Metadata.withDefaults()
+	pdf := fpdf.New("P", "mm", "", "")
+	pdf.SetAutoPageBreak(false, 0)
+	for _, f := range []struct {
+		set   func(string, bool)
+		value string
+	}{
+		{pdf.SetTitle, meta.Title},
+		{pdf.SetAuthor, meta.Author},
+		{pdf.SetSubject, meta.Subject},
+		{pdf.SetKeywords, meta.Keywords},
+		{pdf.SetCreator, meta.Creator},
+	} {
+		if f.value != "" {
+			// fpdf writes UTF-8 as UTF-16 with a byte order mark; keep
+			// plain ASCII readable
+			f.set(f.value, !isASCII(f.value))
+		}
+	}
+	pdf.SetCreationDate(meta.CreationDate)
+	pdf.SetModificationDate(meta.CreationDate)
+
+	var layer *ocrLayer
+	var skipped []int
+	g4 := map[string]g4Image{}
+	for i, p := range pages {
+		x, y, w, h, err := addImagePage(pdf, i, p, opts, g4)
+		if err != nil {
+			if !opts.BestEffort {
+				return nil, nil, err
 			}
-			palImg := toBitonalPNG(img)
-			var buf bytes.Buffer
-			if err := png.Encode(&buf, palImg); err != nil {
-				return nil, fmt.Errorf("encode page %d PNG: %w", i+1, err)
+			slog.Warn("leaving unreadable page out of PDF", "page", i+1, "err", err)
+			skipped = append(skipped, i)
+			continue
+		}
+		if i < len(text) && len(text[i]) > 0 {
+			if layer == nil {
+				layer = newOCRLayer(pdf)
 			}
-			pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, &buf)
-		} else {
-			pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "JPEG"}, bytes.NewReader(p.JPEG))
+			layer.draw(text[i], x, y, w, h)
 		}
-		pdf.ImageOptions(name, 0, 0, widthMM, heightMM, false, fpdf.ImageOptions{}, 0, "")
+	}
+	if len(skipped) == len(pages) {
+		return nil, skipped, fmt.Errorf("no readable pages to write")
 	}
 
 	var out bytes.Buffer
 	if err := pdf.Output(&out); err != nil {
-		return nil, fmt.Errorf("generate PDF: %w", err)
+		return nil, skipped, fmt.Errorf("generate PDF: %w", err)
+	}
+	data, err := embedG4(out.Bytes(), g4)
+	if err != nil {
+		return nil, skipped, err
+	}
+	if opts.PDFA {
+		data, err = convertToPDFA(data, meta)
+		return data, skipped, err
 	}
-	return out.Bytes(), nil
+	return data, skipped, nil
+}
+
+// addImagePage adds page i of a scan to pdf as a page of its own and returns
+// where the image was placed (in mm). The image is registered before the
+// page is added, so on error pdf is left as it was. Bilevel pages to embed
+// as G4 are added to g4 by their PNG image data; see embedG4.
+func addImagePage(pdf *fpdf.Fpdf, i int, p vens.Page, opts PDFOptions, g4 map[string]g4Image) (x, y, w, h float64, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("decode page %d image config: %w", i+1, err)
+	}
+
+	name := fmt.Sprintf("page%d", i)
+	if pageIsTIFF(p, opts.IsBW) {
+		img, err := tiff.Decode(bytes.NewReader(p.JPEG))
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("decode page %d TIFF: %w", i+1, err)
+		}
+		enc, err := encodeBitonal(img, opts.BWEmbedding)
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("encode page %d: %w", i+1, err)
+		}
+		if enc.g4 != nil {
+			b := img.Bounds()
+			g4[string(pngImageData(enc.data))] = g4Image{data: enc.g4, width: b.Dx(), height: b.Dy()}
+		}
+		pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: enc.imageType}, bytes.NewReader(enc.data))
+	} else {
+		pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "JPEG"}, bytes.NewReader(p.JPEG))
+	}
+	if err := pdf.Error(); err != nil {
+		pdf.ClearError()
+		return 0, 0, 0, 0, fmt.Errorf("embed page %d: %w", i+1, err)
+	}
+
+	size, x, y, w, h := pageLayout(cfg.Width, cfg.Height, pageDPI(p, opts.DPI), opts.Margin)
+	pdf.AddPageFormat("P", size)
+	pdf.ImageOptions(name, x, y, w, h, false, fpdf.ImageOptions{}, 0, "")
+	return x, y, w, h, nil
+}
+
+// pageIsTIFF reports whether a page holds TIFF data. In ColorAuto the
+// scanner returns color pages as JPEG and bilevel pages as TIFF within the
+// same job, and a page may not match the requested color mode, so the format
+// is sniffed per page; bwHint is only used when the data matches neither
+// signature.
+func pageIsTIFF(p vens.Page, bwHint bool) bool {
+	if len(p.JPEG) >= 2 && p.JPEG[0] == 0xFF && p.JPEG[1] == 0xD8 {
+		return false
+	}
+	if DetectImageMIME(p.JPEG) == "image/tiff" {
+		return true
+	}
+	return bwHint
+}
+
+// pdfReductionSteps lists the JPEG quality and scale factor tried in order
+// when a PDF exceeds its size cap. The last entry is the floor.
+var pdfReductionSteps = []struct {
+	quality int
+	scale   float64
+}{
+	{85, 1},
+	{70, 1},
+	{55, 0.75},
+	{45, 0.5},
+	{35, 0.5},
+}
+
+// recompressPages returns a copy of pages with every JPEG page re-encoded at
+// the given quality and downsampled by scale (1 = keep resolution). The page
+// resolution is adjusted so the physical page size is unchanged. TIFF pages
+// are already bilevel and are passed through as-is.
+func recompressPages(pages []vens.Page, dpi int, quality int, scale float64) ([]vens.Page, error) {
+	out := make([]vens.Page, len(pages))
+	for i, p := range pages {
+		out[i] = p
+		if len(p.JPEG) < 2 || p.JPEG[0] != 0xFF || p.JPEG[1] != 0xD8 {
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(p.JPEG))
+		if err != nil {
+			return nil, fmt.Errorf("decode page %d: %w", i+1, err)
+		}
+
+		srcDPI := pageDPI(p, dpi)
+
+		b := img.Bounds()
+		w := max(1, int(math.Round(float64(b.Dx())*scale)))
+		h := max(1, int(math.Round(float64(b.Dy())*scale)))
+		if w != b.Dx() || h != b.Dy() {
+			dst := image.NewRGBA(image.Rect(0, 0, w, h))
+			draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+			img = dst
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("encode page %d: %w", i+1, err)
+		}
+		// Re-encoded JPEGs carry no JFIF density, so record it in PixelSize
+		res := max(1, int(math.Round(float64(srcDPI)*float64(w)/float64(b.Dx()))))
+		out[i].JPEG = buf.Bytes()
+		ps := vens.PixelSizeInfo{}
+		if p.PixelSize != nil {
+			ps = *p.PixelSize
+		}
+		ps.XPixels, ps.YPixels, ps.XRes, ps.YRes = w, h, res, res
+		out[i].PixelSize = &ps
+	}
+	return out, nil
+}
+
+// pageDPI returns the resolution of a scanned page: the DPI embedded in the
+// image data when available, then the queried pixel size, then fallback.
+func pageDPI(p vens.Page, fallback int) int {
+	if d := detectImageDPI(p.JPEG); d > 0 {
+		return d
+	}
+	if p.PixelSize != nil && p.PixelSize.XRes > 0 {
+		return p.PixelSize.XRes
+	}
+	return fallback
 }
 
 // detectImageDPI extracts the X resolution (DPI) from image data.
@@ -164,6 +457,54 @@ func detectJPEGDPI(data []byte) int {
 	return 0
 }
 
+// bitonalPage is a bilevel page encoded for embedding.
+type bitonalPage struct {
+	data      []byte // PNG or JPEG registered with fpdf
+	imageType string // fpdf image type of data
+	g4        []byte // CCITT G4 data replacing the PNG stream; nil keeps data
+}
+
+// size returns the number of bytes the page takes up in the PDF.
+func (b bitonalPage) size() int {
+	if b.g4 != nil {
+		return len(b.g4)
+	}
+	return len(b.data)
+}
+
+// encodeBitonal encodes a bilevel page for embedding. The PNG is written at
+// best compression since fpdf copies its Flate stream into the PDF as is, and
+// is also what fpdf registers for a G4 page. With BWEmbedSmallest a grayscale
+// JPEG is tried as well, which pays off for dithered or photo-like pages.
+func encodeBitonal(img image.Image, embedding string) (bitonalPage, error) {
+	bitonal := toBitonalPNG(img)
+	var pngBuf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&pngBuf, bitonal); err != nil {
+		return bitonalPage{}, fmt.Errorf("PNG: %w", err)
+	}
+	best := bitonalPage{data: pngBuf.Bytes(), imageType: "PNG"}
+	if embedding != BWEmbedG4 && embedding != BWEmbedSmallest {
+		return best, nil
+	}
+	g4 := bitonalPage{data: best.data, imageType: "PNG", g4: encodeG4(bitonal)}
+	if embedding == BWEmbedG4 {
+		return g4, nil
+	}
+	if g4.size() < best.size() {
+		best = g4
+	}
+
+	var jpegBuf bytes.Buffer
+	if err := jpeg.Encode(&jpegBuf, img, &jpeg.Options{Quality: bwJPEGQuality}); err != nil {
+		return bitonalPage{}, fmt.Errorf("JPEG: %w", err)
+	}
+	if jpegBuf.Len() < best.size() {
+		best = bitonalPage{data: jpegBuf.Bytes(), imageType: "JPEG"}
+	}
+	return best, nil
+}
+
 // toBitonalPNG converts an image to a 1-bit paletted image (black & white).
 func toBitonalPNG(img image.Image) *image.Paletted {
 	bounds := img.Bounds()
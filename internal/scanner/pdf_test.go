@@ -0,0 +1,477 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// noisyJPEG returns a JPEG of random noise, which compresses poorly and
+// makes a realistic worst case for size reduction.
+func noisyJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGeneratePDFMaxBytes(t *testing.T) {
+	data := noisyJPEG(t, 600, 800)
+	pages := []vens.Page{
+		{Sheet: 1, Side: 0, JPEG: data},
+		{Sheet: 1, Side: 1, JPEG: data},
+	}
+
+	full, err := GeneratePDF(pages, 150, false)
+	if err != nil {
+		t.Fatalf("GeneratePDF: %v", err)
+	}
+
+	t.Run("no limit", func(t *testing.T) {
+		got, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(full) {
+			t.Errorf("size = %d, want unchanged %d", len(got), len(full))
+		}
+	})
+
+	t.Run("under cap", func(t *testing.T) {
+		limit := int64(len(full) / 3)
+		got, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, MaxBytes: limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(got)) > limit {
+			t.Errorf("size = %d, want <= %d", len(got), limit)
+		}
+	})
+}
+
+func TestRecompressPagesKeepsPhysicalSize(t *testing.T) {
+	pages := []vens.Page{{JPEG: noisyJPEG(t, 300, 400)}}
+	got, err := recompressPages(pages, 300, 50, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := got[0].PixelSize
+	if ps == nil || ps.XPixels != 150 || ps.YPixels != 200 || ps.XRes != 150 {
+		t.Errorf("PixelSize = %+v, want 150x200 @ 150 DPI", ps)
+	}
+	if pages[0].PixelSize != nil {
+		t.Error("input page was modified")
+	}
+}
+
+func TestPageLayoutMargin(t *testing.T) {
+	tests := []struct {
+		name         string
+		margin       float64
+		wantPageW    float64
+		wantPageH    float64
+		wantX, wantY float64
+		wantW, wantH float64
+	}{
+		{"no margin", 0, 210, 297, 0, 0, 210, 297},
+		{"10mm margin", 10, 230, 317, 10, 10, 210, 297},
+		{"negative margin ignored", -5, 210, 297, 0, 0, 210, 297},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A4 at 300 DPI: 2480.3 x 3507.9 px → use exact mm multiples via 254 DPI
+			page, x, y, w, h := pageLayout(2100, 2970, 254, tt.margin)
+			near := func(a, b float64) bool { return a-b < 0.001 && b-a < 0.001 }
+			if !near(page.Wd, tt.wantPageW) || !near(page.Ht, tt.wantPageH) {
+				t.Errorf("page = %.2fx%.2f, want %.2fx%.2f", page.Wd, page.Ht, tt.wantPageW, tt.wantPageH)
+			}
+			if !near(x, tt.wantX) || !near(y, tt.wantY) || !near(w, tt.wantW) || !near(h, tt.wantH) {
+				t.Errorf("image = (%.2f,%.2f %.2fx%.2f), want (%.2f,%.2f %.2fx%.2f)", x, y, w, h, tt.wantX, tt.wantY, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestGeneratePDFMargin(t *testing.T) {
+	pages := []vens.Page{{JPEG: noisyJPEG(t, 254, 254)}} // 1 inch at 254 DPI = 25.4mm
+	data, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 254, Margin: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 25.4mm + 2*5mm = 35.4mm = 100.35pt
+	if !bytes.Contains(data, []byte("/MediaBox [0 0 100.35 100.35]")) {
+		t.Error("page MediaBox does not include the margin")
+	}
+}
+
+// bilevelTIFF returns a text-like bilevel page: rows of short black strokes
+// of varying length on white, encoded as a TIFF like BW scans.
+func bilevelTIFF(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(2))
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 40; y+20 < h-40; y += 36 {
+		for x := 60; x < w-60; {
+			glyph := 6 + rng.Intn(14)
+			for gy := y; gy < y+20; gy++ {
+				for gx := x; gx < min(x+glyph, w-60); gx++ {
+					if rng.Intn(4) != 0 {
+						img.Pix[gy*img.Stride+gx] = 0
+					}
+				}
+			}
+			x += glyph + 4 + rng.Intn(6)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// textTIFF returns a bilevel TIFF that looks like a scanned text page:
+// lines of glyphs built from solid strokes with slightly ragged edges.
+func textTIFF(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(5))
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	fill := func(x0, y0, x1, y1 int) {
+		for y := y0; y < y1; y++ {
+			l, r := x0+rng.Intn(2), x1-rng.Intn(2)
+			for x := max(l, 0); x < min(r, w); x++ {
+				img.Pix[y*img.Stride+x] = 0
+			}
+		}
+	}
+	for y := 60; y+30 < h-60; y += 40 {
+		for x := 80; x+18 < w-80; x += 20 + rng.Intn(3)*10 {
+			strokes := rng.Intn(64) | 1
+			for i, s := range [][4]int{
+				{0, 0, 3, 24}, {13, 0, 16, 24}, {0, 0, 16, 3}, {0, 10, 16, 13}, {0, 21, 16, 24}, {6, 0, 9, 24},
+			} {
+				if strokes&(1<<i) != 0 {
+					fill(x+s[0], y+s[1], x+s[2], y+s[3])
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGeneratePDFBilevelSmaller(t *testing.T) {
+	data := textTIFF(t, 1240, 1754)
+	img, err := tiff.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Size of the page as previously embedded: default-compression 1-bit PNG
+	var legacy bytes.Buffer
+	if err := png.Encode(&legacy, toBitonalPNG(img)); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodeBitonal(img, BWEmbedPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded.imageType != "PNG" || encoded.g4 != nil {
+		t.Errorf("image type = %q (G4 %v), want PNG", encoded.imageType, encoded.g4 != nil)
+	}
+	if len(encoded.data) >= legacy.Len() {
+		t.Errorf("PNG embedding = %d bytes, want smaller than previous %d bytes", len(encoded.data), legacy.Len())
+	}
+
+	pages := []vens.Page{{JPEG: data}}
+	pngPDF, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, IsBW: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g4PDF, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, IsBW: true, BWEmbedding: BWEmbedG4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallest, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, IsBW: true, BWEmbedding: BWEmbedSmallest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// G4 codes each row against the one above, which suits text far better
+	if len(g4PDF) > len(pngPDF)*3/4 {
+		t.Errorf("G4 PDF = %d bytes, want at least 25%% smaller than PNG PDF %d bytes", len(g4PDF), len(pngPDF))
+	}
+	if len(smallest) > len(g4PDF) {
+		t.Errorf("smallest embedding PDF = %d bytes, larger than G4 PDF %d bytes", len(smallest), len(g4PDF))
+	}
+	t.Logf("legacy PNG %d, best PNG %d, PDF png %d, PDF g4 %d, PDF smallest %d", legacy.Len(), len(encoded.data), len(pngPDF), len(g4PDF), len(smallest))
+}
+
+func TestEncodeBitonalSmallestPicksSmaller(t *testing.T) {
+	// Random gray noise thresholds to an incompressible bilevel image
+	img := image.NewGray(image.Rect(0, 0, 400, 400))
+	rng := rand.New(rand.NewSource(3))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+	}
+	smallest, err := encodeBitonal(img, BWEmbedSmallest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, embedding := range []string{BWEmbedPNG, BWEmbedG4} {
+		other, err := encodeBitonal(img, embedding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if smallest.size() > other.size() {
+			t.Errorf("smallest = %d bytes (%s), larger than %s %d bytes", smallest.size(), smallest.imageType, embedding, other.size())
+		}
+	}
+}
+
+func TestGeneratePDFMixedColorAuto(t *testing.T) {
+	// ColorAuto: color pages arrive as JPEG, bilevel pages as TIFF
+	pages := []vens.Page{
+		{Sheet: 1, Side: 0, JPEG: noisyJPEG(t, 120, 160)},
+		{Sheet: 1, Side: 1, JPEG: bilevelTIFF(t, 240, 320)},
+	}
+	data, err := GeneratePDF(pages, 150, false)
+	if err != nil {
+		t.Fatalf("GeneratePDF: %v", err)
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != 2 {
+		t.Errorf("pages = %d, want 2", n)
+	}
+	if !bytes.Contains(data, []byte("/Filter /DCTDecode")) {
+		t.Error("JPEG page not embedded as DCT image")
+	}
+	if !bytes.Contains(data, []byte("/BitsPerComponent 1")) {
+		t.Error("TIFF page not embedded as 1-bit image")
+	}
+}
+
+func TestGeneratePDFIgnoresWrongHint(t *testing.T) {
+	jpegPage := vens.Page{JPEG: noisyJPEG(t, 120, 160)}
+	tiffPage := vens.Page{JPEG: bilevelTIFF(t, 240, 320)}
+	tests := []struct {
+		name   string
+		pages  []vens.Page
+		bwHint bool
+	}{
+		{"JPEG pages with BW hint", []vens.Page{jpegPage, jpegPage}, true},
+		{"TIFF pages without BW hint", []vens.Page{tiffPage, tiffPage}, false},
+		{"TIFF then JPEG with BW hint", []vens.Page{tiffPage, jpegPage}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "scan.pdf")
+			if err := WritePDF(tt.pages, 150, tt.bwHint, out); err != nil {
+				t.Fatalf("WritePDF: %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := bytes.Count(data, []byte("/Type /Page\n")); n != len(tt.pages) {
+				t.Errorf("pages = %d, want %d", n, len(tt.pages))
+			}
+		})
+	}
+}
+
+func TestGeneratePDFBestEffort(t *testing.T) {
+	good := vens.Page{JPEG: noisyJPEG(t, 120, 160)}
+	corrupt := vens.Page{JPEG: good.JPEG[:20]} // cut off in transfer
+	pages := []vens.Page{good, corrupt, good, {JPEG: []byte("II*\x00garbage")}}
+
+	if _, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150}); err == nil {
+		t.Fatal("GeneratePDFWithOptions() with a corrupt page succeeded, want an error")
+	}
+
+	data, skipped, err := GeneratePDFWithSkipped(pages, PDFOptions{DPI: 150, BestEffort: true})
+	if err != nil {
+		t.Fatalf("GeneratePDFWithSkipped: %v", err)
+	}
+	if !slices.Equal(skipped, []int{1, 3}) {
+		t.Errorf("skipped = %v, want [1 3]", skipped)
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != 2 {
+		t.Errorf("pages = %d, want the 2 good pages", n)
+	}
+
+	// The size cap re-encodes pages; the skipped ones stay out
+	_, skipped, err = GeneratePDFWithSkipped(pages, PDFOptions{DPI: 150, BestEffort: true, MaxBytes: 1})
+	if err != nil || !slices.Equal(skipped, []int{1, 3}) {
+		t.Errorf("with a size cap: skipped = %v, err = %v", skipped, err)
+	}
+
+	if _, _, err := GeneratePDFWithSkipped([]vens.Page{corrupt}, PDFOptions{DPI: 150, BestEffort: true}); err == nil {
+		t.Error("GeneratePDFWithSkipped() without a readable page succeeded, want an error")
+	}
+}
+
+func TestPageIsTIFF(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		bwHint bool
+		want   bool
+	}{
+		{"JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE0}, true, false},
+		{"TIFF little-endian", []byte{0x49, 0x49, 0x2A, 0x00}, false, true},
+		{"TIFF big-endian", []byte{0x4D, 0x4D, 0x00, 0x2A}, false, true},
+		{"unknown uses hint", []byte{0x00, 0x01, 0x02, 0x03}, true, true},
+		{"unknown without hint", []byte{0x00, 0x01, 0x02, 0x03}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageIsTIFF(vens.Page{JPEG: tt.data}, tt.bwHint); got != tt.want {
+				t.Errorf("pageIsTIFF = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pdfInfo parses the document information dictionary referenced by the
+// trailer. Values are literal strings or UTF-16BE hex strings, one per line
+// as fpdf and convertToPDFA write them.
+func pdfInfo(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	offsets, xref, err := parseXref(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var num int
+	trailer := data[xref:]
+	i := bytes.Index(trailer, []byte("/Info "))
+	if i < 0 {
+		t.Fatal("trailer has no /Info")
+	}
+	if _, err := fmt.Sscanf(string(trailer[i:]), "/Info %d 0 R", &num); err != nil || num >= len(offsets) {
+		t.Fatalf("bad /Info reference: %v", err)
+	}
+	obj, _, _ := bytes.Cut(data[offsets[num]:], []byte("endobj"))
+	info := make(map[string]string)
+	for _, line := range strings.Split(string(obj), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok || !strings.HasPrefix(key, "/") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(value, "<") && strings.HasSuffix(value, ">"):
+			b, err := hex.DecodeString(value[1 : len(value)-1])
+			if err != nil || !bytes.HasPrefix(b, []byte{0xFE, 0xFF}) {
+				t.Fatalf("%s: bad hex string %q", key, value)
+			}
+			u := make([]uint16, 0, len(b)/2)
+			for j := 2; j+1 < len(b); j += 2 {
+				u = append(u, binary.BigEndian.Uint16(b[j:]))
+			}
+			value = string(utf16.Decode(u))
+		case strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")"):
+			value = strings.NewReplacer(`\\`, `\`, `\(`, "(", `\)`, ")").Replace(value[1 : len(value)-1])
+		}
+		info[key[1:]] = value
+	}
+	return info
+}
+
+func TestGeneratePDFMetadata(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "1.2.3"
+	created := time.Date(2026, 4, 1, 9, 30, 0, 0, time.UTC)
+	meta := PDFMetadata{
+		Title:        "Invoice (April)",
+		Author:       "Accounting",
+		Subject:      "Scanned invoice",
+		Keywords:     "invoice 2026",
+		CreationDate: created,
+	}
+	pages := []vens.Page{{JPEG: noisyJPEG(t, 120, 160)}}
+
+	data, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, Metadata: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := pdfInfo(t, data)
+	want := map[string]string{
+		"Title":        "Invoice (April)",
+		"Author":       "Accounting",
+		"Subject":      "Scanned invoice",
+		"Keywords":     "invoice 2026",
+		"Creator":      "AirScap 1.2.3",
+		"CreationDate": created.Local().Format("D:20060102150405"),
+	}
+	for key, v := range want {
+		if info[key] != v {
+			t.Errorf("%s = %q, want %q", key, info[key], v)
+		}
+	}
+
+	// PDF/A keeps the metadata in both the info dictionary and XMP
+	meta.Title = "請求書 4月"
+	data, err = GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, PDFA: true, Metadata: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = pdfInfo(t, data)
+	if info["Title"] != meta.Title || info["Creator"] != "AirScap 1.2.3" || info["CreationDate"] != "D:20260401093000Z" {
+		t.Errorf("PDF/A info = %q", info)
+	}
+	for _, marker := range []string{
+		`<rdf:li xml:lang="x-default">請求書 4月</rdf:li>`,
+		"<pdf:Keywords>invoice 2026</pdf:Keywords>",
+		"<xmp:CreatorTool>AirScap 1.2.3</xmp:CreatorTool>",
+		"<xmp:CreateDate>2026-04-01T09:30:00Z</xmp:CreateDate>",
+	} {
+		if !bytes.Contains(data, []byte(marker)) {
+			t.Errorf("XMP lacks %q", marker)
+		}
+	}
+}
+
+func TestPDFMetadataFromSettings(t *testing.T) {
+	created := time.Now()
+	meta := pdfMetadata(config.Settings{PDFAuthor: "me"}, "scan_20260401_093000", created)
+	if meta.Title != "scan_20260401_093000" || meta.Author != "me" || !meta.CreationDate.Equal(created) {
+		t.Errorf("meta = %+v", meta)
+	}
+	if meta = pdfMetadata(config.Settings{PDFTitle: "Receipts"}, "scan", created); meta.Title != "Receipts" {
+		t.Errorf("Title = %q, want Receipts", meta.Title)
+	}
+}
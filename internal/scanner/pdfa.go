@@ -0,0 +1,267 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// pdfAProducer is written as producer of PDF/A files.
+const pdfAProducer = "AirScap"
+
+// convertToPDFA rewrites a PDF generated by buildPDF as PDF/A-2b. It adds a
+// binary comment after the header, an sRGB output intent, XMP metadata with
+// the PDF/A identification matching a new document info dictionary built
+// from meta, and a trailer ID. fpdf writes a plain cross-reference table with the info and
+// catalog dictionaries as the last two objects, so those two are replaced and
+// the new objects appended after them.
+func convertToPDFA(pdf []byte, meta PDFMetadata) ([]byte, error) {
+	headerEnd := bytes.IndexByte(pdf, '\n') + 1
+	if headerEnd == 0 || !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		return nil, fmt.Errorf("PDF/A: missing header")
+	}
+	offsets, xrefOffset, err := parseXref(pdf)
+	if err != nil {
+		return nil, fmt.Errorf("PDF/A: %w", err)
+	}
+	catalogNum := len(offsets) - 1
+	infoNum := catalogNum - 1
+	if infoNum < 1 {
+		return nil, fmt.Errorf("PDF/A: too few objects")
+	}
+	catalog := pdf[offsets[catalogNum]:xrefOffset]
+	start := bytes.Index(catalog, []byte("<<"))
+	end := bytes.LastIndex(catalog, []byte(">>"))
+	if !bytes.HasPrefix(catalog, fmt.Appendf(nil, "%d 0 obj", catalogNum)) || start < 0 || end < start {
+		return nil, fmt.Errorf("PDF/A: catalog not found")
+	}
+	catalogEntries := bytes.TrimSpace(catalog[start+2 : end])
+
+	comment := "%\xE2\xE3\xCF\xD3\n" // marks the file as binary
+	var buf bytes.Buffer
+	buf.Write(pdf[:headerEnd])
+	buf.WriteString(comment)
+	buf.Write(pdf[headerEnd:offsets[infoNum]])
+	for i := 1; i < infoNum; i++ {
+		offsets[i] += len(comment)
+	}
+	offsets = offsets[:infoNum]
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets)-1, body)
+	}
+	stream := func(dict string, data []byte) string {
+		return fmt.Sprintf("<<%s /Length %d>>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+
+	iccNum, intentNum, metadataNum := catalogNum+1, catalogNum+2, catalogNum+3
+	date := meta.CreationDate.UTC()
+	info := []string{"/Producer " + pdfTextString(pdfAProducer)}
+	for _, f := range []struct{ key, value string }{
+		{"Title", meta.Title},
+		{"Author", meta.Author},
+		{"Subject", meta.Subject},
+		{"Keywords", meta.Keywords},
+		{"Creator", meta.Creator},
+	} {
+		if f.value != "" {
+			info = append(info, "/"+f.key+" "+pdfTextString(f.value))
+		}
+	}
+	info = append(info, "/CreationDate "+date.Format("(D:20060102150405Z)"), "/ModDate "+date.Format("(D:20060102150405Z)"))
+	object("<<\n" + strings.Join(info, "\n") + "\n>>")
+	object(fmt.Sprintf("<<\n%s\n/Metadata %d 0 R\n/OutputIntents [%d 0 R]\n>>", catalogEntries, metadataNum, intentNum))
+	object(stream(" /N 3", srgbProfile()))
+	object(fmt.Sprintf("<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>", iccNum))
+	object(stream(" /Type /Metadata /Subtype /XML", pdfAMetadata(meta, date)))
+
+	sum := md5.Sum(pdf)
+	id := hex.EncodeToString(sum[:])
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, off := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n/ID [<%s> <%s>]\n>>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets), catalogNum, infoNum, id, id, xref)
+	return buf.Bytes(), nil
+}
+
+// parseXref reads the cross-reference table of an fpdf-generated PDF and
+// returns the object offsets indexed by object number and the offset of the
+// table itself.
+func parseXref(pdf []byte) ([]int, int, error) {
+	i := bytes.LastIndex(pdf, []byte("startxref\n"))
+	if i < 0 {
+		return nil, 0, fmt.Errorf("startxref not found")
+	}
+	line, _, _ := strings.Cut(string(pdf[i+len("startxref\n"):]), "\n")
+	xref, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || xref >= len(pdf) {
+		return nil, 0, fmt.Errorf("invalid startxref %q", line)
+	}
+	lines := strings.Split(string(pdf[xref:]), "\n")
+	if len(lines) < 3 || lines[0] != "xref" {
+		return nil, 0, fmt.Errorf("cross-reference table not found")
+	}
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 || len(lines) < 2+count {
+		return nil, 0, fmt.Errorf("unsupported cross-reference table")
+	}
+	offsets := make([]int, count)
+	for n := 1; n < count; n++ {
+		f := strings.Fields(lines[2+n])
+		if len(f) != 3 || f[2] != "n" {
+			return nil, 0, fmt.Errorf("unsupported cross-reference entry %q", lines[2+n])
+		}
+		if offsets[n], err = strconv.Atoi(f[0]); err != nil || offsets[n] >= xref {
+			return nil, 0, fmt.Errorf("invalid cross-reference entry %q", lines[2+n])
+		}
+	}
+	return offsets, xref, nil
+}
+
+// pdfTextString encodes s as a PDF text string: a literal string for ASCII,
+// otherwise UTF-16BE with a byte order mark in hex.
+func pdfTextString(s string) string {
+	if isASCII(s) {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`).Replace(s) + ")"
+	}
+	b := []byte{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.BigEndian.AppendUint16(b, u)
+	}
+	return "<" + hex.EncodeToString(b) + ">"
+}
+
+// pdfAMetadata returns the XMP packet identifying the file as PDF/A-2b. The
+// document metadata and dates match the document info dictionary, as
+// PDF/A requires.
+func pdfAMetadata(meta PDFMetadata, date time.Time) []byte {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	d := date.Format("2006-01-02T15:04:05Z")
+	var props strings.Builder
+	if meta.Title != "" {
+		fmt.Fprintf(&props, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", esc(meta.Title))
+	}
+	if meta.Author != "" {
+		fmt.Fprintf(&props, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", esc(meta.Author))
+	}
+	if meta.Subject != "" {
+		fmt.Fprintf(&props, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", esc(meta.Subject))
+	}
+	if meta.Keywords != "" {
+		fmt.Fprintf(&props, "<pdf:Keywords>%s</pdf:Keywords>\n", esc(meta.Keywords))
+	}
+	if meta.Creator != "" {
+		fmt.Fprintf(&props, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", esc(meta.Creator))
+	}
+	return []byte(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about=""
+ xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"
+ xmlns:dc="http://purl.org/dc/elements/1.1/"
+ xmlns:pdf="http://ns.adobe.com/pdf/1.3/"
+ xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<pdfaid:part>2</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+<pdf:Producer>` + pdfAProducer + `</pdf:Producer>
+` + props.String() + `<xmp:CreateDate>` + d + `</xmp:CreateDate>
+<xmp:ModifyDate>` + d + `</xmp:ModifyDate>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+}
+
+// srgbProfile returns an ICC v2 display profile for sRGB IEC61966-2.1, used
+// as the PDF/A output intent and embedded into color JPEG pages by tagSRGB:
+// the Bradford-adapted sRGB primaries and a sampled sRGB tone curve.
+var srgbProfile = sync.OnceValue(func() []byte {
+	be := binary.BigEndian
+	s15f16 := func(b []byte, v ...float64) []byte {
+		for _, x := range v {
+			b = be.AppendUint32(b, uint32(int32(math.Round(x*65536))))
+		}
+		return b
+	}
+	xyz := func(x, y, z float64) []byte {
+		return s15f16([]byte("XYZ \x00\x00\x00\x00"), x, y, z)
+	}
+	text := func(s string) []byte {
+		return append([]byte("text\x00\x00\x00\x00"+s), 0)
+	}
+	desc := func(s string) []byte {
+		b := be.AppendUint32([]byte("desc\x00\x00\x00\x00"), uint32(len(s)+1))
+		b = append(append(b, s...), 0)
+		b = be.AppendUint32(b, 0) // Unicode language code
+		b = be.AppendUint32(b, 0) // Unicode count
+		b = be.AppendUint16(b, 0) // ScriptCode code
+		b = append(b, 0)          // ScriptCode count
+		return append(b, make([]byte, 67)...)
+	}
+	curve := be.AppendUint32([]byte("curv\x00\x00\x00\x00"), 1024)
+	for i := range 1024 {
+		v := float64(i) / 1023
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = be.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc("sRGB IEC61966-2.1")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9505, 1, 1.0891)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+	offset := 128 + 4 + 12*len(tags)
+	table := be.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	for _, t := range tags {
+		table = append(table, t.sig...)
+		table = be.AppendUint32(table, uint32(offset+len(data)))
+		table = be.AppendUint32(table, uint32(len(t.data)))
+		data = append(data, t.data...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+
+	header := be.AppendUint32(nil, uint32(offset+len(data)))
+	header = append(header, 0, 0, 0, 0)               // preferred CMM
+	header = be.AppendUint32(header, 0x02100000)      // version 2.1
+	header = append(header, "mntrRGB XYZ "...)        // class, color space, PCS
+	for _, v := range []uint16{2025, 1, 1, 0, 0, 0} { // creation date
+		header = be.AppendUint16(header, v)
+	}
+	header = append(header, "acsp"...)
+	header = append(header, make([]byte, 4+4+4+4+8+4)...) // platform .. rendering intent
+	header = s15f16(header, 0.9642, 1, 0.8249)            // PCS illuminant (D50)
+	header = append(header, make([]byte, 128-len(header))...)
+	return append(append(header, table...), data...)
+})
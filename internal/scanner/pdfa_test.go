@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func TestGeneratePDFA(t *testing.T) {
+	pages := []vens.Page{
+		{JPEG: noisyJPEG(t, 120, 160)},
+		{JPEG: bilevelTIFF(t, 240, 320)},
+	}
+	data, err := GeneratePDFWithOptions(pages, PDFOptions{DPI: 150, PDFA: true})
+	if err != nil {
+		t.Fatalf("GeneratePDFWithOptions: %v", err)
+	}
+
+	for _, marker := range []string{
+		"%PDF-1.3\n%\xE2\xE3\xCF\xD3\n",
+		"/OutputIntents [",
+		"/Type /OutputIntent /S /GTS_PDFA1",
+		"/Type /Metadata /Subtype /XML",
+		"<pdfaid:part>2</pdfaid:part>",
+		"<pdfaid:conformance>B</pdfaid:conformance>",
+		"/Producer (AirScap)",
+		"<pdf:Producer>AirScap</pdf:Producer>",
+		"/ID [<",
+	} {
+		if !bytes.Contains(data, []byte(marker)) {
+			t.Errorf("PDF/A output lacks %q", marker)
+		}
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != len(pages) {
+		t.Errorf("pages = %d, want %d", n, len(pages))
+	}
+
+	// Every cross-reference entry points at its object
+	offsets, _, err := parseXref(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, off := range offsets[1:] {
+		if want := fmt.Sprintf("%d 0 obj\n", n+1); !bytes.HasPrefix(data[off:], []byte(want)) {
+			t.Errorf("object %d: offset %d points at %q", n+1, off, data[off:off+min(len(want), len(data)-off)])
+		}
+	}
+}
+
+func TestSRGBProfile(t *testing.T) {
+	p := srgbProfile()
+	if size := binary.BigEndian.Uint32(p); int(size) != len(p) {
+		t.Errorf("profile size field = %d, want %d", size, len(p))
+	}
+	if string(p[12:24]) != "mntrRGB XYZ " || string(p[36:40]) != "acsp" {
+		t.Errorf("header = %q", p[:40])
+	}
+	if n := binary.BigEndian.Uint32(p[128:]); n != 9 {
+		t.Errorf("tag count = %d, want 9", n)
+	}
+}
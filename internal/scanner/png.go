@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// FormatPNG is the Settings.Format and eSCL DocumentFormat that saves each
+// page as a lossless PNG instead of the scanner's JPEG.
+const FormatPNG = "image/png"
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// encodePNGPage re-encodes a scanned page as PNG. JPEG pages keep their
+// decoded pixels; TIFF (B&W) pages become 1-bit PNGs. The page resolution is
+// written as a pHYs chunk, and srgb adds an sRGB chunk to color pages.
+func encodePNGPage(p vens.Page, dpi int, srgb bool) (vens.Page, error) {
+	var img image.Image
+	var err error
+	isTIFF := pageIsTIFF(p, false)
+	if isTIFF {
+		img, err = tiff.Decode(bytes.NewReader(p.JPEG))
+		if err == nil {
+			img = toBitonalPNG(img)
+		}
+	} else {
+		img, err = jpeg.Decode(bytes.NewReader(p.JPEG))
+	}
+	if err != nil {
+		return p, fmt.Errorf("decode page: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return p, fmt.Errorf("encode PNG: %w", err)
+	}
+	dpi = pageDPI(p, dpi)
+	chunks := [][]byte{pngPHYs(dpi)}
+	if _, gray := img.(*image.Gray); srgb && !isTIFF && !gray {
+		chunks = append(chunks, pngChunk("sRGB", []byte{0})) // perceptual intent
+	}
+
+	out := p
+	out.JPEG = insertPNGChunks(buf.Bytes(), chunks...)
+	b := img.Bounds()
+	out.PixelSize = &vens.PixelSizeInfo{XPixels: b.Dx(), YPixels: b.Dy(), XRes: dpi, YRes: dpi}
+	return out, nil
+}
+
+// pngPHYs returns a pHYs chunk for dpi, which PNG stores in pixels per meter.
+func pngPHYs(dpi int) []byte {
+	ppm := uint32(float64(dpi)/0.0254 + 0.5)
+	data := binary.BigEndian.AppendUint32(nil, ppm)
+	data = binary.BigEndian.AppendUint32(data, ppm)
+	return pngChunk("pHYs", append(data, 1)) // unit: meter
+}
+
+// pngChunk encodes a PNG chunk with its length and CRC.
+func pngChunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(c, typ...)
+	c = append(c, data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+// insertPNGChunks adds chunks right after the IHDR chunk of a PNG written
+// by image/png, where pHYs and sRGB must appear before the image data.
+func insertPNGChunks(data []byte, chunks ...[]byte) []byte {
+	pos := len(pngSignature)
+	if len(data) < pos+8 || string(data[pos+4:pos+8]) != "IHDR" {
+		return data
+	}
+	pos += 12 + int(binary.BigEndian.Uint32(data[pos:]))
+	out := append([]byte{}, data[:pos]...)
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return append(out, data[pos:]...)
+}
+
+// pngImageData returns the concatenated IDAT data of a PNG, which fpdf
+// copies into the PDF image stream as is.
+func pngImageData(data []byte) []byte {
+	var out []byte
+	for pos := len(pngSignature); pos+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[pos:]))
+		if pos+12+n > len(data) {
+			break
+		}
+		if string(data[pos+4:pos+8]) == "IDAT" {
+			out = append(out, data[pos+8:pos+8+n]...)
+		}
+		pos += 12 + n
+	}
+	return out
+}
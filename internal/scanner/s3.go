@@ -0,0 +1,245 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// s3Target is a bucket on AWS S3 or an S3-compatible server (MinIO, ...)
+// that button scans are uploaded to.
+type s3Target struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	prefix    string // key prefix without leading slash; "" or ends with "/"
+	pathStyle bool
+}
+
+// newS3Target builds the S3 destination configured in settings. Without an
+// endpoint the AWS endpoint of the region is used; an endpoint without a
+// scheme is assumed to be HTTPS.
+func newS3Target(s config.Settings) (s3Target, error) {
+	if s.S3Bucket == "" {
+		return s3Target{}, errors.New("S3 bucket not configured")
+	}
+	region := s.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := s.S3Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	} else if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return s3Target{}, fmt.Errorf("invalid S3 endpoint %q", s.S3Endpoint)
+	}
+
+	prefix := strings.TrimLeft(s.S3Prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return s3Target{
+		endpoint:  u,
+		bucket:    s.S3Bucket,
+		region:    region,
+		accessKey: s.S3AccessKey,
+		secretKey: s.S3SecretKey,
+		prefix:    prefix,
+		pathStyle: s.S3UsePathStyle,
+	}, nil
+}
+
+// objectURL returns the URL of key, addressed as endpoint/bucket/key with
+// path-style addressing and bucket.endpoint/key otherwise.
+func (t s3Target) objectURL(key string) *url.URL {
+	u := *t.endpoint
+	p := "/" + key
+	if t.pathStyle {
+		p = "/" + t.bucket + p
+	} else {
+		u.Host = t.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + p
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+// upload puts each file into the bucket under the key prefix.
+func (t s3Target) upload(files []outputFile) error {
+	client := &http.Client{Timeout: 60 * time.Second}
+	for _, f := range files {
+		if err := t.put(client, t.prefix+f.Name, f.Data); err != nil {
+			return fmt.Errorf("S3 upload %s: %w", f.Name, err)
+		}
+	}
+	slog.Info("scan uploaded to S3", "bucket", t.bucket, "prefix", t.prefix, "files", len(files))
+	return nil
+}
+
+func (t s3Target) put(client *http.Client, key string, data []byte) error {
+	req, err := http.NewRequest("PUT", t.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s3ContentType(key))
+	if t.accessKey != "" {
+		signS3Request(req, data, t.accessKey, t.secretKey, t.region, time.Now())
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		xml.Unmarshal(body, &e)
+		switch {
+		case e.Code == "NoSuchBucket":
+			return fmt.Errorf("bucket %q does not exist", t.bucket)
+		case e.Code != "":
+			return fmt.Errorf("HTTP %d: %s: %s", resp.StatusCode, e.Code, e.Message)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// s3ContentType returns the MIME type stored with an uploaded scan file.
+func s3ContentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		return "application/pdf"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".tif", ".tiff":
+		return "image/tiff"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return FormatWebP
+	}
+	return "application/octet-stream"
+}
+
+// s3EscapePath percent-encodes p the way AWS Signature Version 4 expects:
+// everything but unreserved characters and "/".
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signS3Request adds an AWS Signature Version 4 Authorization header to req
+// for the S3 service. The host and all headers already set on req are
+// signed; payload is the request body.
+func signS3Request(req *http.Request, payload []byte, accessKey, secretKey, region string, now time.Time) {
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	crSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crSum[:])
+
+	key := sigV4Key(secretKey, date, region, "s3")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes q sorted by key as Signature Version 4 requires.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, s3EscapeQuery(k)+"="+s3EscapeQuery(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3EscapeQuery(s string) string {
+	return strings.ReplaceAll(s3EscapePath(s), "/", "%2F")
+}
+
+// sigV4Key derives the Signature Version 4 signing key.
+func sigV4Key(secretKey, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secretKey), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -2,14 +2,19 @@ package scanner
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +33,15 @@ type ScanJobStatus struct {
 	LastScan  string `json:"lastScan,omitempty"` // RFC3339
 	Pages     int    `json:"pages"`
 	FilePath  string `json:"filePath,omitempty"`
+	Document  string `json:"document,omitempty"` // file name of the downloadable document, if any
+
+	PagesScanned int `json:"pagesScanned,omitempty"` // pages received so far by the running scan
+	Progress     int `json:"progress,omitempty"`     // estimated completion in percent, see estimateProgress
+
+	doc     []byte      // last generated document, served by the download endpoint
+	docTime time.Time   // when doc was generated; stable modtime for range requests
+	jobs    int         // jobs started so far, see Jobs
+	history *JobHistory // results of recent jobs; nil = not recorded
 }
 
 // Snapshot returns a copy of the current status.
@@ -40,6 +54,10 @@ func (s *ScanJobStatus) Snapshot() ScanJobStatus {
 		LastScan:  s.LastScan,
 		Pages:     s.Pages,
 		FilePath:  s.FilePath,
+		Document:  s.Document,
+
+		PagesScanned: s.PagesScanned,
+		Progress:     s.Progress,
 	}
 }
 
@@ -48,16 +66,56 @@ func (s *ScanJobStatus) SetScanning(v bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Scanning = v
+	s.PagesScanned = 0
+	s.Progress = 0
 	if v {
 		s.LastError = ""
+		s.Document = ""
+		s.doc = nil
+		s.jobs++
+	}
+}
+
+// Jobs returns the number of jobs started so far, letting callers notice
+// that a scan ran since they last looked. It is safe to call on a nil
+// receiver.
+func (s *ScanJobStatus) Jobs() int {
+	if s == nil {
+		return 0
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.jobs
+}
+
+// SetHistory makes the status record the result of each job in h.
+func (s *ScanJobStatus) SetHistory(h *JobHistory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = h
+}
+
+// History returns the results of recent jobs, newest first. It is empty
+// without a history set by SetHistory.
+func (s *ScanJobStatus) History() []HistoryEntry {
+	s.mu.RLock()
+	h := s.history
+	s.mu.RUnlock()
+	return h.Entries()
 }
 
 // SetResult records the outcome of a completed scan.
 func (s *ScanJobStatus) SetResult(err error, pages int, filePath string) {
+	s.setResult(err, pages, filePath, HistoryEntry{})
+}
+
+// setResult is SetResult, adding the job to the history with the format
+// and destination of entry.
+func (s *ScanJobStatus) setResult(err error, pages int, filePath string, entry HistoryEntry) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	s.Scanning = false
+	s.PagesScanned = 0
+	s.Progress = 0
 	s.LastScan = time.Now().UTC().Format(time.RFC3339)
 	s.Pages = pages
 	s.FilePath = filePath
@@ -66,6 +124,67 @@ func (s *ScanJobStatus) SetResult(err error, pages int, filePath string) {
 	} else {
 		s.LastError = ""
 	}
+	entry.Time, entry.Pages, entry.Target, entry.Error = s.LastScan, pages, filePath, s.LastError
+	h := s.history
+	s.mu.Unlock()
+	if h != nil {
+		h.Add(entry)
+	}
+}
+
+// SetJobResult records the outcome of a button-scan job like SetResult. With
+// Settings.IgnoreEmptyScan, a job that found no paper or returned no pages is
+// a no-op instead: the scanning state is cleared without an error, the
+// previous result is kept and report is false so the caller skips
+// notifications.
+func (s *ScanJobStatus) SetJobResult(settings config.Settings, err error, pages int, filePath string) (report bool) {
+	if !settings.IgnoreEmptyScan || pages > 0 || !IsEmptyScan(err) {
+		s.setResult(err, pages, filePath, HistoryEntry{Format: settings.Format, Destination: settings.SaveType})
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Scanning = false
+	s.PagesScanned = 0
+	s.Progress = 0
+	s.LastError = ""
+	return false
+}
+
+// SetProgress records the pages received so far and the estimated progress
+// of the running scan. It is safe to call on a nil receiver.
+func (s *ScanJobStatus) SetProgress(pagesScanned, progress int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.PagesScanned = pagesScanned
+	s.Progress = progress
+}
+
+// SetDocument keeps a copy of the job's generated document for download.
+// It is safe to call on a nil receiver.
+func (s *ScanJobStatus) SetDocument(name string, data []byte) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Document = name
+	s.doc = data
+	s.docTime = time.Now()
+}
+
+// LastDocument returns the most recent generated document, its file name and
+// generation time. ok is false if no document is available.
+func (s *ScanJobStatus) LastDocument() (name string, data []byte, modTime time.Time, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.doc == nil {
+		return "", nil, time.Time{}, false
+	}
+	return s.Document, s.doc, s.docTime, true
 }
 
 // SettingsToScanConfig converts config.Settings to vens.ScanConfig.
@@ -97,6 +216,7 @@ func SettingsToScanConfig(s config.Settings) vens.ScanConfig {
 	default:
 		cfg.Quality = vens.QualityAuto
 	}
+	cfg.Quality = capQuality(cfg.Quality, s)
 
 	cfg.Duplex = s.Duplex
 	if s.BlankPageRemoval != nil {
@@ -112,25 +232,9 @@ func SettingsToScanConfig(s config.Settings) vens.ScanConfig {
 	cfg.CompressionArg = byte(0x0E - compression)
 
 	// Paper size for button scan
-	switch s.PaperSize {
-	case "a4":
-		cfg.PaperSize = vens.PaperA4
-		dim := vens.PaperDimensions[vens.PaperA4]
-		cfg.PaperWidth = dim.Width
-		cfg.PaperHeight = dim.Height
-	case "a5":
-		cfg.PaperSize = vens.PaperA5
-		dim := vens.PaperDimensions[vens.PaperA5]
-		cfg.PaperWidth = dim.Width
-		cfg.PaperHeight = dim.Height
-	case "business_card":
-		cfg.PaperSize = vens.PaperBusinessCard
-		dim := vens.PaperDimensions[vens.PaperBusinessCard]
-		cfg.PaperWidth = dim.Width
-		cfg.PaperHeight = dim.Height
-	case "postcard":
-		cfg.PaperSize = vens.PaperPostcard
-		dim := vens.PaperDimensions[vens.PaperPostcard]
+	if size, ok := vens.ParsePaperSize(s.PaperSize); ok && size != vens.PaperAuto {
+		dim := vens.PaperDimensions[size]
+		cfg.PaperSize = size
 		cfg.PaperWidth = dim.Width
 		cfg.PaperHeight = dim.Height
 	}
@@ -138,194 +242,1024 @@ func SettingsToScanConfig(s config.Settings) vens.ScanConfig {
 	return cfg
 }
 
+// ScanOverrides are per-scan image processing options requested by the
+// client. A nil field leaves the value from the settings (or the default)
+// in place.
+type ScanOverrides struct {
+	BlankPageRemoval *bool `json:"blankPageRemoval,omitempty"`
+	BleedThrough     *bool `json:"bleedThrough,omitempty"`
+}
+
+// Apply sets the overridden options on cfg.
+func (o ScanOverrides) Apply(cfg *vens.ScanConfig) {
+	if o.BlankPageRemoval != nil {
+		cfg.BlankPageRemoval = *o.BlankPageRemoval
+	}
+	if o.BleedThrough != nil {
+		cfg.BleedThrough = *o.BleedThrough
+	}
+}
+
+// CheckDestination reports why the save destination selected by
+// Settings.SaveType cannot take a button scan, or nil if it is configured.
+// "none" needs no configuration.
+func CheckDestination(s config.Settings) error {
+	switch s.SaveType {
+	case "none", "":
+		return nil
+	case "local":
+		if s.SavePath == "" {
+			return errors.New("save path not configured")
+		}
+	case "ftp":
+		if s.FTPHost == "" {
+			return errors.New("FTP host not configured")
+		}
+	case "sftp":
+		if s.SFTPHost == "" {
+			return errors.New("SFTP host not configured")
+		}
+	case "paperless":
+		if s.PaperlessURL == "" {
+			return errors.New("Paperless-ngx URL not configured")
+		}
+	case "smb":
+		if s.SMBHost == "" || s.SMBShare == "" {
+			return errors.New("SMB host or share not configured")
+		}
+	case "email":
+		if s.SMTPHost == "" || s.SMTPTo == "" {
+			return errors.New("SMTP host or recipient not configured")
+		}
+	case "s3":
+		if s.S3Bucket == "" {
+			return errors.New("S3 bucket not configured")
+		}
+	case "fifo":
+		if s.FIFOPath == "" {
+			return errors.New("FIFO path not configured")
+		}
+	default:
+		return fmt.Errorf("unknown save type %q", s.SaveType)
+	}
+	return nil
+}
+
+// DestinationEnabled reports whether the save destination selected by
+// Settings.SaveType takes button scans. A disabled destination is skipped
+// but keeps its settings, so it can be turned back on later.
+func DestinationEnabled(s config.Settings) bool {
+	var enabled *bool
+	switch s.SaveType {
+	case "local":
+		enabled = s.LocalEnabled
+	case "ftp":
+		enabled = s.FTPEnabled
+	case "sftp":
+		enabled = s.SFTPEnabled
+	case "paperless":
+		enabled = s.PaperlessEnabled
+	case "smb":
+		enabled = s.SMBEnabled
+	case "email":
+		enabled = s.EmailEnabled
+	case "s3":
+		enabled = s.S3Enabled
+	case "fifo":
+		enabled = s.FIFOEnabled
+	}
+	return enabled == nil || *enabled
+}
+
 // RunSaveJob executes a scan and saves the result to the filesystem.
-func RunSaveJob(sc *Scanner, cfg vens.ScanConfig, format string, savePath string) (int, error) {
+// Image pages are written as they are scanned; a PDF is written at the end.
+// The generated document, if any, is recorded in status (which may be nil).
+func RunSaveJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	savePath := s.SavePath
 	if err := os.MkdirAll(savePath, 0755); err != nil {
 		return 0, fmt.Errorf("create save directory: %w", err)
 	}
 
 	slog.Info("button scan starting", "format", format, "savePath", savePath)
-	pages, err := sc.Scan(cfg, nil)
+	return runStoreJob(sc, cfg, format, s, status, localStore{dir: savePath}, 1)
+}
+
+// RunFTPJob executes a scan and uploads the result to an FTP server.
+// Image pages are uploaded as they are scanned, several at a time over
+// separate connections; a PDF is uploaded at the end.
+// The generated document, if any, is recorded in status (which may be nil).
+func RunFTPJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	host := s.FTPHost
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "21")
+	}
+
+	slog.Info("button scan starting (FTP)", "format", format, "host", host)
+	return runStoreJob(sc, cfg, format, s, status, &ftpStore{host: host, user: s.FTPUser, password: s.FTPPassword}, uploadConcurrency(s))
+}
+
+// RunSFTPJob executes a scan and uploads the result to an SFTP server.
+// The generated document, if any, is recorded in status (which may be nil).
+func RunSFTPJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	target, err := newSFTPTarget(s)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("button scan starting (SFTP)", "format", format, "host", target.host, "path", target.dir)
+	return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, format, s, status, target.upload)
+}
+
+// RunPaperlessJob executes a scan and uploads the result to Paperless-ngx.
+// A PDF is uploaded as a single document, images as one document per page,
+// several at a time.
+// The generated document, if any, is recorded in status (which may be nil).
+func RunPaperlessJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	baseURL := strings.TrimRight(s.PaperlessURL, "/")
+
+	slog.Info("button scan starting (Paperless-ngx)", "format", format, "url", baseURL)
+	return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, format, s, status, func(files []outputFile) error {
+		_, err := uploadPages(files, uploadConcurrency(s), func(f outputFile) error {
+			if err := uploadToPaperless(baseURL, s.PaperlessToken, path.Base(f.Name), f.Data); err != nil {
+				return fmt.Errorf("paperless upload %s: %w", f.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		slog.Info("scan uploaded to Paperless-ngx", "files", len(files))
+		return nil
+	})
+}
+
+// RunURLJob executes a one-off scan and POSTs the result as a single PDF to
+// dest, a URL given for this scan only, as the "file" field of a multipart
+// form. authorization, if not empty, is sent as the Authorization header.
+// The format and destination of s are ignored.
+func RunURLJob(sc PageSource, cfg vens.ScanConfig, dest, authorization string, s config.Settings, status *ScanJobStatus) (int, error) {
+	slog.Info("ad-hoc scan starting", "host", urlHost(dest))
+	return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, "application/pdf", s, status, urlDelivery(dest, authorization))
+}
+
+// urlDelivery returns the delivery function of RunURLJob.
+func urlDelivery(dest, authorization string) func([]outputFile) error {
+	return func(files []outputFile) error {
+		f := files[0]
+		if err := uploadMultipart(dest, authorization, "file", path.Base(f.Name), f.Data); err != nil {
+			return fmt.Errorf("upload %s: %w", f.Name, err)
+		}
+		slog.Info("scan uploaded", "host", urlHost(dest), "file", path.Base(f.Name))
+		return nil
+	}
+}
+
+// urlHost returns the host of rawURL for logging, leaving out any
+// credentials, path or query that may carry secrets.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// RunSMBJob executes a scan and writes the result to a directory on an
+// SMB/CIFS share. The generated document, if any, is recorded in status
+// (which may be nil).
+func RunSMBJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	target := newSMBTarget(s)
+
+	slog.Info("button scan starting (SMB)", "format", format, "host", target.host, "share", target.share, "path", target.dir)
+	return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, format, s, status, target.upload)
+}
+
+// RunEmailJob executes a scan and mails the result as attachments through
+// the configured SMTP server. The subject carries the scan time and page count.
+// The generated document, if any, is recorded in status (which may be nil).
+func RunEmailJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	target, err := newEmailTarget(s)
+	if err != nil {
+		return 0, err
+	}
+
+	var pages int
+	var scanned time.Time
+	scan := func(onPage func(vens.Page) error) error {
+		err := sc.ScanStreaming(cfg, func(p vens.Page) error {
+			pages++
+			return onPage(p)
+		})
+		scanned = time.Now()
+		return err
+	}
+
+	slog.Info("button scan starting (email)", "format", format, "host", target.host, "to", s.SMTPTo)
+	return runJob(scan, sourceOf(sc), cfg, format, s, status, func(files []outputFile) error {
+		return target.send(emailSubject(scanned, pages), files)
+	})
+}
+
+// RunS3Job executes a scan and uploads the result to an S3 bucket or an
+// S3-compatible server. The generated document, if any, is recorded in status
+// (which may be nil).
+func RunS3Job(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus) (int, error) {
+	target, err := newS3Target(s)
 	if err != nil {
-		return len(pages), fmt.Errorf("scan: %w", err)
+		return 0, err
+	}
+
+	slog.Info("button scan starting (S3)", "format", format, "endpoint", target.endpoint.Host, "bucket", target.bucket, "prefix", target.prefix)
+	return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, format, s, status, target.upload)
+}
+
+// RunDestinationJob runs the job of the destination selected by
+// Settings.SaveType, saving in Settings.Format (a FIFO always gets a PDF).
+// It also returns the target the pages were sent to, for notifications.
+func RunDestinationJob(sc PageSource, cfg vens.ScanConfig, s config.Settings, status *ScanJobStatus) (pages int, target string, err error) {
+	switch s.SaveType {
+	case "local":
+		pages, err = RunSaveJob(sc, cfg, s.Format, s, status)
+		target = s.SavePath
+	case "ftp":
+		pages, err = RunFTPJob(sc, cfg, s.Format, s, status)
+		target = s.FTPHost
+	case "sftp":
+		pages, err = RunSFTPJob(sc, cfg, s.Format, s, status)
+		target = "sftp://" + s.SFTPHost
+	case "paperless":
+		pages, err = RunPaperlessJob(sc, cfg, s.Format, s, status)
+		target = s.PaperlessURL
+	case "smb":
+		pages, err = RunSMBJob(sc, cfg, s.Format, s, status)
+		target = "smb://" + s.SMBHost + "/" + s.SMBShare
+	case "email":
+		pages, err = RunEmailJob(sc, cfg, s.Format, s, status)
+		target = s.SMTPTo
+	case "s3":
+		pages, err = RunS3Job(sc, cfg, s.Format, s, status)
+		target = "s3://" + s.S3Bucket + "/" + strings.TrimLeft(s.S3Prefix, "/")
+	case "fifo":
+		pages, err = RunFIFOJob(sc, cfg, s, status)
+		target = s.FIFOPath
+	}
+	return pages, target, err
+}
+
+// outputFile is a named file produced by a button scan, ready for delivery.
+type outputFile struct {
+	Name string
+	Data []byte
+}
+
+// saveRetryDelay is the pause between delivery attempts of a button scan.
+var saveRetryDelay = 3 * time.Second
+
+// PageSource is where a button-scan job gets its pages from: a *Scanner,
+// or pages scanned before (see StagedPages).
+type PageSource interface {
+	ScanStreaming(cfg vens.ScanConfig, onPage func(vens.Page) error) error
+	Serial() string
+	Host() string
+}
+
+// scanFunc returns a function that runs a full scan on sc with cfg, calling
+// onPage for each page as it arrives.
+func scanFunc(sc PageSource, cfg vens.ScanConfig) func(onPage func(vens.Page) error) error {
+	return func(onPage func(vens.Page) error) error { return sc.ScanStreaming(cfg, onPage) }
+}
+
+// estimateProgress approximates scan completion in percent from the pages
+// received so far. The scanner does not report how many sheets are left, so
+// this assumes a full feeder of capacity sheets: it is only an estimate, stays
+// below 100 while scanning, and a short stack finishes well before reaching it.
+func estimateProgress(pages, capacity int, duplex bool) int {
+	if pages <= 0 || capacity <= 0 {
+		return 0
+	}
+	sides := 1
+	if duplex {
+		sides = 2
+	}
+	sheets := (pages + sides - 1) / sides
+	return min(99, max(1, sheets*100/capacity))
+}
+
+// errNoPages is returned by runJob when the scan succeeded without pages.
+var errNoPages = errors.New("scan returned no pages")
+
+// IsEmptyScan reports whether err from a button-scan job means nothing was
+// scanned: the ADF was empty, or the scan returned no pages.
+func IsEmptyScan(err error) bool {
+	var se *vens.ScanError
+	if errors.As(err, &se) && se.Kind == vens.ScanErrNoPaper {
+		return true
+	}
+	return errors.Is(err, errNoPages)
+}
+
+// runJob runs the common part of a button-scan job: scan once (reporting
+// progress to status), post-process the pages, render them into output files
+// and hand those to deliver. A scan that fails midway is only delivered when
+// requireCompleteScan allows it, and its error is still returned. Likewise
+// a PDF delivered without unreadable pages returns ErrPagesLeftOut, and the
+// page count leaves those pages out.
+// A failed delivery is retried up to Settings.SaveRetries more times with the
+// same in-memory files; the physical scan is never repeated.
+func runJob(scan func(onPage func(vens.Page) error) error, src scanSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus, deliver func([]outputFile) error) (int, error) {
+	var pages []vens.Page
+	err := scan(func(p vens.Page) error {
+		pages = append(pages, p)
+		reportProgress(status, len(pages), cfg, s)
+		return nil
+	})
+	var scanErr error
+	if err != nil {
+		scanErr = fmt.Errorf("scan: %w", err)
+		pages = slices.DeleteFunc(pages, func(p vens.Page) bool { return len(p.JPEG) == 0 })
+		if len(pages) == 0 || requireCompleteScan(s) {
+			return len(pages), scanErr
+		}
+		slog.Warn("scan failed, saving partial result", "pages", len(pages), "err", err)
 	}
 	if len(pages) == 0 {
-		return 0, fmt.Errorf("scan returned no pages")
+		return 0, errNoPages
+	}
+	pages = postProcessPages(pages, cfg, s)
+
+	files, skipped, err := renderOutputFiles(pages, cfg, format, s, newFileNamer(src, s, time.Now()))
+	if err != nil {
+		return len(pages), err
+	}
+	if singleFileFormat(format) {
+		status.SetDocument(path.Base(files[0].Name), files[0].Data)
 	}
 
-	timestamp := time.Now().Format("20060102_150405")
-	dpi := vens.QualityDPI[cfg.Quality]
-	if dpi == 0 {
-		dpi = 300
+	err = withSaveRetries(s, func() error { return deliver(files) })
+	n := len(pages) - len(skipped)
+	var pe *pageUploadError
+	if errors.As(err, &pe) && !singleFileFormat(format) {
+		n = pe.uploaded
 	}
+	// A saved partial result still reports the scan failure
+	return n, errors.Join(scanErr, pagesLeftOutError(skipped), err)
+}
 
-	isBW := cfg.ColorMode == vens.ColorBW
+// DefaultUploadConcurrency is the number of page images uploaded in parallel
+// when Settings.UploadConcurrency is unset.
+const DefaultUploadConcurrency = 4
 
-	if format == "application/pdf" {
-		outPath := filepath.Join(savePath, fmt.Sprintf("scan_%s.pdf", timestamp))
-		if err := WritePDF(pages, dpi, isBW, outPath); err != nil {
-			return len(pages), fmt.Errorf("write PDF: %w", err)
+// uploadConcurrency returns how many page images of a scan are uploaded to
+// a remote destination at once.
+func uploadConcurrency(s config.Settings) int {
+	if s.UploadConcurrency <= 0 {
+		return DefaultUploadConcurrency
+	}
+	return s.UploadConcurrency
+}
+
+// pageUploadError is the error of a batch upload that failed at a page.
+type pageUploadError struct {
+	page     int // 1-based index of the failed page
+	uploaded int // pages uploaded successfully
+	err      error
+}
+
+func (e *pageUploadError) Error() string { return fmt.Sprintf("page %d: %v", e.page, e.err) }
+
+func (e *pageUploadError) Unwrap() error { return e.err }
+
+// uploadPages uploads files with up to workers uploads running at once and
+// returns how many succeeded. After a failure no further uploads are
+// started; the error is a *pageUploadError for the first failed page.
+func uploadPages(files []outputFile, workers int, upload func(outputFile) error) (int, error) {
+	pool := newUploadPool(workers)
+	for i, f := range files {
+		if pool.failed() {
+			break
 		}
-		slog.Info("scan saved as PDF", "path", outPath, "pages", len(pages))
-	} else {
-		// Individual image files: extension matches actual data format
-		ext := "jpg"
-		if isBW {
-			ext = "tiff"
+		pool.run(i+1, func() error { return upload(f) })
+	}
+	return pool.wait()
+}
+
+// uploadPool runs page uploads on a bounded number of goroutines and keeps
+// track of their outcome. With one worker, uploads run synchronously.
+type uploadPool struct {
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	uploaded int
+	err      *pageUploadError
+}
+
+func newUploadPool(workers int) *uploadPool {
+	return &uploadPool{sem: make(chan struct{}, max(1, workers))}
+}
+
+// run uploads page n, waiting for a free worker first.
+func (p *uploadPool) run(n int, upload func() error) {
+	if cap(p.sem) == 1 {
+		p.done(n, upload())
+		return
+	}
+	p.sem <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() { <-p.sem; p.wg.Done() }()
+		p.done(n, upload())
+	}()
+}
+
+func (p *uploadPool) done(n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.uploaded++
+	} else if p.err == nil || n < p.err.page {
+		p.err = &pageUploadError{page: n, err: err}
+	}
+}
+
+// failed reports whether an upload has failed so far.
+func (p *uploadPool) failed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+// wait waits for running uploads and returns the number of successful ones
+// and the error of the first failed page, if any.
+func (p *uploadPool) wait() (int, error) {
+	p.wg.Wait()
+	if p.err != nil {
+		p.err.uploaded = p.uploaded
+		return p.uploaded, p.err
+	}
+	return p.uploaded, nil
+}
+
+// pageStore is a destination that button-scan files are written to one by
+// one, so image pages can be stored while the batch is still being scanned.
+type pageStore interface {
+	store(f outputFile) error
+	remove(name string) error
+	close() error
+}
+
+// runStoreJob runs a button-scan job that writes to store. Image pages are
+// streamed to it as they arrive, up to workers at a time; a PDF or
+// multi-page TIFF needs every page and goes through runJob, as do pages
+// whose file names include the page count.
+func runStoreJob(sc PageSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus, store pageStore, workers int) (int, error) {
+	defer store.close()
+	if singleFileFormat(format) || newFileNamer(scanSource{}, s, time.Time{}).needsTotal() {
+		return runJob(scanFunc(sc, cfg), sourceOf(sc), cfg, format, s, status, func(files []outputFile) error {
+			for _, f := range files {
+				if err := store.store(f); err != nil {
+					return err
+				}
+			}
+			slog.Info("scan saved", "files", len(files))
+			return nil
+		})
+	}
+	return runStreamingJob(scanFunc(sc, cfg), sourceOf(sc), cfg, format, s, status, store, workers)
+}
+
+// runStreamingJob is runJob for image formats: each page is post-processed
+// and stored as soon as it is scanned, so only pages still being stored are
+// held in memory. Up to workers pages are stored at once; store must then be
+// safe for concurrent use. A failed store is retried like a delivery in
+// runJob and stops the scan when retries run out. If the job fails and
+// requireCompleteScan is set, the pages stored so far are removed again.
+func runStreamingJob(scan func(onPage func(vens.Page) error) error, src scanSource, cfg vens.ScanConfig, format string, s config.Settings, status *ScanJobStatus, store pageStore, workers int) (int, error) {
+	names := newFileNamer(src, s, time.Now())
+	pool := newUploadPool(workers)
+	var storedMu sync.Mutex
+	var stored []string
+	received, pages := 0, 0
+	err := scan(func(p vens.Page) error {
+		received++
+		reportProgress(status, received, cfg, s)
+		if len(p.JPEG) == 0 {
+			return nil
+		}
+		if pool.failed() {
+			_, err := pool.wait()
+			return err
 		}
-		for i, p := range pages {
-			outPath := filepath.Join(savePath, fmt.Sprintf("scan_%s_%03d.%s", timestamp, i+1, ext))
-			if err := os.WriteFile(outPath, p.JPEG, 0644); err != nil {
-				return len(pages), fmt.Errorf("write page %d: %w", i+1, err)
+		pages++
+		p, _ = postProcessPage(p, pages, cfg, s)
+		f, err := pageOutputFile(names, pages, 0, p, cfg, format, s)
+		if err != nil {
+			return err
+		}
+		pool.run(pages, func() error {
+			if err := withSaveRetries(s, func() error { return store.store(f) }); err != nil {
+				return err
 			}
+			storedMu.Lock()
+			stored = append(stored, f.Name)
+			storedMu.Unlock()
+			return nil
+		})
+		return nil
+	})
+	n, saveErr := pool.wait()
+
+	if saveErr != nil {
+		err = saveErr
+	} else if err != nil {
+		err = fmt.Errorf("scan: %w", err)
+	}
+	if err != nil {
+		if n > 0 && requireCompleteScan(s) {
+			for _, name := range stored {
+				if rmErr := store.remove(name); rmErr != nil {
+					slog.Warn("removing incomplete scan failed", "file", name, "err", rmErr)
+				}
+			}
+		} else if n > 0 {
+			slog.Warn("scan failed, keeping partial result", "pages", n, "err", err)
 		}
-		slog.Info("scan saved as individual files", "path", savePath, "pages", len(pages), "ext", ext)
+		return n, err
 	}
+	if n == 0 {
+		return 0, errNoPages
+	}
+	slog.Info("scan saved", "files", n)
+	return n, nil
+}
 
-	return len(pages), nil
+// reportProgress records that received pages of a button scan have arrived.
+func reportProgress(status *ScanJobStatus, received int, cfg vens.ScanConfig, s config.Settings) {
+	progress := 0
+	if s.ProgressEstimate {
+		progress = estimateProgress(received, ADFCapacity, cfg.ScansDuplex())
+	}
+	status.SetProgress(received, progress)
 }
 
-// RunFTPJob executes a scan and uploads the result to an FTP server.
-func RunFTPJob(sc *Scanner, cfg vens.ScanConfig, format string, s config.Settings) (int, error) {
-	host := s.FTPHost
-	if _, _, err := net.SplitHostPort(host); err != nil {
-		host = net.JoinHostPort(host, "21")
+// withSaveRetries runs save, retrying a failure up to Settings.SaveRetries
+// more times.
+func withSaveRetries(s config.Settings, save func() error) error {
+	attempts := max(0, s.SaveRetries) + 1
+	for attempt := 1; ; attempt++ {
+		err := save()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		slog.Warn("saving scan failed, retrying", "attempt", attempt, "of", attempts, "err", err)
+		time.Sleep(saveRetryDelay)
 	}
+}
 
-	slog.Info("button scan starting (FTP)", "format", format, "host", host)
-	pages, err := sc.Scan(cfg, nil)
-	if err != nil {
-		return len(pages), fmt.Errorf("scan: %w", err)
+// localStore writes button-scan files into a directory.
+type localStore struct {
+	dir string
+}
+
+func (l localStore) store(f outputFile) error {
+	name := filepath.Join(l.dir, filepath.FromSlash(f.Name))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("create directory for %s: %w", f.Name, err)
 	}
-	if len(pages) == 0 {
-		return 0, fmt.Errorf("scan returned no pages")
+	if err := os.WriteFile(name, f.Data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", f.Name, err)
 	}
+	return nil
+}
 
-	conn, err := ftp.Dial(host, ftp.DialWithTimeout(10*time.Second))
-	if err != nil {
-		return len(pages), fmt.Errorf("FTP connect: %w", err)
+func (l localStore) remove(name string) error {
+	return os.Remove(filepath.Join(l.dir, filepath.FromSlash(name)))
+}
+
+func (l localStore) close() error { return nil }
+
+// ftpStore uploads button-scan files to an FTP server. Each concurrent
+// upload uses its own connection; idle connections are reused and a
+// connection is dropped after a failed command.
+type ftpStore struct {
+	host     string
+	user     string
+	password string
+	mu       sync.Mutex
+	idle     []*ftp.ServerConn
+}
+
+// conn returns an idle connection or dials a new one.
+func (f *ftpStore) conn() (*ftp.ServerConn, error) {
+	f.mu.Lock()
+	if n := len(f.idle); n > 0 {
+		c := f.idle[n-1]
+		f.idle = f.idle[:n-1]
+		f.mu.Unlock()
+		return c, nil
 	}
-	defer conn.Quit()
+	f.mu.Unlock()
 
-	user := s.FTPUser
+	c, err := ftp.Dial(f.host, ftp.DialWithTimeout(10*time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("FTP connect: %w", err)
+	}
+	user := f.user
 	if user == "" {
 		user = "anonymous"
 	}
-	if err := conn.Login(user, s.FTPPassword); err != nil {
-		return len(pages), fmt.Errorf("FTP login: %w", err)
+	if err := c.Login(user, f.password); err != nil {
+		c.Quit()
+		return nil, fmt.Errorf("FTP login: %w", err)
 	}
+	return c, nil
+}
 
-	timestamp := time.Now().Format("20060102_150405")
-	dpi := vens.QualityDPI[cfg.Quality]
-	if dpi == 0 {
-		dpi = 300
+// release returns c to the idle connections, or closes it after err.
+func (f *ftpStore) release(c *ftp.ServerConn, err error) {
+	if err != nil {
+		c.Quit()
+		return
 	}
+	f.mu.Lock()
+	f.idle = append(f.idle, c)
+	f.mu.Unlock()
+}
 
-	isBW := cfg.ColorMode == vens.ColorBW
+func (f *ftpStore) store(file outputFile) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	if dir := path.Dir(file.Name); dir != "." {
+		ftpMkdirAll(c, dir)
+	}
+	err = c.Stor(file.Name, bytes.NewReader(file.Data))
+	f.release(c, err)
+	if err != nil {
+		return fmt.Errorf("FTP upload %s: %w", file.Name, err)
+	}
+	slog.Debug("uploaded via FTP", "host", f.host, "file", file.Name)
+	return nil
+}
 
-	if format == "application/pdf" {
-		tmpFile, err := os.CreateTemp("", "scan_*.pdf")
-		if err != nil {
-			return len(pages), fmt.Errorf("create temp file: %w", err)
+// ftpMkdirAll creates dir and its parents on the server. Errors are ignored
+// since most mean the directory exists; a real failure shows up in the
+// upload that follows.
+func ftpMkdirAll(c *ftp.ServerConn, dir string) {
+	for i := range dir {
+		if dir[i] == '/' {
+			c.MakeDir(dir[:i])
 		}
-		tmpPath := tmpFile.Name()
-		tmpFile.Close()
-		defer os.Remove(tmpPath)
+	}
+	c.MakeDir(dir)
+}
 
-		if err := WritePDF(pages, dpi, isBW, tmpPath); err != nil {
-			return len(pages), fmt.Errorf("write PDF: %w", err)
-		}
-		data, err := os.ReadFile(tmpPath)
+func (f *ftpStore) remove(name string) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	err = c.Delete(name)
+	f.release(c, err)
+	return err
+}
+
+func (f *ftpStore) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for _, c := range f.idle {
+		errs = append(errs, c.Quit())
+	}
+	f.idle = nil
+	return errors.Join(errs...)
+}
+
+// requireCompleteScan reports whether the pages of a scan that failed midway
+// (e.g. on a paper jam) are discarded rather than saved as an incomplete
+// document. They are discarded for every destination unless
+// Settings.RequireCompleteScan is turned off.
+func requireCompleteScan(s config.Settings) bool {
+	return s.RequireCompleteScan == nil || *s.RequireCompleteScan
+}
+
+// singleFileFormat reports whether format packs all pages of a scan into
+// one file.
+func singleFileFormat(format string) bool {
+	return format == "application/pdf" || format == FormatMultipageTIFF
+}
+
+// renderOutputFiles converts scanned pages into the files to deliver, named
+// by names: a single PDF or multi-page TIFF, or one image per page whose
+// extension matches the data format. With Settings.OCRDualPDF a PDF scan
+// gives two files, the searchable "<base>_ocr.pdf" first, so destinations
+// taking a single file get that one, and the image-only "<base>.pdf".
+// skipped holds the indices of the pages left out of a PDF, see renderPDF.
+func renderOutputFiles(pages []vens.Page, cfg vens.ScanConfig, format string, s config.Settings, names fileNamer) (files []outputFile, skipped []int, err error) {
+	switch format {
+	case "application/pdf":
+		name := names.document(len(pages), "pdf")
+		meta := pdfMetadata(s, strings.TrimSuffix(path.Base(name), ".pdf"), names.time)
+		pages = splitLongPages(pages, cfg, s)
+		data, skipped, err := renderPDF(pages, cfg, s, meta)
 		if err != nil {
-			return len(pages), fmt.Errorf("read temp PDF: %w", err)
+			return nil, nil, fmt.Errorf("generate PDF: %w", err)
 		}
-		remoteName := fmt.Sprintf("scan_%s.pdf", timestamp)
-		if err := conn.Stor(remoteName, bytes.NewReader(data)); err != nil {
-			return len(pages), fmt.Errorf("FTP upload %s: %w", remoteName, err)
+		if !s.OCR || !s.OCRDualPDF {
+			return []outputFile{{Name: name, Data: data}}, skipped, nil
 		}
-		slog.Info("scan uploaded via FTP", "file", remoteName, "pages", len(pages))
-	} else {
-		ext := "jpg"
-		if isBW {
-			ext = "tiff"
+		imageOnly := s
+		imageOnly.OCR = false
+		plain, _, err := renderPDF(pages, cfg, imageOnly, meta)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generate image-only PDF: %w", err)
 		}
-		for i, p := range pages {
-			remoteName := fmt.Sprintf("scan_%s_%03d.%s", timestamp, i+1, ext)
-			if err := conn.Stor(remoteName, bytes.NewReader(p.JPEG)); err != nil {
-				return len(pages), fmt.Errorf("FTP upload page %d: %w", i+1, err)
-			}
+		return []outputFile{
+			{Name: strings.TrimSuffix(name, ".pdf") + "_ocr.pdf", Data: data},
+			{Name: name, Data: plain},
+		}, skipped, nil
+	case FormatMultipageTIFF:
+		data, err := GenerateMultipageTIFF(pages, fallbackDPI(cfg, s))
+		if err != nil {
+			return nil, nil, fmt.Errorf("generate TIFF: %w", err)
 		}
-		slog.Info("scan uploaded via FTP", "pages", len(pages), "ext", ext)
+		return []outputFile{{Name: names.document(len(pages), "tiff"), Data: data}}, nil, nil
 	}
 
-	return len(pages), nil
+	files = make([]outputFile, len(pages))
+	for i, p := range pages {
+		f, err := pageOutputFile(names, i+1, len(pages), p, cfg, format, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[i] = f
+	}
+	return files, nil, nil
 }
 
-// RunPaperlessJob executes a scan and uploads the result to Paperless-ngx.
-func RunPaperlessJob(sc *Scanner, cfg vens.ScanConfig, format string, s config.Settings) (int, error) {
-	baseURL := strings.TrimRight(s.PaperlessURL, "/")
+// ErrPagesLeftOut is reported, wrapped, by a button-scan job whose PDF was
+// delivered without the pages that could not be read.
+var ErrPagesLeftOut = errors.New("unreadable pages left out of the PDF")
 
-	slog.Info("button scan starting (Paperless-ngx)", "format", format, "url", baseURL)
-	pages, err := sc.Scan(cfg, nil)
-	if err != nil {
-		return len(pages), fmt.Errorf("scan: %w", err)
+// pagesLeftOutError returns the ErrPagesLeftOut error naming the pages at
+// the given 0-based indices, or nil if there are none.
+func pagesLeftOutError(skipped []int) error {
+	if len(skipped) == 0 {
+		return nil
 	}
-	if len(pages) == 0 {
-		return 0, fmt.Errorf("scan returned no pages")
+	numbers := make([]string, len(skipped))
+	for i, idx := range skipped {
+		numbers[i] = strconv.Itoa(idx + 1)
+	}
+	label := "page"
+	if len(numbers) > 1 {
+		label = "pages"
 	}
+	return fmt.Errorf("%w: %s %s", ErrPagesLeftOut, label, strings.Join(numbers, ", "))
+}
 
-	timestamp := time.Now().Format("20060102_150405")
-	dpi := vens.QualityDPI[cfg.Quality]
-	if dpi == 0 {
-		dpi = 300
+// pageOutputFile returns the file of the n-th of total pages of an
+// image-format scan, re-encoding the page for FormatPNG and FormatWebP.
+// total is 0 while
+// the scan is still running. With Settings.OriginalPageNumbers the file is
+// numbered by the page's position as fed instead of n.
+func pageOutputFile(names fileNamer, n, total int, p vens.Page, cfg vens.ScanConfig, format string, s config.Settings) (outputFile, error) {
+	if format == FormatPNG {
+		var err error
+		if p, err = encodePNGPage(p, fallbackDPI(cfg, s), false); err != nil {
+			return outputFile{}, fmt.Errorf("page %d: %w", n, err)
+		}
+	}
+	if format == FormatWebP {
+		var err error
+		if p, err = encodeWebPPage(p, webpQuality(s.Compression)); err != nil {
+			return outputFile{}, fmt.Errorf("page %d: %w", n, err)
+		}
+	}
+	if s.OriginalPageNumbers {
+		n = originalPageNumber(p, cfg)
 	}
+	return outputFile{Name: pageFileName(names, n, total, p, cfg), Data: p.JPEG}, nil
+}
 
-	isBW := cfg.ColorMode == vens.ColorBW
+// originalPageNumber returns the 1-based position of p in the fed document,
+// counting both sides of each sheet in duplex scans. Unlike the index among
+// the saved pages, it keeps the gaps left by removed blank pages.
+func originalPageNumber(p vens.Page, cfg vens.ScanConfig) int {
+	if cfg.ScansDuplex() {
+		return p.Sheet*2 + p.Side + 1
+	}
+	return p.Sheet + 1
+}
 
-	// PDF: upload as single document
-	if format == "application/pdf" {
-		tmpFile, err := os.CreateTemp("", "scan_*.pdf")
-		if err != nil {
-			return len(pages), fmt.Errorf("create temp file: %w", err)
+// pageFileName returns the file name of the n-th of total pages of an
+// image-format scan. ColorAuto can mix JPEG and TIFF pages, so the extension
+// is picked per page.
+func pageFileName(names fileNamer, n, total int, p vens.Page, cfg vens.ScanConfig) string {
+	ext := "jpg"
+	switch DetectImageMIME(p.JPEG) {
+	case FormatPNG:
+		ext = "png"
+	case FormatWebP:
+		ext = "webp"
+	default:
+		if pageIsTIFF(p, cfg.ColorMode == vens.ColorBW) {
+			ext = "tiff"
 		}
-		tmpPath := tmpFile.Name()
-		tmpFile.Close()
-		defer os.Remove(tmpPath)
+	}
+	return names.page(n, total, ext)
+}
 
-		if err := WritePDF(pages, dpi, isBW, tmpPath); err != nil {
-			return len(pages), fmt.Errorf("write PDF: %w", err)
+// scanBaseName returns the file name stem for a button scan started at t:
+// "scan_<timestamp>", or "scan_<serial>_<timestamp>" when
+// Settings.IncludeSerialInFilename is set and the serial is known.
+func scanBaseName(serial string, s config.Settings, t time.Time) string {
+	timestamp := t.Format("20060102_150405")
+	if s.IncludeSerialInFilename {
+		if serial = sanitizeFilenamePart(serial); serial != "" {
+			return fmt.Sprintf("scan_%s_%s", serial, timestamp)
 		}
-		docData, err := os.ReadFile(tmpPath)
-		if err != nil {
-			return len(pages), fmt.Errorf("read temp PDF: %w", err)
+	}
+	return "scan_" + timestamp
+}
+
+// sanitizeFilenamePart replaces characters that are unsafe in file names on
+// common filesystems and remote destinations with '-'.
+func sanitizeFilenamePart(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
 		}
-		filename := fmt.Sprintf("scan_%s.pdf", timestamp)
-		if err := uploadToPaperless(baseURL, s.PaperlessToken, filename, docData); err != nil {
-			return len(pages), fmt.Errorf("paperless upload: %w", err)
+	}, strings.TrimSpace(v))
+}
+
+// postProcessPages applies the optional image processing steps configured
+// in settings to freshly scanned pages, before they are saved or uploaded.
+// A page that fails processing is kept unchanged.
+func postProcessPages(pages []vens.Page, cfg vens.ScanConfig, s config.Settings) []vens.Page {
+	converted := 0
+	for i, p := range pages {
+		var ok bool
+		if pages[i], ok = postProcessPage(p, i+1, cfg, s); ok {
+			converted++
 		}
-		slog.Info("scan uploaded to Paperless-ngx", "file", filename, "pages", len(pages))
-		return len(pages), nil
 	}
+	if converted > 0 {
+		slog.Info("converted near-grayscale pages", "pages", converted)
+	}
+	return pages
+}
+
+// capQuality lowers q to the highest scan quality within
+// Settings.MaxResolution, at least QualityNormal. QualityAuto, where the
+// scanner may pick up to 300 DPI, is replaced by that quality as well.
+func capQuality(q vens.Quality, s config.Settings) vens.Quality {
+	if s.MaxResolution <= 0 || s.MaxResolution >= vens.QualityDPI[vens.QualitySuperFine] {
+		return q
+	}
+	limit := vens.QualityNormal
+	if s.MaxResolution >= vens.QualityDPI[vens.QualityFine] {
+		limit = vens.QualityFine
+	}
+	if q == vens.QualityAuto || q > limit {
+		return limit
+	}
+	return q
+}
 
-	// Individual pages
+// fallbackDPI returns the resolution assumed for pages without embedded
+// DPI: that of the scan quality, or for QualityAuto, where the scanner picks
+// the resolution, the Settings fallback of the color mode (default 300).
+func fallbackDPI(cfg vens.ScanConfig, s config.Settings) int {
+	if dpi := vens.QualityDPI[cfg.Quality]; dpi > 0 {
+		return dpi
+	}
+	dpi := s.FallbackDPIColor
+	switch cfg.ColorMode {
+	case vens.ColorGray:
+		dpi = s.FallbackDPIGray
+	case vens.ColorBW:
+		dpi = s.FallbackDPIBW
+	}
+	if dpi <= 0 {
+		return 300
+	}
+	return dpi
+}
+
+// postProcessPage applies the steps of postProcessPages to the n-th page,
+// reporting whether it was converted to grayscale. Pages scanned in a
+// carrier sheet are not auto-rotated. StagedSettings turns off every step.
+func postProcessPage(p vens.Page, n int, cfg vens.ScanConfig, s config.Settings) (vens.Page, bool) {
+	dpi := fallbackDPI(cfg, s)
+	if s.FillBorders {
+		if out, ok, err := fillBordersPage(p, dpi); err != nil {
+			slog.Warn("border fill failed, keeping page", "page", n, "err", err)
+		} else if ok {
+			slog.Debug("filled black page borders", "page", n)
+			p = out
+		}
+	}
+	// Carrier sheets hold photos and clippings placed in them on purpose,
+	// so they keep the orientation and length they were scanned with
+	if s.AutoRotate && !p.CarrierSheet {
+		if out, ok, err := autoRotatePage(p, dpi); err != nil {
+			slog.Warn("auto rotate failed, keeping page", "page", n, "err", err)
+		} else if ok {
+			slog.Debug("rotated landscape page", "page", n)
+			p = out
+		}
+	}
+	if !s.AutoGrayscale || cfg.ColorMode != vens.ColorAuto {
+		return p, false
+	}
+	out, ok, err := autoGrayscalePage(p, dpi)
+	if err != nil {
+		slog.Warn("auto grayscale failed, keeping color page", "page", n, "err", err)
+		return p, false
+	}
+	if !ok {
+		return p, false
+	}
+	return out, true
+}
+
+// splitLongPages divides pages longer than Settings.LongPageSplit, such as
+// long receipts scanned in long-document mode, into pages of that length
+// for the PDF. A page that fails to split, or one scanned in a carrier
+// sheet, is kept whole.
+func splitLongPages(pages []vens.Page, cfg vens.ScanConfig, s config.Settings) []vens.Page {
+	if s.LongPageSplit <= 0 {
+		return pages
+	}
+	dpi := fallbackDPI(cfg, s)
+	out := make([]vens.Page, 0, len(pages))
 	for i, p := range pages {
-		ext := "jpg"
-		if isBW {
-			ext = "tiff"
+		if p.CarrierSheet {
+			out = append(out, p)
+			continue
 		}
-		fn := fmt.Sprintf("scan_%s_%03d.%s", timestamp, i+1, ext)
-		if err := uploadToPaperless(baseURL, s.PaperlessToken, fn, p.JPEG); err != nil {
-			return len(pages), fmt.Errorf("paperless upload page %d: %w", i+1, err)
+		parts, err := splitLongPage(p, float64(s.LongPageSplit), dpi)
+		if err != nil {
+			slog.Warn("long page split failed, keeping page", "page", i+1, "err", err)
+			parts = []vens.Page{p}
+		} else if len(parts) > 1 {
+			slog.Debug("split long page", "page", i+1, "parts", len(parts))
 		}
+		out = append(out, parts...)
 	}
-	slog.Info("scan uploaded to Paperless-ngx", "pages", len(pages))
-	return len(pages), nil
+	return out
+}
+
+// pdfMetadata returns the document information of a button-scan PDF from
+// settings. The title defaults to the file name without extension.
+func pdfMetadata(s config.Settings, base string, created time.Time) PDFMetadata {
+	title := s.PDFTitle
+	if title == "" {
+		title = base
+	}
+	return PDFMetadata{
+		Title:        title,
+		Author:       s.PDFAuthor,
+		Subject:      s.PDFSubject,
+		Keywords:     s.PDFKeywords,
+		CreationDate: created,
+	}
+}
+
+// renderPDF builds the PDF document for a button scan with the layout and
+// size cap configured in settings. Pages that cannot be decoded are always
+// left out and their indices returned: the paper has been fed through by
+// then, so failing the job would lose every other page of the scan, while
+// the job still reports the missing ones (see ErrPagesLeftOut).
+func renderPDF(pages []vens.Page, cfg vens.ScanConfig, s config.Settings, meta PDFMetadata) ([]byte, []int, error) {
+	return GeneratePDFWithSkipped(pages, PDFOptions{
+		DPI:         fallbackDPI(cfg, s),
+		IsBW:        cfg.ColorMode == vens.ColorBW,
+		Margin:      s.PDFMargin,
+		MaxBytes:    s.MaxPDFBytes,
+		BWEmbedding: s.BWPDFEmbedding,
+		PDFA:        s.PDFA,
+		Metadata:    meta,
+		OCR:         s.OCR,
+		OCRLanguage: s.OCRLanguage,
+		BestEffort:  true,
+	})
 }
 
 func uploadToPaperless(baseURL, token, filename string, data []byte) error {
+	return uploadMultipart(baseURL+"/api/documents/post_document/", "Token "+token, "document", filename, data)
+}
+
+// uploadMultipart POSTs data as the file field of a multipart form to
+// endpoint. authorization, if not empty, is sent as the Authorization header.
+func uploadMultipart(endpoint, authorization, field, filename string, data []byte) error {
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
-	part, err := writer.CreateFormFile("document", filename)
+	part, err := writer.CreateFormFile(field, filename)
 	if err != nil {
 		return fmt.Errorf("create form file: %w", err)
 	}
@@ -334,13 +1268,14 @@ func uploadToPaperless(baseURL, token, filename string, data []byte) error {
 	}
 	writer.Close()
 
-	url := baseURL + "/api/documents/post_document/"
-	req, err := http.NewRequest("POST", url, &body)
+	req, err := http.NewRequest("POST", endpoint, &body)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Token "+token)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
 
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
@@ -0,0 +1,698 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func TestScanBaseName(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.Local)
+	tests := []struct {
+		name    string
+		serial  string
+		include bool
+		want    string
+	}{
+		{"default", "iX500-A1B2", false, "scan_20250304_050607"},
+		{"with serial", "iX500-A1B2", true, "scan_iX500-A1B2_20250304_050607"},
+		{"unknown serial", "", true, "scan_20250304_050607"},
+		{"unsafe characters", " AB/12:C ", true, "scan_AB-12-C_20250304_050607"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanBaseName(tt.serial, config.Settings{IncludeSerialInFilename: tt.include}, ts)
+			if got != tt.want {
+				t.Errorf("scanBaseName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// feedPages hands pages to onPage like a scan would and then ends with err.
+func feedPages(onPage func(vens.Page) error, pages []vens.Page, err error) error {
+	for _, p := range pages {
+		if e := onPage(p); e != nil {
+			return e
+		}
+	}
+	return err
+}
+
+// setSaveRetryDelay sets saveRetryDelay to d for the duration of the test.
+func setSaveRetryDelay(t *testing.T, d time.Duration) {
+	t.Helper()
+	old := saveRetryDelay
+	saveRetryDelay = d
+	t.Cleanup(func() { saveRetryDelay = old })
+}
+
+func TestRunJobRetriesDeliveryOnly(t *testing.T) {
+	setSaveRetryDelay(t, 0)
+
+	scans := 0
+	scan := func(onPage func(vens.Page) error) error {
+		scans++
+		return feedPages(onPage, []vens.Page{{JPEG: []byte("page1")}, {JPEG: []byte("page2")}}, nil)
+	}
+	deliveries := 0
+	deliver := func(files []outputFile) error {
+		deliveries++
+		if len(files) != 2 {
+			t.Errorf("files = %d, want 2", len(files))
+		}
+		if deliveries < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+
+	cfg := vens.DefaultScanConfig()
+	s := config.Settings{SaveRetries: 2}
+	n, err := runJob(scan, scanSource{}, cfg, "image/jpeg", s, nil, deliver)
+	if err != nil {
+		t.Fatalf("runJob() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("pages = %d, want 2", n)
+	}
+	if deliveries != 3 {
+		t.Errorf("deliveries = %d, want 3", deliveries)
+	}
+	if scans != 1 {
+		t.Errorf("scans = %d, want 1 (scan must not be repeated)", scans)
+	}
+}
+
+func TestRunJobRetriesExhausted(t *testing.T) {
+	setSaveRetryDelay(t, 0)
+
+	scan := func(onPage func(vens.Page) error) error {
+		return feedPages(onPage, []vens.Page{{JPEG: []byte("page1")}}, nil)
+	}
+	deliveries := 0
+	deliver := func([]outputFile) error {
+		deliveries++
+		return errors.New("upload failed")
+	}
+
+	s := config.Settings{SaveRetries: 1}
+	_, err := runJob(scan, scanSource{}, vens.DefaultScanConfig(), "image/jpeg", s, nil, deliver)
+	if err == nil {
+		t.Fatal("runJob() error = nil, want upload failure")
+	}
+	if deliveries != 2 {
+		t.Errorf("deliveries = %d, want 2", deliveries)
+	}
+}
+
+func TestRunJobReportsPagesLeftOut(t *testing.T) {
+	good := vens.Page{JPEG: noisyJPEG(t, 120, 160)}
+	corrupt := vens.Page{JPEG: good.JPEG[:20]} // cut off in transfer
+	scan := func(onPage func(vens.Page) error) error {
+		return feedPages(onPage, []vens.Page{good, corrupt, good}, nil)
+	}
+	var delivered []outputFile
+	deliver := func(files []outputFile) error {
+		delivered = files
+		return nil
+	}
+
+	n, err := runJob(scan, scanSource{}, vens.DefaultScanConfig(), "application/pdf", config.Settings{}, nil, deliver)
+	if !errors.Is(err, ErrPagesLeftOut) || !strings.HasSuffix(err.Error(), ": page 2") {
+		t.Errorf("runJob() error = %v, want ErrPagesLeftOut for page 2", err)
+	}
+	if n != 2 {
+		t.Errorf("pages = %d, want the 2 pages in the PDF", n)
+	}
+	if len(delivered) != 1 || bytes.Count(delivered[0].Data, []byte("/Type /Page\n")) != 2 {
+		t.Errorf("delivered %d files, want one PDF of 2 pages", len(delivered))
+	}
+}
+
+func TestEstimateProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    int
+		capacity int
+		duplex   bool
+		want     int
+	}{
+		{"nothing yet", 0, 50, false, 0},
+		{"first page", 1, 50, false, 2},
+		{"half full", 25, 50, false, 50},
+		{"duplex counts sheets", 25, 50, true, 26},
+		{"duplex front only", 1, 50, true, 2},
+		{"never 100 while scanning", 50, 50, false, 99},
+		{"more than capacity", 80, 50, false, 99},
+		{"rounds up to 1", 1, 200, false, 1},
+		{"unknown capacity", 10, 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateProgress(tt.pages, tt.capacity, tt.duplex); got != tt.want {
+				t.Errorf("estimateProgress(%d, %d, %v) = %d, want %d", tt.pages, tt.capacity, tt.duplex, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunJobReportsProgress(t *testing.T) {
+	status := &ScanJobStatus{}
+	status.SetScanning(true)
+	var pagesSeen, progressSeen []int
+	scan := func(onPage func(vens.Page) error) error {
+		for _, p := range []vens.Page{{JPEG: []byte("a")}, {JPEG: []byte("b")}} {
+			onPage(p)
+			snap := status.Snapshot()
+			pagesSeen = append(pagesSeen, snap.PagesScanned)
+			progressSeen = append(progressSeen, snap.Progress)
+		}
+		return nil
+	}
+	cfg := vens.DefaultScanConfig()
+	cfg.Duplex = false
+	s := config.Settings{ProgressEstimate: true}
+	if _, err := runJob(scan, scanSource{}, cfg, "image/jpeg", s, status, func([]outputFile) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(pagesSeen, []int{1, 2}) {
+		t.Errorf("pages scanned = %v, want [1 2]", pagesSeen)
+	}
+	if !slices.Equal(progressSeen, []int{2, 4}) {
+		t.Errorf("progress = %v, want [2 4]", progressSeen)
+	}
+}
+
+func TestRenderOutputFilesMixedFormats(t *testing.T) {
+	tiffPage := []byte{0x49, 0x49, 0x2A, 0x00, 0, 0, 0, 0}
+	jpegPage := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	pages := []vens.Page{{JPEG: jpegPage}, {JPEG: tiffPage}}
+	cfg := vens.DefaultScanConfig()
+	cfg.ColorMode = vens.ColorAuto
+
+	files, _, err := renderOutputFiles(pages, cfg, "image/jpeg", config.Settings{}, fileNamer{base: "scan", time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	want := []string{"scan_001.jpg", "scan_002.tiff"}
+	if !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestRenderOutputFilesOriginalPageNumbers(t *testing.T) {
+	jpegPage := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	// Duplex scan of 3 sheets where the back of sheet 1 and the front of
+	// sheet 3 were removed as blank
+	duplex := []vens.Page{
+		{Sheet: 0, Side: 0, JPEG: jpegPage},
+		{Sheet: 1, Side: 0, JPEG: jpegPage},
+		{Sheet: 1, Side: 1, JPEG: jpegPage},
+		{Sheet: 2, Side: 1, JPEG: jpegPage},
+	}
+	// Simplex scan of 3 sheets where sheet 2 was removed as blank
+	simplex := []vens.Page{{Sheet: 0, JPEG: jpegPage}, {Sheet: 2, JPEG: jpegPage}}
+	names := fileNamer{base: "scan", time: time.Now()}
+
+	tests := []struct {
+		name     string
+		pages    []vens.Page
+		duplex   bool
+		original bool
+		want     []string
+	}{
+		{"compacted", duplex, true, false, []string{"scan_001.jpg", "scan_002.jpg", "scan_003.jpg", "scan_004.jpg"}},
+		{"original duplex", duplex, true, true, []string{"scan_001.jpg", "scan_003.jpg", "scan_004.jpg", "scan_006.jpg"}},
+		{"original simplex", simplex, false, true, []string{"scan_001.jpg", "scan_003.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := vens.DefaultScanConfig()
+			cfg.Duplex = tt.duplex
+			s := config.Settings{OriginalPageNumbers: tt.original}
+			files, _, err := renderOutputFiles(tt.pages, cfg, "image/jpeg", s, names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range files {
+				got = append(got, f.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunJobPartialScan(t *testing.T) {
+	jam := errors.New("paper jam")
+	scan := func(onPage func(vens.Page) error) error {
+		// Two pages made it through before the jam
+		return feedPages(onPage, []vens.Page{{JPEG: []byte("page1")}, {JPEG: []byte("page2")}, {}}, jam)
+	}
+	on, off := true, false
+	tests := []struct {
+		name       string
+		settings   config.Settings
+		wantUpload bool
+	}{
+		{"upload destination defaults to strict", config.Settings{SaveType: "ftp"}, false},
+		{"local save defaults to strict", config.Settings{SaveType: "local"}, false},
+		{"strict local save", config.Settings{SaveType: "local", RequireCompleteScan: &on}, false},
+		{"lenient local save", config.Settings{SaveType: "local", RequireCompleteScan: &off}, true},
+		{"lenient upload", config.Settings{SaveType: "paperless", RequireCompleteScan: &off}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var delivered []outputFile
+			deliver := func(files []outputFile) error {
+				delivered = files
+				return nil
+			}
+			n, err := runJob(scan, scanSource{}, vens.DefaultScanConfig(), "image/jpeg", tt.settings, nil, deliver)
+			if !errors.Is(err, jam) {
+				t.Errorf("runJob() error = %v, want the scan error", err)
+			}
+			if n != 2 {
+				t.Errorf("pages = %d, want 2", n)
+			}
+			if got := delivered != nil; got != tt.wantUpload {
+				t.Fatalf("delivered = %v, want %v", got, tt.wantUpload)
+			}
+			if tt.wantUpload && len(delivered) != 2 {
+				t.Errorf("delivered %d files, want 2", len(delivered))
+			}
+		})
+	}
+}
+
+// memStore is a pageStore that keeps files in a map.
+type memStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	fails int // store calls to fail before succeeding
+}
+
+func (m *memStore) store(f outputFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fails > 0 {
+		m.fails--
+		return errors.New("connection reset")
+	}
+	m.files[f.Name] = f.Data
+	return nil
+}
+
+func (m *memStore) remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memStore) close() error { return nil }
+
+func TestRunStreamingJobPNG(t *testing.T) {
+	dir := t.TempDir()
+	scan := func(onPage func(vens.Page) error) error {
+		return onPage(vens.Page{JPEG: noisyJPEG(t, 120, 160)})
+	}
+	cfg := vens.DefaultScanConfig()
+	cfg.Quality = vens.QualityFine
+	n, err := runStreamingJob(scan, scanSource{}, cfg, FormatPNG, config.Settings{}, nil, localStore{dir: dir}, 1)
+	if err != nil || n != 1 {
+		t.Fatalf("runStreamingJob() = %d, %v", n, err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*_001.png"))
+	if err != nil || len(names) != 1 {
+		t.Fatalf("saved files = %v, %v", names, err)
+	}
+	data, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("saved file is not a valid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 120 || b.Dy() != 160 {
+		t.Errorf("PNG size = %dx%d, want 120x160", b.Dx(), b.Dy())
+	}
+	// 200 DPI is 7874 pixels per meter
+	if !bytes.Contains(data, []byte("pHYs\x00\x00\x1e\xc2\x00\x00\x1e\xc2\x01")) {
+		t.Error("PNG lacks the 200 DPI pHYs chunk")
+	}
+}
+
+func TestRunStreamingJob(t *testing.T) {
+	setSaveRetryDelay(t, 0)
+
+	store := &memStore{files: map[string][]byte{}, fails: 1}
+	var storedBefore []int
+	scan := func(onPage func(vens.Page) error) error {
+		for _, p := range []vens.Page{{JPEG: []byte("a")}, {}, {JPEG: []byte("b")}} {
+			storedBefore = append(storedBefore, len(store.files))
+			if err := onPage(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	s := config.Settings{SaveRetries: 1}
+	n, err := runStreamingJob(scan, scanSource{}, vens.DefaultScanConfig(), "image/jpeg", s, nil, store, 1)
+	if err != nil {
+		t.Fatalf("runStreamingJob() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("pages = %d, want 2", n)
+	}
+	// Each page is stored before the next one arrives
+	if !slices.Equal(storedBefore, []int{0, 1, 1}) {
+		t.Errorf("files stored before each page = %v, want [0 1 1]", storedBefore)
+	}
+	var names []string
+	for name := range store.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if len(names) != 2 || !strings.HasSuffix(names[0], "_001.jpg") || !strings.HasSuffix(names[1], "_002.jpg") {
+		t.Errorf("stored files = %v", names)
+	}
+
+	// A strict destination does not keep a partial scan
+	jam := errors.New("paper jam")
+	store = &memStore{files: map[string][]byte{}}
+	scan = func(onPage func(vens.Page) error) error {
+		return feedPages(onPage, []vens.Page{{JPEG: []byte("a")}}, jam)
+	}
+	n, err = runStreamingJob(scan, scanSource{}, vens.DefaultScanConfig(), "image/jpeg", config.Settings{SaveType: "ftp"}, nil, store, 1)
+	if !errors.Is(err, jam) || n != 1 {
+		t.Errorf("runStreamingJob() = %d, %v, want 1 and the scan error", n, err)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("partial scan left %d files", len(store.files))
+	}
+}
+
+func TestRunStreamingJobConcurrent(t *testing.T) {
+	store := &memStore{files: map[string][]byte{}}
+	var pages []vens.Page
+	for i := 0; i < 10; i++ {
+		pages = append(pages, vens.Page{JPEG: []byte{byte(i)}})
+	}
+	scan := func(onPage func(vens.Page) error) error { return feedPages(onPage, pages, nil) }
+	n, err := runStreamingJob(scan, scanSource{}, vens.DefaultScanConfig(), "image/jpeg", config.Settings{}, nil, store, 3)
+	if err != nil || n != len(pages) {
+		t.Fatalf("runStreamingJob() = %d, %v, want %d", n, err, len(pages))
+	}
+	for i := range pages {
+		name := fmt.Sprintf("_%03d.jpg", i+1)
+		var found bool
+		for k, v := range store.files {
+			if strings.HasSuffix(k, name) {
+				found = true
+				if v[0] != byte(i) {
+					t.Errorf("%s holds page %d", k, v[0]+1)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("page %d not stored", i+1)
+		}
+	}
+}
+
+func TestUploadPages(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]bool{}
+	running, peak := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+
+		f, hdr, err := r.FormFile("document")
+		if err == nil {
+			f.Close()
+		}
+		mu.Lock()
+		running--
+		if err == nil {
+			received[hdr.Filename] = true
+		}
+		mu.Unlock()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	var files []outputFile
+	for i := 1; i <= 12; i++ {
+		files = append(files, outputFile{Name: fmt.Sprintf("scan_%03d.jpg", i), Data: []byte{0xFF, 0xD8}})
+	}
+	n, err := uploadPages(files, 4, func(f outputFile) error {
+		return uploadToPaperless(srv.URL, "token", f.Name, f.Data)
+	})
+	if err != nil || n != len(files) {
+		t.Fatalf("uploadPages() = %d, %v", n, err)
+	}
+	for _, f := range files {
+		if !received[f.Name] {
+			t.Errorf("%s not received", f.Name)
+		}
+	}
+	if peak < 2 || peak > 4 {
+		t.Errorf("peak concurrent uploads = %d, want 2..4", peak)
+	}
+
+	n, err = uploadPages(files, 4, func(f outputFile) error {
+		if f.Name == "scan_007.jpg" {
+			return errors.New("HTTP 500")
+		}
+		return nil
+	})
+	var pe *pageUploadError
+	if !errors.As(err, &pe) || pe.page != 7 || !strings.Contains(err.Error(), "page 7") {
+		t.Fatalf("uploadPages() error = %v, want a failure at page 7", err)
+	}
+	if n != pe.uploaded || n >= len(files) {
+		t.Errorf("uploaded = %d (error reports %d), want fewer than %d", n, pe.uploaded, len(files))
+	}
+}
+
+func TestRunJobToURL(t *testing.T) {
+	type upload struct {
+		auth, name string
+		data       []byte
+	}
+	got := make(chan upload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inbox" {
+			http.NotFound(w, r)
+			return
+		}
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(f)
+		got <- upload{auth: r.Header.Get("Authorization"), name: hdr.Filename, data: buf.Bytes()}
+	}))
+	defer srv.Close()
+
+	scan := func(onPage func(vens.Page) error) error {
+		return feedPages(onPage, []vens.Page{{JPEG: noisyJPEG(t, 32, 32)}, {JPEG: noisyJPEG(t, 32, 32)}}, nil)
+	}
+	n, err := runJob(scan, scanSource{}, vens.DefaultScanConfig(), "application/pdf", config.Settings{}, nil, urlDelivery(srv.URL+"/inbox", "Bearer secret"))
+	if err != nil || n != 2 {
+		t.Fatalf("runJob() = %d, %v", n, err)
+	}
+	u := <-got
+	if u.auth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want Bearer secret", u.auth)
+	}
+	if !strings.HasSuffix(u.name, ".pdf") || !bytes.HasPrefix(u.data, []byte("%PDF")) {
+		t.Errorf("received %s (%d bytes), want a PDF", u.name, len(u.data))
+	}
+
+	if err := urlDelivery(srv.URL+"/missing", "")([]outputFile{{Name: "scan.pdf"}}); err == nil {
+		t.Error("urlDelivery() to a missing endpoint succeeded, want the HTTP error")
+	}
+}
+
+func TestDestinationEnabled(t *testing.T) {
+	off := false
+	s := config.Settings{SaveType: "ftp", FTPHost: "nas.local", FTPPassword: "secret", FTPEnabled: &off}
+	if DestinationEnabled(s) {
+		t.Error("FTPEnabled=false: destination enabled")
+	}
+	// The disabled destination stays fully configured
+	if err := CheckDestination(s); err != nil {
+		t.Errorf("CheckDestination() = %v", err)
+	}
+	for _, saveType := range []string{"local", "paperless", "smb", "sftp", "email", "s3", "fifo", "none"} {
+		s.SaveType = saveType
+		if !DestinationEnabled(s) {
+			t.Errorf("%s: destination disabled by default", saveType)
+		}
+	}
+}
+
+func TestFallbackDPI(t *testing.T) {
+	s := config.Settings{FallbackDPIColor: 200, FallbackDPIGray: 150}
+	jpegPage := []vens.Page{{JPEG: noisyJPEG(t, 200, 200)}} // no embedded DPI
+	tests := []struct {
+		name      string
+		quality   vens.Quality
+		colorMode vens.ColorMode
+		s         config.Settings
+		want      int
+		mediaBox  string
+	}{
+		{"quality wins", vens.QualityFine, vens.ColorGray, s, 200, "/MediaBox [0 0 72.00 72.00]"},
+		{"auto color", vens.QualityAuto, vens.ColorAuto, s, 200, "/MediaBox [0 0 72.00 72.00]"},
+		{"auto gray", vens.QualityAuto, vens.ColorGray, s, 150, "/MediaBox [0 0 96.00 96.00]"},
+		{"auto bw default", vens.QualityAuto, vens.ColorBW, s, 300, ""},
+		{"unset", vens.QualityAuto, vens.ColorColor, config.Settings{}, 300, "/MediaBox [0 0 48.00 48.00]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := vens.ScanConfig{Quality: tt.quality, ColorMode: tt.colorMode}
+			if got := fallbackDPI(cfg, tt.s); got != tt.want {
+				t.Errorf("fallbackDPI() = %d, want %d", got, tt.want)
+			}
+			if tt.mediaBox == "" {
+				return
+			}
+			data, _, err := renderPDF(jpegPage, cfg, tt.s, PDFMetadata{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(data, []byte(tt.mediaBox)) {
+				t.Errorf("PDF page is not sized at %d DPI, want %s", tt.want, tt.mediaBox)
+			}
+		})
+	}
+}
+
+func TestSettingsToScanConfigPaperSize(t *testing.T) {
+	tests := []struct {
+		paperSize string
+		want      vens.PaperSize
+	}{
+		{"auto", vens.PaperAuto},
+		{"a4", vens.PaperA4},
+		{"letter", vens.PaperLetter},
+		{"legal", vens.PaperLegal},
+	}
+	for _, tt := range tests {
+		cfg := SettingsToScanConfig(config.Settings{PaperSize: tt.paperSize})
+		if cfg.PaperSize != tt.want {
+			t.Errorf("%s: PaperSize = %d, want %d", tt.paperSize, cfg.PaperSize, tt.want)
+		}
+		if tt.want != vens.PaperAuto {
+			dim := vens.PaperDimensions[tt.want]
+			if cfg.PaperWidth != dim.Width || cfg.PaperHeight != dim.Height {
+				t.Errorf("%s: paper = %dx%d, want %dx%d", tt.paperSize, cfg.PaperWidth, cfg.PaperHeight, dim.Width, dim.Height)
+			}
+		}
+	}
+}
+
+func TestSettingsToScanConfigCompression(t *testing.T) {
+	tests := []struct {
+		compression int
+		want        byte
+	}{
+		{0, 0x0B}, // unset: standard
+		{1, 0x0D},
+		{2, 0x0C},
+		{3, 0x0B},
+		{4, 0x0A},
+		{5, 0x09},
+		{6, 0x0B},
+	}
+	for _, tt := range tests {
+		cfg := SettingsToScanConfig(config.Settings{Compression: tt.compression})
+		if cfg.CompressionArg != tt.want {
+			t.Errorf("Compression %d: CompressionArg = 0x%02X, want 0x%02X", tt.compression, cfg.CompressionArg, tt.want)
+		}
+	}
+}
+
+func TestSettingsToScanConfigMaxResolution(t *testing.T) {
+	if cfg := SettingsToScanConfig(config.Settings{Resolution: 300, MaxResolution: 200}); cfg.Quality != vens.QualityFine {
+		t.Errorf("300 dpi capped at 200: Quality = %d, want Fine", cfg.Quality)
+	}
+	if cfg := SettingsToScanConfig(config.Settings{MaxResolution: 150}); cfg.Quality != vens.QualityNormal {
+		t.Errorf("auto capped at 150: Quality = %d, want Normal", cfg.Quality)
+	}
+}
+
+func TestSetJobResultEmptyScan(t *testing.T) {
+	noPaper := fmt.Errorf("scan: %w", &vens.ScanError{Kind: vens.ScanErrNoPaper, Msg: "no paper in ADF"})
+	tests := []struct {
+		name       string
+		ignore     bool
+		err        error
+		pages      int
+		wantReport bool
+		wantError  bool
+	}{
+		{"no paper is an error by default", false, noPaper, 0, true, true},
+		{"no paper ignored", true, noPaper, 0, false, false},
+		{"no pages ignored", true, errNoPages, 0, false, false},
+		{"other errors still reported", true, errors.New("scan: paper jam"), 0, true, true},
+		{"success", true, nil, 2, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &ScanJobStatus{}
+			status.SetResult(nil, 3, "/scans")
+			prev := status.Snapshot()
+			status.SetScanning(true)
+
+			report := status.SetJobResult(config.Settings{IgnoreEmptyScan: tt.ignore}, tt.err, tt.pages, "/scans")
+			if report != tt.wantReport {
+				t.Errorf("report = %v, want %v", report, tt.wantReport)
+			}
+			got := status.Snapshot()
+			if got.Scanning {
+				t.Error("still scanning")
+			}
+			if (got.LastError != "") != tt.wantError {
+				t.Errorf("LastError = %q, want error %v", got.LastError, tt.wantError)
+			}
+			if !report && (got.Pages != prev.Pages || got.LastScan != prev.LastScan) {
+				t.Errorf("ignored empty scan changed the last result: pages %d at %s", got.Pages, got.LastScan)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package scanner
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -12,6 +14,21 @@ import (
 	"github.com/mzyy94/airscap/internal/vens"
 )
 
+// Connection errors returned by Connect. Use errors.Is to tell a scanner that
+// refuses our identity apart from one that cannot be reached at all.
+var (
+	// ErrPairingRejected means the scanner answered but rejected the pairing
+	// identity, i.e. the password is wrong. Retrying will not help.
+	ErrPairingRejected = errors.New("pairing rejected — wrong password/identity")
+	// ErrUnreachable means the scanner did not answer discovery (powered off,
+	// asleep, or wrong address). It may come back later.
+	ErrUnreachable = errors.New("scanner unreachable")
+)
+
+// ErrWifiModeDisabled is returned by SetWifiMode unless the experimental
+// Wi-Fi mode switch was enabled with SetWifiModeSwitch.
+var ErrWifiModeDisabled = errors.New("wifi mode switch is disabled")
+
 // Scanner is a high-level interface for ScanSnap operations.
 type Scanner struct {
 	mu          sync.Mutex
@@ -26,14 +43,58 @@ type Scanner struct {
 	name        string
 	serial      string
 	deviceName        string // full device name with manufacturer from TCP GET_SET sub=0x12
+	manufacturer      string // manufacturer prefix of deviceName; "" if the name has none
 	firmwareRevision  string // firmware revision from device name suffix (e.g. "0M00")
 	scanParams        *vens.ScanParams // capabilities from INQUIRY VPD 0xF0
+	model             vens.Model       // from deviceName; fills in scanParams the scanner did not report
 	wifiState         uint32           // last GET_WIFI_STATUS state (signal strength, 0 to 3)
+	discovered        bool             // the last discovery got an answer
+	paired            bool             // discovery: the scanner is reserved by a client
+	pairedClient      string           // discovery: IP of the reserving client
+	reclaim           bool             // take the reservation back from another client, see SetReclaimReservation
+	reconnectAfter    time.Time        // no reconnect attempts before this time (Wi-Fi mode switch)
+	startMode         string           // Settings.StartMode applied after pairing; "" = leave as is
+	blankThreshold    float64          // Settings.BlankThreshold, see SetBlankThreshold
+	ecoIdle           time.Duration    // eco mode idle timeout; 0 = off, see SetEcoMode
+	ecoReleased       bool             // eco mode released the reservation
+	lastActivity      time.Time        // last scan, for the eco idle timer
+	activeScans       int              // running scan sessions; eco mode waits for them
+	now               func() time.Time // time.Now if nil; replaced in tests
+	findScanner       func(context.Context, vens.DiscoveryOptions) (*vens.DeviceInfo, error) // vens.FindScanner if nil
+	discoveryCache    *DiscoveryCache  // ports of the last connection, see SetDiscoveryCache; nil = always discover
+	skipDiscovery     bool             // connect without UDP discovery, see SetSkipDiscovery
 
 	reconnCancel context.CancelFunc
 	reconnDone   chan struct{}
+
+	devInfoRetries    int           // extra GetDeviceInfo attempts during Connect
+	devInfoRetryDelay time.Duration // pause before each GetDeviceInfo retry
+	chunkSize         uint32        // page transfer chunk size (0 = vens default)
+	pipelined         bool          // pipelined page transfer (experimental)
+	shortRetries      int           // resends of a data command with a truncated response
+	timeoutLimit      int           // scan timeouts in a row before reconnecting, see SetScanTimeoutLimit
+	scanTimeouts      int           // scans that timed out in a row
+	healthFailLimit   int           // failed health checks in a row before going offline, see SetHealthFailureLimit
+	healthFailures    int           // health checks that failed in a row
+	wifiModeSwitch    bool          // SetWifiMode allowed (experimental), see SetWifiModeSwitch
+	startModeControl  bool          // start mode sent to the scanner (experimental), see SetStartModeControl
 }
 
+// Defaults for SetDeviceInfoRetry. Some firmware fails the first device info
+// request right after pairing.
+const (
+	DefaultDeviceInfoRetries    = 1
+	DefaultDeviceInfoRetryDelay = 2 * time.Second
+)
+
+// DefaultScanTimeoutLimit is the default for SetScanTimeoutLimit.
+const DefaultScanTimeoutLimit = 2
+
+// DefaultHealthFailureLimit is the default for SetHealthFailureLimit. With
+// the 5 second health check interval a scanner that stops answering is
+// reported offline after about 15 seconds.
+const DefaultHealthFailureLimit = 3
+
 // New creates a Scanner targeting the given host with a pre-computed identity.
 func New(host string, dataPort, controlPort uint16, identity string) *Scanner {
 	var token [8]byte
@@ -46,7 +107,135 @@ func New(host string, dataPort, controlPort uint16, identity string) *Scanner {
 		token:       token,
 		identity:    identity,
 		control:     vens.NewControlSession(host, controlPort),
+
+		devInfoRetries:    DefaultDeviceInfoRetries,
+		devInfoRetryDelay: DefaultDeviceInfoRetryDelay,
+		shortRetries:      vens.DefaultShortResponseRetries,
+		timeoutLimit:      DefaultScanTimeoutLimit,
+		healthFailLimit:   DefaultHealthFailureLimit,
+	}
+}
+
+// SetDeviceInfoRetry configures how many times Connect retries a failed
+// device info request and how long it waits before each retry. A count of 0
+// disables the retry.
+func (s *Scanner) SetDeviceInfoRetry(retries int, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devInfoRetries = max(0, retries)
+	s.devInfoRetryDelay = max(0, delay)
+}
+
+// SetTransferChunkSize sets the bytes requested per page transfer chunk
+// (see vens.DataChannel.SetChunkSize). 0 uses the default 256KB.
+func (s *Scanner) SetTransferChunkSize(n uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunkSize = n
+}
+
+// SetPipelinedTransfer enables experimental pipelined page transfer, which
+// requests the next chunk while the current one is still being received.
+func (s *Scanner) SetPipelinedTransfer(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pipelined = on
+}
+
+// SetShortResponseRetries sets how many times a data channel command is
+// resent when the scanner returns a truncated response (see
+// vens.DataChannel.SetShortResponseRetries). 0 disables the retry.
+func (s *Scanner) SetShortResponseRetries(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shortRetries = max(0, n)
+}
+
+// SetScanTimeoutLimit sets how many scans in a row may fail with a scanner
+// response timeout before the session is considered wedged: the scanner is
+// then marked offline and the reconnect loop pairs again from scratch. 0
+// disables it.
+func (s *Scanner) SetScanTimeoutLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeoutLimit = max(0, n)
+}
+
+// SetHealthFailureLimit sets how many health checks in a row must fail
+// before the scanner is marked offline, so a single lost packet on a weak
+// Wi-Fi link does not take it offline and trigger a reconnect. Values below
+// 1 mark it offline on the first failure.
+func (s *Scanner) SetHealthFailureLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthFailLimit = max(1, n)
+}
+
+// SetReclaimReservation sets what happens when the health check finds the
+// scanner paired with another client (e.g. ScanSnap Home on another
+// machine). By default AirScap goes offline and reconnects once the other
+// client releases the scanner; with on it reconnects right away, taking the
+// reservation back.
+func (s *Scanner) SetReclaimReservation(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reclaim = on
+}
+
+// SetDiscoveryCache makes Connect reuse the ports and identity cached for the
+// scanner's address instead of running UDP discovery first. Discovery runs
+// when nothing is cached for the scanner's token or connecting with the
+// cached entry fails, which also drops the entry. nil always runs discovery.
+func (s *Scanner) SetDiscoveryCache(c *DiscoveryCache) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discoveryCache = c
+}
+
+// SetSkipDiscovery makes Connect use ConnectDirect, so no UDP discovery is
+// sent at all, e.g. where broadcast and multicast are blocked. The scanner
+// must have been created with its IP address. Pairing checks, which rely on
+// discovery, are skipped as well.
+func (s *Scanner) SetSkipDiscovery(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipDiscovery = on
+}
+
+// SetBlankThreshold enables software blank page removal: scanned pages with
+// at least percent near-white pixels are dropped (see isBlankPage). 0
+// disables it, leaving blank pages to the scanner's BlankPageRemoval.
+func (s *Scanner) SetBlankThreshold(percent float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blankThreshold = max(0, percent)
+}
+
+// dataChannel returns a new data channel for the scanner with the configured
+// transfer settings applied.
+func (s *Scanner) dataChannel() *vens.DataChannel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dc := vens.NewDataChannel(s.host, s.dataPort, s.token)
+	dc.SetChunkSize(s.chunkSize)
+	dc.SetPipelining(s.pipelined)
+	dc.SetShortResponseRetries(s.shortRetries)
+	return dc
+}
+
+// getDeviceInfo requests device info, retrying as set by SetDeviceInfoRetry.
+func (s *Scanner) getDeviceInfo(dataCh *vens.DataChannel) (*vens.DataDeviceInfo, error) {
+	s.mu.Lock()
+	retries, delay := s.devInfoRetries, s.devInfoRetryDelay
+	s.mu.Unlock()
+
+	devInfo, err := dataCh.GetDeviceInfo()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		slog.Warn("get device info failed, retrying", "err", err, "attempt", attempt, "delay", delay)
+		time.Sleep(delay)
+		devInfo, err = dataCh.GetDeviceInfo()
 	}
+	return devInfo, err
 }
 
 // Online returns whether the scanner session is active (thread-safe).
@@ -57,27 +246,70 @@ func (s *Scanner) Online() bool {
 }
 
 // Connect establishes a session with the scanner: discovery, heartbeat, configure, data setup.
+// With a discovery cache (see SetDiscoveryCache), discovery is skipped while
+// the cached ports work.
+// With SetSkipDiscovery it is ConnectDirect.
 func (s *Scanner) Connect(ctx context.Context) error {
-	// Clean up any previous connection state (idempotent for reconnection)
 	s.mu.Lock()
-	if s.heartbeat != nil {
-		s.heartbeat.Stop()
-		s.heartbeat = nil
-	}
-	s.connected = false
+	cache, skip, token := s.discoveryCache, s.skipDiscovery, s.token
 	s.mu.Unlock()
+	if skip {
+		return s.ConnectDirect(ctx)
+	}
+	s.resetSession()
+
+	if info, ok := cache.get(s.host, token); ok {
+		slog.Debug("using cached discovery", "host", s.host, "dataPort", info.DataPort, "controlPort", info.ControlPort)
+		err := s.connect(ctx, info)
+		if err == nil || errors.Is(err, ErrPairingRejected) {
+			return err
+		}
+		slog.Info("connecting with cached discovery failed, discovering again", "host", s.host, "err", err)
+		cache.drop(s.host)
+	}
 
 	// Step 1: UDP discovery to let the scanner know our token
 	slog.Debug("discovery...", "host", s.host)
-	info, err := vens.FindScanner(ctx, vens.DiscoveryOptions{
-		ScannerIP: s.host,
-		Token:     s.token,
-	})
+	info, err := s.discover(ctx, 0)
 	if err != nil {
-		return fmt.Errorf("discovery: %w", err)
+		return fmt.Errorf("discovery: %w: %w", ErrUnreachable, err)
 	}
 	slog.Debug("discovery OK", "name", info.Name, "serial", info.Serial, "ip", info.DeviceIP, "dataPort", info.DataPort, "controlPort", info.ControlPort)
+	if err := s.connect(ctx, info); err != nil {
+		return err
+	}
+	cache.put(s.host, token, info)
+	return nil
+}
 
+// ConnectDirect establishes a session like Connect, but without discovery:
+// it goes straight to heartbeat, configure and data setup with the host and
+// ports the scanner was created with. The scanner name and serial, which
+// only discovery reports, stay unknown.
+func (s *Scanner) ConnectDirect(ctx context.Context) error {
+	if s.host == "" {
+		return fmt.Errorf("connect: %w", vens.ErrNoScannerIP)
+	}
+	s.resetSession()
+	slog.Debug("connecting without discovery", "host", s.host, "dataPort", s.dataPort, "controlPort", s.controlPort)
+	return s.connect(ctx, &vens.DeviceInfo{DeviceIP: s.host, DataPort: s.dataPort, ControlPort: s.controlPort})
+}
+
+// resetSession cleans up any previous connection state (idempotent for
+// reconnection).
+func (s *Scanner) resetSession() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.heartbeat != nil {
+		s.heartbeat.Stop()
+		s.heartbeat = nil
+	}
+	s.connected = false
+}
+
+// connect runs the steps of Connect after discovery, with the ports and
+// identity of info.
+func (s *Scanner) connect(ctx context.Context, info *vens.DeviceInfo) error {
 	// Update ports from discovery response
 	if info.DataPort != 0 {
 		s.dataPort = info.DataPort
@@ -114,24 +346,19 @@ func (s *Scanner) Connect(ctx context.Context) error {
 		s.mu.Lock()
 		s.heartbeat = nil
 		s.mu.Unlock()
-		return fmt.Errorf("pairing rejected — wrong password/identity")
+		return ErrPairingRejected
 	}
 
 	// Step 4: Data channel setup (with status check interleaved, matching Python flow)
 	slog.Debug("data channel setup...", "host", s.host, "port", s.dataPort)
-	dataCh := vens.NewDataChannel(s.host, s.dataPort, s.token)
-	devInfo, err := dataCh.GetDeviceInfo()
+	dataCh := s.dataChannel()
+	devInfo, err := s.getDeviceInfo(dataCh)
 	if err != nil {
-		slog.Warn("get device info failed, retrying in 2s", "err", err)
-		time.Sleep(2 * time.Second)
-		devInfo, err = dataCh.GetDeviceInfo()
-		if err != nil {
-			hb.Stop()
-			s.mu.Lock()
-			s.heartbeat = nil
-			s.mu.Unlock()
-			return fmt.Errorf("device info: %w", err)
-		}
+		hb.Stop()
+		s.mu.Lock()
+		s.heartbeat = nil
+		s.mu.Unlock()
+		return fmt.Errorf("device info: %w", err)
 	}
 
 	// Step 5: Status check (between data channel operations, matching Python flow)
@@ -148,57 +375,145 @@ func (s *Scanner) Connect(ctx context.Context) error {
 	if err != nil {
 		slog.Warn("get scan params failed", "err", err)
 	}
+	var model vens.Model
+	if devInfo != nil {
+		model = vens.ModelFromDeviceName(devInfo.DeviceName)
+	}
+	scanParams = model.CompleteScanParams(scanParams)
 
 	if _, err := dataCh.SetConfig(); err != nil {
 		slog.Warn("set config failed", "err", err)
 	}
 
+	s.mu.Lock()
+	startMode := s.startMode
+	s.mu.Unlock()
+	if err := s.applyStartMode(startMode); err != nil {
+		slog.Warn("set start mode failed", "mode", startMode, "err", err)
+	}
+
 	s.mu.Lock()
 	s.connected = true
+	s.healthFailures = 0
 	s.name = info.Name
 	s.serial = info.Serial
 	if devInfo != nil {
 		s.deviceName = devInfo.DeviceName
+		s.manufacturer = devInfo.Manufacturer
 		s.firmwareRevision = devInfo.FirmwareRevision
 	}
+	s.model = model
 	s.scanParams = scanParams
 	s.mu.Unlock()
-	slog.Info("connected to scanner", "host", s.host, "name", info.Name, "serial", info.Serial, "deviceName", s.deviceName)
+	slog.Info("connected to scanner", "host", s.host, "name", info.Name, "serial", info.Serial, "deviceName", s.deviceName, "model", model)
 	return nil
 }
 
+// ScanSession is a scan session started with Scanner.StartScan. Until it is
+// closed, eco mode does not release the scanner.
+type ScanSession struct {
+	*vens.ScanSession
+	sc   *Scanner
+	once sync.Once
+}
+
+// NextPage pulls the next page, restarting the eco idle timer.
+func (ss *ScanSession) NextPage() (vens.Page, error) {
+	p, err := ss.ScanSession.NextPage()
+	ss.sc.markActive()
+	return p, err
+}
+
+// Close ends the scan on the scanner.
+func (ss *ScanSession) Close() error {
+	err := ss.ScanSession.Close()
+	ss.once.Do(ss.sc.endScan)
+	return err
+}
+
 // StartScan begins a lazy scan session. Pages are pulled one at a time via
 // ScanSession.NextPage, allowing the client to stop after any page.
-func (s *Scanner) StartScan(cfg vens.ScanConfig) (*vens.ScanSession, error) {
+// Canceling ctx aborts the session (see vens.DataChannel.StartScan).
+// A model without duplex scans simplex whatever cfg asks for.
+func (s *Scanner) StartScan(ctx context.Context, cfg vens.ScanConfig) (*ScanSession, error) {
+	if err := s.wake(ctx); err != nil {
+		return nil, fmt.Errorf("wake scanner: %w", err)
+	}
 	if !s.Online() {
 		return nil, fmt.Errorf("scanner not connected")
 	}
+	cfg.Model = s.Model()
 	slog.Info("starting scan session", "colorMode", cfg.ColorMode, "quality", cfg.Quality, "duplex", cfg.Duplex, "paperSize", cfg.PaperSize)
-	dataCh := vens.NewDataChannel(s.host, s.dataPort, s.token)
-	return dataCh.StartScan(cfg)
+	dataCh := s.dataChannel()
+	s.beginScan()
+	session, err := dataCh.StartScan(ctx, cfg)
+	if err != nil {
+		s.endScan()
+		s.noteScanResult(err)
+		return nil, err
+	}
+	return &ScanSession{ScanSession: session, sc: s}, nil
 }
 
 // Scan executes a scan with the given config and returns pages.
 func (s *Scanner) Scan(cfg vens.ScanConfig, onPage func(vens.Page)) ([]vens.Page, error) {
+	var pages []vens.Page
+	err := s.ScanStreaming(cfg, func(p vens.Page) error {
+		pages = append(pages, p)
+		if onPage != nil {
+			onPage(p)
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// ScanStreaming executes a scan with the given config, calling onPage for
+// each non-empty page as soon as it arrives instead of collecting them.
+// Pages found blank with SetBlankThreshold are dropped. An error from
+// onPage stops the scan and is returned. A model without duplex scans
+// simplex whatever cfg asks for.
+func (s *Scanner) ScanStreaming(cfg vens.ScanConfig, onPage func(vens.Page) error) error {
+	if err := s.wake(context.Background()); err != nil {
+		return fmt.Errorf("wake scanner: %w", err)
+	}
 	if !s.Online() {
-		return nil, fmt.Errorf("scanner not connected")
+		return fmt.Errorf("scanner not connected")
 	}
+	s.beginScan()
+	defer s.endScan()
+	cfg.Model = s.Model()
 	slog.Info("starting scan", "colorMode", cfg.ColorMode, "quality", cfg.Quality, "duplex", cfg.Duplex, "paperSize", cfg.PaperSize)
-	dataCh := vens.NewDataChannel(s.host, s.dataPort, s.token)
-	pages, err := dataCh.RunScan(cfg, onPage)
-	if err != nil {
-		slog.Warn("scan error", "err", err, "pages_so_far", len(pages))
-		return pages, err
-	}
-	// Filter out empty pages
-	var result []vens.Page
-	for _, p := range pages {
-		if len(p.JPEG) > 0 {
-			result = append(result, p)
+	s.mu.Lock()
+	threshold := s.blankThreshold
+	s.mu.Unlock()
+	dataCh := s.dataChannel()
+	pages, blank := 0, 0
+	err := dataCh.RunScanStreaming(cfg, func(p vens.Page) error {
+		s.markActive()
+		// Skip empty pages
+		if len(p.JPEG) == 0 {
+			return nil
+		}
+		if threshold > 0 {
+			if ok, err := isBlankPage(p, threshold); err != nil {
+				slog.Warn("blank page detection failed, keeping page", "err", err)
+			} else if ok {
+				blank++
+				slog.Debug("dropped blank page", "blank", blank)
+				return nil
+			}
 		}
+		pages++
+		return onPage(p)
+	})
+	s.noteScanResult(err)
+	if err != nil {
+		slog.Warn("scan error", "err", err, "pages_so_far", pages)
+		return err
 	}
-	slog.Info("scan complete", "total_pages", len(pages), "non_empty", len(result))
-	return result, nil
+	slog.Info("scan complete", "non_empty", pages, "blank_dropped", blank)
+	return nil
 }
 
 // Disconnect deregisters from the scanner and stops heartbeat.
@@ -234,6 +549,37 @@ func (s *Scanner) markOffline() {
 	s.connected = false
 }
 
+// isScanTimeout reports whether a scan failed because the scanner stopped
+// answering, as opposed to being canceled or reporting an error.
+func isScanTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, context.Canceled)
+}
+
+// noteScanResult counts the scans that fail with a timeout in a row. At the
+// SetScanTimeoutLimit the scanner is marked offline, so instead of reusing
+// a half-dead session the reconnect loop pairs again.
+func (s *Scanner) noteScanResult(err error) {
+	s.mu.Lock()
+	if !isScanTimeout(err) {
+		s.scanTimeouts = 0
+		s.mu.Unlock()
+		return
+	}
+	s.scanTimeouts++
+	n, limit := s.scanTimeouts, s.timeoutLimit
+	wedged := limit > 0 && n >= limit
+	if wedged {
+		s.scanTimeouts = 0
+	}
+	s.mu.Unlock()
+
+	slog.Warn("scan timed out", "host", s.host, "in_a_row", n)
+	if wedged {
+		slog.Warn("scanner stopped responding during scans, reconnecting", "host", s.host, "timeouts", n)
+		s.markOffline()
+	}
+}
+
 // StartReconnectLoop starts a background goroutine that monitors scanner
 // health and reconnects automatically when the connection is lost.
 func (s *Scanner) StartReconnectLoop(ctx context.Context) {
@@ -251,19 +597,35 @@ func (s *Scanner) StopReconnectLoop() {
 	}
 }
 
+// pairingCheckInterval is how often the health check runs discovery to
+// notice another client taking the reservation.
+const pairingCheckInterval = 30 * time.Second
+
 func (s *Scanner) reconnectLoop(ctx context.Context) {
 	defer close(s.reconnDone)
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	var lastPairingCheck time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if s.Online() {
+				s.ecoCheck()
+			}
+			if s.Sleeping() {
+				// Released by eco mode; the next scan pairs again
+				continue
+			}
 			if s.Online() {
 				s.healthCheck()
+				if s.Online() && time.Since(lastPairingCheck) >= pairingCheckInterval {
+					lastPairingCheck = time.Now()
+					s.checkPairing(ctx)
+				}
 			} else {
 				s.tryReconnect(ctx)
 			}
@@ -282,29 +644,258 @@ func (s *Scanner) healthCheck() {
 		return
 	}
 	state, err := ctrl.CheckStatus(token)
+	s.mu.Lock()
 	if err != nil {
-		slog.Warn("health check failed", "err", err)
-		s.markOffline()
+		s.healthFailures++
+		n, limit := s.healthFailures, s.healthFailLimit
+		down := n >= limit
+		if down {
+			s.healthFailures = 0
+		}
+		s.mu.Unlock()
+		slog.Warn("health check failed", "err", err, "in_a_row", n, "limit", limit)
+		if down {
+			s.markOffline()
+		}
 		return
 	}
-	s.mu.Lock()
+	s.healthFailures = 0
 	s.wifiState = state
 	s.mu.Unlock()
 }
 
+// discover runs UDP discovery against the scanner and records the pairing
+// state it reports. A zero timeout uses the vens default.
+func (s *Scanner) discover(ctx context.Context, timeout time.Duration) (*vens.DeviceInfo, error) {
+	s.mu.Lock()
+	find := s.findScanner
+	token := s.token
+	skip := s.skipDiscovery
+	s.mu.Unlock()
+	if find == nil {
+		find = vens.FindScanner
+	}
+	info, err := find(ctx, vens.DiscoveryOptions{
+		ScannerIP:     s.host,
+		Token:         token,
+		Timeout:       timeout,
+		SkipDiscovery: skip,
+	})
+	if skip {
+		return info, err // the scanner was not asked, so its pairing state is unknown
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.discovered = false
+		return nil, err
+	}
+	s.discovered = true
+	s.paired = info.Paired
+	s.pairedClient = info.ClientIP
+	return info, nil
+}
+
+// DiscoverAll lists the scanners that answer broadcast discovery within
+// timeout, including this one. A zero timeout uses the vens default.
+// A discovery of this scanner running at the same time, e.g. by a
+// reconnect, is waited for first.
+func (s *Scanner) DiscoverAll(ctx context.Context, timeout time.Duration) ([]*vens.DeviceInfo, error) {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	return vens.FindAllScanners(ctx, vens.DiscoveryOptions{Token: token, Timeout: timeout})
+}
+
+// pairedElsewhere reports whether the last discovery found the scanner
+// paired with a client other than AirScap.
+func (s *Scanner) pairedElsewhere() bool {
+	s.mu.Lock()
+	discovered, paired, client := s.discovered, s.paired, s.pairedClient
+	s.mu.Unlock()
+	return discovered && paired && client != "" && client != vens.GetLocalIP(s.host)
+}
+
+// checkPairing runs discovery while online and takes the scanner offline if
+// another client has taken the reservation, so the status reflects it
+// instead of the next scan failing.
+func (s *Scanner) checkPairing(ctx context.Context) {
+	if _, err := s.discover(ctx, 3*time.Second); err != nil {
+		slog.Debug("pairing check failed", "err", err)
+		return
+	}
+	if s.pairedElsewhere() {
+		s.mu.Lock()
+		client := s.pairedClient
+		s.mu.Unlock()
+		slog.Warn("scanner reserved by another client", "host", s.host, "client", client)
+		s.markOffline()
+	}
+}
+
 func (s *Scanner) tryReconnect(ctx context.Context) {
+	s.mu.Lock()
+	reclaim := s.reclaim
+	wait := time.Until(s.reconnectAfter)
+	s.mu.Unlock()
+	if wait > 0 {
+		slog.Debug("waiting before reconnecting", "host", s.host, "remaining", wait)
+		return
+	}
+	if !reclaim && s.pairedElsewhere() {
+		// Wait for the other client to release the scanner
+		if _, err := s.discover(ctx, 3*time.Second); err != nil || s.pairedElsewhere() {
+			slog.Debug("scanner still reserved by another client", "host", s.host)
+			return
+		}
+	}
 	slog.Info("attempting reconnection...", "host", s.host)
 	if err := s.Connect(ctx); err != nil {
 		slog.Debug("reconnect failed", "host", s.host, "err", err)
 	}
 }
 
+// startModes maps Settings.StartMode values to SET_START_MODE values.
+var startModes = map[string]uint32{
+	"normal": vens.StartModeNormal,
+	"quick":  vens.StartModeQuick,
+}
+
+// ValidStartMode reports whether mode is a Settings.StartMode value:
+// "normal", "quick" or "".
+func ValidStartMode(mode string) bool {
+	_, ok := startModes[mode]
+	return ok || mode == ""
+}
+
+// SetStartMode sets what the scanner's scan button starts, "normal" or
+// "quick" (see config.Settings.StartMode). It is applied after each pairing
+// and right away when online; "" leaves the scanner's setting alone.
+func (s *Scanner) SetStartMode(mode string) error {
+	if !ValidStartMode(mode) {
+		return fmt.Errorf("unknown start mode %q", mode)
+	}
+	s.mu.Lock()
+	changed := s.startMode != mode
+	s.startMode = mode
+	s.mu.Unlock()
+	if !changed || !s.Online() {
+		return nil
+	}
+	return s.applyStartMode(mode)
+}
+
+// SetStartModeControl allows sending the start mode to the scanner. It is
+// off by default, as the SET_START_MODE values are not confirmed by a
+// capture; the mode set with SetStartMode is only remembered then.
+func (s *Scanner) SetStartModeControl(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startModeControl = on
+}
+
+// StartModeControl reports whether the start mode is sent to the scanner.
+func (s *Scanner) StartModeControl() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startModeControl
+}
+
+// applyStartMode sends mode to the scanner; "" does nothing, and so does
+// any mode without SetStartModeControl.
+func (s *Scanner) applyStartMode(mode string) error {
+	m, ok := startModes[mode]
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	ctrl := s.control
+	token := s.token
+	enabled := s.startModeControl
+	s.mu.Unlock()
+	if !enabled {
+		return nil
+	}
+	if err := ctrl.SetStartMode(token, m); err != nil {
+		return err
+	}
+	slog.Info("start mode set", "mode", mode)
+	return nil
+}
+
+// SetWifiModeSwitch allows SetWifiMode. It is off by default: the
+// SET_WIFI_MODE values are not confirmed by a capture, and a wrong switch
+// can take the scanner off the network.
+func (s *Scanner) SetWifiModeSwitch(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wifiModeSwitch = on
+}
+
+// WifiModeSwitch reports whether SetWifiMode is allowed.
+func (s *Scanner) WifiModeSwitch() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wifiModeSwitch
+}
+
+// WifiModeSwitchDelay is how long the reconnect loop waits after SetWifiMode
+// for the scanner to restart its network interface.
+const WifiModeSwitchDelay = 15 * time.Second
+
+// SetWifiMode switches the scanner between infrastructure and direct-connect
+// mode (vens.WifiModeInfrastructure, vens.WifiModeDirect). The scanner drops
+// the session to apply it: the scanner goes offline and the reconnect loop
+// starts over after WifiModeSwitchDelay. In direct mode the scanner leaves
+// the network, so it only comes back once switched to infrastructure mode on
+// the device. It fails with ErrWifiModeDisabled unless enabled with
+// SetWifiModeSwitch.
+func (s *Scanner) SetWifiMode(mode uint32) error {
+	if !s.WifiModeSwitch() {
+		return ErrWifiModeDisabled
+	}
+	if !s.Online() {
+		return fmt.Errorf("scanner not connected")
+	}
+	s.mu.Lock()
+	ctrl := s.control
+	token := s.token
+	s.mu.Unlock()
+	if err := ctrl.SetWifiMode(token, mode); err != nil {
+		return fmt.Errorf("set wifi mode: %w", err)
+	}
+	slog.Warn("wifi mode switched, scanner connection will drop", "host", s.host, "mode", mode)
+	s.mu.Lock()
+	s.reconnectAfter = time.Now().Add(WifiModeSwitchDelay)
+	s.mu.Unlock()
+	s.markOffline()
+	return nil
+}
+
+// RefreshScanParams re-reads the scanner capabilities (INQUIRY VPD 0xF0) over
+// a fresh data channel, e.g. after a firmware update, and stores the result.
+func (s *Scanner) RefreshScanParams() (*vens.ScanParams, error) {
+	if !s.Online() {
+		return nil, fmt.Errorf("scanner not connected")
+	}
+	dataCh := s.dataChannel()
+	params, err := dataCh.GetScanParams()
+	if err != nil {
+		return nil, fmt.Errorf("get scan params: %w", err)
+	}
+	s.mu.Lock()
+	params = s.model.CompleteScanParams(params)
+	s.scanParams = params
+	s.mu.Unlock()
+	return params, nil
+}
+
 // CheckSenseStatus probes the scanner for error conditions via REQUEST SENSE.
 func (s *Scanner) CheckSenseStatus() *vens.ScanError {
 	if !s.Online() {
 		return nil
 	}
-	dataCh := vens.NewDataChannel(s.host, s.dataPort, s.token)
+	dataCh := s.dataChannel()
 	return dataCh.CheckSenseStatus()
 }
 
@@ -313,10 +904,23 @@ func (s *Scanner) CheckADFStatus() (*vens.ADFStatus, error) {
 	if !s.Online() {
 		return nil, fmt.Errorf("scanner not connected")
 	}
-	dataCh := vens.NewDataChannel(s.host, s.dataPort, s.token)
+	dataCh := s.dataChannel()
 	return dataCh.CheckADFStatus()
 }
 
+// CurrentScanSettings reads back the scan settings stored in the scanner.
+func (s *Scanner) CurrentScanSettings() (*vens.ScanConfigState, error) {
+	if !s.Online() {
+		return nil, fmt.Errorf("scanner not connected")
+	}
+	dataCh := s.dataChannel()
+	resp, err := dataCh.GetScanSettings()
+	if err != nil {
+		return nil, err
+	}
+	return vens.ParseScanSettings(resp)
+}
+
 // Host returns the scanner's IP address.
 func (s *Scanner) Host() string { return s.host }
 
@@ -341,6 +945,14 @@ func (s *Scanner) DeviceName() string {
 	return s.deviceName
 }
 
+// Manufacturer returns the manufacturer prefix of the device name, or "" if
+// the scanner reports its name without one.
+func (s *Scanner) Manufacturer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.manufacturer
+}
+
 // FirmwareRevision returns the firmware revision from the device name suffix.
 func (s *Scanner) FirmwareRevision() string {
 	s.mu.Lock()
@@ -348,7 +960,16 @@ func (s *Scanner) FirmwareRevision() string {
 	return s.firmwareRevision
 }
 
-// ScanParams returns the scanner capabilities from INQUIRY VPD 0xF0.
+// Model returns the scanner model detected from the device name.
+func (s *Scanner) Model() vens.Model {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.model
+}
+
+// ScanParams returns the scanner capabilities from INQUIRY VPD 0xF0, with
+// what the scanner did not report filled in from its model's limits (see
+// vens.Model.CompleteScanParams).
 func (s *Scanner) ScanParams() *vens.ScanParams {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -362,6 +983,15 @@ func (s *Scanner) WifiState() uint32 {
 	return s.wifiState
 }
 
+// Pairing returns the reservation state reported by the last discovery:
+// whether the scanner is paired and the IP of the client it is paired with.
+// ok is false if the last discovery got no answer.
+func (s *Scanner) Pairing() (paired bool, clientIP string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paired, s.pairedClient, s.discovered
+}
+
 // MakeAndModel returns the device name (already stripped of firmware revision by ParseDataDeviceInfo).
 // Falls back to the discovery name if the full device name is unavailable.
 func (s *Scanner) MakeAndModel() string {
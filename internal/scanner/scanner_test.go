@@ -0,0 +1,717 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/proto/escl"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// fakeDataServer emulates the VENS data channel: it sends a welcome packet on
+// each connection, reads one length-prefixed request and replies with
+// respond(request). It returns the listening port.
+func fakeDataServer(t *testing.T, respond func(req []byte) []byte) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				welcome := make([]byte, vens.WelcomeSize)
+				copy(welcome[4:8], vens.Magic[:])
+				if _, err := conn.Write(welcome); err != nil {
+					return
+				}
+				for {
+					hdr := make([]byte, 4)
+					if _, err := io.ReadFull(conn, hdr); err != nil {
+						return
+					}
+					req := make([]byte, binary.BigEndian.Uint32(hdr))
+					copy(req, hdr)
+					if _, err := io.ReadFull(conn, req[4:]); err != nil {
+						return
+					}
+					if _, err := conn.Write(respond(req)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// fakeReply returns a responder for fakeDataServer that answers every
+// request with an all-zero response of n bytes: an accepted reservation on
+// the control channel, an unnamed device on the data channel.
+func fakeReply(n int) func(req []byte) []byte {
+	return func([]byte) []byte {
+		resp := make([]byte, n)
+		binary.BigEndian.PutUint32(resp[0:4], uint32(n))
+		copy(resp[4:8], vens.Magic[:])
+		return resp
+	}
+}
+
+// scanParamsResponse builds an INQUIRY VPD 0xF0 response with the given
+// maximum resolution and maximum width/height (1/600 inch).
+func scanParamsResponse(maxRes int, maxWidth, maxHeight uint16) []byte {
+	data := make([]byte, 184)
+	binary.BigEndian.PutUint32(data[0:4], 184)
+	copy(data[4:8], vens.Magic[:])
+	binary.BigEndian.PutUint32(data[32:36], vens.CmdGetSet)
+	binary.BigEndian.PutUint16(data[45:47], uint16(maxRes))
+	binary.BigEndian.PutUint16(data[47:49], uint16(maxRes))
+	binary.BigEndian.PutUint16(data[54:56], 50)
+	binary.BigEndian.PutUint16(data[56:58], 50)
+	binary.BigEndian.PutUint16(data[62:64], maxWidth)
+	binary.BigEndian.PutUint16(data[66:68], maxHeight)
+	return data
+}
+
+func TestRefreshCapabilities(t *testing.T) {
+	var requests atomic.Int32
+	port := fakeDataServer(t, func(req []byte) []byte {
+		requests.Add(1)
+		return scanParamsResponse(600, 0x1468, 0x50E8)
+	})
+
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.dataPort = port
+	sc.connected = true
+	a := &ESCLAdapter{scanner: sc}
+	a.caps = a.buildCapabilities()
+
+	before, after, err := a.RefreshCapabilities()
+	if err != nil {
+		t.Fatalf("RefreshCapabilities: %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("data channel requests = %d, want 1", requests.Load())
+	}
+	if got := before.ADFSimplex.MaxOpticalXResolution; got != 300 {
+		t.Errorf("before max resolution = %d, want fallback 300", got)
+	}
+	if got := after.ADFSimplex.MaxOpticalXResolution; got != 600 {
+		t.Errorf("after max resolution = %d, want 600", got)
+	}
+	if sc.ScanParams() == nil || sc.ScanParams().MaxResolutionX != 600 {
+		t.Errorf("scanner params not updated: %+v", sc.ScanParams())
+	}
+	if a.Capabilities() != after {
+		t.Error("adapter still advertises old capabilities")
+	}
+}
+
+func TestRefreshCapabilitiesOffline(t *testing.T) {
+	sc := newTestScanner(nil)
+	a := &ESCLAdapter{scanner: sc}
+	a.caps = a.buildCapabilities()
+
+	before, after, err := a.RefreshCapabilities()
+	if err == nil {
+		t.Fatal("expected error when scanner is offline")
+	}
+	if before != after {
+		t.Error("capabilities should be unchanged on failure")
+	}
+}
+
+// statusResponse builds a GET_STATUS response carrying scanStatus at offset 40.
+func statusResponse(scanStatus uint32) []byte {
+	data := make([]byte, vens.StatusRespErrorOffset+4)
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(data)))
+	copy(data[4:8], vens.Magic[:])
+	binary.BigEndian.PutUint32(data[vens.StatusRespScanStatusOffset:], scanStatus)
+	return data
+}
+
+func TestScanErrorKindPropagatesToAdapter(t *testing.T) {
+	tests := []struct {
+		name       string
+		scanStatus uint32
+		want       vens.ScanErrorKind
+	}{
+		{"cover open", vens.ADFCoverOpenMask, vens.ScanErrCoverOpen},
+		{"no paper", vens.ADFPaperMask, vens.ScanErrNoPaper},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := fakeDataServer(t, func(req []byte) []byte {
+				return statusResponse(tt.scanStatus)
+			})
+			sc := newTestScanner(nil)
+			sc.host = "127.0.0.1"
+			sc.dataPort = port
+			sc.connected = true
+			a := &ESCLAdapter{scanner: sc, listenPort: 8080}
+			a.caps = a.buildCapabilities()
+
+			_, err := a.Scan(context.Background(), abstract.ScannerRequest{})
+			var scanErr *vens.ScanError
+			if !errors.As(err, &scanErr) {
+				t.Fatalf("Scan() err = %v, want *vens.ScanError", err)
+			}
+			if scanErr.Kind != tt.want {
+				t.Errorf("returned Kind = %v, want %v", scanErr.Kind, tt.want)
+			}
+			if got := a.LastErrorKind(); got != tt.want {
+				t.Errorf("LastErrorKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeScanDevice returns a data channel responder that feeds the given pages,
+// one simplex sheet each, through a VENS scan session. Every page reports
+// 850x1100 pixels at 100 DPI in its pixel size metadata.
+func fakeScanDevice(pages [][]byte) func(req []byte) []byte {
+	var waits, sheet atomic.Int32
+	short := func(n int) []byte {
+		resp := make([]byte, n)
+		binary.BigEndian.PutUint32(resp[0:4], uint32(n))
+		copy(resp[4:8], vens.Magic[:])
+		return resp
+	}
+	return func(req []byte) []byte {
+		switch req[48] { // CDB opcode
+		case 0xC2: // GET STATUS: paper loaded, no error
+			return statusResponse(0)
+		case 0xE0: // WAIT FOR SCAN: a sheet is ready while pages remain
+			resp := short(40)
+			if int(waits.Add(1)) > len(pages) {
+				binary.BigEndian.PutUint32(resp[vens.WaitRespStatusOffset:], 1)
+			}
+			return resp
+		case vens.SCSIOpcodeRead10:
+			if req[50] == vens.DataTypePixelSize {
+				resp := short(40 + int(vens.PixelSizeResponseLen))
+				binary.BigEndian.PutUint32(resp[40:], 850)  // width
+				binary.BigEndian.PutUint32(resp[44:], 1100) // height
+				binary.BigEndian.PutUint16(resp[58:], 100)  // X resolution
+				binary.BigEndian.PutUint16(resp[60:], 100)  // Y resolution
+				return resp
+			}
+			if req[50] == vens.DataTypePaperSize {
+				resp := short(40 + int(vens.PaperSizeResponseLen))
+				binary.BigEndian.PutUint16(resp[44:], 1) // A4
+				return resp
+			}
+			if req[50] != 0 || req[59] != 0 {
+				// a pipelined request past the final chunk
+				return short(16)
+			}
+			data := pages[sheet.Add(1)-1]
+			resp := make([]byte, vens.PageHeaderSize, vens.PageHeaderSize+len(data))
+			binary.BigEndian.PutUint32(resp[0:4], uint32(vens.PageHeaderSize+len(data)))
+			copy(resp[4:8], vens.Magic[:])
+			binary.BigEndian.PutUint32(resp[12:16], vens.PageTypeFinal)
+			return append(resp, data...)
+		}
+		return short(40)
+	}
+}
+
+func TestScanPixelSize(t *testing.T) {
+	pages := [][]byte{{0xFF, 0xD8, 0xFF, 0x01}, {0xFF, 0xD8, 0xFF, 0x02}}
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.dataPort = fakeDataServer(t, fakeScanDevice(pages))
+	sc.connected = true
+
+	cfg := vens.DefaultScanConfig()
+	cfg.Duplex = false
+	got, err := sc.Scan(cfg, nil)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(got) != len(pages) {
+		t.Fatalf("pages = %d, want %d", len(got), len(pages))
+	}
+	want := vens.PixelSizeInfo{XPixels: 850, YPixels: 1100, XRes: 100, YRes: 100}
+	for i, p := range got {
+		if p.PixelSize == nil || *p.PixelSize != want {
+			t.Errorf("page %d PixelSize = %+v, want %+v", i, p.PixelSize, want)
+		}
+		if p.PaperSize == nil || *p.PaperSize != vens.PaperDimensions[vens.PaperA4] {
+			t.Errorf("page %d PaperSize = %+v, want A4", i, p.PaperSize)
+		}
+	}
+}
+
+func TestESCLScanPDF(t *testing.T) {
+	var pages [][]byte
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 850, 1100)), nil); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, buf.Bytes())
+	}
+	port := fakeDataServer(t, fakeScanDevice(pages))
+
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.dataPort = port
+	sc.connected = true
+	a := &ESCLAdapter{scanner: sc, listenPort: 8080}
+	a.caps = a.buildCapabilities()
+
+	doc, err := a.Scan(context.Background(), abstract.ScannerRequest{
+		ColorMode:      abstract.ColorModeMono,
+		DocumentFormat: "application/pdf",
+		Resolution:     abstract.Resolution{XResolution: 300, YResolution: 300},
+	})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	defer doc.Close()
+
+	file, err := doc.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if file.Format() != "application/pdf" {
+		t.Errorf("Format = %q, want application/pdf", file.Format())
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.Contains(data, []byte("%%EOF")) {
+		t.Fatalf("document is not a PDF (%d bytes)", len(data))
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != len(pages) {
+		t.Errorf("PDF has %d pages, want %d", n, len(pages))
+	}
+	if _, err := doc.Next(); err != io.EOF {
+		t.Errorf("second Next: err = %v, want io.EOF", err)
+	}
+}
+
+func TestESCLCancelScan(t *testing.T) {
+	device := fakeScanDevice([][]byte{{0xFF, 0xD8, 0xFF, 0x01}})
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	endScan := make(chan struct{}, 1)
+	port := fakeDataServer(t, func(req []byte) []byte {
+		switch {
+		case req[48] == vens.SCSIOpcodeRead10 && req[50] == 0 && req[59] == 0:
+			// Stall the page transfer until the test lets it go
+			requested <- struct{}{}
+			<-release
+		case req[48] == 0xD6: // END SCAN
+			endScan <- struct{}{}
+		}
+		return device(req)
+	})
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.dataPort = port
+	sc.connected = true
+	a := &ESCLAdapter{scanner: sc, listenPort: 8080}
+	a.caps = a.buildCapabilities()
+
+	doc, err := a.Scan(context.Background(), abstract.ScannerRequest{})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := doc.Next()
+		errc <- err
+	}()
+	<-requested
+
+	a.CancelScan()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Next after cancel: err = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Next still blocked after CancelScan")
+	}
+	if a.ScannerState() != escl.ScannerIdle {
+		t.Errorf("ScannerState = %v after cancel, want Idle", a.ScannerState())
+	}
+
+	close(release)
+	doc.Close()
+	select {
+	case <-endScan:
+	case <-time.After(2 * time.Second):
+		t.Error("END SCAN not sent on close")
+	}
+	if _, err := doc.Next(); err != io.EOF {
+		t.Errorf("Next after close: err = %v, want io.EOF", err)
+	}
+}
+
+func TestESCLJobTracking(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 85, 110)), nil); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.Bytes()
+
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.connected = true
+	a := &ESCLAdapter{scanner: sc, listenPort: 8080}
+	a.caps = a.buildCapabilities()
+
+	// startJob scans as a new client job, pulling the given number of pages
+	startJob := func(jobURI string, pages int) abstract.Document {
+		t.Helper()
+		sc.dataPort = fakeDataServer(t, fakeScanDevice([][]byte{page, page}))
+		doc, err := a.Scan(context.Background(), abstract.ScannerRequest{})
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		a.SetJobURI(jobURI)
+		for range pages {
+			if _, err := doc.Next(); err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+		}
+		return doc
+	}
+
+	first := startJob("/ScanJobs/urn:uuid:job-1", 2)
+	if n, ok := a.JobImagesCompleted("urn:uuid:job-1"); !ok || n != 2 {
+		t.Errorf("job 1 images = %d, %v, want 2", n, ok)
+	}
+	first.Close()
+
+	second := startJob("/ScanJobs/urn:uuid:job-2", 1)
+	defer second.Close()
+	if n, _ := a.JobImagesCompleted("urn:uuid:job-2"); n != 1 {
+		t.Errorf("job 2 images = %d, want 1", n)
+	}
+	if n, _ := a.JobImagesCompleted("urn:uuid:job-1"); n != 2 {
+		t.Errorf("job 1 images = %d after job 2 started, want 2 still", n)
+	}
+	if _, ok := a.JobImagesCompleted("urn:uuid:other"); ok {
+		t.Error("unknown job reported as tracked")
+	}
+
+	// Deleting the finished job must not cancel the running one
+	a.CancelJob("/ScanJobs/urn:uuid:job-1")
+	if a.ScannerState() != escl.ScannerProcessing {
+		t.Errorf("ScannerState = %v after deleting a finished job, want Processing", a.ScannerState())
+	}
+	a.CancelJob("/ScanJobs/urn:uuid:job-2")
+	if a.ScannerState() != escl.ScannerIdle {
+		t.Errorf("ScannerState = %v after deleting the running job, want Idle", a.ScannerState())
+	}
+}
+
+func TestGetDeviceInfoRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		delay   time.Duration
+	}{
+		{"disabled", 0, time.Second},
+		{"two retries", 2, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			port := fakeDataServer(t, func(req []byte) []byte {
+				requests.Add(1)
+				// Too short to parse as device info
+				resp := make([]byte, 16)
+				binary.BigEndian.PutUint32(resp[0:4], 16)
+				copy(resp[4:8], vens.Magic[:])
+				return resp
+			})
+			sc := New("127.0.0.1", port, 0, "")
+			sc.SetDeviceInfoRetry(tt.retries, tt.delay)
+
+			// Count only the retries of getDeviceInfo itself
+			dc := vens.NewDataChannel("127.0.0.1", port, sc.token)
+			dc.SetShortResponseRetries(0)
+			start := time.Now()
+			_, err := sc.getDeviceInfo(dc)
+			elapsed := time.Since(start)
+			if err == nil {
+				t.Fatal("getDeviceInfo() error = nil, want parse error")
+			}
+			if got := int(requests.Load()); got != tt.retries+1 {
+				t.Errorf("requests = %d, want %d", got, tt.retries+1)
+			}
+			if want := time.Duration(tt.retries) * tt.delay; elapsed < want {
+				t.Errorf("elapsed = %v, want at least %v", elapsed, want)
+			}
+			if tt.retries == 0 && elapsed >= tt.delay {
+				t.Errorf("elapsed = %v, retry delay applied with retries disabled", elapsed)
+			}
+		})
+	}
+}
+
+func TestCheckPairingOwnershipChange(t *testing.T) {
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.connected = true
+	local := vens.GetLocalIP(sc.host)
+
+	var finds atomic.Int32
+	owner := local
+	sc.findScanner = func(context.Context, vens.DiscoveryOptions) (*vens.DeviceInfo, error) {
+		finds.Add(1)
+		if owner == "" {
+			return nil, errors.New("timeout")
+		}
+		return &vens.DeviceInfo{DeviceIP: sc.host, Paired: true, ClientIP: owner}, nil
+	}
+
+	sc.checkPairing(context.Background())
+	if !sc.Online() {
+		t.Fatal("went offline while AirScap holds the reservation")
+	}
+
+	// ScanSnap Home on another machine takes the scanner
+	owner = "192.168.1.20"
+	sc.checkPairing(context.Background())
+	if sc.Online() {
+		t.Error("still online after another client took the reservation")
+	}
+	if paired, client, ok := sc.Pairing(); !ok || !paired || client != owner {
+		t.Errorf("Pairing() = %v, %q, %v, want true, %q, true", paired, client, ok, owner)
+	}
+
+	// Without reclaiming, reconnecting waits for the other client
+	finds.Store(0)
+	sc.tryReconnect(context.Background())
+	if n := finds.Load(); n != 1 {
+		t.Errorf("discovery ran %d times, want 1 (no reconnect while reserved elsewhere)", n)
+	}
+
+	// With reclaiming, Connect runs right away (its discovery fails here)
+	sc.SetReclaimReservation(true)
+	finds.Store(0)
+	owner = ""
+	sc.tryReconnect(context.Background())
+	if n := finds.Load(); n != 1 {
+		t.Errorf("discovery ran %d times, want 1 (Connect)", n)
+	}
+	if _, _, ok := sc.Pairing(); ok {
+		t.Error("Pairing() still known after discovery failed")
+	}
+}
+
+func TestTryReconnectWaitsAfterWifiModeSwitch(t *testing.T) {
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	var finds atomic.Int32
+	sc.findScanner = func(context.Context, vens.DiscoveryOptions) (*vens.DeviceInfo, error) {
+		finds.Add(1)
+		return nil, errors.New("timeout")
+	}
+
+	sc.reconnectAfter = time.Now().Add(time.Minute)
+	sc.tryReconnect(context.Background())
+	if n := finds.Load(); n != 0 {
+		t.Errorf("reconnect attempted %d times during the switch delay", n)
+	}
+
+	sc.reconnectAfter = time.Now().Add(-time.Second)
+	sc.tryReconnect(context.Background())
+	if n := finds.Load(); n != 1 {
+		t.Errorf("reconnect attempted %d times after the switch delay, want 1", n)
+	}
+}
+
+func TestSetStartMode(t *testing.T) {
+	sent := make(chan []byte, 4)
+	port := fakeDataServer(t, func(req []byte) []byte {
+		sent <- req
+		return make([]byte, 16)
+	})
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.control = vens.NewControlSession(sc.host, port)
+
+	// Offline, the mode is only remembered for the next Connect
+	if err := sc.SetStartMode("quick"); err != nil {
+		t.Fatalf("SetStartMode offline: %v", err)
+	}
+	if len(sent) != 0 {
+		t.Fatal("start mode sent while offline")
+	}
+
+	// Unverified, so nothing is sent unless enabled
+	sc.connected = true
+	if err := sc.SetStartMode("normal"); err != nil {
+		t.Fatalf("SetStartMode disabled: %v", err)
+	}
+	if len(sent) != 0 {
+		t.Fatal("start mode sent without SetStartModeControl")
+	}
+	sc.SetStartModeControl(true)
+	sc.startMode = "quick"
+	if err := sc.SetStartMode("normal"); err != nil {
+		t.Fatalf("SetStartMode online: %v", err)
+	}
+	if req := <-sent; !bytes.Equal(req, vens.MarshalSetStartMode(sc.token, vens.StartModeNormal)) {
+		t.Errorf("request = % X", req)
+	}
+	if err := sc.SetStartMode("normal"); err != nil || len(sent) != 0 {
+		t.Errorf("unchanged mode: err = %v, sent %d requests", err, len(sent))
+	}
+	if err := sc.SetStartMode(""); err != nil || len(sent) != 0 {
+		t.Errorf("empty mode: err = %v, sent %d requests", err, len(sent))
+	}
+	if err := sc.SetStartMode("turbo"); err == nil {
+		t.Error("SetStartMode accepted an unknown mode")
+	}
+}
+
+func TestScanTimeoutsReconnect(t *testing.T) {
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.connected = true
+	sc.SetScanTimeoutLimit(DefaultScanTimeoutLimit)
+	var finds atomic.Int32
+	sc.findScanner = func(context.Context, vens.DiscoveryOptions) (*vens.DeviceInfo, error) {
+		finds.Add(1)
+		return nil, errors.New("timeout")
+	}
+	timeout := fmt.Errorf("read page: %w", os.ErrDeadlineExceeded)
+
+	// A timeout followed by a working scan does not count as wedged
+	sc.noteScanResult(timeout)
+	sc.noteScanResult(nil)
+	sc.noteScanResult(timeout)
+	if !sc.Online() {
+		t.Fatal("offline after timeouts that were not in a row")
+	}
+	// Canceled scans are not timeouts
+	sc.noteScanResult(fmt.Errorf("scan canceled: %w", context.Canceled))
+	sc.noteScanResult(timeout)
+	if !sc.Online() {
+		t.Fatal("offline after a canceled scan and a timeout")
+	}
+
+	sc.noteScanResult(timeout)
+	if sc.Online() {
+		t.Fatalf("still online after %d timeouts in a row", DefaultScanTimeoutLimit)
+	}
+	sc.tryReconnect(context.Background())
+	if n := finds.Load(); n != 1 {
+		t.Errorf("discovery ran %d times, want 1 (reconnect)", n)
+	}
+
+	sc.connected = true
+	sc.SetScanTimeoutLimit(0)
+	for range 5 {
+		sc.noteScanResult(timeout)
+	}
+	if !sc.Online() {
+		t.Error("went offline with the timeout limit disabled")
+	}
+}
+
+func TestHealthCheckFailureLimit(t *testing.T) {
+	var failing atomic.Bool
+	ok, short := fakeReply(32), fakeReply(16)
+	port := fakeDataServer(t, func(req []byte) []byte {
+		if failing.Load() {
+			return short(req) // too short for a status response
+		}
+		return ok(req)
+	})
+	sc := newTestScanner(nil)
+	sc.host = "127.0.0.1"
+	sc.control = vens.NewControlSession(sc.host, port)
+	sc.connected = true
+	sc.SetHealthFailureLimit(3)
+
+	// Failures that are not in a row are forgiven
+	failing.Store(true)
+	sc.healthCheck()
+	sc.healthCheck()
+	failing.Store(false)
+	sc.healthCheck()
+	failing.Store(true)
+	sc.healthCheck()
+	sc.healthCheck()
+	if !sc.Online() {
+		t.Fatal("offline after failed health checks that were not in a row")
+	}
+	sc.healthCheck()
+	if sc.Online() {
+		t.Fatal("still online after 3 failed health checks in a row")
+	}
+
+	sc.connected = true
+	sc.SetHealthFailureLimit(0)
+	sc.healthCheck()
+	if sc.Online() {
+		t.Error("still online after a failed health check with the limit at 1")
+	}
+}
+
+func TestConnectDirect(t *testing.T) {
+	controlPort := fakeDataServer(t, fakeReply(32))
+	dataPort := fakeDataServer(t, fakeReply(vens.DeviceInfoRespLen))
+
+	sc := New("127.0.0.1", dataPort, controlPort, "")
+	sc.SetDeviceInfoRetry(0, 0)
+	sc.SetSkipDiscovery(true)
+	var opts []vens.DiscoveryOptions
+	sc.findScanner = func(_ context.Context, o vens.DiscoveryOptions) (*vens.DeviceInfo, error) {
+		opts = append(opts, o)
+		return vens.FindScanner(context.Background(), o)
+	}
+	if err := sc.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer sc.heartbeat.Stop()
+	if !sc.Online() || sc.dataPort != dataPort || sc.controlPort != controlPort {
+		t.Errorf("online %v on ports %d/%d, want connected on %d/%d", sc.Online(), sc.dataPort, sc.controlPort, dataPort, controlPort)
+	}
+	if len(opts) != 0 {
+		t.Errorf("Connect ran discovery %d times, want none", len(opts))
+	}
+
+	// Pairing checks do not send discovery either
+	sc.checkPairing(context.Background())
+	if len(opts) != 1 || !opts[0].SkipDiscovery {
+		t.Errorf("pairing check discovery options = %+v, want SkipDiscovery", opts)
+	}
+	if _, _, ok := sc.Pairing(); ok || !sc.Online() {
+		t.Errorf("after the pairing check: pairing known %v, online %v, want unknown and online", ok, sc.Online())
+	}
+
+	if err := New("", dataPort, controlPort, "").ConnectDirect(context.Background()); !errors.Is(err, vens.ErrNoScannerIP) {
+		t.Errorf("ConnectDirect without a host = %v, want ErrNoScannerIP", err)
+	}
+}
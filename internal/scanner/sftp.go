@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// sftpTarget is a directory on an SFTP server that button scans are
+// uploaded to.
+type sftpTarget struct {
+	host   string // host:port
+	dir    string // directory on the server; "." = login directory
+	config *ssh.ClientConfig
+}
+
+// newSFTPTarget builds the SFTP destination configured in settings. It fails
+// if the private key or known_hosts file cannot be loaded, so a broken
+// configuration is reported before anything is scanned.
+func newSFTPTarget(s config.Settings) (sftpTarget, error) {
+	host := s.SFTPHost
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+
+	var auth []ssh.AuthMethod
+	if s.SFTPKeyPath != "" {
+		signer, err := loadSSHKey(s.SFTPKeyPath, s.SFTPPassword)
+		if err != nil {
+			return sftpTarget{}, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.SFTPPassword != "" {
+		auth = append(auth, ssh.Password(s.SFTPPassword))
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(s)
+	if err != nil {
+		return sftpTarget{}, err
+	}
+
+	return sftpTarget{
+		host: host,
+		dir:  path.Clean(s.SFTPPath),
+		config: &ssh.ClientConfig{
+			User:            s.SFTPUser,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+	}, nil
+}
+
+// loadSSHKey reads a private key file. A passphrase-protected key is
+// decrypted with passphrase (the configured SFTP password).
+func loadSSHKey(keyPath, passphrase string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read SFTP key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse SFTP key %s: %w", keyPath, err)
+	}
+	return signer, nil
+}
+
+// sftpHostKeyCallback verifies the server against the configured known_hosts
+// file, ~/.ssh/known_hosts by default. Verification can be turned off with
+// Settings.SFTPInsecureIgnoreHostKey.
+func sftpHostKeyCallback(s config.Settings) (ssh.HostKeyCallback, error) {
+	if s.SFTPInsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	file := s.SFTPKnownHosts
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("locate known_hosts: %w", err)
+		}
+		file = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	cb, err := knownhosts.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("load SFTP known_hosts: %w", err)
+	}
+	return cb, nil
+}
+
+// upload connects to the server and writes files into the target directory,
+// creating it if needed.
+func (t sftpTarget) upload(files []outputFile) error {
+	conn, err := ssh.Dial("tcp", t.host, t.config)
+	if err != nil {
+		return fmt.Errorf("SFTP connect: %w", err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("SFTP session: %w", err)
+	}
+	defer client.Close()
+
+	if t.dir != "." {
+		if err := client.MkdirAll(t.dir); err != nil {
+			return fmt.Errorf("SFTP create directory %s: %w", t.dir, err)
+		}
+	}
+
+	for _, f := range files {
+		name := path.Join(t.dir, f.Name)
+		if dir := path.Dir(name); dir != path.Clean(t.dir) {
+			if err := client.MkdirAll(dir); err != nil {
+				return fmt.Errorf("SFTP create directory %s: %w", dir, err)
+			}
+		}
+		if err := writeSFTPFile(client, name, f.Data); err != nil {
+			return fmt.Errorf("SFTP upload %s: %w", f.Name, err)
+		}
+	}
+	slog.Info("scan uploaded via SFTP", "host", t.host, "path", t.dir, "files", len(files))
+	return nil
+}
+
+func writeSFTPFile(client *sftp.Client, name string, data []byte) error {
+	f, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
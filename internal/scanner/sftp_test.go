@@ -0,0 +1,208 @@
+package scanner
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// fakeSFTPServer starts an SSH server accepting user/password that serves the
+// local filesystem over SFTP. It returns the listen address and host key.
+func fakeSFTPServer(t *testing.T, user, password string) (string, ssh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(nc, cfg)
+		}
+	}()
+	return ln.Addr().String(), hostKey.PublicKey()
+}
+
+func serveSFTP(nc net.Conn, cfg *ssh.ServerConfig) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, reqs, err := nch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(ch)
+					if err == nil {
+						server.Serve()
+						server.Close()
+					}
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSFTPUpload(t *testing.T) {
+	addr, hostKey := fakeSFTPServer(t, "scan", "secret")
+	dir := filepath.Join(t.TempDir(), "inbox", "airscap")
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := config.Settings{
+		SFTPHost:       addr,
+		SFTPUser:       "scan",
+		SFTPPassword:   "secret",
+		SFTPPath:       dir,
+		SFTPKnownHosts: knownHosts,
+	}
+	target, err := newSFTPTarget(s)
+	if err != nil {
+		t.Fatalf("newSFTPTarget: %v", err)
+	}
+	files := []outputFile{
+		{Name: "scan_001.jpg", Data: []byte("page one")},
+		{Name: "scan_002.jpg", Data: []byte("page two")},
+	}
+	if err := target.upload(files); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	for _, f := range files {
+		got, err := os.ReadFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(f.Data) {
+			t.Errorf("%s = %q, want %q", f.Name, got, f.Data)
+		}
+	}
+
+	t.Run("wrong password", func(t *testing.T) {
+		bad := s
+		bad.SFTPPassword = "wrong"
+		target, err := newSFTPTarget(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := target.upload(files); err == nil {
+			t.Error("upload succeeded with a wrong password")
+		}
+	})
+}
+
+func TestSFTPHostKeyVerification(t *testing.T) {
+	addr, _ := fakeSFTPServer(t, "scan", "secret")
+
+	// known_hosts lists a different key for the server
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ssh.NewSignerFromKey(otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, other.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := config.Settings{
+		SFTPHost:       addr,
+		SFTPUser:       "scan",
+		SFTPPassword:   "secret",
+		SFTPPath:       t.TempDir(),
+		SFTPKnownHosts: knownHosts,
+	}
+	files := []outputFile{{Name: "scan.pdf", Data: []byte("%PDF")}}
+
+	target, err := newSFTPTarget(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = target.upload(files)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		t.Fatalf("upload error = %v, want host key mismatch", err)
+	}
+
+	s.SFTPInsecureIgnoreHostKey = true
+	target, err = newSFTPTarget(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.upload(files); err != nil {
+		t.Errorf("upload with host key check disabled: %v", err)
+	}
+}
+
+func TestNewSFTPTarget(t *testing.T) {
+	_, err := newSFTPTarget(config.Settings{
+		SFTPHost:       "nas.local",
+		SFTPKnownHosts: filepath.Join(t.TempDir(), "missing"),
+	})
+	if err == nil {
+		t.Fatal("newSFTPTarget succeeded without a known_hosts file")
+	}
+
+	target, err := newSFTPTarget(config.Settings{SFTPHost: "nas.local", SFTPInsecureIgnoreHostKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.host != "nas.local:22" || target.dir != "." {
+		t.Errorf("host, dir = %q, %q, want nas.local:22 and login directory", target.host, target.dir)
+	}
+}
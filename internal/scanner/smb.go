@@ -0,0 +1,202 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+// NTSTATUS codes returned when the server has dropped the session or tree
+// connection, e.g. after an idle timeout or a server restart.
+const (
+	statusNetworkNameDeleted    = 0xC00000C9
+	statusUserSessionDeleted    = 0xC0000203
+	statusNetworkSessionExpired = 0xC000035C
+)
+
+// smbTarget is a directory on an SMB/CIFS share that button scans are
+// written to.
+type smbTarget struct {
+	host     string // host:port
+	share    string
+	dir      string // slash-separated directory within the share; "" = share root
+	domain   string
+	user     string
+	password string
+}
+
+// newSMBTarget builds the SMB destination configured in settings.
+func newSMBTarget(s config.Settings) smbTarget {
+	host := s.SMBHost
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "445")
+	}
+	domain, user := splitSMBUser(s.SMBUser)
+	if user == "" {
+		user = "guest"
+	}
+	return smbTarget{
+		host:     host,
+		share:    strings.Trim(s.SMBShare, `/\`),
+		dir:      smbDir(s.SMBPath),
+		domain:   domain,
+		user:     user,
+		password: s.SMBPassword,
+	}
+}
+
+// splitSMBUser splits a domain-qualified user name ("DOMAIN\user") into its
+// domain and user parts. Other forms, including "user@domain", are returned
+// as the user name unchanged.
+func splitSMBUser(v string) (domain, user string) {
+	if d, u, ok := strings.Cut(v, `\`); ok {
+		return d, u
+	}
+	return "", v
+}
+
+// smbDir normalizes a configured directory within a share to a relative,
+// slash-separated path that cannot escape the share root.
+func smbDir(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, `\`, "/"))
+	return strings.TrimPrefix(p, "/")
+}
+
+// isStaleSMBSession reports whether err means the connection or session is
+// gone and the operation may succeed on a fresh one.
+func isStaleSMBSession(err error) bool {
+	var te *smb2.TransportError
+	if errors.As(err, &te) {
+		return true
+	}
+	var re *smb2.ResponseError
+	if errors.As(err, &re) {
+		switch re.Code {
+		case statusNetworkNameDeleted, statusUserSessionDeleted, statusNetworkSessionExpired:
+			return true
+		}
+	}
+	return false
+}
+
+// smbConn is a mounted share on an authenticated SMB session.
+type smbConn struct {
+	tcp     net.Conn
+	session *smb2.Session
+	share   *smb2.Share
+}
+
+// dial connects to the server, authenticates and mounts the share.
+func (t smbTarget) dial() (*smbConn, error) {
+	tcp, err := net.DialTimeout("tcp", t.host, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("SMB connect: %w", err)
+	}
+	d := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     t.user,
+			Password: t.password,
+			Domain:   t.domain,
+		},
+	}
+	session, err := d.Dial(tcp)
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("SMB login: %w", err)
+	}
+	share, err := session.Mount(t.share)
+	if err != nil {
+		session.Logoff()
+		tcp.Close()
+		return nil, fmt.Errorf("SMB mount %s: %w", t.share, err)
+	}
+	return &smbConn{tcp: tcp, session: session, share: share}, nil
+}
+
+func (c *smbConn) MkdirAll(dir string, perm os.FileMode) error {
+	return c.share.MkdirAll(dir, perm)
+}
+
+func (c *smbConn) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return c.share.WriteFile(name, data, perm)
+}
+
+func (c *smbConn) close() {
+	c.share.Umount()
+	c.session.Logoff()
+	c.tcp.Close()
+}
+
+// smbSession is what upload needs of a mounted share; an *smbConn, or a
+// fake in tests.
+type smbSession interface {
+	MkdirAll(dir string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	close()
+}
+
+// upload writes files into the target directory, creating it if needed. If
+// the session goes stale mid-upload, it reconnects once per file and retries.
+func (t smbTarget) upload(files []outputFile) error {
+	return t.uploadWith(files, func() (smbSession, error) {
+		conn, err := t.dial()
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+// uploadWith is upload with the sessions opened by dial, which returns a nil
+// session with its error.
+func (t smbTarget) uploadWith(files []outputFile, dial func() (smbSession, error)) error {
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if conn != nil {
+			conn.close()
+		}
+	}()
+
+	if t.dir != "" {
+		if err := conn.MkdirAll(t.dir, 0755); err != nil {
+			return fmt.Errorf("SMB create directory %s: %w", t.dir, err)
+		}
+	}
+
+	for _, f := range files {
+		name := path.Join(t.dir, f.Name)
+		if dir := path.Dir(f.Name); dir != "." {
+			if err := conn.MkdirAll(path.Join(t.dir, dir), 0755); err != nil {
+				return fmt.Errorf("SMB create directory %s: %w", dir, err)
+			}
+		}
+		err := conn.WriteFile(name, f.Data, 0644)
+		if err != nil && isStaleSMBSession(err) {
+			slog.Warn("SMB session lost, reconnecting", "host", t.host, "err", err)
+			conn.close()
+			// dial returns a nil session on failure, so the deferred close
+			// skips the one just closed
+			if conn, err = dial(); err != nil {
+				return err
+			}
+			err = conn.WriteFile(name, f.Data, 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("SMB upload %s: %w", f.Name, err)
+		}
+	}
+	slog.Info("scan uploaded via SMB", "host", t.host, "share", t.share, "path", t.dir, "files", len(files))
+	return nil
+}
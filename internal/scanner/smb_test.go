@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/hirochachacha/go-smb2"
+
+	"github.com/mzyy94/airscap/internal/config"
+)
+
+func TestSplitSMBUser(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantDomain string
+		wantUser   string
+	}{
+		{"alice", "", "alice"},
+		{`WORKGROUP\alice`, "WORKGROUP", "alice"},
+		{"alice@example.com", "", "alice@example.com"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			domain, user := splitSMBUser(tt.in)
+			if domain != tt.wantDomain || user != tt.wantUser {
+				t.Errorf("splitSMBUser(%q) = %q, %q, want %q, %q", tt.in, domain, user, tt.wantDomain, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestSMBDir(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"scans", "scans"},
+		{`\scans\inbox\`, "scans/inbox"},
+		{"/scans//inbox/", "scans/inbox"},
+		{"../../etc", "etc"},
+	}
+	for _, tt := range tests {
+		if got := smbDir(tt.in); got != tt.want {
+			t.Errorf("smbDir(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewSMBTarget(t *testing.T) {
+	target := newSMBTarget(config.Settings{
+		SMBHost:  "nas.local",
+		SMBShare: "/scans/",
+		SMBUser:  `HOME\bob`,
+		SMBPath:  "inbox",
+	})
+	if target.host != "nas.local:445" {
+		t.Errorf("host = %q, want default port 445", target.host)
+	}
+	if target.share != "scans" || target.dir != "inbox" {
+		t.Errorf("share, dir = %q, %q, want scans, inbox", target.share, target.dir)
+	}
+	if target.domain != "HOME" || target.user != "bob" {
+		t.Errorf("domain, user = %q, %q, want HOME, bob", target.domain, target.user)
+	}
+
+	guest := newSMBTarget(config.Settings{SMBHost: "10.0.0.2:1445", SMBShare: "public"})
+	if guest.host != "10.0.0.2:1445" || guest.user != "guest" {
+		t.Errorf("host, user = %q, %q, want explicit port and guest", guest.host, guest.user)
+	}
+}
+
+func TestIsStaleSMBSession(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transport", &os.PathError{Op: "open", Path: "a.pdf", Err: &smb2.TransportError{Err: io.EOF}}, true},
+		{"session expired", &os.PathError{Op: "open", Path: "a.pdf", Err: &smb2.ResponseError{Code: statusNetworkSessionExpired}}, true},
+		{"session deleted", fmt.Errorf("write: %w", &smb2.ResponseError{Code: statusUserSessionDeleted}), true},
+		{"access denied", &os.PathError{Op: "open", Path: "a.pdf", Err: &smb2.ResponseError{Code: 0xC0000022}}, false},
+		{"other", io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStaleSMBSession(tt.err); got != tt.want {
+				t.Errorf("isStaleSMBSession = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSMBSession is an smbSession whose writes fail with err.
+type fakeSMBSession struct {
+	err    error
+	closed int
+}
+
+func (f *fakeSMBSession) MkdirAll(string, os.FileMode) error { return nil }
+
+func (f *fakeSMBSession) WriteFile(string, []byte, os.FileMode) error { return f.err }
+
+func (f *fakeSMBSession) close() { f.closed++ }
+
+func TestSMBUploadRedialFails(t *testing.T) {
+	stale := &fakeSMBSession{err: &smb2.TransportError{Err: io.EOF}}
+	dialErr := errors.New("connection refused")
+	dials := 0
+	dial := func() (smbSession, error) {
+		dials++
+		if dials == 1 {
+			return stale, nil
+		}
+		return nil, dialErr
+	}
+
+	target := smbTarget{host: "nas.local:445", share: "scans", dir: "inbox"}
+	err := target.uploadWith([]outputFile{{Name: "scan.pdf", Data: []byte("%PDF")}}, dial)
+	if !errors.Is(err, dialErr) {
+		t.Errorf("upload = %v, want the reconnect error", err)
+	}
+	if dials != 2 {
+		t.Errorf("dials = %d, want one reconnect", dials)
+	}
+	if stale.closed != 1 {
+		t.Errorf("stale session closed %d times, want once", stale.closed)
+	}
+}
@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// PageEdit places a previously scanned page into the document being
+// committed. A list of edits gives the new page order; pages it does not
+// name are dropped.
+type PageEdit struct {
+	Index  int `json:"index"`  // 0-based index of the scanned page
+	Rotate int `json:"rotate"` // clockwise rotation in degrees: 0, 90, 180 or 270
+}
+
+// ErrInvalidEdits is returned by ApplyPageEdits for edits that name a page
+// that does not exist or twice, rotate by other than a multiple of 90°, or
+// leave no page.
+var ErrInvalidEdits = errors.New("invalid page edits")
+
+// ApplyPageEdits returns the pages named by edits in their order, rotated as
+// requested. The pages were scanned with cfg and s, which give the
+// resolution of pages without resolution metadata.
+func ApplyPageEdits(pages []vens.Page, edits []PageEdit, cfg vens.ScanConfig, s config.Settings) ([]vens.Page, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("%w: no pages left", ErrInvalidEdits)
+	}
+	dpi := fallbackDPI(cfg, s)
+	used := make([]bool, len(pages))
+	out := make([]vens.Page, 0, len(edits))
+	for _, e := range edits {
+		if e.Index < 0 || e.Index >= len(pages) || used[e.Index] {
+			return nil, fmt.Errorf("%w: page index %d", ErrInvalidEdits, e.Index)
+		}
+		if e.Rotate%90 != 0 {
+			return nil, fmt.Errorf("%w: rotation %d", ErrInvalidEdits, e.Rotate)
+		}
+		used[e.Index] = true
+		p, err := rotatePage(pages[e.Index], e.Rotate/90, dpi)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", e.Index+1, err)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// PostProcessStaged applies the image processing of a button scan to pages
+// scanned for staging, so a preview shows them as they will be saved.
+// Commit them with StagedSettings.
+func PostProcessStaged(pages []vens.Page, cfg vens.ScanConfig, s config.Settings) []vens.Page {
+	return postProcessPages(pages, cfg, s)
+}
+
+// StagedSettings returns s with the steps of PostProcessStaged turned off,
+// for saving staged pages that went through it. Applying them again would
+// e.g. have AutoRotate turn a page the user rotated by hand once more.
+func StagedSettings(s config.Settings) config.Settings {
+	s.FillBorders = false
+	s.AutoRotate = false
+	s.AutoGrayscale = false
+	return s
+}
+
+// StagedPages is a PageSource of pages scanned before, e.g. a preview, so
+// they can be saved like a button scan without scanning again.
+type StagedPages struct {
+	Pages  []vens.Page
+	serial string
+	host   string
+}
+
+// NewStagedPages returns the staged pages of the scanner with the given
+// serial number and host, which file names may refer to.
+func NewStagedPages(pages []vens.Page, serial, host string) *StagedPages {
+	return &StagedPages{Pages: pages, serial: serial, host: host}
+}
+
+// ScanStreaming hands the staged pages to onPage; cfg is ignored.
+func (sp *StagedPages) ScanStreaming(_ vens.ScanConfig, onPage func(vens.Page) error) error {
+	for _, p := range sp.Pages {
+		if err := onPage(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sp *StagedPages) Serial() string { return sp.serial }
+
+func (sp *StagedPages) Host() string { return sp.host }
@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// FormatMultipageTIFF is the Settings.Format that saves all pages of a scan
+// into one multi-page TIFF file.
+const FormatMultipageTIFF = "image/tiff-multipage"
+
+// TIFF tags written for each page.
+const (
+	tagNewSubfileType      = 254
+	tagImageWidth          = 256
+	tagImageLength         = 257
+	tagBitsPerSample       = 258
+	tagCompression         = 259
+	tagPhotometric         = 262
+	tagStripOffsets        = 273
+	tagSamplesPerPixel     = 277
+	tagRowsPerStrip        = 278
+	tagStripByteCounts     = 279
+	tagXResolution         = 282
+	tagYResolution         = 283
+	tagPlanarConfiguration = 284
+	tagResolutionUnit      = 296
+	tagPageNumber          = 297
+)
+
+// TIFF field types and values.
+const (
+	tiffShort               = 3
+	tiffLong                = 4
+	tiffRational            = 5
+	tiffCompressionDeflate  = 8
+	tiffPhotometricBlackIs0 = 1
+	tiffPhotometricRGB      = 2
+)
+
+// WriteMultipageTIFF combines scanned pages (JPEG or TIFF) into a single
+// multi-page TIFF file. See GenerateMultipageTIFF.
+func WriteMultipageTIFF(pages []vens.Page, dpi int, outputPath string) error {
+	data, err := GenerateMultipageTIFF(pages, dpi)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, data, 0644)
+}
+
+// GenerateMultipageTIFF combines scanned pages into a multi-page TIFF in
+// memory, one Deflate-compressed IFD per page. TIFF (B&W) pages are stored
+// as 1-bit bilevel images; JPEG pages are decoded and stored as 8-bit
+// grayscale or RGB. Each IFD records the page resolution, falling back to
+// dpi for pages without embedded DPI.
+func GenerateMultipageTIFF(pages []vens.Page, dpi int) ([]byte, error) {
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages")
+	}
+	if dpi <= 0 {
+		dpi = 300
+	}
+	var buf bytes.Buffer
+	buf.Write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0}) // first IFD offset patched below
+	prevNext := 4                                  // where the offset of the next IFD goes
+	for i, p := range pages {
+		img, err := decodeTIFFPage(p)
+		if err != nil {
+			return nil, fmt.Errorf("decode page %d: %w", i+1, err)
+		}
+		ifd, err := writeTIFFPage(&buf, img, pageDPI(p, dpi), i, len(pages))
+		if err != nil {
+			return nil, fmt.Errorf("encode page %d: %w", i+1, err)
+		}
+		data := buf.Bytes()
+		binary.LittleEndian.PutUint32(data[prevNext:], uint32(ifd))
+		prevNext = buf.Len() - 4
+	}
+	return buf.Bytes(), nil
+}
+
+// tiffImage is a page image in TIFF sample layout.
+type tiffImage struct {
+	width, height int
+	bits          int // bits per sample: 1 (bilevel) or 8
+	samples       int // samples per pixel: 1 or 3
+	pix           []byte
+}
+
+// decodeTIFFPage converts a scanned page into TIFF samples.
+func decodeTIFFPage(p vens.Page) (tiffImage, error) {
+	if pageIsTIFF(p, false) {
+		img, err := tiff.Decode(bytes.NewReader(p.JPEG))
+		if err != nil {
+			return tiffImage{}, err
+		}
+		return bilevelSamples(toBitonalPNG(img)), nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return tiffImage{}, err
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if gray, ok := img.(*image.Gray); ok {
+		pix := make([]byte, 0, w*h)
+		for y := range h {
+			pix = append(pix, gray.Pix[y*gray.Stride:y*gray.Stride+w]...)
+		}
+		return tiffImage{width: w, height: h, bits: 8, samples: 1, pix: pix}, nil
+	}
+	pix := make([]byte, 0, w*h*3)
+	ycc, isYCbCr := img.(*image.YCbCr)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isYCbCr {
+				c := ycc.YCbCrAt(x, y)
+				r, g, bl := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+				pix = append(pix, r, g, bl)
+				continue
+			}
+			r, g, bl, _ := img.At(x, y).RGBA()
+			pix = append(pix, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+	}
+	return tiffImage{width: w, height: h, bits: 8, samples: 3, pix: pix}, nil
+}
+
+// bilevelSamples packs a black & white image into 1-bit BlackIsZero rows.
+func bilevelSamples(img *image.Paletted) tiffImage {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rowBytes := (w + 7) / 8
+	pix := make([]byte, rowBytes*h)
+	for y := range h {
+		src := img.Pix[y*img.Stride : y*img.Stride+w]
+		dst := pix[y*rowBytes : (y+1)*rowBytes]
+		for x, v := range src {
+			if v == 0 { // white
+				dst[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return tiffImage{width: w, height: h, bits: 1, samples: 1, pix: pix}
+}
+
+// writeTIFFPage appends the page's strip, out-of-line values and IFD to buf
+// and returns the offset of the IFD. The IFD ends with a zero next-IFD
+// offset for the caller to patch.
+func writeTIFFPage(buf *bytes.Buffer, page tiffImage, dpi, index, total int) (int, error) {
+	le := binary.LittleEndian
+	pad := func() {
+		if buf.Len()%2 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+
+	stripOffset := buf.Len()
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(page.pix); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	stripBytes := buf.Len() - stripOffset
+	pad()
+
+	resOffset := buf.Len()
+	for range 2 { // XResolution, YResolution
+		buf.Write(le.AppendUint32(le.AppendUint32(nil, uint32(dpi)), 1))
+	}
+	bitsValue := uint32(page.bits)
+	if page.samples == 3 {
+		bitsValue = uint32(buf.Len())
+		for range 3 {
+			buf.Write(le.AppendUint16(nil, uint16(page.bits)))
+		}
+		pad()
+	}
+	photometric := tiffPhotometricBlackIs0
+	if page.samples == 3 {
+		photometric = tiffPhotometricRGB
+	}
+
+	type entry struct {
+		tag, typ uint16
+		count    uint32
+		value    uint32
+	}
+	entries := []entry{
+		{tagNewSubfileType, tiffLong, 1, 2}, // page of a multi-page image
+		{tagImageWidth, tiffLong, 1, uint32(page.width)},
+		{tagImageLength, tiffLong, 1, uint32(page.height)},
+		{tagBitsPerSample, tiffShort, uint32(page.samples), bitsValue},
+		{tagCompression, tiffShort, 1, tiffCompressionDeflate},
+		{tagPhotometric, tiffShort, 1, uint32(photometric)},
+		{tagStripOffsets, tiffLong, 1, uint32(stripOffset)},
+		{tagSamplesPerPixel, tiffShort, 1, uint32(page.samples)},
+		{tagRowsPerStrip, tiffLong, 1, uint32(page.height)},
+		{tagStripByteCounts, tiffLong, 1, uint32(stripBytes)},
+		{tagXResolution, tiffRational, 1, uint32(resOffset)},
+		{tagYResolution, tiffRational, 1, uint32(resOffset + 8)},
+		{tagPlanarConfiguration, tiffShort, 1, 1},
+		{tagResolutionUnit, tiffShort, 1, 2}, // inch
+		{tagPageNumber, tiffShort, 2, uint32(index) | uint32(total)<<16},
+	}
+
+	ifdOffset := buf.Len()
+	ifd := le.AppendUint16(nil, uint16(len(entries)))
+	for _, e := range entries {
+		ifd = le.AppendUint16(ifd, e.tag)
+		ifd = le.AppendUint16(ifd, e.typ)
+		ifd = le.AppendUint32(ifd, e.count)
+		ifd = le.AppendUint32(ifd, e.value) // SHORTs are left-justified in little-endian
+	}
+	ifd = le.AppendUint32(ifd, 0) // next IFD
+	buf.Write(ifd)
+	return ifdOffset, nil
+}
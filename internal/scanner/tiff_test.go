@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/tiff"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// tiffIFDOffsets follows the IFD chain of a little-endian TIFF.
+func tiffIFDOffsets(t *testing.T, data []byte) []uint32 {
+	t.Helper()
+	var offsets []uint32
+	for off := binary.LittleEndian.Uint32(data[4:8]); off != 0; {
+		if int(off)+2 > len(data) || len(offsets) > 100 {
+			t.Fatalf("bad IFD offset %d", off)
+		}
+		offsets = append(offsets, off)
+		n := int(binary.LittleEndian.Uint16(data[off:]))
+		off = binary.LittleEndian.Uint32(data[int(off)+2+n*12:])
+	}
+	return offsets
+}
+
+func TestWriteMultipageTIFF(t *testing.T) {
+	var gray bytes.Buffer
+	if err := jpeg.Encode(&gray, image.NewGray(image.Rect(0, 0, 90, 110)), nil); err != nil {
+		t.Fatal(err)
+	}
+	pages := []vens.Page{
+		{Sheet: 0, Side: 0, JPEG: noisyJPEG(t, 120, 160)},
+		{Sheet: 0, Side: 1, JPEG: bilevelTIFF(t, 240, 320)},
+		{Sheet: 1, Side: 0, JPEG: gray.Bytes()},
+	}
+	out := filepath.Join(t.TempDir(), "scan.tiff")
+	if err := WriteMultipageTIFF(pages, 200, out); err != nil {
+		t.Fatalf("WriteMultipageTIFF: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dpi := detectTIFFDPI(data); dpi != 200 {
+		t.Errorf("detectTIFFDPI = %d, want 200", dpi)
+	}
+	offsets := tiffIFDOffsets(t, data)
+	if len(offsets) != len(pages) {
+		t.Fatalf("pages = %d, want %d", len(offsets), len(pages))
+	}
+
+	want := []struct {
+		w, h int
+		dpi  int
+		gray bool
+	}{
+		{120, 160, 200, false},                         // color JPEG stored as RGB
+		{240, 320, detectTIFFDPI(pages[1].JPEG), true}, // bilevel TIFF keeps its own DPI
+		{90, 110, 200, true},                           // grayscale JPEG stored as 8-bit gray
+	}
+	for i, off := range offsets {
+		// Point the header at this page's IFD to decode and check it alone
+		page := bytes.Clone(data)
+		binary.LittleEndian.PutUint32(page[4:8], off)
+		if dpi := detectTIFFDPI(page); dpi != want[i].dpi {
+			t.Errorf("page %d: XResolution = %d, want %d", i+1, dpi, want[i].dpi)
+		}
+		img, err := tiff.Decode(bytes.NewReader(page))
+		if err != nil {
+			t.Fatalf("page %d: decode: %v", i+1, err)
+		}
+		if b := img.Bounds(); b.Dx() != want[i].w || b.Dy() != want[i].h {
+			t.Errorf("page %d: size = %dx%d, want %dx%d", i+1, b.Dx(), b.Dy(), want[i].w, want[i].h)
+		}
+		if _, isGray := img.(*image.Gray); isGray != want[i].gray {
+			t.Errorf("page %d: decoded as %T", i+1, img)
+		}
+	}
+}
+
+func TestRenderOutputFilesMultipageTIFF(t *testing.T) {
+	pages := []vens.Page{
+		{JPEG: bilevelTIFF(t, 240, 320)},
+		{JPEG: bilevelTIFF(t, 240, 320)},
+	}
+	cfg := vens.DefaultScanConfig()
+	files, _, err := renderOutputFiles(pages, cfg, FormatMultipageTIFF, config.Settings{}, fileNamer{base: "scan", time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "scan.tiff" {
+		t.Fatalf("files = %v, want one scan.tiff", files)
+	}
+	if n := len(tiffIFDOffsets(t, files[0].Data)); n != 2 {
+		t.Errorf("pages = %d, want 2", n)
+	}
+}
@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"sync"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// FormatWebP is the Settings.Format that saves each color or grayscale page
+// as a lossy WebP, which is usually much smaller than the scanner's JPEG.
+// Encoding needs libwebp (build with -tags libwebp); without it the pages
+// are saved as JPEG.
+const FormatWebP = "image/webp"
+
+// webpEncoder encodes an image as lossy WebP at quality 0-100. It is nil
+// when the binary was built without a WebP encoder.
+var webpEncoder func(img image.Image, quality int) ([]byte, error)
+
+// WebPAvailable reports whether FormatWebP pages are encoded as WebP.
+func WebPAvailable() bool {
+	return webpEncoder != nil
+}
+
+var webpFallbackOnce sync.Once
+
+// webpQuality maps Settings.Compression (1 best quality .. 5 most
+// compressed, default 3) to a WebP quality.
+func webpQuality(compression int) int {
+	if compression < 1 || compression > 5 {
+		compression = 3
+	}
+	return 100 - compression*10
+}
+
+// encodeWebPPage re-encodes a scanned JPEG page as WebP. B&W (TIFF) pages
+// are returned unchanged, as are all pages when no encoder is available.
+func encodeWebPPage(p vens.Page, quality int) (vens.Page, error) {
+	if webpEncoder == nil {
+		webpFallbackOnce.Do(func() {
+			slog.Warn("WebP encoder not available in this build, saving pages as JPEG")
+		})
+		return p, nil
+	}
+	if DetectImageMIME(p.JPEG) != "image/jpeg" {
+		return p, nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(p.JPEG))
+	if err != nil {
+		return p, fmt.Errorf("decode page: %w", err)
+	}
+	data, err := webpEncoder(img, quality)
+	if err != nil {
+		return p, fmt.Errorf("encode WebP: %w", err)
+	}
+	out := p
+	out.JPEG = data
+	return out, nil
+}
+
+// isWebP reports whether data is a WebP file (a RIFF container of type WEBP).
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
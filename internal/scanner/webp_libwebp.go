@@ -0,0 +1,39 @@
+//go:build cgo && libwebp
+
+package scanner
+
+/*
+#cgo pkg-config: libwebp
+#include <webp/encode.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"unsafe"
+)
+
+func init() {
+	webpEncoder = encodeWebP
+}
+
+// encodeWebP encodes img as lossy WebP with libwebp.
+func encodeWebP(img image.Image, quality int) ([]byte, error) {
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, errors.New("libwebp: empty image")
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+
+	var out *C.uint8_t
+	n := C.WebPEncodeRGBA((*C.uint8_t)(unsafe.Pointer(&rgba.Pix[0])),
+		C.int(b.Dx()), C.int(b.Dy()), C.int(rgba.Stride), C.float(quality), &out)
+	if n == 0 {
+		return nil, errors.New("libwebp: encoding failed")
+	}
+	defer C.WebPFree(unsafe.Pointer(out))
+	return C.GoBytes(unsafe.Pointer(out), C.int(n)), nil
+}
@@ -0,0 +1,70 @@
+package scanner
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"time"
+
+	"golang.org/x/image/webp"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func TestRenderOutputFilesWebP(t *testing.T) {
+	if !WebPAvailable() {
+		t.Skip("built without a WebP encoder (-tags libwebp)")
+	}
+	page := vens.Page{JPEG: noisyJPEG(t, 64, 48)}
+	files, _, err := renderOutputFiles([]vens.Page{page}, vens.DefaultScanConfig(), FormatWebP, config.Settings{}, fileNamer{base: "scan", time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "scan_001.webp" {
+		t.Fatalf("files = %+v, want scan_001.webp", files)
+	}
+	cfg, err := webp.DecodeConfig(bytes.NewReader(files[0].Data))
+	if err != nil {
+		t.Fatalf("output is not a WebP image: %v", err)
+	}
+	if cfg.Width != 64 || cfg.Height != 48 {
+		t.Errorf("size = %dx%d, want 64x48", cfg.Width, cfg.Height)
+	}
+}
+
+func TestRenderOutputFilesWebPFallback(t *testing.T) {
+	saved := webpEncoder
+	t.Cleanup(func() { webpEncoder = saved })
+
+	jpegPage := vens.Page{JPEG: noisyJPEG(t, 16, 16)}
+	tiffPage := vens.Page{JPEG: []byte{0x49, 0x49, 0x2A, 0x00}}
+	names := fileNamer{base: "scan", time: time.Now()}
+
+	// Without an encoder, pages are saved as they were scanned
+	webpEncoder = nil
+	files, _, err := renderOutputFiles([]vens.Page{jpegPage}, vens.DefaultScanConfig(), FormatWebP, config.Settings{}, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Name != "scan_001.jpg" || !bytes.Equal(files[0].Data, jpegPage.JPEG) {
+		t.Errorf("fallback file = %s, want the unchanged JPEG page", files[0].Name)
+	}
+
+	// B&W pages stay TIFF even with an encoder
+	var quality int
+	webpEncoder = func(img image.Image, q int) ([]byte, error) {
+		quality = q
+		return []byte("RIFF\x04\x00\x00\x00WEBP"), nil
+	}
+	files, _, err = renderOutputFiles([]vens.Page{jpegPage, tiffPage}, vens.DefaultScanConfig(), FormatWebP, config.Settings{Compression: 1}, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Name != "scan_001.webp" || files[1].Name != "scan_002.tiff" {
+		t.Errorf("files = %s, %s, want scan_001.webp, scan_002.tiff", files[0].Name, files[1].Name)
+	}
+	if quality != 90 {
+		t.Errorf("quality = %d, want 90 for compression 1", quality)
+	}
+}
@@ -30,6 +30,20 @@ const (
 	CmdSetStartMode  uint32 = 0x62 // Set scanner start mode
 )
 
+// SET_WIFI_MODE mode values. Unverified on real hardware: no capture of the
+// command exists, see protocol §4.6.
+const (
+	WifiModeInfrastructure uint32 = 0x00 // join the configured access point
+	WifiModeDirect         uint32 = 0x01 // act as an access point (direct connect)
+)
+
+// SET_START_MODE mode values: what the scan button starts. Unverified on real
+// hardware, see protocol §4.7.
+const (
+	StartModeNormal uint32 = 0x00 // regular scan
+	StartModeQuick  uint32 = 0x01 // quick scan
+)
+
 // Data channel commands (TCP:53218).
 // These values at offset 32 represent the SCSI CDB byte length:
 // 0x06=6-byte CDB, 0x08=8-byte CDB, 0x0A=10-byte CDB, 0x0C=12-byte CDB.
@@ -77,12 +91,17 @@ const (
 
 // READ(10) response sizes for metadata types.
 const (
-	PixelSizeResponseLen  uint32 = 0x20 // 32 bytes
-	PaperSizeResponseLen  uint32 = 0x08 // 8 bytes
+	PixelSizeResponseLen    uint32 = 0x20 // 32 bytes
+	PaperSizeResponseLen    uint32 = 0x08 // 8 bytes
+	CarrierSheetResponseLen uint32 = 0x04 // 4 bytes
 )
 
 // Page transfer constants.
-const PageTransferLen uint32 = 0x040000 // 256KB per chunk
+const (
+	PageTransferLen    uint32 = 0x040000 // 256KB per chunk (default, matches ScanSnap Manager)
+	MinPageTransferLen uint32 = 0x010000 // 64KB
+	MaxPageTransferLen uint32 = 0xFFFFFF // Transfer Length is a 24-bit CDB field
+)
 
 // Response field offsets.
 const (
@@ -1,6 +1,7 @@
 package vens
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -8,6 +9,7 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"os"
 	"time"
 )
 
@@ -30,24 +32,101 @@ type ScanError struct {
 
 func (e *ScanError) Error() string { return e.Msg }
 
+// String returns the kind name, for logging.
+func (k ScanErrorKind) String() string {
+	switch k {
+	case ScanErrGeneric:
+		return "generic"
+	case ScanErrNoPaper:
+		return "noPaper"
+	case ScanErrPaperJam:
+		return "paperJam"
+	case ScanErrMultiFeed:
+		return "multiFeed"
+	case ScanErrCoverOpen:
+		return "coverOpen"
+	}
+	return fmt.Sprintf("ScanErrorKind(%d)", int(k))
+}
+
+// ErrorCodeKind maps a GET_STATUS error code (offset 44) to a ScanErrorKind.
+func ErrorCodeKind(code uint16) ScanErrorKind {
+	switch code {
+	case 0x0155:
+		return ScanErrMultiFeed
+	default:
+		// Unknown error code — log it so we can add mappings later
+		return ScanErrGeneric
+	}
+}
+
 // Page holds a single scanned page image.
 type Page struct {
-	Sheet     int            // Physical sheet index (0-based)
-	Side      int            // 0=front, 1=back
-	JPEG      []byte         // Raw JPEG data
-	PixelSize *PixelSizeInfo // Actual pixel dimensions (nil if not queried)
+	Sheet        int             // Physical sheet index (0-based)
+	Side         int             // 0=front, 1=back
+	JPEG         []byte          // Raw JPEG data
+	PixelSize    *PixelSizeInfo  // Actual pixel dimensions (nil if not queried)
+	PaperSize    *PaperDimension // Detected paper size (nil if not reported)
+	CarrierSheet bool            // Scanned in a carrier sheet (photos, fragile documents)
 }
 
+// DefaultStartTimeout is how long StartScan waits for the first sheet to
+// feed when ScanConfig.StartTimeout is unset. It is long enough for the user
+// to load paper after pressing the scan button.
+const DefaultStartTimeout = 120 * time.Second
+
 // DataChannel manages TCP data channel connections (port 53218).
 type DataChannel struct {
-	host  string
-	port  uint16
-	token [8]byte
+	host         string
+	port         uint16
+	token        [8]byte
+	chunkSize    uint32 // page transfer chunk size (PageTransferLen if 0)
+	pipeline     bool   // request the next chunk before reading the current one
+	shortRetries int    // resends of a command whose response is too short
 }
 
+// DefaultShortResponseRetries is how many times a command is resent when
+// its response is shorter than expected. Some firmware truncates responses
+// right after waking from sleep.
+const DefaultShortResponseRetries = 1
+
 // NewDataChannel creates a DataChannel for the given scanner address.
 func NewDataChannel(host string, port uint16, token [8]byte) *DataChannel {
-	return &DataChannel{host: host, port: port, token: token}
+	return &DataChannel{host: host, port: port, token: token, shortRetries: DefaultShortResponseRetries}
+}
+
+// SetChunkSize sets the number of bytes requested per page transfer chunk,
+// clamped to [MinPageTransferLen, MaxPageTransferLen]. 0 restores the
+// default PageTransferLen. Larger chunks need fewer round trips per page;
+// the scanner may still return less than requested per chunk.
+func (d *DataChannel) SetChunkSize(n uint32) {
+	if n != 0 {
+		n = min(max(n, MinPageTransferLen), MaxPageTransferLen)
+	}
+	d.chunkSize = n
+}
+
+// SetPipelining enables pipelined page transfer (experimental): the next
+// chunk is requested before the current one has been read. This leaves a
+// request outstanding after the final chunk, which no capture shows the
+// scanner accepting; see transferPageChunks. Off by default.
+func (d *DataChannel) SetPipelining(on bool) {
+	d.pipeline = on
+}
+
+// SetShortResponseRetries sets how many times a command is resent when the
+// response is shorter than the command's minimum length. 0 disables the
+// retry.
+func (d *DataChannel) SetShortResponseRetries(n int) {
+	d.shortRetries = max(0, n)
+}
+
+// transferLen returns the page transfer chunk size in effect.
+func (d *DataChannel) transferLen() uint32 {
+	if d.chunkSize == 0 {
+		return PageTransferLen
+	}
+	return d.chunkSize
 }
 
 // connect opens a TCP connection and reads the welcome packet.
@@ -93,6 +172,18 @@ func (d *DataChannel) request(data []byte) ([]byte, error) {
 	return resp, nil
 }
 
+// requestMin is request for a command whose response must be at least
+// minLen bytes. A shorter response is retried as set by
+// SetShortResponseRetries and then returned for the parser to reject.
+func (d *DataChannel) requestMin(data []byte, minLen int) ([]byte, error) {
+	resp, err := d.request(data)
+	for i := 0; err == nil && len(resp) < minLen && i < d.shortRetries; i++ {
+		slog.Warn("data channel response too short, retrying", "bytes", len(resp), "want", minLen)
+		resp, err = d.request(data)
+	}
+	return resp, err
+}
+
 // readResponse reads a length-prefixed VENS response from a connection.
 func readResponse(r io.Reader) ([]byte, error) {
 	lenBuf := make([]byte, 4)
@@ -114,7 +205,7 @@ func readResponse(r io.Reader) ([]byte, error) {
 // GetDeviceInfo queries device identity (cmd=0x06, sub=0x12).
 func (d *DataChannel) GetDeviceInfo() (*DataDeviceInfo, error) {
 	slog.Debug("getting device info...")
-	resp, err := d.request(MarshalGetDeviceInfo(d.token))
+	resp, err := d.requestMin(MarshalGetDeviceInfo(d.token), DeviceInfoRespLen)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +220,7 @@ func (d *DataChannel) GetDeviceInfo() (*DataDeviceInfo, error) {
 // GetScanParams queries scanner capabilities (cmd=0x06, sub=0x90).
 func (d *DataChannel) GetScanParams() (*ScanParams, error) {
 	slog.Debug("getting scan params...")
-	resp, err := d.request(MarshalGetScanParams(d.token))
+	resp, err := d.requestMin(MarshalGetScanParams(d.token), ScanParamsMinLen)
 	if err != nil {
 		return nil, err
 	}
@@ -144,7 +235,7 @@ func (d *DataChannel) GetScanParams() (*ScanParams, error) {
 // GetScanSettings queries current scan settings (cmd=0x06, sub=0xD8).
 func (d *DataChannel) GetScanSettings() ([]byte, error) {
 	slog.Debug("getting scan settings...")
-	resp, err := d.request(MarshalGetScanSettings(d.token))
+	resp, err := d.requestMin(MarshalGetScanSettings(d.token), ScanSettingsMinLen)
 	if err != nil {
 		return nil, err
 	}
@@ -167,25 +258,41 @@ func (d *DataChannel) SetConfig() ([]byte, error) {
 // This enables lazy scanning where the client can stop after any page without
 // the scanner feeding additional sheets.
 type ScanSession struct {
+	ctx           context.Context
 	dc            *DataChannel
-	conn          net.Conn
+	conn          *cancelConn
 	token         [8]byte
 	sidesPerSheet int
 	physicalSheet int
 	transferSheet int
 	sideIdx       int
 	done          bool
+	noPaperSize   bool // the scanner did not answer the PAPERSIZE query; skip it
+	noCarrier     bool // the scanner did not answer the CARRIER_SHEET query; skip it
 }
 
 // StartScan begins a scan session (setup, config, prepare, status check,
 // wait for first sheet) and returns a ScanSession from which pages can be
 // pulled one at a time via NextPage.
-func (d *DataChannel) StartScan(cfg ScanConfig) (*ScanSession, error) {
+//
+// Canceling ctx aborts the setup, or a running session: pending I/O on the
+// data connection fails at once and NextPage returns the context error.
+// The session must still be closed, which ends the scan on the scanner.
+func (d *DataChannel) StartScan(ctx context.Context, cfg ScanConfig) (session *ScanSession, err error) {
 	slog.Debug("starting scan session", "colorMode", cfg.ColorMode, "quality", cfg.Quality, "duplex", cfg.Duplex, "paperSize", cfg.PaperSize)
-	conn, err := d.connect()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("scan canceled: %w", err)
+	}
+	raw, err := d.connect()
 	if err != nil {
 		return nil, err
 	}
+	conn := newCancelConn(ctx, raw)
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("scan canceled: %w", ctx.Err())
+		}
+	}()
 
 	sendAndRecv := func(data []byte) ([]byte, error) {
 		conn.SetDeadline(time.Now().Add(10 * time.Second))
@@ -255,8 +362,12 @@ func (d *DataChannel) StartScan(cfg ScanConfig) (*ScanSession, error) {
 	}
 
 	// Step 5: Wait for scan to start
-	slog.Debug("scan step 5: waiting for scan to start...")
-	conn.SetDeadline(time.Now().Add(120 * time.Second)) // Long timeout for user interaction
+	startTimeout := cfg.StartTimeout
+	if startTimeout <= 0 {
+		startTimeout = DefaultStartTimeout
+	}
+	slog.Debug("scan step 5: waiting for scan to start...", "timeout", startTimeout)
+	conn.SetDeadline(time.Now().Add(startTimeout))
 	if _, err := conn.Write(MarshalWaitForScan(d.token)); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("wait for scan: %w", err)
@@ -264,6 +375,9 @@ func (d *DataChannel) StartScan(cfg ScanConfig) (*ScanSession, error) {
 	resp, err = readResponse(conn)
 	if err != nil {
 		conn.Close()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, &ScanError{Kind: ScanErrGeneric, Msg: fmt.Sprintf("scan did not start within %s", startTimeout)}
+		}
 		return nil, fmt.Errorf("wait for scan response: %w", err)
 	}
 	if len(resp) >= WaitRespStatusOffset+4 {
@@ -287,11 +401,12 @@ func (d *DataChannel) StartScan(cfg ScanConfig) (*ScanSession, error) {
 	slog.Info("scan started")
 
 	sidesPerSheet := 1
-	if cfg.Duplex {
+	if cfg.ScansDuplex() {
 		sidesPerSheet = 2
 	}
 
 	return &ScanSession{
+		ctx:           ctx,
 		dc:            d,
 		conn:          conn,
 		token:         d.token,
@@ -309,6 +424,22 @@ func (s *ScanSession) NextPage() (Page, error) {
 	if s.done {
 		return Page{}, io.EOF
 	}
+	if err := s.ctx.Err(); err != nil {
+		s.done = true
+		return Page{}, fmt.Errorf("scan canceled: %w", err)
+	}
+	page, err := s.nextPage()
+	if err != nil && err != io.EOF && s.ctx.Err() != nil {
+		s.done = true
+		return Page{}, fmt.Errorf("scan canceled: %w", s.ctx.Err())
+	}
+	return page, err
+}
+
+func (s *ScanSession) nextPage() (Page, error) {
+	if s.done {
+		return Page{}, io.EOF
+	}
 
 	// Before first side of a new sheet (except the very first), wait for next sheet
 	if s.sideIdx == 0 && s.physicalSheet > 0 {
@@ -335,7 +466,7 @@ func (s *ScanSession) NextPage() (Page, error) {
 				s.done = true
 				msg := fmt.Sprintf("scanner error 0x%04X", errorCode)
 				slog.Warn(msg, "errorCode", fmt.Sprintf("0x%04X", errorCode))
-				return Page{}, &ScanError{Kind: ScanErrGeneric, Msg: msg}
+				return Page{}, &ScanError{Kind: ErrorCodeKind(uint16(errorCode)), Msg: msg}
 			}
 		}
 
@@ -403,6 +534,46 @@ func (s *ScanSession) NextPage() (Page, error) {
 			"xRes", psInfo.XRes, "yRes", psInfo.YRes, "detectedLen", psInfo.DetectedLength)
 	}
 
+	// Query the detected paper size (best-effort, unverified on real
+	// hardware — give up for the session when the scanner does not answer;
+	// a size without a known code, e.g. Letter, only leaves this page
+	// without one)
+	if !s.noPaperSize {
+		s.conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := s.conn.Write(MarshalGetDetectedPaperSize(s.token, s.transferSheet)); err != nil {
+			slog.Debug("papersize query send failed", "err", err)
+			s.noPaperSize = true
+		} else if psResp, err := readResponse(s.conn); err != nil {
+			slog.Debug("papersize query recv failed", "err", err)
+			s.noPaperSize = true
+		} else if w, h, err := ParseDetectedPaperSize(psResp); err != nil {
+			slog.Debug("papersize parse failed", "err", err, "hex", hex.EncodeToString(psResp))
+		} else {
+			page.PaperSize = &PaperDimension{Width: w, Height: h}
+			slog.Info("papersize", "width", w, "height", h)
+		}
+	}
+
+	// Query whether the sheet was in a carrier sheet (best-effort,
+	// unverified on real hardware — give up for the session after the first
+	// failure)
+	if !s.noCarrier {
+		s.conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := s.conn.Write(MarshalGetCarrierSheet(s.token)); err != nil {
+			slog.Debug("carrier sheet query send failed", "err", err)
+			s.noCarrier = true
+		} else if csResp, err := readResponse(s.conn); err != nil {
+			slog.Debug("carrier sheet query recv failed", "err", err)
+			s.noCarrier = true
+		} else if detected, err := ParseCarrierSheet(csResp); err != nil {
+			slog.Debug("carrier sheet parse failed", "err", err, "hex", hex.EncodeToString(csResp))
+			s.noCarrier = true
+		} else if detected {
+			page.CarrierSheet = true
+			slog.Info("carrier sheet detected", "sheet", s.physicalSheet)
+		}
+	}
+
 	s.transferSheet++
 	s.sideIdx++
 	if s.sideIdx >= s.sidesPerSheet {
@@ -419,114 +590,230 @@ func (s *ScanSession) Close() error {
 	if s.conn == nil {
 		return nil
 	}
-	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
-	if _, err := s.conn.Write(MarshalEndScan(s.token)); err != nil {
+	// End the scan even if the session was canceled
+	conn := s.conn.detach()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(MarshalEndScan(s.token)); err != nil {
 		slog.Debug("end scan send failed", "err", err)
-	} else if _, err := readResponse(s.conn); err != nil {
+	} else if _, err := readResponse(conn); err != nil {
 		slog.Debug("end scan response failed", "err", err)
 	} else {
 		slog.Debug("end scan session OK")
 	}
-	err := s.conn.Close()
+	err := conn.Close()
 	s.conn = nil
 	s.done = true
 	return err
 }
 
 // RunScan executes a full scan session and returns all scanned pages.
-// This is a convenience wrapper around StartScan + NextPage for callers
-// that want all pages at once (e.g. button scan).
+// This is a convenience wrapper around RunScanStreaming for callers that
+// want all pages at once.
 func (d *DataChannel) RunScan(cfg ScanConfig, onPage func(Page)) ([]Page, error) {
-	session, err := d.StartScan(cfg)
+	var pages []Page
+	err := d.RunScanStreaming(cfg, func(page Page) error {
+		pages = append(pages, page)
+		if onPage != nil {
+			onPage(page)
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// RunScanStreaming executes a full scan session, calling onPage for each
+// page as soon as it has been transferred. Pages are not retained, so memory
+// use does not grow with the batch size. An error returned by onPage ends
+// the session and is returned as is.
+func (d *DataChannel) RunScanStreaming(cfg ScanConfig, onPage func(Page) error) error {
+	session, err := d.StartScan(context.Background(), cfg)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer session.Close()
 
-	var pages []Page
+	total, nonEmpty := 0, 0
 	for {
 		page, err := session.NextPage()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return pages, err
+			return err
 		}
-		pages = append(pages, page)
-		if onPage != nil {
-			onPage(page)
+		total++
+		if len(page.JPEG) > 0 {
+			nonEmpty++
+		}
+		if err := onPage(page); err != nil {
+			return err
 		}
 	}
 
-	nonEmpty := 0
-	for _, p := range pages {
-		if len(p.JPEG) > 0 {
-			nonEmpty++
-		}
+	slog.Info("scan finished", "total_pages", total, "non_empty", nonEmpty)
+	return nil
+}
+
+// cancelConn is a net.Conn whose I/O fails once ctx is canceled: the
+// deadline expires at cancellation and later deadlines are ignored.
+type cancelConn struct {
+	net.Conn
+	ctx  context.Context
+	stop func() bool
+}
+
+func newCancelConn(ctx context.Context, conn net.Conn) *cancelConn {
+	c := &cancelConn{Conn: conn, ctx: ctx}
+	c.stop = context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	return c
+}
+
+func (c *cancelConn) SetDeadline(t time.Time) error {
+	err := c.Conn.SetDeadline(t)
+	// ctx is done before the AfterFunc runs, so a deadline set concurrently
+	// with cancellation is always overridden here or there
+	if c.ctx.Err() != nil {
+		return c.Conn.SetDeadline(time.Now())
 	}
-	slog.Info("scan finished", "total_pages", len(pages), "non_empty", nonEmpty)
-	return pages, nil
+	return err
+}
+
+// detach stops watching ctx and returns the underlying connection.
+func (c *cancelConn) detach() net.Conn {
+	c.stop()
+	return c.Conn
+}
+
+func (c *cancelConn) Close() error {
+	return c.detach().Close()
 }
 
 // transferPageChunks reads all JPEG chunks for a single page side.
-// The scanner sends data in 256KB chunks; page_type=2 marks the final chunk.
+// The scanner sends data in chunks of up to the configured chunk size
+// (256KB by default); page_type=2 marks the final chunk.
+//
+// With pipelining enabled, the request for the next chunk is sent before the
+// current chunk is read, so the scanner can prepare it while the previous one
+// is on the wire. The one extra request outstanding after the final chunk is
+// expected to be answered with a short response, which is read and discarded
+// to keep the connection in step. This is unverified on hardware: if the
+// scanner never answers it, each page waits drainTimeout before the transfer
+// returns, and a late answer would be read as the response to the next
+// command.
 func (d *DataChannel) transferPageChunks(conn net.Conn, sheet int, backSide bool) ([]byte, error) {
-	var jpegBuf []byte
-
-	for chunk := 0; ; chunk++ {
+	tlen := d.transferLen()
+	// Chunk data is read straight into the page buffer; start with room for
+	// one full chunk so small pages need no regrowth.
+	jpegBuf := make([]byte, 0, tlen)
+	headerBuf := make([]byte, PageHeaderSize)
+	send := func(chunk int) error {
 		conn.SetDeadline(time.Now().Add(30 * time.Second))
-
-		if _, err := conn.Write(MarshalPageTransfer(d.token, sheet, chunk, backSide)); err != nil {
-			return nil, fmt.Errorf("chunk %d send: %w", chunk, err)
+		if _, err := conn.Write(MarshalPageTransferLen(d.token, sheet, chunk, backSide, tlen)); err != nil {
+			return fmt.Errorf("chunk %d send: %w", chunk, err)
 		}
+		return nil
+	}
 
-		// Read length prefix first to detect error responses (< 42 bytes)
-		lenBuf := make([]byte, 4)
-		if _, err := io.ReadFull(conn, lenBuf); err != nil {
-			return nil, fmt.Errorf("chunk %d length: %w", chunk, err)
+	// Pipelined: chunk 0 is requested up front and each iteration then
+	// requests one chunk ahead of the one it reads.
+	ahead := 0
+	if d.pipeline {
+		ahead = 1
+		if err := send(0); err != nil {
+			return nil, err
 		}
-		totalLen := binary.BigEndian.Uint32(lenBuf)
-		if totalLen < uint32(PageHeaderSize) {
-			// Scanner returned an error/short response, not a page header
-			if totalLen > 4 {
-				discard := make([]byte, totalLen-4)
-				io.ReadFull(conn, discard)
-			}
-			return nil, &ScanError{Msg: fmt.Sprintf("page transfer error: expected page header, got %d bytes", totalLen)}
+	}
+	chunk := 0
+	for ; ; chunk++ {
+		if err := send(chunk + ahead); err != nil {
+			return nil, err
 		}
 
-		restBuf := make([]byte, PageHeaderSize-4)
-		if _, err := io.ReadFull(conn, restBuf); err != nil {
-			return nil, fmt.Errorf("chunk %d header: %w", chunk, err)
-		}
-		headerBuf := make([]byte, PageHeaderSize)
-		copy(headerBuf[:4], lenBuf)
-		copy(headerBuf[4:], restBuf)
-		header, err := ParsePageHeader(headerBuf)
+		prev := len(jpegBuf)
+		header, err := readPageChunk(conn, chunk, headerBuf, &jpegBuf)
 		if err != nil {
-			return nil, fmt.Errorf("chunk %d parse: %w", chunk, err)
-		}
-
-		jpegSize := header.JPEGSize()
-		if jpegSize > 0 {
-			jpegChunk := make([]byte, jpegSize)
-			if _, err := io.ReadFull(conn, jpegChunk); err != nil {
-				return nil, fmt.Errorf("chunk %d data: %w", chunk, err)
+			if d.pipeline {
+				drainResponse(conn)
 			}
-			jpegBuf = append(jpegBuf, jpegChunk...)
+			return nil, err
 		}
 
-		slog.Debug("chunk", "sheet", sheet, "chunk", chunk, "pageType", header.PageType, "chunk_bytes", jpegSize, "total_bytes", len(jpegBuf))
+		slog.Debug("chunk", "sheet", sheet, "chunk", chunk, "pageType", header.PageType, "chunk_bytes", len(jpegBuf)-prev, "total_bytes", len(jpegBuf))
 
 		if header.PageType == PageTypeFinal {
 			break
 		}
 	}
+	if d.pipeline {
+		drainResponse(conn)
+	}
 
-	slog.Debug("transfer complete", "sheet", sheet, "bytes", len(jpegBuf), "chunks", len(jpegBuf)/int(PageTransferLen)+1)
+	slog.Debug("transfer complete", "sheet", sheet, "bytes", len(jpegBuf), "chunks", chunk+1, "chunkSize", tlen, "pipelined", d.pipeline)
 	return jpegBuf, nil
 }
 
+// readPageChunk reads one page transfer response: a page header (into
+// headerBuf, PageHeaderSize bytes) followed by the chunk data, which is
+// appended to *dst without an intermediate copy.
+func readPageChunk(conn net.Conn, chunk int, headerBuf []byte, dst *[]byte) (*PageHeader, error) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// Read length prefix first to detect error responses (< 42 bytes)
+	if _, err := io.ReadFull(conn, headerBuf[:4]); err != nil {
+		return nil, fmt.Errorf("chunk %d length: %w", chunk, err)
+	}
+	totalLen := binary.BigEndian.Uint32(headerBuf[:4])
+	if totalLen < uint32(PageHeaderSize) {
+		// Scanner returned an error/short response, not a page header
+		if totalLen > 4 {
+			io.CopyN(io.Discard, conn, int64(totalLen-4))
+		}
+		return nil, &ScanError{Kind: ScanErrGeneric, Msg: fmt.Sprintf("page transfer error: expected page header, got %d bytes", totalLen)}
+	}
+
+	if _, err := io.ReadFull(conn, headerBuf[4:PageHeaderSize]); err != nil {
+		return nil, fmt.Errorf("chunk %d header: %w", chunk, err)
+	}
+	header, err := ParsePageHeader(headerBuf)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %d parse: %w", chunk, err)
+	}
+
+	if jpegSize := header.JPEGSize(); jpegSize > 0 {
+		buf := *dst
+		n := len(buf)
+		if cap(buf)-n < jpegSize {
+			// Double rather than append's ~1.25x growth for large slices:
+			// fewer reallocations and copies of a multi-megabyte page.
+			grown := make([]byte, n, max(2*cap(buf), n+jpegSize))
+			copy(grown, buf)
+			buf = grown
+		}
+		buf = buf[:n+jpegSize]
+		if _, err := io.ReadFull(conn, buf[n:]); err != nil {
+			return nil, fmt.Errorf("chunk %d data: %w", chunk, err)
+		}
+		*dst = buf
+	}
+	return header, nil
+}
+
+// drainTimeout bounds how long drainResponse waits for the response to a
+// speculative pipelined request.
+var drainTimeout = 10 * time.Second
+
+// drainResponse reads and discards the response to a speculative pipelined
+// request.
+func drainResponse(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(drainTimeout))
+	resp, err := readResponse(conn)
+	if err != nil {
+		slog.Warn("pipelined transfer: reading extra response failed", "err", err)
+		return
+	}
+	slog.Debug("pipelined transfer: discarded extra response", "bytes", len(resp))
+}
+
 // parseSenseError extracts error information from a REQUEST SENSE VENS response.
 // The 18-byte SCSI Sense Data starts at offset 40. Returns nil if no error.
 func parseSenseError(resp []byte) *ScanError {
@@ -0,0 +1,367 @@
+package vens
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScanErrorKindString(t *testing.T) {
+	tests := []struct {
+		kind ScanErrorKind
+		want string
+	}{
+		{ScanErrGeneric, "generic"},
+		{ScanErrNoPaper, "noPaper"},
+		{ScanErrPaperJam, "paperJam"},
+		{ScanErrMultiFeed, "multiFeed"},
+		{ScanErrCoverOpen, "coverOpen"},
+		{ScanErrorKind(42), "ScanErrorKind(42)"},
+	}
+	for _, tt := range tests {
+		if got := tt.kind.String(); got != tt.want {
+			t.Errorf("ScanErrorKind(%d).String() = %q, want %q", int(tt.kind), got, tt.want)
+		}
+	}
+}
+
+func TestErrorCodeKind(t *testing.T) {
+	if got := ErrorCodeKind(0x0155); got != ScanErrMultiFeed {
+		t.Errorf("ErrorCodeKind(0x0155) = %v, want multiFeed", got)
+	}
+	if got := ErrorCodeKind(0x0001); got != ScanErrGeneric {
+		t.Errorf("ErrorCodeKind(0x0001) = %v, want generic", got)
+	}
+}
+
+func TestTransferPageChunksShortResponse(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		if _, err := readResponse(server); err != nil {
+			return
+		}
+		// 8-byte error response instead of a page header
+		resp := make([]byte, 8)
+		binary.BigEndian.PutUint32(resp, uint32(len(resp)))
+		server.Write(resp)
+	}()
+
+	d := NewDataChannel("127.0.0.1", 0, [8]byte{})
+	_, err := d.transferPageChunks(client, 0, false)
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) {
+		t.Fatalf("err = %v, want *ScanError", err)
+	}
+	if scanErr.Kind != ScanErrGeneric {
+		t.Errorf("Kind = %v, want generic", scanErr.Kind)
+	}
+}
+
+// fakePageServer serves one page of data over the page transfer protocol on
+// a loopback TCP connection. Each READ(10) is answered with up to the
+// requested transfer length after latency, emulating the scanner round trip.
+// Requests past the final chunk get a short response if answerExtra is set
+// and none otherwise. It returns the client side and a channel reporting the
+// transfer lengths requested.
+func fakePageServer(tb testing.TB, page []byte, latency time.Duration, answerExtra bool) (net.Conn, <-chan uint32) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { ln.Close() })
+	lengths := make(chan uint32, 1024)
+	go func() {
+		conn, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		remaining := page
+		done := false
+		hdr := make([]byte, PageHeaderSize)
+		copy(hdr[4:8], Magic[:])
+		for {
+			req, err := readResponse(conn)
+			if err != nil {
+				return
+			}
+			cdb := req[48:60]
+			tlen := uint32(cdb[6])<<16 | uint32(cdb[7])<<8 | uint32(cdb[8])
+			select {
+			case lengths <- tlen:
+			default:
+			}
+			if done {
+				if !answerExtra {
+					continue
+				}
+				// Requests past the final chunk get a short error response
+				resp := make([]byte, 16)
+				binary.BigEndian.PutUint32(resp, uint32(len(resp)))
+				if _, err := conn.Write(resp); err != nil {
+					return
+				}
+				continue
+			}
+			time.Sleep(latency)
+
+			n := min(int(tlen), len(remaining))
+			binary.BigEndian.PutUint32(hdr[0:4], uint32(PageHeaderSize+n))
+			if n == len(remaining) {
+				binary.BigEndian.PutUint32(hdr[12:16], PageTypeFinal)
+				done = true
+			}
+			if _, err := conn.Write(hdr); err != nil {
+				return
+			}
+			if _, err := conn.Write(remaining[:n]); err != nil {
+				return
+			}
+			remaining = remaining[n:]
+		}
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return conn, lengths
+}
+
+func syntheticPage(size int) []byte {
+	page := make([]byte, size)
+	for i := range page {
+		page[i] = byte(i * 31)
+	}
+	return page
+}
+
+func TestTransferPageChunksChunkSize(t *testing.T) {
+	page := syntheticPage(2*1024*1024 + 123)
+	tests := []struct {
+		name      string
+		chunkSize uint32
+		want      uint32
+	}{
+		{"default", 0, PageTransferLen},
+		{"1MB", 1 << 20, 1 << 20},
+		{"clamped low", 1024, MinPageTransferLen},
+		{"clamped high", 1 << 30, MaxPageTransferLen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, lengths := fakePageServer(t, page, 0, true)
+			d := NewDataChannel("127.0.0.1", 0, [8]byte{})
+			d.SetChunkSize(tt.chunkSize)
+			got, err := d.transferPageChunks(conn, 0, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, page) {
+				t.Fatalf("page data mismatch: got %d bytes, want %d", len(got), len(page))
+			}
+			if l := <-lengths; l != tt.want {
+				t.Errorf("requested transfer length = %d, want %d", l, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferPageChunksPipelinedUnanswered(t *testing.T) {
+	old := drainTimeout
+	drainTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { drainTimeout = old })
+
+	// A scanner that ignores the request past the final chunk costs each
+	// page drainTimeout, not the 30s chunk deadline
+	page := syntheticPage(300 * 1024)
+	conn, lengths := fakePageServer(t, page, 0, false)
+	d := NewDataChannel("127.0.0.1", 0, [8]byte{})
+	d.SetPipelining(true)
+
+	start := time.Now()
+	got, err := d.transferPageChunks(conn, 0, false)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, page) {
+		t.Fatalf("page data mismatch: got %d bytes, want %d", len(got), len(page))
+	}
+	if n := len(lengths); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+	if elapsed < drainTimeout || elapsed > drainTimeout+2*time.Second {
+		t.Errorf("transfer took %v, want about %v", elapsed, drainTimeout)
+	}
+}
+
+func TestTransferPageChunksPipelined(t *testing.T) {
+	page := syntheticPage(1024*1024 + 77) // 5 chunks at 256KB
+	conn, lengths := fakePageServer(t, page, time.Millisecond, true)
+	d := NewDataChannel("127.0.0.1", 0, [8]byte{})
+	d.SetPipelining(true)
+
+	got, err := d.transferPageChunks(conn, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, page) {
+		t.Fatalf("page data mismatch: got %d bytes, want %d", len(got), len(page))
+	}
+	// 5 chunk requests plus the one speculative request past the end
+	if n := len(lengths); n != 6 {
+		t.Errorf("requests = %d, want 6", n)
+	}
+	// The extra response must have been consumed so the next command on the
+	// connection reads its own response.
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Errorf("unread data left on connection (n=%d, err=%v)", n, err)
+	}
+}
+
+// BenchmarkTransferPageChunks measures the wall-clock time and allocations
+// to transfer a large color page at different chunk sizes, with 1ms
+// simulated latency per request.
+func BenchmarkTransferPageChunks(b *testing.B) {
+	page := syntheticPage(8 * 1024 * 1024)
+	for _, size := range []uint32{64 << 10, 256 << 10, 1 << 20, 4 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(page)))
+			b.ReportAllocs()
+			for b.Loop() {
+				b.StopTimer()
+				conn, _ := fakePageServer(b, page, time.Millisecond, true)
+				d := NewDataChannel("127.0.0.1", 0, [8]byte{})
+				d.SetChunkSize(size)
+				b.StartTimer()
+				if _, err := d.transferPageChunks(conn, 0, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// fakeStartServer answers every request of a scan session up to
+// WAIT FOR SCAN, which it never answers, as a scanner with paper loaded
+// that does not feed.
+func fakeStartServer(t *testing.T) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		welcome := make([]byte, WelcomeSize)
+		copy(welcome[4:8], Magic[:])
+		conn.Write(welcome)
+		for {
+			req, err := readResponse(conn)
+			if err != nil {
+				return
+			}
+			if req[48] == 0xE0 { // WAIT FOR SCAN: hold until the client gives up
+				readResponse(conn)
+				return
+			}
+			resp := make([]byte, StatusRespScanStatusOffset+4)
+			binary.BigEndian.PutUint32(resp, uint32(len(resp)))
+			copy(resp[4:8], Magic[:])
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestStartScanTimeout(t *testing.T) {
+	d := NewDataChannel("127.0.0.1", fakeStartServer(t), [8]byte{})
+	cfg := DefaultScanConfig()
+	cfg.StartTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	_, err := d.StartScan(context.Background(), cfg)
+	elapsed := time.Since(start)
+
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) {
+		t.Fatalf("err = %v, want *ScanError", err)
+	}
+	if want := "scan did not start within 200ms"; scanErr.Msg != want {
+		t.Errorf("Msg = %q, want %q", scanErr.Msg, want)
+	}
+	if elapsed < cfg.StartTimeout || elapsed > 5*time.Second {
+		t.Errorf("StartScan returned after %v, want about %v", elapsed, cfg.StartTimeout)
+	}
+}
+
+// fakeInfoServer answers each data channel request on a new connection with
+// the next of the given response lengths, and counts the requests.
+func fakeInfoServer(t *testing.T, lengths ...int) (uint16, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	requests := new(atomic.Int32)
+	go func() {
+		for _, n := range lengths {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			welcome := make([]byte, WelcomeSize)
+			copy(welcome[4:8], Magic[:])
+			conn.Write(welcome)
+			if _, err := readResponse(conn); err == nil {
+				requests.Add(1)
+				resp := make([]byte, n)
+				binary.BigEndian.PutUint32(resp, uint32(n))
+				copy(resp[4:8], Magic[:])
+				copy(resp[48:], "ScanSnap iX500  0M00")
+				conn.Write(resp)
+			}
+			conn.Close()
+		}
+	}()
+	return uint16(ln.Addr().(*net.TCPAddr).Port), requests
+}
+
+func TestGetDeviceInfoShortResponseRetry(t *testing.T) {
+	port, requests := fakeInfoServer(t, 60, DeviceInfoRespLen)
+	d := NewDataChannel("127.0.0.1", port, [8]byte{})
+	info, err := d.GetDeviceInfo()
+	if err != nil {
+		t.Fatalf("GetDeviceInfo: %v", err)
+	}
+	if info.DeviceName == "" || requests.Load() != 2 {
+		t.Errorf("device name = %q after %d requests, want a name after 2", info.DeviceName, requests.Load())
+	}
+
+	port, _ = fakeInfoServer(t, 60, DeviceInfoRespLen)
+	d = NewDataChannel("127.0.0.1", port, [8]byte{})
+	d.SetShortResponseRetries(0)
+	if _, err := d.GetDeviceInfo(); err == nil {
+		t.Error("GetDeviceInfo accepted a short response with retries disabled")
+	}
+}
@@ -3,9 +3,12 @@ package vens
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
+	"slices"
 	"time"
 )
 
@@ -22,12 +25,17 @@ func NewToken() [8]byte {
 // pick the correct outbound interface. If targetIP is empty,
 // the link-local all-hosts multicast address (224.0.0.1) is used
 // to determine the default LAN interface without any external dependency.
+// For an IPv6 target the local IPv6 address is returned.
 func GetLocalIP(targetIP string) string {
 	if targetIP == "" {
 		targetIP = "224.0.0.1"
 	}
-	conn, err := net.Dial("udp4", net.JoinHostPort(targetIP, "80"))
+	network := udpNetwork(targetIP)
+	conn, err := net.Dial(network, net.JoinHostPort(targetIP, "80"))
 	if err != nil {
+		if network == "udp6" {
+			return "::"
+		}
 		return "0.0.0.0"
 	}
 	defer conn.Close()
@@ -35,67 +43,232 @@ func GetLocalIP(targetIP string) string {
 	return addr.IP.String()
 }
 
+// udpNetwork returns "udp6" for an IPv6 address, with or without a zone,
+// and "udp4" for anything else.
+func udpNetwork(ip string) string {
+	if addr, err := netip.ParseAddr(ip); err == nil && addr.Is6() && !addr.Is4In6() {
+		return "udp6"
+	}
+	return "udp4"
+}
+
+// udpAddr returns the UDP address of ip (which may carry an IPv6 zone) and
+// port, or nil if ip is not an IP address.
+func udpAddr(ip string, port int) *net.UDPAddr {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	return net.UDPAddrFromAddrPort(netip.AddrPortFrom(addr.Unmap(), uint16(port)))
+}
+
+// packetClientIP returns the address for the client IP field of discovery
+// and heartbeat packets, which holds IPv4 only: localIP, or when that is
+// IPv6 the IPv4 address of the default interface, if any.
+func packetClientIP(localIP string) string {
+	if udpNetwork(localIP) == "udp6" {
+		return GetLocalIP("")
+	}
+	return localIP
+}
+
 // DiscoveryOptions configures scanner discovery.
 type DiscoveryOptions struct {
 	ScannerIP string   // Empty for broadcast discovery
 	Token     [8]byte
 	Timeout   time.Duration
+	SkipDiscovery bool // Send nothing; the scanner at ScannerIP is assumed on the default ports
 }
 
-// FindScanner discovers a scanner on the local network.
+// ErrNoScannerIP is returned by FindScanner when discovery is skipped
+// without a ScannerIP to connect to.
+var ErrNoScannerIP = errors.New("skipping discovery requires a scanner IP")
+
+// FindScanner discovers a scanner on the local network. A ScannerIP is
+// probed directly over IPv4 or IPv6; without one, discovery is broadcast on
+// IPv4 and multicast to all IPv6 link-local nodes at the same time.
+// The first scanner to reply is returned.
+//
+// With SkipDiscovery, for networks that block broadcast and multicast,
+// nothing is sent and the DeviceInfo holds only ScannerIP and the default
+// ports; the scanner is not known to exist until it is connected to.
 func FindScanner(ctx context.Context, opts DiscoveryOptions) (*DeviceInfo, error) {
+	if opts.SkipDiscovery {
+		if opts.ScannerIP == "" {
+			return nil, ErrNoScannerIP
+		}
+		return &DeviceInfo{DeviceIP: opts.ScannerIP, DataPort: DefaultDataPort, ControlPort: DefaultControlPort}, nil
+	}
+	var first *DeviceInfo
+	err := discover(ctx, opts, func(info *DeviceInfo) bool {
+		first = info
+		return false
+	})
+	if first != nil {
+		logScanner(first)
+		return first, nil
+	}
+	return nil, err
+}
+
+// FindAllScanners discovers scanners like FindScanner, but listens for the
+// whole timeout and returns every scanner that replied, once each by serial
+// number, in the order they replied. No reply is not an error.
+func FindAllScanners(ctx context.Context, opts DiscoveryOptions) ([]*DeviceInfo, error) {
+	var found []*DeviceInfo
+	err := discover(ctx, opts, func(info *DeviceInfo) bool {
+		if !slices.ContainsFunc(found, func(d *DeviceInfo) bool { return sameDevice(d, info) }) {
+			logScanner(info)
+			found = append(found, info)
+		}
+		return true
+	})
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		// The discovery window is over
+		err = nil
+	}
+	return found, err
+}
+
+// sameDevice reports whether two replies come from the same scanner: by
+// serial number, or by address for replies without one.
+func sameDevice(a, b *DeviceInfo) bool {
+	if a.Serial != "" || b.Serial != "" {
+		return a.Serial == b.Serial
+	}
+	return a.DeviceIP == b.DeviceIP
+}
+
+func logScanner(info *DeviceInfo) {
+	slog.Info("found scanner",
+		"name", info.Name,
+		"serial", info.Serial,
+		"ip", info.DeviceIP,
+		"data_port", info.DataPort,
+		"control_port", info.ControlPort,
+	)
+}
+
+// discoveryLock is held by a running discovery. Every discovery binds
+// ClientDiscoveryPort, which the scanners answer to, so a second one at the
+// same time, e.g. the Web UI listing scanners while a reconnect discovers
+// the scanner, would fail to bind it; it waits instead.
+var discoveryLock = make(chan struct{}, 1)
+
+// discover sends discovery packets and calls found for each device info
+// response until found returns false or opts.Timeout passes. It returns nil
+// when found stopped it, and otherwise the first error of the probes, which
+// is the context error once the timeout passed. The timeout starts once a
+// discovery running at the same time has finished.
+func discover(ctx context.Context, opts DiscoveryOptions, found func(*DeviceInfo) bool) error {
 	if opts.Timeout == 0 {
 		opts.Timeout = 10 * time.Second
 	}
+	select {
+	case discoveryLock <- struct{}{}:
+		defer func() { <-discoveryLock }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
 	defer cancel()
 
 	localIP := GetLocalIP(opts.ScannerIP)
+	clientIP := packetClientIP(localIP)
+	vensPacket := MarshalDiscoveryVENS(clientIP, opts.Token, ClientDiscoveryPort, false)
+	ssnrPacket := MarshalDiscoverySSNR(clientIP, opts.Token, ClientDiscoveryPort)
 
-	// Bind to client discovery port
-	listenAddr := &net.UDPAddr{Port: ClientDiscoveryPort}
-	conn, err := net.ListenUDP("udp4", listenAddr)
-	if err != nil {
-		return nil, fmt.Errorf("bind discovery port %d: %w", ClientDiscoveryPort, err)
+	var probes []*discoveryProbe
+	switch {
+	case opts.ScannerIP != "":
+		target := udpAddr(opts.ScannerIP, DiscoveryPort)
+		if target == nil {
+			return fmt.Errorf("invalid scanner IP %q", opts.ScannerIP)
+		}
+		probes = append(probes, &discoveryProbe{network: udpNetwork(opts.ScannerIP), targets: []*net.UDPAddr{target}})
+	default:
+		targets := []*net.UDPAddr{{IP: net.IPv4bcast, Port: DiscoveryPort}}
+		// Also send to the subnet broadcast address
+		if ip := net.ParseIP(localIP).To4(); ip != nil {
+			targets = append(targets, &net.UDPAddr{IP: net.IPv4(ip[0], ip[1], ip[2], 255), Port: DiscoveryPort})
+		}
+		probes = append(probes, &discoveryProbe{network: "udp4", targets: targets})
+		if v6 := linkLocalAllNodes(); len(v6) > 0 {
+			probes = append(probes, &discoveryProbe{network: "udp6", targets: v6, optional: true})
+		}
 	}
-	defer conn.Close()
 
-	// Send discovery packets
-	targetIP := opts.ScannerIP
-	if targetIP == "" {
-		targetIP = "255.255.255.255"
+	infos := make(chan *DeviceInfo)
+	errs := make(chan error, len(probes))
+	stop := make(chan struct{})
+	defer close(stop)
+	started := 0
+	for _, p := range probes {
+		conn, err := net.ListenUDP(p.network, &net.UDPAddr{Port: ClientDiscoveryPort})
+		if err != nil {
+			if p.optional {
+				slog.Debug("IPv6 discovery unavailable", "err", err)
+				continue
+			}
+			return fmt.Errorf("bind discovery port %d: %w", ClientDiscoveryPort, err)
+		}
+		defer conn.Close()
+		if err := p.send(conn, vensPacket, ssnrPacket); err != nil && !p.optional {
+			return err
+		}
+		slog.Debug("sent discovery", "network", p.network, "targets", p.targets, "localIP", localIP, "vens_size", len(vensPacket), "ssnr_size", len(ssnrPacket))
+		go func() {
+			errs <- p.receive(ctx, conn, infos, stop, vensPacket, ssnrPacket)
+		}()
+		started++
 	}
 
-	scannerAddr := &net.UDPAddr{IP: net.ParseIP(targetIP), Port: DiscoveryPort}
-	vensPacket := MarshalDiscoveryVENS(localIP, opts.Token, ClientDiscoveryPort, false)
-	ssnrPacket := MarshalDiscoverySSNR(localIP, opts.Token, ClientDiscoveryPort)
-
-	if _, err := conn.WriteToUDP(vensPacket, scannerAddr); err != nil {
-		return nil, fmt.Errorf("send VENS discovery: %w", err)
-	}
-	if _, err := conn.WriteToUDP(ssnrPacket, scannerAddr); err != nil {
-		return nil, fmt.Errorf("send ssNR discovery: %w", err)
+	var firstErr error
+	for started > 0 {
+		select {
+		case info := <-infos:
+			if !found(info) {
+				return nil
+			}
+		case err := <-errs:
+			started--
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
-	slog.Debug("sent discovery", "target", targetIP, "port", DiscoveryPort, "localIP", localIP, "vens_size", len(vensPacket), "ssnr_size", len(ssnrPacket))
+	return firstErr
+}
+
+// discoveryProbe sends discovery packets on one address family and waits
+// for device info responses.
+type discoveryProbe struct {
+	network  string // "udp4" or "udp6"
+	targets  []*net.UDPAddr
+	optional bool // failures are ignored (IPv6 alongside IPv4 broadcast)
+}
 
-	// Also send to subnet broadcast if doing broadcast discovery
-	if opts.ScannerIP == "" {
-		ip := net.ParseIP(localIP).To4()
-		if ip != nil {
-			subnetBroadcast := fmt.Sprintf("%d.%d.%d.255", ip[0], ip[1], ip[2])
-			subnetAddr := &net.UDPAddr{IP: net.ParseIP(subnetBroadcast), Port: DiscoveryPort}
-			conn.WriteToUDP(vensPacket, subnetAddr)
-			conn.WriteToUDP(ssnrPacket, subnetAddr)
-			slog.Debug("sent subnet broadcast discovery", "broadcast", subnetBroadcast)
+func (p *discoveryProbe) send(conn *net.UDPConn, packets ...[]byte) error {
+	var firstErr error
+	for _, addr := range p.targets {
+		for _, packet := range packets {
+			if _, err := conn.WriteToUDP(packet, addr); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("send discovery to %s: %w", addr, err)
+			}
 		}
 	}
+	return firstErr
+}
 
-	// Read responses
+// receive reads responses on conn and sends each device info to infos until
+// ctx is done, stop is closed or reading fails, resending the discovery
+// packets every 500ms without a response.
+func (p *discoveryProbe) receive(ctx context.Context, conn *net.UDPConn, infos chan<- *DeviceInfo, stop <-chan struct{}, packets ...[]byte) error {
 	buf := make([]byte, 256)
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		default:
 		}
 
@@ -104,12 +277,11 @@ func FindScanner(ctx context.Context, opts DiscoveryOptions) (*DeviceInfo, error
 		if err != nil {
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				// Resend discovery on timeout
-				slog.Debug("discovery timeout, resending...")
-				conn.WriteToUDP(vensPacket, scannerAddr)
-				conn.WriteToUDP(ssnrPacket, scannerAddr)
+				slog.Debug("discovery timeout, resending...", "network", p.network)
+				p.send(conn, packets...)
 				continue
 			}
-			return nil, fmt.Errorf("read discovery: %w", err)
+			return fmt.Errorf("read discovery: %w", err)
 		}
 
 		slog.Debug("received UDP packet", "from", remoteAddr, "bytes", n)
@@ -120,19 +292,51 @@ func FindScanner(ctx context.Context, opts DiscoveryOptions) (*DeviceInfo, error
 			continue
 		}
 
-		info, err := ParseDeviceInfo(buf[:n])
+		info, err := deviceInfoFrom(buf[:n], remoteAddr)
 		if err != nil {
 			slog.Debug("ignored non-device-info packet", "error", err, "bytes", n)
 			continue
 		}
 
-		slog.Info("found scanner",
-			"name", info.Name,
-			"serial", info.Serial,
-			"ip", info.DeviceIP,
-			"data_port", info.DataPort,
-			"control_port", info.ControlPort,
-		)
-		return info, nil
+		select {
+		case infos <- info:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// deviceInfoFrom parses a device info packet received from addr. The packet
+// only carries the scanner's IPv4 address, so a scanner that answered over
+// IPv6 is addressed by the sender address instead.
+func deviceInfoFrom(data []byte, addr *net.UDPAddr) (*DeviceInfo, error) {
+	info, err := ParseDeviceInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if addr != nil && addr.IP.To4() == nil && len(addr.IP) == net.IPv6len {
+		ip := addr.IP.String()
+		if addr.Zone != "" {
+			ip += "%" + addr.Zone
+		}
+		info.DeviceIP = ip
+	}
+	return info, nil
+}
+
+// linkLocalAllNodes returns the IPv6 all-nodes multicast address (ff02::1)
+// of each interface that is up and can multicast.
+func linkLocalAllNodes() []*net.UDPAddr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var addrs []*net.UDPAddr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs = append(addrs, &net.UDPAddr{IP: net.IPv6linklocalallnodes, Port: DiscoveryPort, Zone: iface.Name})
 	}
+	return addrs
 }
@@ -0,0 +1,133 @@
+package vens
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGetLocalIP(t *testing.T) {
+	if got := GetLocalIP("127.0.0.1"); got != "127.0.0.1" {
+		t.Errorf("GetLocalIP(127.0.0.1) = %q, want 127.0.0.1", got)
+	}
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skip("IPv6 loopback not available:", err)
+	}
+	conn.Close()
+	if got := GetLocalIP("::1"); got != "::1" {
+		t.Errorf("GetLocalIP(::1) = %q, want ::1", got)
+	}
+}
+
+func TestUDPNetwork(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.168.5.3", "udp4"},
+		{"::ffff:192.168.5.3", "udp4"},
+		{"fd00::2", "udp6"},
+		{"fe80::1%eth0", "udp6"},
+		{"scanner.local", "udp4"},
+	}
+	for _, tt := range tests {
+		if got := udpNetwork(tt.ip); got != tt.want {
+			t.Errorf("udpNetwork(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+	if addr := udpAddr("fe80::1%eth0", DiscoveryPort); addr == nil || addr.Zone != "eth0" || addr.Port != DiscoveryPort {
+		t.Errorf("udpAddr(fe80::1%%eth0) = %v, want the zone kept", addr)
+	}
+}
+
+func TestDeviceInfoFromIPv6(t *testing.T) {
+	data := make([]byte, 132)
+	copy(data[0:4], Magic[:])
+	copy(data[16:20], []byte{192, 168, 5, 3}) // DeviceIP
+	copy(data[104:120], "ScanSnap iX500\x00")
+
+	info, err := deviceInfoFrom(data, &net.UDPAddr{IP: net.ParseIP("192.168.5.3"), Port: DiscoveryPort})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DeviceIP != "192.168.5.3" {
+		t.Errorf("over IPv4: DeviceIP = %q, want 192.168.5.3", info.DeviceIP)
+	}
+
+	// The packet only has room for IPv4; the sender address is used instead
+	info, err = deviceInfoFrom(data, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: DiscoveryPort, Zone: "eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DeviceIP != "fe80::1%eth0" || info.Name != "ScanSnap iX500" {
+		t.Errorf("over IPv6: DeviceIP = %q, Name = %q, want fe80::1%%eth0, ScanSnap iX500", info.DeviceIP, info.Name)
+	}
+}
+
+// deviceInfoPacket returns a device info response of a scanner.
+func deviceInfoPacket(ip [4]byte, serial, name string) []byte {
+	wire := deviceInfoWire{Magic: Magic, DeviceIP: ip, DataPort: DefaultDataPort, ControlPort: DefaultControlPort}
+	copy(wire.Serial[:], serial)
+	copy(wire.Name[:], name)
+	return writeWire(&wire)
+}
+
+func TestFindAllScanners(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: DiscoveryPort})
+	if err != nil {
+		t.Skip("discovery port not available:", err)
+	}
+	defer responder.Close()
+	// Two scanners behind one address; each probe is answered by both
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			_, from, err := responder.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			responder.WriteToUDP(deviceInfoPacket([4]byte{192, 168, 5, 3}, "AAAA000001", "ScanSnap iX500"), from)
+			responder.WriteToUDP(deviceInfoPacket([4]byte{192, 168, 5, 4}, "AAAA000002", "ScanSnap iX1500"), from)
+		}
+	}()
+
+	opts := DiscoveryOptions{ScannerIP: "127.0.0.1", Timeout: time.Second}
+	found, err := FindAllScanners(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("FindAllScanners: %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found %d scanners, want 2 (deduplicated by serial)", len(found))
+	}
+	if found[0].Serial != "AAAA000001" || found[1].Serial != "AAAA000002" || found[1].DeviceIP != "192.168.5.4" {
+		t.Errorf("found = %+v, %+v", *found[0], *found[1])
+	}
+
+	start := time.Now()
+	info, err := FindScanner(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("FindScanner: %v", err)
+	}
+	if info.Serial != "AAAA000001" {
+		t.Errorf("FindScanner serial = %q, want the first reply", info.Serial)
+	}
+	if time.Since(start) >= opts.Timeout {
+		t.Error("FindScanner waited for the timeout, want it to return on the first reply")
+	}
+}
+
+func TestFindScannerSkipDiscovery(t *testing.T) {
+	info, err := FindScanner(context.Background(), DiscoveryOptions{ScannerIP: "192.168.5.3", SkipDiscovery: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DeviceIP != "192.168.5.3" || info.DataPort != DefaultDataPort || info.ControlPort != DefaultControlPort {
+		t.Errorf("info = %+v, want the scanner IP on the default ports", *info)
+	}
+	if _, err := FindScanner(context.Background(), DiscoveryOptions{SkipDiscovery: true}); !errors.Is(err, ErrNoScannerIP) {
+		t.Errorf("without a scanner IP: err = %v, want ErrNoScannerIP", err)
+	}
+}
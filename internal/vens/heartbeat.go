@@ -2,6 +2,7 @@ package vens
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net"
 	"time"
@@ -21,10 +22,13 @@ func StartHeartbeat(ctx context.Context, scannerIP string, token [8]byte, interv
 	}
 
 	localIP := GetLocalIP(scannerIP)
-	packet := MarshalDiscoveryVENS(localIP, token, ClientDiscoveryPort, true)
-	addr := &net.UDPAddr{IP: net.ParseIP(scannerIP), Port: DiscoveryPort}
+	packet := MarshalDiscoveryVENS(packetClientIP(localIP), token, ClientDiscoveryPort, true)
+	addr := udpAddr(scannerIP, DiscoveryPort)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid scanner IP %q", scannerIP)
+	}
 
-	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: 0})
+	conn, err := net.ListenUDP(udpNetwork(scannerIP), &net.UDPAddr{Port: 0})
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +86,20 @@ type getWifiStatusRequestWire struct {
 	_             [8]byte // [24:32]
 }
 
+// setWifiModeRequestWire is a 32-byte Wi-Fi mode switch request packet.
+type setWifiModeRequestWire struct {
+	controlHeader         // [0:24]
+	Mode          uint32  // [24:28]
+	_             [4]byte // [28:32]
+}
+
+// setStartModeRequestWire is a 32-byte start mode request packet.
+type setStartModeRequestWire struct {
+	controlHeader         // [0:24]
+	Mode          uint32  // [24:28]
+	_             [4]byte // [28:32]
+}
+
 // dataHeader is the 36-byte common header for TCP data channel requests.
 type dataHeader struct {
 	Size      uint32   // [0:4]
@@ -307,18 +321,21 @@ func MarshalReserveRequest(token [8]byte, clientIP string, notifyPort uint16, id
 	p.putBytes(52, idBytes)
 
 	// Timestamp at offset 100
-	p.putU16(100, uint16(ts.Year()))
-	p[102] = byte(ts.Month())
-	p[103] = byte(ts.Day())
-	p[104] = byte(ts.Hour())
-	p[105] = byte(ts.Minute())
-	p[106] = byte(ts.Second())
+	p.putBytes(100, marshalDeviceTime(ts))
 
 	// Client type constant
 	p.putU32(116, 0xFFFF8170)
 	return p
 }
 
+// marshalDeviceTime encodes t as the scanner's date and time field: a
+// big-endian year followed by month, day, hour, minute and second bytes.
+// The scanner has no time zone, so t is sent as wall clock time.
+func marshalDeviceTime(t time.Time) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(t.Year()))
+	return append(b, byte(t.Month()), byte(t.Day()), byte(t.Hour()), byte(t.Minute()), byte(t.Second()))
+}
+
 // MarshalGetWifiStatusRequest builds a 32-byte WiFi status request.
 func MarshalGetWifiStatusRequest(token [8]byte) []byte {
 	return writeWire(&getWifiStatusRequestWire{
@@ -326,6 +343,24 @@ func MarshalGetWifiStatusRequest(token [8]byte) []byte {
 	})
 }
 
+// MarshalSetWifiMode builds a 32-byte SET_WIFI_MODE request that switches the
+// scanner to mode (WifiModeInfrastructure or WifiModeDirect).
+func MarshalSetWifiMode(token [8]byte, mode uint32) []byte {
+	return writeWire(&setWifiModeRequestWire{
+		controlHeader: controlHeader{Size: 32, Magic: Magic, Command: CmdSetWifiMode, Token: token},
+		Mode:          mode,
+	})
+}
+
+// MarshalSetStartMode builds a 32-byte SET_START_MODE request that selects
+// what the scan button starts (StartModeNormal or StartModeQuick).
+func MarshalSetStartMode(token [8]byte, mode uint32) []byte {
+	return writeWire(&setStartModeRequestWire{
+		controlHeader: controlHeader{Size: 32, Magic: Magic, Command: CmdSetStartMode, Token: token},
+		Mode:          mode,
+	})
+}
+
 // ParseGetWifiStatusResponse extracts the state field from a 32-byte status response.
 func ParseGetWifiStatusResponse(data []byte) (state uint32, err error) {
 	if len(data) < 32 {
@@ -358,26 +393,62 @@ func marshalDataRequest(token [8]byte, command uint32, params []byte) []byte {
 	return append(hdr, params...)
 }
 
+// DeviceInfoRespLen is the length of a device info (INQUIRY) response.
+const DeviceInfoRespLen = 136
+
 // ParseDataDeviceInfo parses a 136-byte SCSI INQUIRY response.
 // Extracts device name (offset 48, 33 bytes) and firmware revision from the name suffix.
 func ParseDataDeviceInfo(data []byte) (*DataDeviceInfo, error) {
-	if len(data) < 136 {
+	if len(data) < DeviceInfoRespLen {
 		return nil, fmt.Errorf("device info response too short: %d bytes", len(data))
 	}
-	raw := nullTerminated(data[48:81])
-	// Firmware revision is the last space-separated token in the device name
-	// e.g. "FUJITSU ScanSnap iX500  0M00" → name "FUJITSU ScanSnap iX500", revision "0M00"
-	var revision string
-	trimmed := strings.TrimRight(raw, " ")
-	name := trimmed
-	if i := strings.LastIndex(trimmed, " "); i >= 0 {
-		revision = trimmed[i+1:]
-		name = strings.TrimRight(trimmed[:i], " ")
-	}
-	return &DataDeviceInfo{
-		DeviceName:       name,
-		FirmwareRevision: revision,
-	}, nil
+	return parseDeviceName(nullTerminated(data[48:81])), nil
+}
+
+// modelLine is the product line every ScanSnap model name starts with. A
+// device name starting with it has no manufacturer prefix.
+const modelLine = "ScanSnap"
+
+// parseDeviceName splits an INQUIRY device name into manufacturer, model and
+// firmware revision. The name normally follows the SCSI layout of an 8-byte
+// vendor, a 16-byte product and a 4-byte revision field, all space-padded:
+// "FUJITSU ScanSnap iX500  0M00". The manufacturer and revision may be
+// missing and the padding may differ, so words are used instead of offsets.
+//
+// The last word is only taken as the revision when it looks like one (see
+// isRevision) and either sits in the SCSI revision field or follows at least
+// two model words, so a short model name such as "ScanSnap S500" is kept.
+func parseDeviceName(raw string) *DataDeviceInfo {
+	words := strings.Fields(raw)
+	info := &DataDeviceInfo{}
+	model := words
+	if len(model) > 1 && model[0] != modelLine {
+		info.Manufacturer = model[0]
+		model = model[1:]
+	}
+	if n := len(model); n > 1 && isRevision(model[n-1]) {
+		atRevisionField := len(raw) >= 28 && strings.TrimSpace(raw[24:28]) == model[n-1]
+		if n > 2 || atRevisionField {
+			info.FirmwareRevision = model[n-1]
+			words = words[:len(words)-1]
+		}
+	}
+	info.DeviceName = strings.Join(words, " ")
+	return info
+}
+
+// isRevision reports whether s looks like a firmware revision: four
+// uppercase letters or digits with at least one digit (e.g. "0M00").
+func isRevision(s string) bool {
+	if len(s) != 4 || !strings.ContainsAny(s, "0123456789") {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
 }
 
 // MarshalGetDeviceInfo builds a SCSI INQUIRY (EVPD) request for device identity.
@@ -396,7 +467,78 @@ func MarshalGetScanSettings(token [8]byte) []byte {
 	return marshalDataRequest(token, CmdGetSet, p)
 }
 
+// ScanSettingsMinLen is the shortest GET SCAN SETTINGS response that
+// ParseScanSettings accepts.
+const ScanSettingsMinLen = 40
+
+// ParseScanSettings parses a GET SCAN SETTINGS (0xD8) response. A response
+// with only the 40-byte VENS header means the scanner has no stored settings.
+// Otherwise the data after the header is decoded with the SET SCAN CONFIG
+// (0xD4) config data layout; see MarshalScanConfig. This is an assumption:
+// every capture so far has the header-only response, so no stored settings
+// have been seen on the wire, and the layout is only tested by parsing what
+// MarshalScanConfig writes.
+//
+//	[+1]      Duplex (0x03 = duplex, 0x01 = simplex)
+//	[+2]      Paper size auto-detect (0x01 = auto)
+//	[+7]      Auto color+quality (0xC1)
+//	[+33]     Color/BW flag (0x40 = BW)
+//	[+34-35]  Resolution (DPI, 0 = auto)
+//	[+38]     Color mode (0x05 = color, 0x02 = gray, 0x00 = BW)
+//	[+44-45]  Paper width (1/1200 inch)
+//	[+48-49]  Paper height (1/1200 inch)
+func ParseScanSettings(data []byte) (*ScanConfigState, error) {
+	if len(data) < ScanSettingsMinLen {
+		return nil, fmt.Errorf("scan settings response too short: %d bytes", len(data))
+	}
+	if [4]byte(data[4:8]) != Magic {
+		return nil, errors.New("scan settings response: bad magic")
+	}
+	if len(data) == 40 {
+		return &ScanConfigState{PaperSize: PaperAuto}, nil
+	}
+	c := data[40:]
+	if len(c) < 50 {
+		return nil, fmt.Errorf("scan settings data too short: %d bytes", len(c))
+	}
+	slog.Debug("scan settings raw", "hex", hex.EncodeToString(c))
+
+	st := &ScanConfigState{
+		Stored:      true,
+		Duplex:      c[1] == 0x03,
+		Resolution:  int(binary.BigEndian.Uint16(c[34:36])),
+		PaperWidth:  binary.BigEndian.Uint16(c[44:46]),
+		PaperHeight: binary.BigEndian.Uint16(c[48:50]),
+	}
+	switch {
+	case c[7] == 0xC1:
+		st.ColorMode = ColorAuto
+	case c[33] == 0x40 || c[38] == 0x00:
+		st.ColorMode = ColorBW
+	case c[38] == 0x02:
+		st.ColorMode = ColorGray
+	default:
+		st.ColorMode = ColorColor
+	}
+	st.PaperSize = PaperAuto
+	if c[2] != 0x01 {
+		for size, dim := range PaperDimensions {
+			if size != PaperAuto && dim.Width == st.PaperWidth && dim.Height == st.PaperHeight {
+				st.PaperSize = size
+				break
+			}
+		}
+	}
+	return st, nil
+}
+
+// ScanParamsMinLen is the shortest scan params response that
+// ParseScanParams accepts; the full response is 184 bytes.
+const ScanParamsMinLen = 68
+
 // ParseScanParams parses a 184-byte INQUIRY VPD 0xF0 response into ScanParams.
+// The layout is that of the iX500; values other models report elsewhere are
+// filled in from their limits by Model.CompleteScanParams.
 //
 // Response layout (after 40-byte VENS header):
 //
@@ -414,7 +556,7 @@ func MarshalGetScanSettings(token [8]byte) []byte {
 //	[62-63] Max Width (1/600 inch)
 //	[66-67] Max Height (1/600 inch)
 func ParseScanParams(data []byte) (*ScanParams, error) {
-	if len(data) < 68 {
+	if len(data) < ScanParamsMinLen {
 		return nil, fmt.Errorf("scan params response too short: %d bytes", len(data))
 	}
 	slog.Debug("scan params raw",
@@ -494,9 +636,15 @@ func MarshalEndScan(token [8]byte) []byte {
 // sheet is the transfer sheet counter (Page ID), chunk is the sequence index within a sheet.
 // backSide indicates whether this is the back side of a duplex scan.
 func MarshalPageTransfer(token [8]byte, sheet int, chunk int, backSide bool) []byte {
+	return MarshalPageTransferLen(token, sheet, chunk, backSide, PageTransferLen)
+}
+
+// MarshalPageTransferLen is MarshalPageTransfer with an explicit chunk size
+// (Allocation/Transfer Length), up to MaxPageTransferLen.
+func MarshalPageTransferLen(token [8]byte, sheet int, chunk int, backSide bool, length uint32) []byte {
 	p := newPacket(28)
 	// Allocation Length (param[0:4])
-	p.putU32(0, PageTransferLen)
+	p.putU32(0, length)
 
 	// SCSI CDB at param[12:24] — READ(10), 12 bytes
 	cdb := p[12:24]
@@ -509,7 +657,7 @@ func MarshalPageTransfer(token [8]byte, sheet int, chunk int, backSide bool) []b
 		cdb[5] = 0x80 // Back side
 	}
 	// Transfer Length: 24-bit big-endian (0x040000 = 256KB)
-	tlen := PageTransferLen
+	tlen := length
 	cdb[6] = byte(tlen >> 16)
 	cdb[7] = byte(tlen >> 8)
 	cdb[8] = byte(tlen)
@@ -558,6 +706,77 @@ func ParsePixelSizeInfo(resp []byte) (*PixelSizeInfo, error) {
 	}, nil
 }
 
+// MarshalGetDetectedPaperSize builds a SCSI READ(10) request for the paper
+// size detected while feeding the given sheet (DataType=0x81).
+func MarshalGetDetectedPaperSize(token [8]byte, sheet int) []byte {
+	p := newPacket(28)
+	p.putU32(0, PaperSizeResponseLen)
+
+	cdb := p[12:24]
+	cdb[0] = SCSIOpcodeRead10
+	cdb[2] = DataTypePaperSize
+	tlen := PaperSizeResponseLen
+	cdb[6] = byte(tlen >> 16)
+	cdb[7] = byte(tlen >> 8)
+	cdb[8] = byte(tlen)
+	cdb[10] = byte(sheet)
+
+	return marshalDataRequest(token, CmdPageTransfer, p)
+}
+
+// MarshalGetCarrierSheet builds a SCSI READ(10) request for the carrier
+// sheet detection state of the sheet just transferred (DataType=0x83).
+func MarshalGetCarrierSheet(token [8]byte) []byte {
+	p := newPacket(28)
+	p.putU32(0, CarrierSheetResponseLen)
+
+	cdb := p[12:24]
+	cdb[0] = SCSIOpcodeRead10
+	cdb[2] = DataTypeCarrierSheet
+	tlen := CarrierSheetResponseLen
+	cdb[6] = byte(tlen >> 16)
+	cdb[7] = byte(tlen >> 8)
+	cdb[8] = byte(tlen)
+
+	return marshalDataRequest(token, CmdPageTransfer, p)
+}
+
+// ParseCarrierSheet parses a CARRIER_SHEET READ(10) VENS response and
+// reports whether the sheet was scanned in a carrier sheet (protocol §6.7).
+// The payload starts after the VENS response header at offset 40.
+func ParseCarrierSheet(resp []byte) (detected bool, err error) {
+	const payloadOffset = 40
+	if len(resp) < payloadOffset+int(CarrierSheetResponseLen) {
+		return false, fmt.Errorf("carrier sheet response too short: %d bytes", len(resp))
+	}
+	return resp[payloadOffset+0x01]&0x01 != 0, nil
+}
+
+// detectedPaperSizes maps the paper size codes of a PAPERSIZE response
+// (protocol §6.6) to PaperSize.
+var detectedPaperSizes = map[uint16]PaperSize{
+	1: PaperA4,
+	2: PaperA5,
+	3: PaperB5,
+}
+
+// ParseDetectedPaperSize parses a PAPERSIZE READ(10) VENS response and
+// returns the detected paper dimensions in 1/1200 inch. The payload starts
+// after the VENS response header at offset 40.
+func ParseDetectedPaperSize(resp []byte) (widthInch1200, heightInch1200 uint16, err error) {
+	const payloadOffset = 40
+	if len(resp) < payloadOffset+int(PaperSizeResponseLen) {
+		return 0, 0, fmt.Errorf("papersize response too short: %d bytes", len(resp))
+	}
+	code := binary.BigEndian.Uint16(resp[payloadOffset+0x04:])
+	size, ok := detectedPaperSizes[code]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown paper size code %d", code)
+	}
+	dim := PaperDimensions[size]
+	return dim.Width, dim.Height, nil
+}
+
 // MarshalGetPageMetadata builds a SCSI REQUEST SENSE request for page metadata after transfer.
 func MarshalGetPageMetadata(token [8]byte) []byte {
 	p := newPacket(28)
@@ -607,6 +826,8 @@ func MarshalWriteToneCurve(token [8]byte) []byte {
 }
 
 // MarshalScanConfig builds a vendor SCSI SET SCAN CONFIG request (opcode 0xD4).
+// Brightness and Contrast are not encoded: no config field for them has been
+// identified in captures.
 func MarshalScanConfig(token [8]byte, cfg ScanConfig) []byte {
 	isBW := cfg.ColorMode == ColorBW
 	isGray := cfg.ColorMode == ColorGray
@@ -614,6 +835,7 @@ func MarshalScanConfig(token [8]byte, cfg ScanConfig) []byte {
 	isAutoQuality := cfg.Quality == QualityAuto
 	hasPaperOverride := cfg.PaperWidth > 0 || cfg.PaperHeight > 0
 	isFullAuto := isAutoColor && isAutoQuality
+	duplex := cfg.ScansDuplex()
 
 	dpi := QualityDPI[cfg.Quality]
 	dim := PaperDimensions[cfg.PaperSize]
@@ -628,7 +850,7 @@ func MarshalScanConfig(token [8]byte, cfg ScanConfig) []byte {
 	}
 
 	configSize := 0x50 // 80 bytes
-	if cfg.Duplex && isFullAuto {
+	if duplex && isFullAuto {
 		configSize = 0x80 // 128 bytes
 	}
 
@@ -651,7 +873,7 @@ func MarshalScanConfig(token [8]byte, cfg ScanConfig) []byte {
 	c := 64
 
 	// +1: duplex
-	if cfg.Duplex {
+	if duplex {
 		p[c+1] = 0x03
 	} else {
 		p[c+1] = 0x01
@@ -718,8 +940,8 @@ func MarshalScanConfig(token [8]byte, cfg ScanConfig) []byte {
 	// +39: fixed (0x82 for color/gray, 0x03 for bw)
 	// +40: JPEG compression (0x09=highest compression .. 0x0D=highest quality; 0x00 for bw)
 	colorEncTail := cfg.CompressionArg
-	if colorEncTail == 0 {
-		colorEncTail = 0x0B // standard compression
+	if colorEncTail < 0x09 || colorEncTail > 0x0D {
+		colorEncTail = 0x0B // auto or out of range: standard compression
 	}
 	if isGray {
 		p[c+38] = 0x02
@@ -1,9 +1,11 @@
 package vens
 
 import (
+	"bytes"
 	"encoding/binary"
 	"strings"
 	"testing"
+	"time"
 )
 
 // buildPcapScanParamsResponse constructs a 184-byte INQUIRY VPD 0xF0 response
@@ -216,6 +218,41 @@ func TestParseDataDeviceInfo_SingleWord(t *testing.T) {
 	}
 }
 
+func TestParseDataDeviceInfo_NameFormats(t *testing.T) {
+	tests := []struct {
+		raw              string
+		wantName         string
+		wantManufacturer string
+		wantRevision     string
+	}{
+		{"FUJITSU ScanSnap iX500  0M00", "FUJITSU ScanSnap iX500", "FUJITSU", "0M00"},
+		{"PFU     ScanSnap iX1600 0L02", "PFU ScanSnap iX1600", "PFU", "0L02"},
+		{"ScanSnap iX1600", "ScanSnap iX1600", "", ""},
+		{"ScanSnap iX1600 0L02", "ScanSnap iX1600", "", "0L02"},
+		{"FUJITSU ScanSnap iX500", "FUJITSU ScanSnap iX500", "FUJITSU", ""},
+		{"FUJITSU ScanSnap SV600", "FUJITSU ScanSnap SV600", "FUJITSU", ""},
+		{"FUJITSU ScanSnap S500", "FUJITSU ScanSnap S500", "FUJITSU", ""},
+		{"ScanSnap S500", "ScanSnap S500", "", ""},
+		{" FUJITSU  ScanSnap  iX500  0M00", "FUJITSU ScanSnap iX500", "FUJITSU", "0M00"},
+		{"FUJITSU S500            0A00", "FUJITSU S500", "FUJITSU", "0A00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			data := make([]byte, 136)
+			copy(data[48:81], tt.raw)
+			info, err := ParseDataDeviceInfo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.DeviceName != tt.wantName || info.Manufacturer != tt.wantManufacturer || info.FirmwareRevision != tt.wantRevision {
+				t.Errorf("got %q / %q / %q, want %q / %q / %q",
+					info.DeviceName, info.Manufacturer, info.FirmwareRevision,
+					tt.wantName, tt.wantManufacturer, tt.wantRevision)
+			}
+		})
+	}
+}
+
 func TestParseDataDeviceInfo_TooShort(t *testing.T) {
 	data := make([]byte, 135)
 	_, err := ParseDataDeviceInfo(data)
@@ -439,6 +476,61 @@ func TestParseGetWifiStatusResponse_TooShort(t *testing.T) {
 	}
 }
 
+func TestMarshalSetWifiMode(t *testing.T) {
+	token := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00}
+	tests := []struct {
+		name string
+		mode uint32
+		want []byte
+	}{
+		{"infrastructure", WifiModeInfrastructure, []byte{
+			0x00, 0x00, 0x00, 0x20, 'V', 'E', 'N', 'S',
+			0x00, 0x00, 0x00, 0x31, 0x00, 0x00, 0x00, 0x00,
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		}},
+		{"direct", WifiModeDirect, []byte{
+			0x00, 0x00, 0x00, 0x20, 'V', 'E', 'N', 'S',
+			0x00, 0x00, 0x00, 0x31, 0x00, 0x00, 0x00, 0x00,
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MarshalSetWifiMode(token, tt.mode); !bytes.Equal(got, tt.want) {
+				t.Errorf("MarshalSetWifiMode() =\n% X\nwant\n% X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalSetStartMode(t *testing.T) {
+	token := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00}
+	want := []byte{
+		0x00, 0x00, 0x00, 0x20, 'V', 'E', 'N', 'S',
+		0x00, 0x00, 0x00, 0x62, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+	}
+	if got := MarshalSetStartMode(token, StartModeQuick); !bytes.Equal(got, want) {
+		t.Errorf("MarshalSetStartMode() =\n% X\nwant\n% X", got, want)
+	}
+	if got := MarshalSetStartMode(token, StartModeNormal); got[27] != 0x00 {
+		t.Errorf("normal mode byte = 0x%02X, want 0x00", got[27])
+	}
+}
+
+func TestMarshalReserveRequest_Timestamp(t *testing.T) {
+	ts := time.Date(2026, time.March, 9, 14, 5, 7, 0, time.Local)
+	req := MarshalReserveRequest([8]byte{}, "192.168.1.10", 55265, "", ts)
+
+	want := []byte{0x07, 0xEA, 0x03, 0x09, 0x0E, 0x05, 0x07}
+	if got := req[100:107]; !bytes.Equal(got, want) {
+		t.Errorf("timestamp = % X, want % X", got, want)
+	}
+}
+
 func TestParseReserveResponse(t *testing.T) {
 	data := make([]byte, 20)
 	binary.BigEndian.PutUint32(data[8:12], 0x00000001)
@@ -722,6 +814,146 @@ func TestMarshalPageTransfer(t *testing.T) {
 	}
 }
 
+func TestMarshalReadPixelSize(t *testing.T) {
+	token := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00}
+	pkt := MarshalReadPixelSize(token, 2, true)
+	if len(pkt) != 64 {
+		t.Fatalf("packet length = %d, want 64", len(pkt))
+	}
+	if command := binary.BigEndian.Uint32(pkt[32:36]); command != CmdPageTransfer {
+		t.Errorf("Command = 0x%02X, want 0x%02X", command, CmdPageTransfer)
+	}
+	if n := binary.BigEndian.Uint32(pkt[36:40]); n != PixelSizeResponseLen {
+		t.Errorf("response length = %d, want %d", n, PixelSizeResponseLen)
+	}
+	want := []byte{SCSIOpcodeRead10, 0x00, DataTypePixelSize, 0x00, 0x00, 0x80, 0x00, 0x00, 0x20, 0x00, 0x02, 0x00}
+	if cdb := pkt[48:60]; !bytes.Equal(cdb, want) {
+		t.Errorf("CDB = % X, want % X", cdb, want)
+	}
+}
+
+// pixelSizeResponse builds a PIXELSIZE READ(10) response: the 40-byte VENS
+// header followed by the 32-byte payload of protocol §6.5.
+func pixelSizeResponse(xPixels, yPixels, detectedLength uint32, xRes, yRes uint16) []byte {
+	resp := make([]byte, 40+PixelSizeResponseLen)
+	binary.BigEndian.PutUint32(resp[0:4], uint32(len(resp)))
+	copy(resp[4:8], Magic[:])
+	data := resp[40:]
+	binary.BigEndian.PutUint32(data[0x00:], xPixels)
+	binary.BigEndian.PutUint32(data[0x04:], yPixels)
+	binary.BigEndian.PutUint32(data[0x0C:], detectedLength)
+	binary.BigEndian.PutUint16(data[0x12:], xRes)
+	binary.BigEndian.PutUint16(data[0x14:], yRes)
+	return resp
+}
+
+func TestParsePixelSizeInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		resp []byte
+		want PixelSizeInfo
+	}{
+		{"A4 300dpi", pixelSizeResponse(2480, 3508, 0x36D0, 300, 300), PixelSizeInfo{2480, 3508, 0x36D0, 300, 300}},
+		{"A5 150dpi", pixelSizeResponse(874, 1240, 0x26C0, 150, 150), PixelSizeInfo{874, 1240, 0x26C0, 150, 150}},
+		{"anisotropic", pixelSizeResponse(1700, 4400, 0x3390, 200, 400), PixelSizeInfo{1700, 4400, 0x3390, 200, 400}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePixelSizeInfo(tt.resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParsePixelSizeInfo = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePixelSizeInfo_TooShort(t *testing.T) {
+	// Short response returned when the scanner has no pixel size for the page
+	resp := make([]byte, 40)
+	binary.BigEndian.PutUint32(resp[0:4], 40)
+	copy(resp[4:8], Magic[:])
+	if _, err := ParsePixelSizeInfo(resp); err == nil {
+		t.Fatal("expected error for header-only response, got nil")
+	}
+}
+
+func TestMarshalGetDetectedPaperSize(t *testing.T) {
+	token := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00}
+	pkt := MarshalGetDetectedPaperSize(token, 3)
+	if n := binary.BigEndian.Uint32(pkt[36:40]); n != PaperSizeResponseLen {
+		t.Errorf("response length = %d, want %d", n, PaperSizeResponseLen)
+	}
+	want := []byte{SCSIOpcodeRead10, 0x00, DataTypePaperSize, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x03, 0x00}
+	if cdb := pkt[48:60]; !bytes.Equal(cdb, want) {
+		t.Errorf("CDB = % X, want % X", cdb, want)
+	}
+}
+
+func TestParseDetectedPaperSize(t *testing.T) {
+	resp := make([]byte, 40, 40+PaperSizeResponseLen)
+	binary.BigEndian.PutUint32(resp[0:4], 40+PaperSizeResponseLen)
+	copy(resp[4:8], Magic[:])
+	payload := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00} // A4
+	w, h, err := ParseDetectedPaperSize(append(resp, payload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := PaperDimensions[PaperA4]; w != want.Width || h != want.Height {
+		t.Errorf("size = %#x x %#x, want %#x x %#x", w, h, want.Width, want.Height)
+	}
+
+	payload[5] = 0x7F
+	if _, _, err := ParseDetectedPaperSize(append(resp, payload...)); err == nil {
+		t.Error("expected error for unknown paper size code")
+	}
+	if _, _, err := ParseDetectedPaperSize(resp); err == nil {
+		t.Error("expected error for header-only response")
+	}
+}
+
+func TestMarshalGetCarrierSheet(t *testing.T) {
+	token := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x00}
+	pkt := MarshalGetCarrierSheet(token)
+	if n := binary.BigEndian.Uint32(pkt[36:40]); n != CarrierSheetResponseLen {
+		t.Errorf("response length = %d, want %d", n, CarrierSheetResponseLen)
+	}
+	want := []byte{SCSIOpcodeRead10, 0x00, DataTypeCarrierSheet, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00}
+	if cdb := pkt[48:60]; !bytes.Equal(cdb, want) {
+		t.Errorf("CDB = % X, want % X", cdb, want)
+	}
+}
+
+func TestParseCarrierSheet(t *testing.T) {
+	resp := make([]byte, 40, 40+CarrierSheetResponseLen)
+	binary.BigEndian.PutUint32(resp[0:4], 40+CarrierSheetResponseLen)
+	copy(resp[4:8], Magic[:])
+
+	tests := []struct {
+		payload []byte
+		want    bool
+	}{
+		{[]byte{0x80, 0x01, 0x00, 0x00}, true},  // detection enabled, carrier sheet detected
+		{[]byte{0x80, 0x00, 0x00, 0x00}, false}, // detection enabled, plain sheet
+		{[]byte{0x00, 0x00, 0x00, 0x00}, false}, // detection disabled
+		{[]byte{0x80, 0x02, 0x00, 0x00}, false}, // extended info only
+	}
+	for _, tt := range tests {
+		got, err := ParseCarrierSheet(append(resp, tt.payload...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseCarrierSheet(% X) = %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+	if _, err := ParseCarrierSheet(resp); err == nil {
+		t.Error("expected error for header-only response")
+	}
+}
+
 func TestMarshalDiscoveryVENS(t *testing.T) {
 	token := [8]byte{0xAA, 0xBB, 0xCC, 0xDD, 0x00, 0x00, 0x00, 0x00}
 
@@ -777,16 +1009,19 @@ func TestMarshalScanConfig_Duplex(t *testing.T) {
 
 	tests := []struct {
 		name     string
+		model    Model
 		duplex   bool
 		wantByte byte
 	}{
-		{"simplex", false, 0x01},
-		{"duplex", true, 0x03},
+		{"simplex", ModelIX500, false, 0x01},
+		{"duplex", ModelIX500, true, 0x03},
+		{"simplex-only model", ModelIX100, true, 0x01},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := DefaultScanConfig()
+			cfg.Model = tt.model
 			cfg.Duplex = tt.duplex
 			cfg.ColorMode = ColorColor // non-auto to avoid full-auto duplex back-side
 			cfg.Quality = QualityNormal
@@ -919,6 +1154,28 @@ func TestMarshalScanConfig_PaperDimensions(t *testing.T) {
 			t.Errorf("PaperSize=%d: height = 0x%04X, want 0x%04X", ps, height, dim.Height)
 		}
 	}
+
+	// US sizes are exact inch multiples: 8.5in = 10200, 11in = 13200, 14in = 16800
+	tests := []struct {
+		name   string
+		ps     PaperSize
+		width  uint16
+		height uint16
+	}{
+		{"Letter", PaperLetter, 10200, 13200},
+		{"Legal", PaperLegal, 10200, 16800},
+	}
+	for _, tt := range tests {
+		cfg := DefaultScanConfig()
+		cfg.PaperSize = tt.ps
+		pkt := MarshalScanConfig(token, cfg)
+		c := 64
+		width := binary.BigEndian.Uint16(pkt[c+44 : c+46])
+		height := binary.BigEndian.Uint16(pkt[c+48 : c+50])
+		if width != tt.width || height != tt.height {
+			t.Errorf("%s: width, height = %d, %d, want %d, %d", tt.name, width, height, tt.width, tt.height)
+		}
+	}
 }
 
 func TestMarshalScanConfig_Resolution(t *testing.T) {
@@ -1002,6 +1259,73 @@ func TestMarshalScanConfig_BleedThrough(t *testing.T) {
 	}
 }
 
+func TestMarshalScanConfig_Compression(t *testing.T) {
+	token := [8]byte{}
+
+	tests := []struct {
+		name string
+		arg  byte
+		want byte // config[40] — JPEG compression
+	}{
+		{"auto", 0, 0x0B},
+		{"most compressed", 0x09, 0x09},
+		{"0x0A", 0x0A, 0x0A},
+		{"standard", 0x0B, 0x0B},
+		{"0x0C", 0x0C, 0x0C},
+		{"best quality", 0x0D, 0x0D},
+		{"too low", 0x08, 0x0B},
+		{"too high", 0x0E, 0x0B},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultScanConfig()
+			cfg.CompressionArg = tt.arg
+			c := 64
+			for _, mode := range []ColorMode{ColorColor, ColorGray} {
+				cfg.ColorMode = mode
+				cfg.Quality = QualityNormal
+				pkt := MarshalScanConfig(token, cfg)
+				if pkt[c+39] != 0x82 || pkt[c+40] != tt.want {
+					t.Errorf("color mode %d: config[39:41] = % X, want 82 %02X", mode, pkt[c+39:c+41], tt.want)
+				}
+			}
+
+			// BW is not JPEG encoded
+			cfg.ColorMode = ColorBW
+			pkt := MarshalScanConfig(token, cfg)
+			if pkt[c+39] != 0x03 || pkt[c+40] != 0x00 {
+				t.Errorf("bw: config[39:41] = % X, want 03 00", pkt[c+39:c+41])
+			}
+
+			// Full-auto duplex repeats the compression in the back side params
+			cfg.ColorMode = ColorAuto
+			cfg.Quality = QualityAuto
+			cfg.Duplex = true
+			pkt = MarshalScanConfig(token, cfg)
+			if pkt[c+40] != tt.want || pkt[c+80+8] != tt.want {
+				t.Errorf("full-auto duplex: front = 0x%02X, back = 0x%02X, want 0x%02X", pkt[c+40], pkt[c+80+8], tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalScanConfig_BrightnessContrastNotEncoded(t *testing.T) {
+	token := [8]byte{}
+
+	// No config field is known for these; the request must stay as captured
+	for _, mode := range []ColorMode{ColorAuto, ColorColor, ColorGray, ColorBW} {
+		cfg := DefaultScanConfig()
+		cfg.ColorMode = mode
+		want := MarshalScanConfig(token, cfg)
+		cfg.Brightness = 5
+		cfg.Contrast = -5
+		if got := MarshalScanConfig(token, cfg); !bytes.Equal(got, want) {
+			t.Errorf("color mode %d: brightness/contrast changed the config\ngot  % X\nwant % X", mode, got, want)
+		}
+	}
+}
+
 func TestMarshalScanConfig_FullAutoDuplexSize(t *testing.T) {
 	token := [8]byte{}
 
@@ -1341,6 +1665,26 @@ func buildPcapScanConfigMultiFeedOff() []byte {
 	}
 }
 
+// buildPcapScanSettingsEmpty constructs the 40-byte D8 GET SCAN SETTINGS
+// response seen in all captures (protocol §5.3.2): header only, no stored
+// settings.
+func buildPcapScanSettingsEmpty() []byte {
+	return []byte{
+		0x00, 0x00, 0x00, 0x28, 0x56, 0x45, 0x4e, 0x53, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+}
+
+// scanSettingsResponse wraps config data in a D8 response header.
+func scanSettingsResponse(config []byte) []byte {
+	resp := make([]byte, 40+len(config))
+	binary.BigEndian.PutUint32(resp[0:4], uint32(len(resp)))
+	copy(resp[4:8], Magic[:])
+	copy(resp[40:], config)
+	return resp
+}
+
 // --------------------------------------------------------------------------
 // Pcap-based parse tests
 // --------------------------------------------------------------------------
@@ -1555,6 +1899,79 @@ func TestParseSenseError_PcapIllegalRequest(t *testing.T) {
 	}
 }
 
+// TestParseScanSettings_RoundTrip parses config data written by
+// MarshalScanConfig (and the captured D4 request body), since no capture has
+// a D8 response with stored settings.
+func TestParseScanSettings_RoundTrip(t *testing.T) {
+	a4 := DefaultScanConfig()
+	a4.ColorMode = ColorGray
+	a4.Quality = QualityFine
+	a4.Duplex = false
+	a4.PaperSize = PaperA4
+	a4.PaperWidth = PaperDimensions[PaperA4].Width
+	a4.PaperHeight = PaperDimensions[PaperA4].Height
+
+	color := a4
+	color.ColorMode = ColorColor
+	color.Quality = QualitySuperFine
+	color.PaperSize = PaperAuto
+	color.PaperWidth, color.PaperHeight = 0, 0
+
+	tests := []struct {
+		name string
+		data []byte
+		want ScanConfigState
+	}{
+		{"no stored settings", buildPcapScanSettingsEmpty(), ScanConfigState{PaperSize: PaperAuto}},
+		{
+			"BW duplex auto quality",
+			scanSettingsResponse(buildPcapScanConfigBWDuplexAutoQuality()[64:]),
+			ScanConfigState{Stored: true, ColorMode: ColorBW, Duplex: true, PaperSize: PaperAuto, PaperWidth: 0x28D0, PaperHeight: 0x45A4},
+		},
+		{
+			"gray simplex A4",
+			scanSettingsResponse(MarshalScanConfig(pcapToken, a4)[64:]),
+			ScanConfigState{Stored: true, ColorMode: ColorGray, Resolution: 200, PaperSize: PaperA4, PaperWidth: 0x26D0, PaperHeight: 0x36D0},
+		},
+		{
+			"color auto paper",
+			scanSettingsResponse(MarshalScanConfig(pcapToken, color)[64:]),
+			ScanConfigState{Stored: true, ColorMode: ColorColor, Resolution: 300, PaperSize: PaperAuto, PaperWidth: 0x28D0, PaperHeight: 0x45A4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScanSettings(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseScanSettings = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScanSettings_Invalid(t *testing.T) {
+	bad := buildPcapScanSettingsEmpty()
+	bad[4] = 'X'
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", buildPcapScanSettingsEmpty()[:20]},
+		{"bad magic", bad},
+		{"truncated config", scanSettingsResponse(make([]byte, 20))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseScanSettings(tt.data); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
 // --------------------------------------------------------------------------
 // Pcap-based round-trip (marshal) tests
 // --------------------------------------------------------------------------
@@ -138,6 +138,56 @@ func (s *ControlSession) CheckStatus(token [8]byte) (uint32, error) {
 	return state, nil
 }
 
+// SetWifiMode switches the scanner's Wi-Fi mode. The scanner restarts its
+// network interface to apply it, so the current session is lost and the
+// reply may never arrive; only failing to send the request is an error.
+func (s *ControlSession) SetWifiMode(token [8]byte, mode uint32) error {
+	slog.Debug("setting wifi mode...", "mode", mode)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := MarshalSetWifiMode(token, mode)
+	slog.Debug("set wifi mode request", "bytes", len(req), "hex", hex.EncodeToString(req))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("set wifi mode send: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	ack := make([]byte, 16)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		slog.Debug("set wifi mode: no response", "err", err)
+		return nil
+	}
+	slog.Debug("set wifi mode response", "bytes", len(ack), "hex", hex.EncodeToString(ack))
+	return nil
+}
+
+// SetStartMode selects what the scanner's scan button starts.
+func (s *ControlSession) SetStartMode(token [8]byte, mode uint32) error {
+	slog.Debug("setting start mode...", "mode", mode)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := MarshalSetStartMode(token, mode)
+	slog.Debug("set start mode request", "bytes", len(req), "hex", hex.EncodeToString(req))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("set start mode send: %w", err)
+	}
+
+	ack := make([]byte, 16)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		return fmt.Errorf("set start mode recv: %w", err)
+	}
+	slog.Debug("set start mode response", "bytes", len(ack), "hex", hex.EncodeToString(ack))
+	return nil
+}
+
 // Deregister removes this client from the scanner.
 func (s *ControlSession) Deregister(token [8]byte) error {
 	slog.Debug("deregistering...")
@@ -1,5 +1,10 @@
 package vens
 
+import (
+	"strings"
+	"time"
+)
+
 // ColorMode represents scan color modes.
 type ColorMode int
 
@@ -37,6 +42,10 @@ const (
 	PaperA5           PaperSize = 2
 	PaperBusinessCard PaperSize = 3
 	PaperPostcard     PaperSize = 4
+	PaperLetter       PaperSize = 5
+	PaperLegal        PaperSize = 6
+	PaperA6           PaperSize = 7
+	PaperB5           PaperSize = 8 // JIS B5
 )
 
 // PaperDimension holds paper width and height in 1/1200 inch units.
@@ -52,6 +61,46 @@ var PaperDimensions = map[PaperSize]PaperDimension{
 	PaperA5:           {0x1B50, 0x26C0}, // 148mm x 210mm
 	PaperBusinessCard: {0x28D0, 0x1274}, // auto-width x 100mm
 	PaperPostcard:     {0x1280, 0x1B50}, // 100mm x 148mm
+	PaperLetter:       {0x27D8, 0x3390}, // 8.5in x 11in (215.9mm x 279.4mm)
+	PaperLegal:        {0x27D8, 0x41A0}, // 8.5in x 14in (215.9mm x 355.6mm)
+	PaperA6:           {0x1361, 0x1B50}, // 105mm x 148mm
+	PaperB5:           {0x2196, 0x2F6E}, // 182mm x 257mm
+}
+
+// PaperSizeNames maps PaperSize to its name in the settings ("a4", ...).
+var PaperSizeNames = map[PaperSize]string{
+	PaperAuto:         "auto",
+	PaperA4:           "a4",
+	PaperA5:           "a5",
+	PaperBusinessCard: "business_card",
+	PaperPostcard:     "postcard",
+	PaperLetter:       "letter",
+	PaperLegal:        "legal",
+	PaperA6:           "a6",
+	PaperB5:           "b5",
+}
+
+// PaperSizeLabels maps PaperSize to a human-readable label.
+var PaperSizeLabels = map[PaperSize]string{
+	PaperAuto:         "Auto",
+	PaperA4:           "A4",
+	PaperA5:           "A5",
+	PaperBusinessCard: "Business Card",
+	PaperPostcard:     "Postcard",
+	PaperLetter:       "Letter",
+	PaperLegal:        "Legal",
+	PaperA6:           "A6",
+	PaperB5:           "B5 (JIS)",
+}
+
+// ParsePaperSize returns the PaperSize named name in PaperSizeNames.
+func ParsePaperSize(name string) (PaperSize, bool) {
+	for size, n := range PaperSizeNames {
+		if n == name {
+			return size, true
+		}
+	}
+	return PaperAuto, false
 }
 
 // ScanConfig holds scan parameters to send to the scanner.
@@ -67,6 +116,15 @@ type ScanConfig struct {
 	CompressionArg     byte   // JPEG compression: 0x09 (most compressed) to 0x0D (best quality); 0 = auto
 	MultiFeed          bool
 	BlankPageRemoval   bool
+	StartTimeout       time.Duration // how long to wait for the first sheet to feed; 0 = DefaultStartTimeout
+	Brightness         int    // -5 to +5; not sent to the scanner, applied to the JPEG by the host
+	Contrast           int    // -5 to +5; not sent to the scanner, applied to the JPEG by the host
+	Model              Model  // scanner model; Duplex is ignored for a model without duplex
+}
+
+// ScansDuplex reports whether the scan covers both sides of each sheet.
+func (c ScanConfig) ScansDuplex() bool {
+	return c.Duplex && c.Model.HasDuplex()
 }
 
 // DefaultScanConfig returns a ScanConfig with default values.
@@ -82,6 +140,18 @@ func DefaultScanConfig() ScanConfig {
 	}
 }
 
+// ScanConfigState is the scan configuration stored in the scanner, read back
+// with GET SCAN SETTINGS (0xD8). See ParseScanSettings.
+type ScanConfigState struct {
+	Stored      bool      // false when the scanner reports no stored settings
+	ColorMode   ColorMode // ColorAuto when color and quality are both auto
+	Resolution  int       // DPI; 0 = auto
+	Duplex      bool
+	PaperSize   PaperSize // named size matching the dimensions; PaperAuto otherwise
+	PaperWidth  uint16    // 1/1200 inch
+	PaperHeight uint16    // 1/1200 inch
+}
+
 // ScanParams holds scanner capabilities from INQUIRY VPD 0xF0 response.
 type ScanParams struct {
 	MaxResolutionX int    // DPI
@@ -93,6 +163,108 @@ type ScanParams struct {
 	MaxHeight      uint16 // 1/1200 inch (converted from 1/600 on the wire)
 }
 
+// Model identifies a ScanSnap model, see ModelFromDeviceName.
+type Model int
+
+const (
+	ModelUnknown Model = iota
+	ModelIX500
+	ModelIX1500
+	ModelIX1600
+	ModelIX100
+)
+
+var modelNames = map[Model]string{
+	ModelIX500:  "iX500",
+	ModelIX1500: "iX1500",
+	ModelIX1600: "iX1600",
+	ModelIX100:  "iX100",
+}
+
+func (m Model) String() string {
+	if name, ok := modelNames[m]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ModelFromDeviceName returns the model named in a DataDeviceInfo.DeviceName,
+// e.g. "FUJITSU ScanSnap iX1500", or ModelUnknown.
+func ModelFromDeviceName(name string) Model {
+	for _, word := range strings.Fields(name) {
+		for m, model := range modelNames {
+			if strings.EqualFold(word, model) {
+				return m
+			}
+		}
+	}
+	return ModelUnknown
+}
+
+// modelScanParams are the hardware limits of the models they are known for.
+// The iX500 values are those of its INQUIRY VPD 0xF0 response. The iX100
+// takes paper up to 216 mm wide and 863 mm long. Without captures of their
+// responses, the iX1500 and iX1600 have no entry and are handled like an
+// unknown model.
+var modelScanParams = map[Model]ScanParams{
+	ModelIX500: {MaxResolutionX: 600, MaxResolutionY: 600, MinResolutionX: 50, MinResolutionY: 50, MaxWidth: 0x28D0, MaxHeight: 0xA1D0},
+	ModelIX100: {MaxResolutionX: 600, MaxResolutionY: 600, MinResolutionX: 50, MinResolutionY: 50, MaxWidth: 0x27D8, MaxHeight: 0x9F60},
+}
+
+// ADFCapacity is the number of sheets the document feeder of the ADF models
+// holds.
+const ADFCapacity = 50
+
+// HasDuplex reports whether model m scans both sides of a sheet in one
+// pass. The iX100 is simplex only; unknown models are taken to be like the
+// iX500.
+func (m Model) HasDuplex() bool {
+	return m != ModelIX100
+}
+
+// FeederCapacity returns the number of sheets model m takes at once: one
+// for the sheet-fed iX100, ADFCapacity otherwise.
+func (m Model) FeederCapacity() int {
+	if m == ModelIX100 {
+		return 1
+	}
+	return ADFCapacity
+}
+
+// Plausible resolutions in a scan params response. Values outside are taken
+// as a VPD layout that differs from the iX500's.
+const (
+	minPlausibleDPI = 50
+	maxPlausibleDPI = 1200
+)
+
+// CompleteScanParams returns p with the resolutions and scan area that are
+// missing or out of range replaced by the limits of model m. p may be nil,
+// e.g. when the scanner did not answer the request; for a model without
+// known limits p is returned unchanged.
+func (m Model) CompleteScanParams(p *ScanParams) *ScanParams {
+	def, ok := modelScanParams[m]
+	if !ok {
+		return p
+	}
+	if p == nil {
+		return &def
+	}
+	out := *p
+	plausible := func(dpi int) bool { return dpi >= minPlausibleDPI && dpi <= maxPlausibleDPI }
+	if !plausible(out.MaxResolutionX) || !plausible(out.MaxResolutionY) {
+		out.MaxResolutionX, out.MaxResolutionY = def.MaxResolutionX, def.MaxResolutionY
+	}
+	if !plausible(out.MinResolutionX) || !plausible(out.MinResolutionY) ||
+		out.MinResolutionX > out.MaxResolutionX || out.MinResolutionY > out.MaxResolutionY {
+		out.MinResolutionX, out.MinResolutionY = def.MinResolutionX, def.MinResolutionY
+	}
+	if out.MaxWidth == 0 || out.MaxHeight == 0 {
+		out.MaxWidth, out.MaxHeight = def.MaxWidth, def.MaxHeight
+	}
+	return &out
+}
+
 // PixelSizeInfo holds the actual pixel dimensions of a scanned page,
 // returned by READ(10) with DataType=0x80.
 type PixelSizeInfo struct {
@@ -105,7 +277,8 @@ type PixelSizeInfo struct {
 
 // DataDeviceInfo holds device identity from TCP GET_SET sub=0x12 response.
 type DataDeviceInfo struct {
-	DeviceName       string
+	DeviceName       string // manufacturer and model, single-spaced (e.g. "FUJITSU ScanSnap iX500")
+	Manufacturer     string // leading vendor word (e.g. "FUJITSU"); "" when the name starts with the model
 	FirmwareRevision string // extracted from device name suffix (e.g. "0M00")
 }
 
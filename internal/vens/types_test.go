@@ -1,6 +1,9 @@
 package vens
 
-import "testing"
+import (
+	"encoding/binary"
+	"testing"
+)
 
 func TestDefaultScanConfig(t *testing.T) {
 	cfg := DefaultScanConfig()
@@ -115,7 +118,7 @@ func TestPaperSizeConstants(t *testing.T) {
 
 func TestPaperDimensions(t *testing.T) {
 	// Verify all declared paper sizes have dimensions
-	expected := []PaperSize{PaperAuto, PaperA4, PaperA5, PaperBusinessCard, PaperPostcard}
+	expected := []PaperSize{PaperAuto, PaperA4, PaperA5, PaperBusinessCard, PaperPostcard, PaperLetter, PaperLegal, PaperA6, PaperB5}
 	for _, ps := range expected {
 		dim, ok := PaperDimensions[ps]
 		if !ok {
@@ -143,6 +146,10 @@ func TestPaperDimensions_SpecificValues(t *testing.T) {
 		{"PaperA5", PaperA5, 0x1B50, 0x26C0},
 		{"PaperBusinessCard", PaperBusinessCard, 0x28D0, 0x1274},
 		{"PaperPostcard", PaperPostcard, 0x1280, 0x1B50},
+		{"PaperLetter", PaperLetter, 0x27D8, 0x3390},
+		{"PaperLegal", PaperLegal, 0x27D8, 0x41A0},
+		{"PaperA6", PaperA6, 0x1361, 0x1B50},
+		{"PaperB5", PaperB5, 0x2196, 0x2F6E},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -175,6 +182,32 @@ func TestPaperDimensions_A4Millimeters(t *testing.T) {
 	}
 }
 
+// TestPaperDimensions_A6B5Millimeters verifies A6 (105mm × 148mm) and
+// JIS B5 (182mm × 257mm) match their physical sizes.
+func TestPaperDimensions_A6B5Millimeters(t *testing.T) {
+	tests := []struct {
+		name              string
+		ps                PaperSize
+		widthMM, heightMM float64
+	}{
+		{"A6", PaperA6, 105, 148},
+		{"B5", PaperB5, 182, 257},
+	}
+	for _, tt := range tests {
+		dim := PaperDimensions[tt.ps]
+		widthMM := float64(dim.Width) * 25.4 / 1200.0
+		heightMM := float64(dim.Height) * 25.4 / 1200.0
+
+		// allow 1mm tolerance
+		if widthMM < tt.widthMM-1 || widthMM > tt.widthMM+1 {
+			t.Errorf("%s width = %.1fmm, want ~%.0fmm", tt.name, widthMM, tt.widthMM)
+		}
+		if heightMM < tt.heightMM-1 || heightMM > tt.heightMM+1 {
+			t.Errorf("%s height = %.1fmm, want ~%.0fmm", tt.name, heightMM, tt.heightMM)
+		}
+	}
+}
+
 func TestScanErrorKindConstants(t *testing.T) {
 	// Verify ScanErrorKind iota values
 	if ScanErrGeneric != 0 {
@@ -200,3 +233,70 @@ func TestScanError_Error(t *testing.T) {
 		t.Errorf("Error() = %q, want %q", err.Error(), "paper jam")
 	}
 }
+
+func TestModelFromDeviceName(t *testing.T) {
+	tests := []struct {
+		name string
+		want Model
+	}{
+		{"FUJITSU ScanSnap iX500", ModelIX500},
+		{"ScanSnap iX500", ModelIX500},
+		{"FUJITSU ScanSnap iX1500", ModelIX1500},
+		{"PFU ScanSnap IX1600", ModelIX1600},
+		{"FUJITSU ScanSnap iX100", ModelIX100},
+		{"FUJITSU ScanSnap S1300i", ModelUnknown},
+		{"", ModelUnknown},
+	}
+	for _, tt := range tests {
+		if got := ModelFromDeviceName(tt.name); got != tt.want {
+			t.Errorf("ModelFromDeviceName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if ModelIX100.HasDuplex() || ModelIX100.FeederCapacity() != 1 {
+		t.Errorf("iX100: HasDuplex() = %v, FeederCapacity() = %d, want simplex with 1 sheet", ModelIX100.HasDuplex(), ModelIX100.FeederCapacity())
+	}
+	if !ModelUnknown.HasDuplex() || ModelUnknown.FeederCapacity() != ADFCapacity {
+		t.Errorf("unknown model: HasDuplex() = %v, FeederCapacity() = %d, want the ADF defaults", ModelUnknown.HasDuplex(), ModelUnknown.FeederCapacity())
+	}
+}
+
+func TestCompleteScanParams(t *testing.T) {
+	// The iX500 response is kept as reported
+	reported, err := ParseScanParams(buildPcapScanParamsResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ModelIX500.CompleteScanParams(reported); *got != *reported {
+		t.Errorf("iX500: %+v, want the reported %+v", *got, *reported)
+	}
+
+	// A response without the values at the iX500 offsets takes the model's limits
+	data := make([]byte, 184)
+	copy(data[4:8], Magic[:])
+	data[49] = 0x11
+	binary.BigEndian.PutUint16(data[45:47], 0xFFFF) // out of range
+	params, err := ParseScanParams(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ModelIX500.CompleteScanParams(params)
+	if got.MaxResolutionX != 600 || got.MinResolutionX != 50 || got.MaxWidth != 0x28D0 || got.MaxHeight != 0xA1D0 {
+		t.Errorf("iX500: %+v, want the iX500 limits", *got)
+	}
+	if got.ColorModes != 0x11 {
+		t.Errorf("iX500: ColorModes = 0x%02X, want the reported 0x11", got.ColorModes)
+	}
+	if *params == *got {
+		t.Error("CompleteScanParams modified its argument")
+	}
+
+	if got := ModelIX100.CompleteScanParams(nil); got == nil || got.MaxWidth != 0x27D8 || got.MaxHeight != 0x9F60 {
+		t.Errorf("iX100 without a response: %+v, want the iX100 limits", got)
+	}
+	// Models without captured limits keep what the scanner reported
+	for _, m := range []Model{ModelUnknown, ModelIX1500, ModelIX1600} {
+		if got := m.CompleteScanParams(params); got != params {
+			t.Errorf("%v: %+v, want the response unchanged", m, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package webui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// redacted replaces secrets in the debug bundle.
+const redacted = "REDACTED"
+
+// LogBuffer is an io.Writer that keeps the last lines written to it, so the
+// debug bundle can include recent log output.
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int // index of the oldest line once the buffer is full
+	max   int
+}
+
+// NewLogBuffer returns a LogBuffer holding up to max lines.
+func NewLogBuffer(max int) *LogBuffer {
+	return &LogBuffer{max: max}
+}
+
+// Write records each complete line of p. slog handlers write one record per
+// call.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimRight(line, "\n")
+		if len(b.lines) < b.max {
+			b.lines = append(b.lines, string(line))
+			continue
+		}
+		if b.max > 0 {
+			b.lines[b.next] = string(line)
+			b.next = (b.next + 1) % b.max
+		}
+	}
+	return len(p), nil
+}
+
+// Lines returns the buffered lines, oldest first.
+func (b *LogBuffer) Lines() []string {
+	if b == nil {
+		return []string{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// debugBundle collects everything a bug report needs in one document.
+type debugBundle struct {
+	Version      string                        `json:"version"`
+	CreatedAt    string                        `json:"createdAt"`
+	Config       config.Settings               `json:"config"` // secrets redacted
+	Status       statusResponse                `json:"status"`
+	ScanParams   *vens.ScanParams              `json:"scanParams"` // nil until the scanner was connected
+	Capabilities *abstract.ScannerCapabilities `json:"capabilities"`
+	Logs         []string                      `json:"logs"`
+}
+
+// redactSettings blanks out the passwords, tokens and keys of s. Empty
+// values stay empty so the bundle still shows which are unset.
+//
+// Webhook and push URLs keep only their scheme and host: Slack, Discord
+// and Home Assistant webhook URLs carry their token in the path, and an
+// ntfy topic URL works as a password.
+func redactSettings(s config.Settings) config.Settings {
+	s = maskSecrets(s, redacted)
+	s.WebhookURL = redactURL(s.WebhookURL)
+	s.PushURL = redactURL(s.PushURL)
+	return s
+}
+
+// redactURL replaces the user info, path, query and fragment of raw with
+// redacted. A value that does not parse as an absolute URL is redacted
+// whole.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// --- Debug API ---
+
+// handleDebugBundle returns the redacted settings, the current status, the
+// scanner capabilities and recent log lines as a JSON attachment to add to
+// bug reports.
+func (h *handler) handleDebugBundle(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	bundle := debugBundle{
+		Version:      h.version,
+		CreatedAt:    now.Format(time.RFC3339),
+		Config:       redactSettings(h.settings.Get()),
+		Status:       h.status(),
+		ScanParams:   h.sc.ScanParams(),
+		Capabilities: h.adapter.Capabilities(),
+		Logs:         h.logs.Lines(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="airscap-debug-%s.json"`, now.Format("20060102-150405")))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(bundle)
+}
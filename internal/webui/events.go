@@ -0,0 +1,161 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+// scanEventBacklog is how many page events are replayed to a subscriber that
+// connects after the scan started.
+const scanEventBacklog = 64
+
+// scanEvent reports a page received from the scanner.
+type scanEvent struct {
+	Sheet int    `json:"sheet"` // 1-based physical sheet number
+	Side  string `json:"side"`  // "front" or "back"
+	Bytes int    `json:"bytes"`
+}
+
+// scanEnd is sent as the last event of a scan.
+type scanEnd struct {
+	Pages int    `json:"pages"`
+	Error string `json:"error,omitempty"`
+}
+
+// scanEvents fans out page events of the running scan to SSE subscribers.
+// The last scanEventBacklog events are kept in a ring buffer so late
+// subscribers catch up.
+type scanEvents struct {
+	mu       sync.Mutex
+	ring     [scanEventBacklog]scanEvent
+	next     int // ring index of the next event
+	count    int // events received in this scan
+	scanning bool
+	end      scanEnd
+	subs     map[chan scanEvent]struct{}
+}
+
+// start begins a new scan, dropping the events of the previous one.
+func (e *scanEvents) start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.next, e.count = 0, 0
+	e.scanning = true
+	e.end = scanEnd{}
+}
+
+// page records a received page and passes it on to the subscribers. A
+// subscriber that falls behind misses the event.
+func (e *scanEvents) page(p vens.Page) {
+	ev := scanEvent{Sheet: p.Sheet + 1, Side: "front", Bytes: len(p.JPEG)}
+	if p.Side == 1 {
+		ev.Side = "back"
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ring[e.next] = ev
+	e.next = (e.next + 1) % scanEventBacklog
+	e.count++
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// finish ends the scan and closes the subscriber channels.
+func (e *scanEvents) finish(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scanning = false
+	e.end = scanEnd{Pages: e.count}
+	if err != nil {
+		e.end.Error = err.Error()
+	}
+	for ch := range e.subs {
+		close(ch)
+	}
+	e.subs = nil
+}
+
+// subscribe returns the buffered events of the current or last scan and, if
+// a scan is running, a channel receiving its further events that is closed
+// when it finishes.
+func (e *scanEvents) subscribe() ([]scanEvent, chan scanEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := min(e.count, scanEventBacklog)
+	backlog := make([]scanEvent, 0, n)
+	for i := range n {
+		backlog = append(backlog, e.ring[(e.next-n+i+scanEventBacklog)%scanEventBacklog])
+	}
+	if !e.scanning {
+		return backlog, nil
+	}
+	ch := make(chan scanEvent, scanEventBacklog)
+	if e.subs == nil {
+		e.subs = make(map[chan scanEvent]struct{})
+	}
+	e.subs[ch] = struct{}{}
+	return backlog, ch
+}
+
+func (e *scanEvents) unsubscribe(ch chan scanEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.subs[ch]; ok {
+		delete(e.subs, ch)
+		close(ch)
+	}
+}
+
+func (e *scanEvents) result() scanEnd {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.end
+}
+
+// handleScanEvents streams the page events of the running preview scan as
+// Server-Sent Events. Events already received are sent first; an "end"
+// event with the page count and error closes the stream.
+func (h *handler) handleScanEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	backlog, ch := h.events.subscribe()
+	if ch != nil {
+		defer h.events.unsubscribe(ch)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, ev := range backlog {
+		writeEvent(w, "page", ev)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for ch != nil {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				ch = nil
+				break
+			}
+			writeEvent(w, "page", ev)
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeEvent(w, "end", h.events.result())
+}
+
+func writeEvent(w http.ResponseWriter, name string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
@@ -2,18 +2,31 @@ package webui
 
 import (
 	"bytes"
+	"cmp"
 	"embed"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
+	"io"
 	"io/fs"
 	"log/slog"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/OpenPrinting/go-mfp/abstract"
+
 	"github.com/mzyy94/airscap/internal/config"
 	"github.com/mzyy94/airscap/internal/scanner"
 	"github.com/mzyy94/airscap/internal/vens"
@@ -31,31 +44,75 @@ type handler struct {
 	scanStatus *scanner.ScanJobStatus // nil when button listener is disabled
 	version    string
 	scanMu     *sync.Mutex // shared with button listener for scan exclusion
+	logs       *LogBuffer  // recent log lines for the debug bundle; may be nil
+	// POST /api/scan is served only behind the UI password, since it sends
+	// a scan to any URL the caller names
+	scanToURLAllowed bool
+
+	scanPages func(vens.ScanConfig, func(vens.Page)) ([]vens.Page, error) // preview scan; replaced in tests
+	// ad-hoc scan to a URL; replaced in tests
+	scanToURL func(cfg vens.ScanConfig, dest, authorization string, s config.Settings) (int, error)
+	preview   previewCache
+	events    scanEvents
 }
 
-// NewHandler creates an HTTP handler for the Web UI.
-func NewHandler(sc *scanner.Scanner, adapter *scanner.ESCLAdapter, listenPort int, settings *config.Store, scanStatus *scanner.ScanJobStatus, version string, scanMu *sync.Mutex) http.Handler {
-	h := &handler{adapter: adapter, sc: sc, listenPort: listenPort, settings: settings, scanStatus: scanStatus, version: version, scanMu: scanMu}
+// NewHandler creates an HTTP handler for the Web UI. passwordProtected tells
+// whether the handler is served behind the UI password; without it the
+// ad-hoc scan to a URL is refused.
+func NewHandler(sc *scanner.Scanner, adapter *scanner.ESCLAdapter, listenPort int, settings *config.Store, scanStatus *scanner.ScanJobStatus, version string, scanMu *sync.Mutex, logs *LogBuffer, passwordProtected bool) http.Handler {
+	h := &handler{adapter: adapter, sc: sc, listenPort: listenPort, settings: settings, scanStatus: scanStatus, version: version, scanMu: scanMu, logs: logs, scanToURLAllowed: passwordProtected}
+	h.scanPages = func(cfg vens.ScanConfig, onPage func(vens.Page)) ([]vens.Page, error) {
+		if !sc.Online() && !sc.Sleeping() {
+			return nil, errScannerOffline
+		}
+		return sc.Scan(cfg, onPage)
+	}
+	h.scanToURL = func(cfg vens.ScanConfig, dest, authorization string, s config.Settings) (int, error) {
+		if !sc.Online() && !sc.Sleeping() {
+			return 0, errScannerOffline
+		}
+		return scanner.RunURLJob(sc, cfg, dest, authorization, s, nil)
+	}
 	mux := http.NewServeMux()
 	staticContent, _ := fs.Sub(staticFS, "static")
 	mux.HandleFunc("GET /api/status", h.handleStatus)
 	mux.HandleFunc("GET /api/settings", h.handleGetSettings)
 	mux.HandleFunc("PUT /api/settings", h.handlePutSettings)
+	mux.HandleFunc("GET /api/profiles", h.handleGetProfiles)
+	mux.HandleFunc("PUT /api/profiles", h.handlePutProfiles)
+	mux.HandleFunc("GET /api/destination", h.handleGetDestination)
+	mux.HandleFunc("PUT /api/destination", h.handlePutDestination)
+	mux.HandleFunc("GET /api/papersizes", h.handlePaperSizes)
+	mux.HandleFunc("POST /api/scanner/refresh-capabilities", h.handleRefreshCapabilities)
+	mux.HandleFunc("POST /api/scanner/wifi-mode", h.handleSetWifiMode)
+	mux.HandleFunc("GET /api/discover", h.handleDiscover)
 	mux.HandleFunc("GET /api/scan/status", h.handleScanStatus)
+	mux.HandleFunc("GET /api/scan/download", h.handleScanDownload)
+	mux.HandleFunc("GET /api/scan/history", h.handleScanHistory)
+	mux.HandleFunc("GET /api/files", h.handleListFiles)
+	mux.HandleFunc("GET /api/files/{name}", h.handleDownloadFile)
+	mux.HandleFunc("POST /api/scan", h.handleScanToURL)
 	mux.HandleFunc("POST /api/scan/preview", h.handleScanPreview)
+	mux.HandleFunc("POST /api/scan/commit", h.handleScanCommit)
+	mux.HandleFunc("GET /api/scan/events", h.handleScanEvents)
+	mux.HandleFunc("GET /api/debug/bundle", h.handleDebugBundle)
 	mux.Handle("GET /", http.FileServer(http.FS(staticContent)))
 	return mux
 }
 
 type statusResponse struct {
-	Online    bool       `json:"online"`
-	State     string     `json:"state"`
-	ADF       *adfStatus `json:"adf,omitempty"`
-	Device    deviceInfo `json:"device"`
-	Caps      capsInfo   `json:"capabilities"`
-	ESCLUrl   string     `json:"esclUrl"`
-	UpdatedAt string     `json:"updatedAt"`
-	Version   string     `json:"version"`
+	Online      bool            `json:"online"`
+	State       string          `json:"state"`
+	ADF         *adfStatus      `json:"adf,omitempty"`
+	Device      deviceInfo      `json:"device"`
+	Reservation reservationInfo `json:"reservation"`
+	Eco         string          `json:"eco"` // eco mode state: "off", "active", "idle" or "released"
+	Caps        capsInfo        `json:"capabilities"`
+	ESCLUrl     string          `json:"esclUrl"`
+	UpdatedAt   string          `json:"updatedAt"`
+	Version     string          `json:"version"`
+	WifiMode    bool            `json:"wifiModeSwitch"`   // the experimental Wi-Fi mode switch is enabled
+	StartMode   bool            `json:"startModeControl"` // the experimental start mode setting is enabled
 }
 
 type adfStatus struct {
@@ -63,6 +120,22 @@ type adfStatus struct {
 	Error  string `json:"error,omitempty"` // "jam", "hatchOpen", "multiFeed", "error", or ""
 }
 
+// adfErrorString maps a scan error kind to the adfStatus.Error value.
+// No paper and no error (-1) are not error states and map to "".
+func adfErrorString(kind vens.ScanErrorKind) string {
+	switch kind {
+	case vens.ScanErrPaperJam:
+		return "jam"
+	case vens.ScanErrCoverOpen:
+		return "hatchOpen"
+	case vens.ScanErrMultiFeed:
+		return "multiFeed"
+	case vens.ScanErrGeneric:
+		return "error"
+	}
+	return ""
+}
+
 type deviceInfo struct {
 	Name             string `json:"name"`
 	Serial           string `json:"serial"`
@@ -71,17 +144,49 @@ type deviceInfo struct {
 	WifiState        string `json:"wifiState"` // "strong", "normal", "weak", "disconnected", or "unknown"
 }
 
+type reservationInfo struct {
+	State    string `json:"state"`              // "held" (by AirScap), "other", "free", or "unknown"
+	ClientIP string `json:"clientIp,omitempty"` // client holding the reservation when State is "other"
+}
+
+// reservationStatus maps the connection state and the pairing state from
+// discovery to a reservationInfo. localIP is the address AirScap uses on the
+// scanner's network; an online session always holds the reservation.
+func reservationStatus(online, known, paired bool, clientIP, localIP string) reservationInfo {
+	switch {
+	case online:
+		return reservationInfo{State: "held"}
+	case !known:
+		return reservationInfo{State: "unknown"}
+	case !paired:
+		return reservationInfo{State: "free"}
+	case clientIP == localIP:
+		return reservationInfo{State: "held"}
+	}
+	return reservationInfo{State: "other", ClientIP: clientIP}
+}
+
 type capsInfo struct {
 	Resolutions []int    `json:"resolutions"`
 	ColorModes  []string `json:"colorModes"`
 	Duplex      bool     `json:"duplex"`
 	Formats     []string `json:"formats"`
+	WebP        bool     `json:"webp"` // FormatWebP pages are encoded as WebP, not saved as JPEG
 }
 
 func (h *handler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.status())
+}
+
+// status reports the scanner state shown on the status page.
+func (h *handler) status() statusResponse {
 	online := h.sc.Online()
 	state := "idle"
-	if !online {
+	eco := h.sc.EcoState()
+	if eco == scanner.EcoReleased {
+		state = "sleeping"
+	} else if !online {
 		state = "offline"
 	}
 
@@ -95,41 +200,27 @@ func (h *handler) handleStatus(w http.ResponseWriter, r *http.Request) {
 			FirmwareRevision: h.sc.FirmwareRevision(),
 			WifiState:        wifiStateString(h.sc.WifiState()),
 		},
+		Eco:       eco,
 		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 		Version:   h.version,
+		WifiMode:  h.sc.WifiModeSwitch(),
+		StartMode: h.sc.StartModeControl(),
 	}
+	localIP := vens.GetLocalIP(h.sc.Host())
+	paired, clientIP, known := h.sc.Pairing()
+	resp.Reservation = reservationStatus(online, known, paired, clientIP, localIP)
 
 	if online {
 		hasPaper, err := h.adapter.CheckADFStatus()
 		if err == nil {
-			adf := &adfStatus{Loaded: hasPaper}
-			switch h.adapter.LastErrorKind() {
-			case vens.ScanErrPaperJam:
-				adf.Error = "jam"
-			case vens.ScanErrCoverOpen:
-				adf.Error = "hatchOpen"
-			case vens.ScanErrMultiFeed:
-				adf.Error = "multiFeed"
-			case vens.ScanErrGeneric:
-				adf.Error = "error"
-			}
+			adf := &adfStatus{Loaded: hasPaper, Error: adfErrorString(h.adapter.LastErrorKind())}
 			if adf.Error != "" {
 				resp.State = "error"
 			}
 			resp.ADF = adf
 		} else {
 			// CheckADFStatus failed; still report cached error state
-			adf := &adfStatus{}
-			switch h.adapter.LastErrorKind() {
-			case vens.ScanErrPaperJam:
-				adf.Error = "jam"
-			case vens.ScanErrCoverOpen:
-				adf.Error = "hatchOpen"
-			case vens.ScanErrMultiFeed:
-				adf.Error = "multiFeed"
-			case vens.ScanErrGeneric:
-				adf.Error = "error"
-			}
+			adf := &adfStatus{Error: adfErrorString(h.adapter.LastErrorKind())}
 			if adf.Error != "" {
 				resp.State = "error"
 				resp.ADF = adf
@@ -143,20 +234,199 @@ func (h *handler) handleStatus(w http.ResponseWriter, r *http.Request) {
 		ColorModes:  []string{"auto", "color", "grayscale", "bw"},
 		Duplex:      caps.ADFDuplex != nil,
 		Formats:     caps.DocumentFormats,
+		WebP:        scanner.WebPAvailable(),
 	}
 
-	localIP := vens.GetLocalIP(h.sc.Host())
-	resp.ESCLUrl = fmt.Sprintf("http://%s:%d/eSCL", localIP, h.listenPort)
+	resp.ESCLUrl = fmt.Sprintf("http://%s/eSCL", net.JoinHostPort(localIP, strconv.Itoa(h.listenPort)))
+	return resp
+}
+
+// --- Capability Refresh API ---
+
+type capsSummary struct {
+	MaxResolution int `json:"maxResolution"`
+	MaxWidthMM    int `json:"maxWidthMm"`
+	MaxHeightMM   int `json:"maxHeightMm"`
+}
+
+func summarizeCaps(caps *abstract.ScannerCapabilities) capsSummary {
+	if caps == nil || caps.ADFSimplex == nil {
+		return capsSummary{}
+	}
+	in := caps.ADFSimplex
+	return capsSummary{
+		MaxResolution: in.MaxOpticalXResolution,
+		MaxWidthMM:    int(in.MaxWidth / abstract.Millimeter),
+		MaxHeightMM:   int(in.MaxHeight / abstract.Millimeter),
+	}
+}
+
+func (h *handler) handleRefreshCapabilities(w http.ResponseWriter, r *http.Request) {
+	if !h.scanMu.TryLock() {
+		writeJSONError(w, http.StatusConflict, "scan_in_progress")
+		return
+	}
+	defer h.scanMu.Unlock()
+
+	if !h.sc.Online() {
+		writeJSONError(w, http.StatusServiceUnavailable, "scanner_offline")
+		return
+	}
+
+	before, after, err := h.adapter.RefreshCapabilities()
+	if err != nil {
+		slog.Warn("capability refresh failed", "err", err)
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]capsSummary{
+		"before": summarizeCaps(before),
+		"after":  summarizeCaps(after),
+	})
+}
+
+// --- Wi-Fi Mode API ---
+
+// wifiModes maps the mode names accepted by the Wi-Fi mode API to
+// SET_WIFI_MODE values.
+var wifiModes = map[string]uint32{
+	"infrastructure": vens.WifiModeInfrastructure,
+	"direct":         vens.WifiModeDirect,
+}
+
+// wifiModeWarning is returned with every mode switch: the scanner drops the
+// session to apply it.
+const wifiModeWarning = "The scanner drops the connection to switch modes. AirScap reconnects once it is back on the network; in direct mode that requires switching back on the scanner."
 
+func (h *handler) handleSetWifiMode(w http.ResponseWriter, r *http.Request) {
+	if !h.sc.WifiModeSwitch() {
+		writeJSONError(w, http.StatusForbidden, "wifi_mode_disabled")
+		return
+	}
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	mode, ok := wifiModes[req.Mode]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid_mode")
+		return
+	}
+
+	if !h.scanMu.TryLock() {
+		writeJSONError(w, http.StatusConflict, "scan_in_progress")
+		return
+	}
+	defer h.scanMu.Unlock()
+
+	if !h.sc.Online() {
+		writeJSONError(w, http.StatusServiceUnavailable, "scanner_offline")
+		return
+	}
+	if err := h.sc.SetWifiMode(mode); err != nil {
+		slog.Warn("wifi mode switch failed", "mode", req.Mode, "err", err)
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"mode":    req.Mode,
+		"warning": wifiModeWarning,
+	})
+}
+
+// --- Discovery API ---
+
+// discoverTimeout is how long the discovery API listens for scanners.
+var discoverTimeout = 3 * time.Second
+
+type discoveredScanner struct {
+	Name     string `json:"name"`
+	Serial   string `json:"serial"`
+	IP       string `json:"ip"`
+	MAC      string `json:"mac"`
+	Paired   bool   `json:"paired"`
+	ClientIP string `json:"clientIp,omitempty"` // client the scanner is paired with
+	Current  bool   `json:"current"`            // the scanner AirScap is set up for
+}
+
+// handleDiscover lists the scanners on the local network, so the one to use
+// can be picked when there are several.
+func (h *handler) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	found, err := h.sc.DiscoverAll(r.Context(), discoverTimeout)
+	if err != nil {
+		slog.Warn("scanner discovery failed", "err", err)
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	scanners := make([]discoveredScanner, len(found))
+	for i, d := range found {
+		scanners[i] = discoveredScanner{
+			Name:     strings.TrimSpace(d.Name),
+			Serial:   d.Serial,
+			IP:       d.DeviceIP,
+			MAC:      d.MAC,
+			Paired:   d.Paired,
+			ClientIP: d.ClientIP,
+			Current:  d.DeviceIP == h.sc.Host(),
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(map[string]any{"scanners": scanners})
 }
 
 // --- Settings API ---
 
+// secretMask replaces the secrets that are set in the settings API
+// responses. A PUT that sends it back keeps the stored secret.
+const secretMask = "********"
+
+// secretFields returns the passwords, tokens and keys of s.
+func secretFields(s *config.Settings) []*string {
+	return []*string{
+		&s.FTPPassword,
+		&s.PaperlessToken,
+		&s.SMBPassword,
+		&s.SFTPPassword,
+		&s.SMTPPassword,
+		&s.S3AccessKey,
+		&s.S3SecretKey,
+		&s.PushToken,
+	}
+}
+
+// maskSecrets replaces the secrets of s that are set with mask. Empty
+// values stay empty so clients can tell which are unset.
+func maskSecrets(s config.Settings, mask string) config.Settings {
+	for _, v := range secretFields(&s) {
+		if *v != "" {
+			*v = mask
+		}
+	}
+	return s
+}
+
+// keepMaskedSecrets restores the secrets of s that a client sent back as
+// secretMask from the stored settings old.
+func keepMaskedSecrets(s *config.Settings, old config.Settings) {
+	olds := secretFields(&old)
+	for i, v := range secretFields(s) {
+		if *v == secretMask {
+			*v = *olds[i]
+		}
+	}
+}
+
 func (h *handler) handleGetSettings(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(h.settings.Get())
+	json.NewEncoder(w).Encode(maskSecrets(h.settings.Get(), secretMask))
 }
 
 func (h *handler) handlePutSettings(w http.ResponseWriter, r *http.Request) {
@@ -165,13 +435,208 @@ func (h *handler) handlePutSettings(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !scanner.ValidStartMode(s.StartMode) {
+		http.Error(w, "unknown start mode", http.StatusBadRequest)
+		return
+	}
+	keepMaskedSecrets(&s, h.settings.Get())
 	if err := h.settings.Update(s); err != nil {
 		slog.Warn("settings save failed", "err", err)
 		http.Error(w, "failed to save settings", http.StatusInternalServerError)
 		return
 	}
+	h.preview.clear()
+	h.applyScannerSettings(s)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maskSecrets(s, secretMask))
+}
+
+// scanConfig returns the scan config of an interactive scan with settings s
+// on the connected scanner.
+func (h *handler) scanConfig(s config.Settings) vens.ScanConfig {
+	cfg := scanner.SettingsToScanConfig(s)
+	cfg.StartTimeout = scanner.InteractiveStartTimeout
+	if h.sc != nil {
+		cfg.Model = h.sc.Model()
+	}
+	return cfg
+}
+
+// applyScannerSettings passes the settings kept by the scanner itself on to
+// it after they changed.
+func (h *handler) applyScannerSettings(s config.Settings) {
+	if h.sc == nil {
+		return
+	}
+	if err := h.sc.SetStartMode(s.StartMode); err != nil {
+		slog.Warn("set start mode failed", "mode", s.StartMode, "err", err)
+	}
+	h.sc.SetEcoMode(scanner.EcoIdleTimeout(s))
+	h.sc.SetBlankThreshold(s.BlankThreshold)
+}
+
+// --- Profiles API ---
+
+func (h *handler) handleGetProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.settings.Profiles())
+}
+
+// handlePutProfiles replaces the profile list: listed names that do not
+// exist yet are created from the active profile, missing ones are deleted,
+// and the active and button profiles are selected.
+func (h *handler) handlePutProfiles(w http.ResponseWriter, r *http.Request) {
+	var p config.ProfileList
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	active := h.settings.Profiles().Active
+	if err := h.settings.SetProfiles(p); err != nil {
+		if errors.Is(err, config.ErrNoProfiles) || errors.Is(err, config.ErrProfileName) ||
+			errors.Is(err, config.ErrNoActiveProfile) || errors.Is(err, config.ErrNoButtonProfile) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Warn("settings save failed", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	if p.Active != active {
+		slog.Info("scan profile selected", "profile", p.Active)
+		h.preview.clear()
+		h.applyScannerSettings(h.settings.Get())
+	}
+	h.handleGetProfiles(w, r)
+}
+
+// --- Destination API ---
+
+// destinationFields lists the settings (by JSON name) that configure each
+// save destination.
+var destinationFields = map[string][]string{
+	"none":      nil,
+	"local":     {"savePath"},
+	"ftp":       {"ftpHost", "ftpUser", "ftpPassword"},
+	"sftp":      {"sftpHost", "sftpUser", "sftpPassword", "sftpKeyPath", "sftpPath", "sftpKnownHosts", "sftpInsecureIgnoreHostKey"},
+	"paperless": {"paperlessUrl", "paperlessToken"},
+	"smb":       {"smbHost", "smbShare", "smbUser", "smbPassword", "smbPath"},
+	"email":     {"smtpHost", "smtpPort", "smtpUser", "smtpPassword", "smtpFrom", "smtpTo", "smtpUseTls"},
+	"s3":        {"s3Endpoint", "s3Bucket", "s3Region", "s3AccessKey", "s3SecretKey", "s3Prefix", "s3UsePathStyle"},
+	"fifo":      {"fifoPath"},
+}
+
+// destinationRequest is the body of GET and PUT /api/destination: the save
+// type and the settings of that destination only.
+type destinationRequest struct {
+	SaveType    string                     `json:"saveType"`
+	Destination map[string]json.RawMessage `json:"destination"`
+}
+
+// destinationOf returns the save type of s with its destination settings,
+// secrets masked.
+func destinationOf(s config.Settings) destinationRequest {
+	all := map[string]json.RawMessage{}
+	data, _ := json.Marshal(maskSecrets(s, secretMask))
+	json.Unmarshal(data, &all)
+	d := destinationRequest{SaveType: s.SaveType, Destination: map[string]json.RawMessage{}}
+	for _, f := range destinationFields[s.SaveType] {
+		d.Destination[f] = all[f]
+	}
+	return d
+}
+
+func (h *handler) handleGetDestination(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(destinationOf(h.settings.Get()))
+}
+
+// handlePutDestination switches the save destination, optionally updating
+// its settings, and leaves all other settings alone. A destination that is
+// not fully configured afterwards is rejected.
+func (h *handler) handlePutDestination(w http.ResponseWriter, r *http.Request) {
+	var req destinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	fields, ok := destinationFields[req.SaveType]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid_save_type")
+		return
+	}
+	for name := range req.Destination {
+		if !slices.Contains(fields, name) {
+			writeJSONError(w, http.StatusBadRequest, "unknown field for "+req.SaveType+": "+name)
+			return
+		}
+	}
+
+	old := h.settings.Get()
+	s := old
+	s.SaveType = req.SaveType
+	if len(req.Destination) > 0 {
+		data, _ := json.Marshal(req.Destination)
+		if err := json.Unmarshal(data, &s); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid destination: "+err.Error())
+			return
+		}
+		keepMaskedSecrets(&s, old)
+	}
+	if err := scanner.CheckDestination(s); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := h.settings.Update(s); err != nil {
+		slog.Warn("settings save failed", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	slog.Info("save destination changed", "saveType", s.SaveType)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(destinationOf(s))
+}
+
+// --- Paper Sizes API ---
+
+type paperSizeInfo struct {
+	Name     string  `json:"name"` // value of the paperSize setting
+	Label    string  `json:"label"`
+	Width    uint16  `json:"width"`  // 1/1200 inch
+	Height   uint16  `json:"height"` // 1/1200 inch
+	WidthMM  float64 `json:"widthMm"`
+	HeightMM float64 `json:"heightMm"`
+}
+
+// paperSizes lists vens.PaperDimensions ordered by PaperSize.
+func paperSizes() []paperSizeInfo {
+	sizes := make([]vens.PaperSize, 0, len(vens.PaperDimensions))
+	for size := range vens.PaperDimensions {
+		sizes = append(sizes, size)
+	}
+	slices.Sort(sizes)
+	list := make([]paperSizeInfo, 0, len(sizes))
+	for _, size := range sizes {
+		dim := vens.PaperDimensions[size]
+		label := vens.PaperSizeLabels[size]
+		if label == "" {
+			label = vens.PaperSizeNames[size]
+		}
+		list = append(list, paperSizeInfo{
+			Name:     vens.PaperSizeNames[size],
+			Label:    label,
+			Width:    dim.Width,
+			Height:   dim.Height,
+			WidthMM:  pixelsToMM(int(dim.Width), 1200),
+			HeightMM: pixelsToMM(int(dim.Height), 1200),
+		})
+	}
+	return list
+}
+
+func (h *handler) handlePaperSizes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s)
+	json.NewEncoder(w).Encode(paperSizes())
 }
 
 // --- Scan Status API ---
@@ -185,25 +650,299 @@ func (h *handler) handleScanStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(h.scanStatus.Snapshot())
 }
 
+// handleScanHistory returns the results of recent button scans, newest first.
+func (h *handler) handleScanHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if h.scanStatus == nil {
+		json.NewEncoder(w).Encode([]scanner.HistoryEntry{})
+		return
+	}
+	json.NewEncoder(w).Encode(h.scanStatus.History())
+}
+
+// handleScanDownload serves the last button-scan document. http.ServeContent
+// handles Range and conditional requests, so large PDFs can be resumed.
+func (h *handler) handleScanDownload(w http.ResponseWriter, r *http.Request) {
+	if h.scanStatus == nil {
+		writeJSONError(w, http.StatusNotFound, "no_document")
+		return
+	}
+	name, data, modTime, ok := h.scanStatus.LastDocument()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "no_document")
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+}
+
+// --- Saved Files API ---
+
+// savedFile describes a scan saved to the local SavePath.
+type savedFile struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"` // RFC3339
+}
+
+// isScanFileName reports whether name is a file AirScap saves by default,
+// "scan_<timestamp>...", directly in SavePath. Only these are served.
+func isScanFileName(name string) bool {
+	return strings.HasPrefix(name, "scan_") && !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
+
+// localSavePath returns SavePath when scans are saved locally.
+func (h *handler) localSavePath() (string, bool) {
+	s := h.settings.Get()
+	if s.SaveType != "local" || s.SavePath == "" {
+		return "", false
+	}
+	return s.SavePath, true
+}
+
+// handleListFiles lists the scans in the local SavePath, newest first.
+// Files saved under other names, e.g. by a file name template, are not
+// listed.
+func (h *handler) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	dir, ok := h.localSavePath()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "local_save_disabled")
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("list saved files failed", "path", dir, "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "list_failed")
+		return
+	}
+	files := []savedFile{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isScanFileName(e.Name()) {
+			continue // directories and symlinks are never served
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, savedFile{Name: e.Name(), Size: info.Size(), Modified: info.ModTime().UTC().Format(time.RFC3339)})
+	}
+	slices.SortFunc(files, func(a, b savedFile) int {
+		return cmp.Or(strings.Compare(b.Modified, a.Modified), strings.Compare(b.Name, a.Name))
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// handleDownloadFile serves a scan from the local SavePath. The file is
+// opened through an os.Root, so symlinks cannot lead out of the directory.
+func (h *handler) handleDownloadFile(w http.ResponseWriter, r *http.Request) {
+	dir, ok := h.localSavePath()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "local_save_disabled")
+		return
+	}
+	name := r.PathValue("name")
+	if !isScanFileName(name) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_name")
+		return
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found")
+		return
+	}
+	defer root.Close()
+	f, err := root.Open(name)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeJSONError(w, http.StatusNotFound, "not_found")
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
 // --- Scan Preview API ---
 
+type previewPage struct {
+	DataURL  string  `json:"dataUrl"`
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	DPI      int     `json:"dpi,omitempty"`
+	WidthMM  float64 `json:"widthMm,omitempty"`  // physical size, when the DPI is known
+	HeightMM float64 `json:"heightMm,omitempty"` // physical size, when the DPI is known
+	Size     int     `json:"size"`
+}
+
+// newPreviewPage describes a scanned page for the preview response. The DPI
+// and physical size come from the page's pixel-size metadata when present.
+func newPreviewPage(p vens.Page) previewPage {
+	mimeType := scanner.DetectImageMIME(p.JPEG)
+	pp := previewPage{
+		DataURL: fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(p.JPEG)),
+		Size:    len(p.JPEG),
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(p.JPEG)); err == nil {
+		pp.Width = cfg.Width
+		pp.Height = cfg.Height
+	}
+	if p.PixelSize != nil && p.PixelSize.XRes > 0 {
+		pp.DPI = p.PixelSize.XRes
+		yRes := p.PixelSize.YRes
+		if yRes <= 0 {
+			yRes = pp.DPI
+		}
+		pp.WidthMM = pixelsToMM(pp.Width, pp.DPI)
+		pp.HeightMM = pixelsToMM(pp.Height, yRes)
+	}
+	return pp
+}
+
+// pixelsToMM converts a pixel count at dpi to millimeters, rounded to 0.1mm.
+func pixelsToMM(px, dpi int) float64 {
+	return math.Round(float64(px)/float64(dpi)*254) / 10
+}
+
+// previewCacheTTL is how long a preview result is reused. Previewing feeds
+// the paper out of the ADF, so clicking preview again right away would
+// otherwise fail or scan the next sheet.
+const previewCacheTTL = time.Minute
+
+var errScannerOffline = errors.New("scanner offline")
+
+// previewCache holds the last preview result. It is dropped when the
+// settings change or a button-scan job runs. The scanned pages are kept
+// apart from that until they are committed or the next preview replaces
+// them, see handleScanCommit.
+type previewCache struct {
+	mu    sync.Mutex
+	pages []previewPage
+	time  time.Time
+	jobs  int                   // ScanJobStatus.Jobs when the preview was taken
+	ov    scanner.ScanOverrides // per-scan options of the preview
+
+	staged     []vens.Page     // pages of the last preview, for handleScanCommit
+	stagedCfg  vens.ScanConfig // scan config of staged
+	stagedFast bool            // staged was scanned with Settings.FastPreview
+}
+
+// get returns the cached pages if they are younger than previewCacheTTL, no
+// job has run since and they were scanned with the same overrides.
+func (c *previewCache) get(jobs int, ov scanner.ScanOverrides) ([]previewPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pages == nil || time.Since(c.time) > previewCacheTTL || c.jobs != jobs ||
+		!sameBool(c.ov.BlankPageRemoval, ov.BlankPageRemoval) || !sameBool(c.ov.BleedThrough, ov.BleedThrough) {
+		return nil, false
+	}
+	return c.pages, true
+}
+
+func (c *previewCache) set(pages []previewPage, jobs int, ov scanner.ScanOverrides) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages = pages
+	c.time = time.Now()
+	c.jobs = jobs
+	c.ov = ov
+}
+
+// stage keeps the scanned pages of a preview for committing them. fast
+// reports whether they were scanned with Settings.FastPreview.
+func (c *previewCache) stage(pages []vens.Page, cfg vens.ScanConfig, fast bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.staged = pages
+	c.stagedCfg = cfg
+	c.stagedFast = fast
+}
+
+// isFast reports whether the staged pages come from a fast preview, which
+// are not saved: they are scanned at low resolution and single-sided.
+func (c *previewCache) isFast() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.staged != nil && c.stagedFast
+}
+
+// takeStaged returns the staged pages and forgets them, so they are saved
+// once only.
+func (c *previewCache) takeStaged() ([]vens.Page, vens.ScanConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pages, cfg := c.staged, c.stagedCfg
+	c.staged = nil
+	return pages, cfg, pages != nil
+}
+
+// restage puts pages taken with takeStaged back when committing them failed
+// before anything was saved, unless a new preview replaced them meanwhile.
+func (c *previewCache) restage(pages []vens.Page, cfg vens.ScanConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.staged == nil {
+		c.staged = pages
+		c.stagedCfg = cfg
+		c.stagedFast = false
+	}
+}
+
+func sameBool(a, b *bool) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func (c *previewCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages = nil
+}
+
+// handleScanPreview scans with the stored settings, or with
+// Settings.FastPreview at the lowest resolution and single-sided. The
+// optional JSON body (scanner.ScanOverrides) changes image processing for
+// this scan only.
 func (h *handler) handleScanPreview(w http.ResponseWriter, r *http.Request) {
+	var ov scanner.ScanOverrides
+	if err := json.NewDecoder(r.Body).Decode(&ov); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
 	if !h.scanMu.TryLock() {
 		writeJSONError(w, http.StatusConflict, "scan_in_progress")
 		return
 	}
 	defer h.scanMu.Unlock()
 
-	if !h.sc.Online() {
-		writeJSONError(w, http.StatusServiceUnavailable, "scanner_offline")
+	jobs := h.scanStatus.Jobs()
+	if result, ok := h.preview.get(jobs, ov); ok {
+		slog.Info("scan preview served from cache", "pages", len(result))
+		writePreview(w, result, true, h.preview.isFast())
 		return
 	}
 
 	s := h.settings.Get()
-	cfg := scanner.SettingsToScanConfig(s)
+	cfg := h.scanConfig(s)
+	if s.FastPreview {
+		cfg.Quality = vens.QualityNormal
+		cfg.Duplex = false
+	}
+	ov.Apply(&cfg)
 
-	slog.Info("scan preview starting", "colorMode", cfg.ColorMode, "quality", cfg.Quality, "duplex", cfg.Duplex)
-	pages, err := h.sc.Scan(cfg, nil)
+	slog.Info("scan preview starting", "colorMode", cfg.ColorMode, "quality", cfg.Quality, "duplex", cfg.Duplex,
+		"blankPageRemoval", cfg.BlankPageRemoval, "bleedThrough", cfg.BleedThrough)
+	h.events.start()
+	pages, err := h.scanPages(cfg, h.events.page)
+	h.events.finish(err)
+	if errors.Is(err, errScannerOffline) {
+		writeJSONError(w, http.StatusServiceUnavailable, "scanner_offline")
+		return
+	}
 	if err != nil {
 		slog.Error("scan preview failed", "err", err)
 		writeJSONError(w, http.StatusInternalServerError, err.Error())
@@ -213,53 +952,159 @@ func (h *handler) handleScanPreview(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusInternalServerError, "no pages scanned")
 		return
 	}
-
-	type previewPage struct {
-		DataURL string `json:"dataUrl"`
-		Width   int    `json:"width,omitempty"`
-		Height  int    `json:"height,omitempty"`
-		DPI     int    `json:"dpi,omitempty"`
-		Size    int    `json:"size"`
-	}
+	// Show the pages as a commit saves them; the commit skips this step
+	pages = scanner.PostProcessStaged(pages, cfg, s)
 
 	result := make([]previewPage, len(pages))
 	for i, p := range pages {
-		mime := detectImageMIME(p.JPEG)
-		pp := previewPage{
-			DataURL: fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(p.JPEG)),
-			Size:    len(p.JPEG),
-		}
-		if cfg, _, err := image.DecodeConfig(bytes.NewReader(p.JPEG)); err == nil {
-			pp.Width = cfg.Width
-			pp.Height = cfg.Height
-		}
-		if p.PixelSize != nil {
-			pp.DPI = p.PixelSize.XRes
-		}
-		result[i] = pp
+		result[i] = newPreviewPage(p)
 	}
+	h.preview.set(result, jobs, ov)
+	h.preview.stage(pages, cfg, s.FastPreview)
 
 	slog.Info("scan preview complete", "pages", len(pages))
+	writePreview(w, result, false, s.FastPreview)
+}
+
+// handleScanCommit saves the pages of the last preview to the configured
+// destination like a button scan, without scanning again. The JSON body
+// lists the pages to keep in their new order, each optionally rotated:
+// {"pages":[{"index":1},{"index":0,"rotate":90}]} swaps two pages, turns
+// the first scanned one and drops any others. Indexes and rotations refer to
+// the pages as previewed, which are post-processed (e.g. auto-rotated)
+// already, so the commit does not process them again. Pages of a fast
+// preview are refused, as they were not scanned with the saved settings.
+func (h *handler) handleScanCommit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Pages []scanner.PageEdit `json:"pages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s := h.settings.Get()
+	if s.SaveType == "none" || s.SaveType == "" || !scanner.DestinationEnabled(s) {
+		writeJSONError(w, http.StatusBadRequest, "no_destination")
+		return
+	}
+	if err := scanner.CheckDestination(s); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.scanMu.TryLock() {
+		writeJSONError(w, http.StatusConflict, "scan_in_progress")
+		return
+	}
+	defer h.scanMu.Unlock()
+
+	if h.preview.isFast() {
+		writeJSONError(w, http.StatusConflict, "fast_preview")
+		return
+	}
+	staged, cfg, ok := h.preview.takeStaged()
+	if !ok {
+		writeJSONError(w, http.StatusConflict, "no_preview")
+		return
+	}
+	pages, err := scanner.ApplyPageEdits(staged, req.Pages, cfg, s)
+	if err != nil {
+		h.preview.restage(staged, cfg)
+		if errors.Is(err, scanner.ErrInvalidEdits) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		} else {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	var serial, host string
+	if h.sc != nil {
+		serial, host = h.sc.Serial(), h.sc.Host()
+	}
+	slog.Info("committing preview", "pages", len(pages), "of", len(staged), "saveType", s.SaveType)
+	h.scanStatus.SetScanning(true)
+	n, target, err := scanner.RunDestinationJob(scanner.NewStagedPages(pages, serial, host), cfg, scanner.StagedSettings(s), h.scanStatus)
+	h.scanStatus.SetJobResult(s, err, n, target)
+	if err != nil {
+		slog.Error("preview commit failed", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"pages": result,
-	})
+	json.NewEncoder(w).Encode(map[string]int{"pages": n})
 }
 
-// detectImageMIME returns the MIME type based on magic bytes.
-// TIFF: 49 49 2A 00 (little-endian) or 4D 4D 00 2A (big-endian)
-// JPEG: FF D8 FF
-func detectImageMIME(data []byte) string {
-	if len(data) >= 4 {
-		if data[0] == 0x49 && data[1] == 0x49 && data[2] == 0x2A && data[3] == 0x00 {
-			return "image/tiff"
-		}
-		if data[0] == 0x4D && data[1] == 0x4D && data[2] == 0x00 && data[3] == 0x2A {
-			return "image/tiff"
-		}
+// --- Ad-hoc Scan API ---
+
+// destAuthHeader is the request header whose value is sent as the
+// Authorization header to the destination of an ad-hoc scan.
+const destAuthHeader = "X-Destination-Authorization"
+
+// handleScanToURL scans with the stored settings and POSTs the result as a
+// PDF to the http(s) URL in the dest query parameter. The destination is
+// used for this scan only and never stored.
+func (h *handler) handleScanToURL(w http.ResponseWriter, r *http.Request) {
+	// Anyone who can reach the Web UI could otherwise send scans anywhere
+	if !h.scanToURLAllowed {
+		writeJSONError(w, http.StatusForbidden, "ui_password_required")
+		return
+	}
+	// A cross-site form could otherwise start a scan and send it anywhere
+	if !sameOrigin(r) {
+		writeJSONError(w, http.StatusForbidden, "cross_origin")
+		return
+	}
+	dest := r.URL.Query().Get("dest")
+	u, err := url.Parse(dest)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_dest")
+		return
+	}
+
+	if !h.scanMu.TryLock() {
+		writeJSONError(w, http.StatusConflict, "scan_in_progress")
+		return
 	}
-	return "image/jpeg"
+	defer h.scanMu.Unlock()
+
+	s := h.settings.Get()
+	cfg := h.scanConfig(s)
+	pages, err := h.scanToURL(cfg, u.String(), r.Header.Get(destAuthHeader), s)
+	if errors.Is(err, errScannerOffline) {
+		writeJSONError(w, http.StatusServiceUnavailable, "scanner_offline")
+		return
+	}
+	if err != nil {
+		slog.Error("ad-hoc scan failed", "host", u.Host, "pages", pages, "err", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"pages": pages})
+}
+
+// sameOrigin reports whether r was not sent by a page of another origin.
+// Requests without an Origin header come from scripts, not browsers.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func writePreview(w http.ResponseWriter, pages []previewPage, cached, fast bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"pages":  pages,
+		"cached": cached,
+		"fast":   fast, // the pages cannot be committed
+	})
 }
 
 func wifiStateString(state uint32) string {
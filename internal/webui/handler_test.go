@@ -0,0 +1,1047 @@
+package webui
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/airscap/internal/config"
+	"github.com/mzyy94/airscap/internal/scanner"
+	"github.com/mzyy94/airscap/internal/vens"
+)
+
+func newTestHandler(t *testing.T, status *scanner.ScanJobStatus) http.Handler {
+	t.Helper()
+	return NewHandler(nil, nil, 8080, config.NewMemoryStore(), status, "test", &sync.Mutex{}, nil, false)
+}
+
+func TestScanDownloadRange(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	status := &scanner.ScanJobStatus{}
+	status.SetDocument("scan_20250101_120000.pdf", data)
+	h := newTestHandler(t, status)
+
+	req := httptest.NewRequest("GET", "/api/scan/download", nil)
+	req.Header.Set("Range", "bytes=100-199")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 100-199/1000" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !bytes.Equal(body, data[100:200]) {
+		t.Errorf("body = %q, want %q", body, data[100:200])
+	}
+	if rec.Header().Get("Last-Modified") == "" {
+		t.Error("Last-Modified header missing")
+	}
+}
+
+func TestScanHistory(t *testing.T) {
+	status := &scanner.ScanJobStatus{}
+	h := newTestHandler(t, status)
+	get := func() []scanner.HistoryEntry {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/scan/history", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var entries []scanner.HistoryEntry
+		if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil || entries == nil {
+			t.Fatalf("body is not a JSON array: %v", err)
+		}
+		return entries
+	}
+	if entries := get(); len(entries) != 0 {
+		t.Errorf("entries = %+v, want none", entries)
+	}
+
+	status.SetHistory(scanner.NewJobHistory("", 0))
+	status.SetJobResult(config.Settings{Format: "image/jpeg", SaveType: "local"}, nil, 3, "/scans")
+	entries := get()
+	if len(entries) != 1 || entries[0].Pages != 3 || entries[0].Destination != "local" {
+		t.Errorf("entries = %+v, want the local scan of 3 pages", entries)
+	}
+}
+
+func TestScanDownloadNoDocument(t *testing.T) {
+	h := newTestHandler(t, &scanner.ScanJobStatus{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/scan/download", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestRefreshCapabilitiesOffline(t *testing.T) {
+	sc := scanner.New("127.0.0.1", vens.DefaultDataPort, vens.DefaultControlPort, "")
+	store := config.NewMemoryStore()
+	h := NewHandler(sc, scanner.NewESCLAdapter(sc, 8080, store), 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/scanner/refresh-capabilities", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
+
+func TestSetWifiModeRequests(t *testing.T) {
+	sc := scanner.New("127.0.0.1", vens.DefaultDataPort, vens.DefaultControlPort, "")
+	store := config.NewMemoryStore()
+	h := NewHandler(sc, scanner.NewESCLAdapter(sc, 8080, store), 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+
+	// Off by default: the mode values are unverified
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/scanner/wifi-mode", strings.NewReader(`{"mode":"direct"}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("disabled: status = %d, want 403", rec.Code)
+	}
+	sc.SetWifiModeSwitch(true)
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"mode":"adhoc"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+		{`{"mode":"direct"}`, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/scanner/wifi-mode", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("POST %s: status = %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestADFErrorString(t *testing.T) {
+	tests := []struct {
+		kind vens.ScanErrorKind
+		want string
+	}{
+		{vens.ScanErrPaperJam, "jam"},
+		{vens.ScanErrCoverOpen, "hatchOpen"},
+		{vens.ScanErrMultiFeed, "multiFeed"},
+		{vens.ScanErrGeneric, "error"},
+		{vens.ScanErrNoPaper, ""},
+		{-1, ""},
+	}
+	for _, tt := range tests {
+		if got := adfErrorString(tt.kind); got != tt.want {
+			t.Errorf("adfErrorString(%v) = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestReservationStatus(t *testing.T) {
+	const local = "192.168.1.10"
+	tests := []struct {
+		name     string
+		online   bool
+		known    bool
+		paired   bool
+		clientIP string
+		want     reservationInfo
+	}{
+		{"connected", true, true, true, local, reservationInfo{State: "held"}},
+		{"connected before discovery data", true, false, false, "", reservationInfo{State: "held"}},
+		{"unreachable", false, false, false, "", reservationInfo{State: "unknown"}},
+		{"not paired", false, true, false, "", reservationInfo{State: "free"}},
+		{"paired to AirScap", false, true, true, local, reservationInfo{State: "held"}},
+		{"paired to another client", false, true, true, "192.168.1.20", reservationInfo{State: "other", ClientIP: "192.168.1.20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reservationStatus(tt.online, tt.known, tt.paired, tt.clientIP, local); got != tt.want {
+				t.Errorf("reservationStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPreviewPagePixelSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 2480, 3508)), nil); err != nil {
+		t.Fatal(err)
+	}
+	p := vens.Page{
+		JPEG:      buf.Bytes(),
+		PixelSize: &vens.PixelSizeInfo{XPixels: 2480, YPixels: 3508, XRes: 300, YRes: 300},
+	}
+	data, err := json.Marshal(newPreviewPage(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(data, &got)
+	want := map[string]float64{"width": 2480, "height": 3508, "dpi": 300, "widthMm": 210, "heightMm": 297}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestNewPreviewPageWithoutPixelSize(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 100, 50)), nil)
+	pp := newPreviewPage(vens.Page{JPEG: buf.Bytes()})
+	if pp.Width != 100 || pp.Height != 50 {
+		t.Errorf("size = %dx%d, want 100x50", pp.Width, pp.Height)
+	}
+	if pp.DPI != 0 || pp.WidthMM != 0 || pp.HeightMM != 0 {
+		t.Errorf("DPI/mm = %d/%v/%v, want unset", pp.DPI, pp.WidthMM, pp.HeightMM)
+	}
+}
+
+func TestScanPreviewCache(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10)), nil)
+
+	status := &scanner.ScanJobStatus{}
+	h := &handler{settings: config.NewMemoryStore(), scanStatus: status, scanMu: &sync.Mutex{}}
+	scans := 0
+	h.scanPages = func(vens.ScanConfig, func(vens.Page)) ([]vens.Page, error) {
+		scans++
+		return []vens.Page{{JPEG: buf.Bytes()}}, nil
+	}
+
+	preview := func() (cached bool) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var resp struct {
+			Pages  []previewPage `json:"pages"`
+			Cached bool          `json:"cached"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Pages) != 1 {
+			t.Fatalf("pages = %d, want 1", len(resp.Pages))
+		}
+		return resp.Cached
+	}
+
+	if preview() || scans != 1 {
+		t.Fatalf("first preview: scans = %d, want 1 uncached", scans)
+	}
+	if !preview() || scans != 1 {
+		t.Errorf("second preview: scans = %d, want cached result", scans)
+	}
+
+	// Changing settings drops the cache.
+	rec := httptest.NewRecorder()
+	h.handlePutSettings(rec, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(`{"colorMode":"color"}`)))
+	if preview() || scans != 2 {
+		t.Errorf("after settings change: scans = %d, want 2", scans)
+	}
+
+	// So does a button-scan job.
+	status.SetScanning(true)
+	status.SetResult(nil, 1, "")
+	if preview() || scans != 3 {
+		t.Errorf("after button scan: scans = %d, want 3", scans)
+	}
+
+	// And the cache expires.
+	h.preview.time = time.Now().Add(-previewCacheTTL - time.Second)
+	if preview() || scans != 4 {
+		t.Errorf("after expiry: scans = %d, want 4", scans)
+	}
+}
+
+func TestScanPreviewOverrides(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10)), nil)
+
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.BleedThrough = true
+	store.Update(s)
+
+	h := &handler{settings: store, scanStatus: &scanner.ScanJobStatus{}, scanMu: &sync.Mutex{}}
+	var got vens.ScanConfig
+	h.scanPages = func(cfg vens.ScanConfig, _ func(vens.Page)) ([]vens.Page, error) {
+		got = cfg
+		return []vens.Page{{JPEG: buf.Bytes()}}, nil
+	}
+
+	tests := []struct {
+		body      string
+		wantBlank bool
+		wantBleed bool
+	}{
+		{``, true, true},
+		{`{"bleedThrough":false}`, true, false},
+		{`{"blankPageRemoval":false,"bleedThrough":true}`, false, true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", strings.NewReader(tt.body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("body %q: status = %d, want 200", tt.body, rec.Code)
+		}
+		if got.BlankPageRemoval != tt.wantBlank || got.BleedThrough != tt.wantBleed {
+			t.Errorf("body %q: BlankPageRemoval, BleedThrough = %v, %v, want %v, %v",
+				tt.body, got.BlankPageRemoval, got.BleedThrough, tt.wantBlank, tt.wantBleed)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", strings.NewReader(`{"bleedThrough":1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid body: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestScanPreviewFast(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10)), nil)
+
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.ColorMode = "color"
+	s.Resolution = 300
+	s.Duplex = true
+	store.Update(s)
+
+	h := &handler{settings: store, scanStatus: &scanner.ScanJobStatus{}, scanMu: &sync.Mutex{}}
+	var got vens.ScanConfig
+	h.scanPages = func(cfg vens.ScanConfig, _ func(vens.Page)) ([]vens.Page, error) {
+		got = cfg
+		return []vens.Page{{JPEG: buf.Bytes()}}, nil
+	}
+	preview := func() {
+		t.Helper()
+		h.preview.clear()
+		rec := httptest.NewRecorder()
+		h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+	}
+
+	preview()
+	if got.Quality != vens.QualitySuperFine || !got.Duplex {
+		t.Errorf("stored settings: Quality %d, Duplex %v, want the settings' 300 dpi duplex", got.Quality, got.Duplex)
+	}
+
+	s.FastPreview = true
+	store.Update(s)
+	preview()
+	if got.Quality != vens.QualityNormal || got.Duplex || got.ColorMode != vens.ColorColor {
+		t.Errorf("fast preview: Quality %d, Duplex %v, ColorMode %d, want 150 dpi simplex in color", got.Quality, got.Duplex, got.ColorMode)
+	}
+}
+
+func TestScanCommit(t *testing.T) {
+	var pages []vens.Page
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 10, 20), image.Rect(0, 0, 30, 10), image.Rect(0, 0, 40, 50)} {
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, image.NewGray(r), nil)
+		pages = append(pages, vens.Page{Sheet: len(pages), JPEG: buf.Bytes()})
+	}
+
+	dir := t.TempDir()
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.SaveType = "local"
+	s.SavePath = dir
+	s.Format = "image/jpeg"
+	store.Update(s)
+
+	h := &handler{settings: store, scanStatus: &scanner.ScanJobStatus{}, scanMu: &sync.Mutex{}}
+	h.scanPages = func(vens.ScanConfig, func(vens.Page)) ([]vens.Page, error) {
+		return slices.Clone(pages), nil
+	}
+	commit := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.handleScanCommit(rec, httptest.NewRequest("POST", "/api/scan/commit", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := commit(`{"pages":[{"index":0}]}`); rec.Code != http.StatusConflict {
+		t.Errorf("without a preview: status = %d, want 409", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview status = %d, want 200", rec.Code)
+	}
+
+	// Invalid edits are rejected and keep the preview for another try
+	for _, body := range []string{`{"pages":[]}`, `{"pages":[{"index":3}]}`, `{"pages":[{"index":0},{"index":0}]}`, `{"pages":[{"index":0,"rotate":45}]}`} {
+		if rec := commit(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("commit %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	// Drop the middle page, put the last one first and turn it
+	rec = commit(`{"pages":[{"index":2,"rotate":90},{"index":0}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("commit status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp struct{ Pages int }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Pages != 2 {
+		t.Errorf("pages = %d, want 2", resp.Pages)
+	}
+
+	if sizes, want := savedSizes(t, dir), []image.Point{{50, 40}, {10, 20}}; !slices.Equal(sizes, want) {
+		t.Errorf("saved page sizes = %v, want %v", sizes, want)
+	}
+	if st := h.scanStatus.Snapshot(); st.Pages != 2 {
+		t.Errorf("job status pages = %d, want 2", st.Pages)
+	}
+
+	// The preview is consumed by the commit
+	if rec := commit(`{"pages":[{"index":0}]}`); rec.Code != http.StatusConflict {
+		t.Errorf("second commit: status = %d, want 409", rec.Code)
+	}
+
+	// With AutoRotate the preview already shows the landscape page turned,
+	// and a page the user turned to landscape is not turned back on commit
+	s.AutoRotate = true
+	s.SavePath = t.TempDir()
+	store.Update(s)
+	rec = httptest.NewRecorder()
+	h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview status = %d, want 200", rec.Code)
+	}
+	var preview struct{ Pages []previewPage }
+	json.NewDecoder(rec.Body).Decode(&preview)
+	if len(preview.Pages) != 3 || preview.Pages[1].Width != 10 || preview.Pages[1].Height != 30 {
+		t.Errorf("preview pages = %+v, want the second one 10x30", preview.Pages)
+	}
+	if rec := commit(`{"pages":[{"index":0,"rotate":90},{"index":1}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("commit status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if sizes, want := savedSizes(t, s.SavePath), []image.Point{{20, 10}, {10, 30}}; !slices.Equal(sizes, want) {
+		t.Errorf("saved page sizes with AutoRotate = %v, want %v", sizes, want)
+	}
+
+	// Pages of a fast preview are low resolution and never saved
+	s.FastPreview = true
+	store.Update(s)
+	rec = httptest.NewRecorder()
+	h.handleScanPreview(rec, httptest.NewRequest("POST", "/api/scan/preview", nil))
+	var fast struct{ Fast bool }
+	json.NewDecoder(rec.Body).Decode(&fast)
+	if rec.Code != http.StatusOK || !fast.Fast {
+		t.Fatalf("fast preview: status = %d, fast = %v, want 200 true", rec.Code, fast.Fast)
+	}
+	rec = commit(`{"pages":[{"index":0}]}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "fast_preview") {
+		t.Errorf("commit of a fast preview: status = %d %s, want 409 fast_preview", rec.Code, rec.Body)
+	}
+}
+
+// savedSizes returns the image sizes of the JPEG files in dir by name.
+func savedSizes(t *testing.T, dir string) []image.Point {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jpg"))
+	slices.Sort(files)
+	var sizes []image.Point
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		sizes = append(sizes, image.Pt(c.Width, c.Height))
+	}
+	return sizes
+}
+
+func TestScanToURL(t *testing.T) {
+	h := &handler{settings: config.NewMemoryStore(), scanMu: &sync.Mutex{}}
+	rec := httptest.NewRecorder()
+	h.handleScanToURL(rec, httptest.NewRequest("POST", "/api/scan?dest=http://dms.local/upload", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("without UI password: status = %d, want 403", rec.Code)
+	}
+
+	h.scanToURLAllowed = true
+	var gotDest, gotAuth string
+	h.scanToURL = func(_ vens.ScanConfig, dest, authorization string, _ config.Settings) (int, error) {
+		gotDest, gotAuth = dest, authorization
+		return 3, nil
+	}
+
+	tests := []struct {
+		name   string
+		dest   string
+		origin string
+		want   int
+	}{
+		{"no dest", "", "", http.StatusBadRequest},
+		{"not http", "ftp://nas/scans", "", http.StatusBadRequest},
+		{"no host", "http:///upload", "", http.StatusBadRequest},
+		{"cross origin", "http://dms.local/upload", "http://evil.example", http.StatusForbidden},
+		{"same origin", "http://dms.local/upload", "http://example.com", http.StatusOK},
+		{"script", "https://dms.local/upload?folder=1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/scan?dest="+url.QueryEscape(tt.dest), nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			req.Header.Set(destAuthHeader, "Token abc")
+			rec := httptest.NewRecorder()
+			h.handleScanToURL(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK && (gotDest != tt.dest || gotAuth != "Token abc") {
+				t.Errorf("scanned to %q with %q, want %q with Token abc", gotDest, gotAuth, tt.dest)
+			}
+		})
+	}
+
+	h.scanMu.Lock()
+	rec = httptest.NewRecorder()
+	h.handleScanToURL(rec, httptest.NewRequest("POST", "/api/scan?dest=http://dms.local/upload", nil))
+	h.scanMu.Unlock()
+	if rec.Code != http.StatusConflict {
+		t.Errorf("while scanning: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestPutSettingsRejectsUnknownStartMode(t *testing.T) {
+	store := config.NewMemoryStore()
+	h := NewHandler(nil, nil, 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(`{"startMode":"turbo"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if mode := store.Get().StartMode; mode != "" {
+		t.Errorf("stored start mode = %q, want it unchanged", mode)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(`{"startMode":"quick"}`)))
+	if rec.Code != http.StatusOK || store.Get().StartMode != "quick" {
+		t.Errorf("status = %d, start mode = %q, want 200 quick", rec.Code, store.Get().StartMode)
+	}
+}
+
+func TestSettingsSecretsMasked(t *testing.T) {
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.FTPUser = "scanner"
+	s.FTPPassword = "hunter2"
+	s.PaperlessToken = "tok"
+	store.Update(s)
+	h := NewHandler(nil, nil, 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/settings", nil))
+	if strings.Contains(rec.Body.String(), "hunter2") {
+		t.Fatalf("GET /api/settings leaks the FTP password: %s", rec.Body)
+	}
+	var got config.Settings
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.FTPPassword != secretMask || got.PaperlessToken != secretMask || got.SMBPassword != "" || got.FTPUser != "scanner" {
+		t.Errorf("GET /api/settings: ftpPassword %q, paperlessToken %q, smbPassword %q, ftpUser %q",
+			got.FTPPassword, got.PaperlessToken, got.SMBPassword, got.FTPUser)
+	}
+
+	// Sending the form back keeps the masked secrets and applies new ones
+	got.FTPUser = "archive"
+	got.PaperlessToken = "new-token"
+	body, _ := json.Marshal(got)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/settings", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /api/settings: status = %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") || strings.Contains(rec.Body.String(), "new-token") {
+		t.Errorf("PUT /api/settings response leaks secrets: %s", rec.Body)
+	}
+	stored := store.Get()
+	if stored.FTPPassword != "hunter2" || stored.PaperlessToken != "new-token" || stored.FTPUser != "archive" {
+		t.Errorf("stored: ftpPassword %q, paperlessToken %q, ftpUser %q", stored.FTPPassword, stored.PaperlessToken, stored.FTPUser)
+	}
+}
+
+func TestProfilesAPI(t *testing.T) {
+	store := config.NewMemoryStore()
+	h := NewHandler(nil, nil, 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/profiles", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := put(`{"active":"Receipts","button":"Receipts","names":["default","Receipts"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /api/profiles: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var got config.ProfileList
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Active != "Receipts" || got.Button != "Receipts" || len(got.Names) != 2 {
+		t.Errorf("PUT /api/profiles = %+v", got)
+	}
+	if rec := put(`{"active":"Photos","names":["default"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a missing active profile: status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/profiles", nil))
+	got = config.ProfileList{}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Active != "Receipts" {
+		t.Errorf("GET /api/profiles: active = %q, want Receipts", got.Active)
+	}
+}
+
+func TestDestinationSwitch(t *testing.T) {
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.SavePath = "/scans"
+	s.FTPHost = "nas.local"
+	s.Format = "image/jpeg"
+	store.Update(s)
+	h := NewHandler(nil, nil, 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/destination", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := put(`{"saveType":"ftp"}`); rec.Code != http.StatusOK {
+		t.Fatalf("switch to ftp: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := put(`{"saveType":"local","destination":{"savePath":"/archive"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("switch to local: status = %d, body %s", rec.Code, rec.Body)
+	}
+	got := store.Get()
+	if got.SaveType != "local" || got.SavePath != "/archive" || got.FTPHost != "nas.local" || got.Format != "image/jpeg" {
+		t.Errorf("settings = saveType %q, savePath %q, ftpHost %q, format %q", got.SaveType, got.SavePath, got.FTPHost, got.Format)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/destination", nil))
+	var resp struct {
+		SaveType    string            `json:"saveType"`
+		Destination map[string]string `json:"destination"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.SaveType != "local" || len(resp.Destination) != 1 || resp.Destination["savePath"] != "/archive" {
+		t.Errorf("GET /api/destination = %+v", resp)
+	}
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"saveType":"s3"}`, http.StatusUnprocessableEntity},
+		{`{"saveType":"local","destination":{"savePath":""}}`, http.StatusUnprocessableEntity},
+		{`{"saveType":"ftp","destination":{"savePath":"/tmp"}}`, http.StatusBadRequest},
+		{`{"saveType":"dropbox"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := put(tt.body); rec.Code != tt.want {
+			t.Errorf("PUT %s: status = %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+	if got := store.Get(); got.SaveType != "local" || got.SavePath != "/archive" {
+		t.Errorf("rejected switch changed settings: saveType %q, savePath %q", got.SaveType, got.SavePath)
+	}
+}
+
+func TestDisabledDestinationKeepsSettings(t *testing.T) {
+	store := config.NewMemoryStore()
+	h := NewHandler(nil, nil, 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(
+		`{"saveType":"ftp","ftpHost":"nas.local","ftpUser":"scan","ftpPassword":"secret","ftpEnabled":false,"paperlessUrl":"http://paperless:8000","paperlessToken":"tok"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /api/settings: status = %d", rec.Code)
+	}
+	got := store.Get()
+	if scanner.DestinationEnabled(got) {
+		t.Error("disabled FTP destination is enabled")
+	}
+	if got.FTPHost != "nas.local" || got.FTPUser != "scan" || got.FTPPassword != "secret" {
+		t.Errorf("FTP settings = %q %q %q, want them kept", got.FTPHost, got.FTPUser, got.FTPPassword)
+	}
+
+	// Switching destinations leaves the disabled one as it was
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/destination", strings.NewReader(`{"saveType":"paperless"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("switch to paperless: status = %d, body %s", rec.Code, rec.Body)
+	}
+	got = store.Get()
+	if !scanner.DestinationEnabled(got) {
+		t.Error("Paperless-ngx destination is disabled")
+	}
+	got.SaveType = "ftp"
+	if scanner.DestinationEnabled(got) || got.FTPPassword != "secret" {
+		t.Errorf("FTP after switch: enabled %v, password %q", scanner.DestinationEnabled(got), got.FTPPassword)
+	}
+}
+
+func TestPaperSizes(t *testing.T) {
+	h := NewHandler(nil, nil, 8080, config.NewMemoryStore(), nil, "test", &sync.Mutex{}, nil, false)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/papersizes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var got []paperSizeInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(vens.PaperDimensions) {
+		t.Fatalf("got %d sizes, want %d", len(got), len(vens.PaperDimensions))
+	}
+	byName := make(map[string]paperSizeInfo)
+	for _, p := range got {
+		byName[p.Name] = p
+	}
+	for size, dim := range vens.PaperDimensions {
+		name := vens.PaperSizeNames[size]
+		p, ok := byName[name]
+		if !ok {
+			t.Errorf("paper size %q (%d) not listed", name, size)
+			continue
+		}
+		if p.Label == "" || p.Width != dim.Width || p.Height != dim.Height {
+			t.Errorf("%s = %+v, want %dx%d with a label", name, p, dim.Width, dim.Height)
+		}
+		if d := p.WidthMM - float64(dim.Width)*25.4/1200; d < -0.05 || d > 0.05 {
+			t.Errorf("%s widthMm = %v, want %.2f", name, p.WidthMM, float64(dim.Width)*25.4/1200)
+		}
+		if d := p.HeightMM - float64(dim.Height)*25.4/1200; d < -0.05 || d > 0.05 {
+			t.Errorf("%s heightMm = %v, want %.2f", name, p.HeightMM, float64(dim.Height)*25.4/1200)
+		}
+	}
+	if a4 := byName["a4"]; a4.WidthMM != 210.3 || a4.HeightMM != 297.0 {
+		t.Errorf("a4 = %vmm x %vmm, want 210.3mm x 297mm", a4.WidthMM, a4.HeightMM)
+	}
+	if letter := byName["letter"]; letter.WidthMM != 215.9 || letter.HeightMM != 279.4 {
+		t.Errorf("letter = %vmm x %vmm, want 215.9mm x 279.4mm", letter.WidthMM, letter.HeightMM)
+	}
+}
+
+func TestScanEvents(t *testing.T) {
+	h := &handler{settings: config.NewMemoryStore(), scanStatus: &scanner.ScanJobStatus{}, scanMu: &sync.Mutex{}}
+	received := make(chan struct{})
+	release := make(chan struct{})
+	h.scanPages = func(_ vens.ScanConfig, onPage func(vens.Page)) ([]vens.Page, error) {
+		pages := []vens.Page{
+			{Sheet: 0, Side: 0, JPEG: make([]byte, 100)},
+			{Sheet: 0, Side: 1, JPEG: make([]byte, 200)},
+		}
+		for _, p := range pages {
+			onPage(p)
+		}
+		close(received)
+		<-release
+		return nil, errors.New("paper jam")
+	}
+	go h.handleScanPreview(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/scan/preview", nil))
+	<-received
+
+	srv := httptest.NewServer(http.HandlerFunc(h.handleScanEvents))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	readFrame := func() string {
+		t.Helper()
+		var frame strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read frame: %v (got %q)", err, frame.String())
+			}
+			if line == "\n" {
+				return frame.String()
+			}
+			frame.WriteString(line)
+		}
+	}
+	want := []string{
+		"event: page\ndata: {\"sheet\":1,\"side\":\"front\",\"bytes\":100}\n",
+		"event: page\ndata: {\"sheet\":1,\"side\":\"back\",\"bytes\":200}\n",
+	}
+	for i, w := range want {
+		if got := readFrame(); got != w {
+			t.Errorf("frame %d = %q, want %q", i, got, w)
+		}
+	}
+
+	close(release)
+	if got, w := readFrame(), "event: end\ndata: {\"pages\":2,\"error\":\"paper jam\"}\n"; got != w {
+		t.Errorf("end frame = %q, want %q", got, w)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("stream not closed after end event: err = %v", err)
+	}
+}
+
+func TestDiscoverDuringReconnect(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: vens.ClientDiscoveryPort})
+	if err != nil {
+		t.Skip("discovery port not available:", err)
+	}
+	conn.Close()
+	old := discoverTimeout
+	discoverTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { discoverTimeout = old })
+
+	// A reconnect discovering the scanner holds the client discovery port
+	// until its timeout; listing the scanners meanwhile waits for it
+	reconnect := make(chan error, 1)
+	go func() {
+		_, err := vens.FindScanner(context.Background(), vens.DiscoveryOptions{ScannerIP: "127.0.0.1", Timeout: 300 * time.Millisecond})
+		reconnect <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	sc := scanner.New("127.0.0.1", vens.DefaultDataPort, vens.DefaultControlPort, "")
+	store := config.NewMemoryStore()
+	h := NewHandler(sc, scanner.NewESCLAdapter(sc, 8080, store), 8080, store, nil, "test", &sync.Mutex{}, nil, false)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/discover", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if err := <-reconnect; err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("reconnect discovery: %v", err)
+	}
+}
+
+func TestDebugBundle(t *testing.T) {
+	sc := scanner.New("127.0.0.1", vens.DefaultDataPort, vens.DefaultControlPort, "")
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.SaveType = "ftp"
+	s.FTPUser = "scanner"
+	s.FTPPassword = "hunter2"
+	s.S3SecretKey = "s3-secret"
+	s.PushToken = "tk_push"
+	s.WebhookURL = "https://hooks.slack.com/services/T000/B000/wh-secret?token=q-secret"
+	s.PushService = "ntfy"
+	s.PushURL = "https://ntfy.sh/topic-secret"
+	if err := store.Update(s); err != nil {
+		t.Fatal(err)
+	}
+	logs := NewLogBuffer(2)
+	logs.Write([]byte("level=INFO msg=one\n"))
+	logs.Write([]byte("level=INFO msg=two\nlevel=WARN msg=three\n"))
+	h := NewHandler(sc, scanner.NewESCLAdapter(sc, 8080, store), 8080, store, nil, "test", &sync.Mutex{}, logs, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/debug/bundle", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{"hunter2", "s3-secret", "tk_push", "wh-secret", "q-secret", "topic-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("bundle contains secret %q", secret)
+		}
+	}
+
+	var bundle map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{"version", "config", "status", "scanParams", "capabilities", "logs"} {
+		if _, ok := bundle[section]; !ok {
+			t.Errorf("bundle lacks %q", section)
+		}
+	}
+	var cfg config.Settings
+	json.Unmarshal(bundle["config"], &cfg)
+	if cfg.FTPPassword != redacted || cfg.FTPUser != "scanner" || cfg.SMTPPassword != "" {
+		t.Errorf("config = ftpPassword %q, ftpUser %q, smtpPassword %q", cfg.FTPPassword, cfg.FTPUser, cfg.SMTPPassword)
+	}
+	if cfg.WebhookURL != "https://hooks.slack.com/REDACTED" || cfg.PushURL != "https://ntfy.sh/REDACTED" {
+		t.Errorf("config = webhookUrl %q, pushUrl %q, want host only", cfg.WebhookURL, cfg.PushURL)
+	}
+	var status statusResponse
+	json.Unmarshal(bundle["status"], &status)
+	if status.State != "offline" || status.Version != "test" {
+		t.Errorf("status = %q version %q, want offline test", status.State, status.Version)
+	}
+	var lines []string
+	json.Unmarshal(bundle["logs"], &lines)
+	if want := []string{"level=INFO msg=two", "level=WARN msg=three"}; !slices.Equal(lines, want) {
+		t.Errorf("logs = %q, want %q", lines, want)
+	}
+}
+
+// newFilesHandler returns a handler saving scans locally to a temporary
+// directory holding two scans, a file of another name, a subdirectory and a
+// symlink to a file outside the directory.
+func newFilesHandler(t *testing.T) (http.Handler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, data string, mod time.Time) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Date(2026, 3, 9, 14, 5, 7, 0, time.UTC)
+	write("scan_20260309_140507.pdf", "old scan", old)
+	write("scan_20260310_090000_001.jpg", "new scan", old.Add(24*time.Hour))
+	write("notes.txt", "not a scan", old)
+	if err := os.Mkdir(filepath.Join(dir, "scan_dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "scan_link.pdf")); err != nil {
+		t.Fatal(err)
+	}
+
+	store := config.NewMemoryStore()
+	s := store.Get()
+	s.SaveType = "local"
+	s.SavePath = dir
+	store.Update(s)
+	return NewHandler(nil, nil, 8080, store, &scanner.ScanJobStatus{}, "test", &sync.Mutex{}, nil, false), dir
+}
+
+func TestListFiles(t *testing.T) {
+	h, _ := newFilesHandler(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/files", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var files []savedFile
+	if err := json.NewDecoder(rec.Body).Decode(&files); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if want := []string{"scan_20260310_090000_001.jpg", "scan_20260309_140507.pdf"}; !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v (scans only, newest first)", names, want)
+	}
+	if len(files) == 2 && (files[1].Size != 8 || files[1].Modified != "2026-03-09T14:05:07Z") {
+		t.Errorf("file = %+v", files[1])
+	}
+
+	// Nothing is served unless scans are saved locally
+	store := config.NewMemoryStore()
+	rec = httptest.NewRecorder()
+	NewHandler(nil, nil, 8080, store, nil, "test", &sync.Mutex{}, nil, false).ServeHTTP(rec, httptest.NewRequest("GET", "/api/files", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("save type none: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	h, _ := newFilesHandler(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/files/scan_20260309_140507.pdf", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if body := rec.Body.String(); body != "old scan" {
+		t.Errorf("body = %q, want %q", body, "old scan")
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "scan_20260309_140507.pdf") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestDownloadFileRejectsTraversal(t *testing.T) {
+	h, dir := newFilesHandler(t)
+	// A scan-like file next to SavePath
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dir), "scan_outside.pdf"), []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/files/scan_..%2Fscan_outside.pdf", http.StatusBadRequest},
+		{"/api/files/..%2Fscan_outside.pdf", http.StatusBadRequest},
+		{"/api/files/%2Fetc%2Fpasswd", http.StatusBadRequest},
+		{"/api/files/scan_x%5C..%5Cscan_outside.pdf", http.StatusBadRequest},
+		{"/api/files/notes.txt", http.StatusBadRequest},
+		{"/api/files/scan_link.pdf", http.StatusNotFound}, // symlink out of SavePath
+		{"/api/files/scan_dir", http.StatusNotFound},
+		{"/api/files/scan_missing.pdf", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if body := rec.Body.String(); strings.Contains(body, "secret") || strings.Contains(body, "outside") {
+				t.Errorf("leaked file content: %q", body)
+			}
+		})
+	}
+}
@@ -15,6 +15,14 @@ const MESSAGES = {
   noPaper:          { en: 'No paper',     ja: '用紙なし' },
   wifiSignal:       { en: 'Wi-Fi Signal', ja: 'Wi-Fi 強度' },
   lastUpdated:      { en: 'Last updated', ja: '最終更新' },
+  eco_active:       { en: 'Active',       ja: '動作中' },
+  eco_idle:         { en: 'Idle',         ja: 'アイドル' },
+  eco_released:     { en: 'Sleeping',     ja: 'スリープ中' },
+  reservation:      { en: 'Reservation',  ja: '占有' },
+  reservation_held: { en: 'AirScap',      ja: 'AirScap' },
+  reservation_other:{ en: 'Other client', ja: '他のクライアント' },
+  reservation_free: { en: 'Free',         ja: '空き' },
+  reservedByOtherWarn: { en: 'The scanner is paired with another client. AirScap cannot scan until it is released', ja: 'スキャナーは他のクライアントとペアリングされています。解放されるまで AirScap からはスキャンできません' },
   adfErr_jam:       { en: 'Paper jam',    ja: '紙詰まり' },
   adfErr_hatchOpen: { en: 'Cover open',   ja: 'カバーオープン' },
   adfErr_multiFeed: { en: 'Multi-feed',   ja: '重送検知' },
@@ -33,11 +41,25 @@ const MESSAGES = {
 
   // Capabilities
   resolution:       { en: 'Resolution',    ja: '解像度' },
+  fallbackDpi:      { en: 'Assumed DPI (auto resolution)', ja: '想定解像度 (自動解像度)' },
+  fallbackDpiHelp:  { en: 'Resolution used to size saved pages when the scanner does not report one, set separately for each color mode. 0 = 300', ja: 'スキャナーが解像度を返さないときに保存ページのサイズ計算に使う解像度です。カラーモードごとに設定します。0 = 300' },
+  maxResolution:    { en: 'Max resolution', ja: '最大解像度' },
+  maxResolutionNone: { en: 'No limit', ja: '制限なし' },
+  maxResolutionHelp: { en: 'Scan at most at this resolution, also for AirScan clients, to spare a low-power host such as a Raspberry Pi. Higher requests and auto resolution are lowered to it', ja: 'Raspberry Pi など非力なホストの負荷を抑えるため、AirScan クライアントを含めこの解像度以下でスキャンします。これより高い指定や自動解像度はこの解像度に下げます' },
+  fastPreview:      { en: 'Fast preview', ja: '高速プレビュー' },
+  fastPreviewHelp:  { en: 'Preview at 150 dpi single-sided regardless of the settings above, to quickly check alignment and content.', ja: '上記の設定に関わらず 150 dpi の片面でプレビューし、向きや内容をすばやく確認できます。' },
   color:            { en: 'Color',         ja: 'カラー' },
   duplex:           { en: 'Duplex',        ja: '両面' },
   supported:        { en: 'Supported',     ja: '対応' },
   notSupported:     { en: 'Not supported', ja: '非対応' },
   outputFormat:     { en: 'Output Format', ja: '出力形式' },
+  multipageTiff:    { en: 'Multi-page TIFF', ja: 'マルチページTIFF' },
+  refreshCapabilities: { en: 'Refresh capabilities', ja: 'スキャン機能を再取得' },
+  wifiMode:         { en: 'Wi-Fi Mode',   ja: 'Wi-Fi モード' },
+  wifiMode_infrastructure: { en: 'Access point', ja: 'アクセスポイント' },
+  wifiMode_direct:  { en: 'Direct',       ja: 'ダイレクト' },
+  wifiModeHelp:     { en: 'Switches how the scanner connects to Wi-Fi. Experimental', ja: 'スキャナーの Wi-Fi 接続方式を切り替えます（実験的）' },
+  wifiModeConfirm:  { en: 'The scanner drops the connection to switch modes. In direct mode AirScap cannot reach it until it is switched back on the scanner. Continue?', ja: 'モードを切り替えるとスキャナーとの接続が切れます。ダイレクトモードではスキャナー側で戻すまで AirScap から接続できません。続行しますか？' },
 
   // Scan settings
   colorMode:        { en: 'Color Mode',              ja: 'カラーモード' },
@@ -46,8 +68,16 @@ const MESSAGES = {
   singleSided:      { en: 'Single-sided',            ja: '片面スキャン' },
   doubleSided:      { en: 'Double-sided',            ja: '両面スキャン' },
   blankPageRemoval: { en: 'Blank page removal',      ja: '白紙ページスキップ' },
+  blankThreshold:   { en: 'Blank page threshold (%)', ja: '白紙判定のしきい値 (%)' },
+  blankThresholdHelp: { en: 'Also drop pages the scanner keeps when at least this share of the page is near-white, e.g. 99.5. 0 = off', ja: 'ほぼ白の部分がこの割合以上のページは、スキャナーが残した場合も除外します (例: 99.5)。0 = 無効' },
   bleedThrough:     { en: 'Bleed-through reduction', ja: '裏写り軽減' },
   bwDensity:        { en: 'B&W Density',             ja: '白黒濃度' },
+  autoGrayscale:    { en: 'Save gray pages as grayscale', ja: 'グレーのページをグレースケールで保存' },
+  autoGrayscaleHelp: { en: 'In auto mode, pages without real color are converted to grayscale to save space.', ja: '自動モードで実質的に色のないページをグレースケールに変換し、容量を削減します。' },
+  fillBorders:      { en: 'Fill black borders', ja: '黒い縁を白で埋める' },
+  fillBordersHelp:  { en: 'Whiten the black wedges that deskewing leaves along the page edges. Dark areas reaching further into the page are kept.', ja: '傾き補正でページの縁に残る黒い三角形を白で塗りつぶします。ページの内側まで続く暗い部分はそのまま残します。' },
+  autoRotate:       { en: 'Auto rotate', ja: '自動回転' },
+  autoRotateHelp:   { en: 'Turn landscape pages 90° clockwise so that every page is portrait.', ja: '横長のページを時計回りに 90° 回転し、すべてのページを縦向きにそろえます。' },
   compression:      { en: 'JPEG Quality',            ja: 'JPEG 画質' },
   compBest:         { en: 'Best',                   ja: '高画質' },
   compStandard:     { en: 'Standard',               ja: '標準' },
@@ -62,17 +92,127 @@ const MESSAGES = {
   ftpHostHelp:      { en: 'hostname:port (default port 21)', ja: 'ホスト名:ポート（ポート省略時は 21）' },
   username:         { en: 'Username',       ja: 'ユーザー名' },
   password:         { en: 'Password',       ja: 'パスワード' },
+  sftpAddress:      { en: 'SFTP Address',   ja: 'SFTP アドレス' },
+  sftpHostHelp:     { en: 'hostname:port (default port 22)', ja: 'ホスト名:ポート（ポート省略時は 22）' },
+  sftpPasswordHelp: { en: 'Also used as the passphrase of an encrypted private key', ja: '暗号化された秘密鍵のパスフレーズとしても使用します' },
+  sftpKeyPath:      { en: 'Private Key File', ja: '秘密鍵ファイル' },
+  sftpPath:         { en: 'Upload Directory', ja: 'アップロード先ディレクトリ' },
+  sftpPathHelp:     { en: 'Created if missing. Empty = login directory', ja: '存在しない場合は作成します。空欄 = ログインディレクトリ' },
+  sftpKnownHosts:   { en: 'known_hosts File', ja: 'known_hosts ファイル' },
+  sftpInsecure:     { en: 'Skip Host Key Verification', ja: 'ホスト鍵の検証をスキップ' },
+  sftpInsecureHelp: { en: 'Not recommended: the server identity is not checked', ja: '非推奨：サーバーの正当性を確認しません' },
+  email:            { en: 'Email',          ja: 'メール' },
+  smtpServer:       { en: 'SMTP Server',    ja: 'SMTP サーバー' },
+  smtpPort:         { en: 'Port',           ja: 'ポート' },
+  smtpPortHelp:     { en: '0 = 465 with TLS, otherwise 587 (STARTTLS when available)', ja: '0 = TLS 有効時は 465、それ以外は 587（利用可能なら STARTTLS）' },
+  smtpUseTls:       { en: 'Implicit TLS (SMTPS)', ja: '暗黙的 TLS (SMTPS)' },
+  smtpFrom:         { en: 'From',           ja: '送信元' },
+  smtpTo:           { en: 'To',             ja: '宛先' },
+  smtpToHelp:       { en: 'Separate multiple recipients with commas', ja: '複数の宛先はカンマで区切ります' },
+  s3Endpoint:       { en: 'Endpoint',       ja: 'エンドポイント' },
+  s3EndpointHelp:   { en: 'Leave empty for AWS S3. For MinIO and other S3-compatible servers, enter the server URL', ja: 'AWS S3 の場合は空欄。MinIO などの S3 互換サーバーの場合はサーバーの URL を入力します' },
+  s3Bucket:         { en: 'Bucket',         ja: 'バケット' },
+  s3Region:         { en: 'Region',         ja: 'リージョン' },
+  s3AccessKey:      { en: 'Access Key',     ja: 'アクセスキー' },
+  s3SecretKey:      { en: 'Secret Key',     ja: 'シークレットキー' },
+  s3Prefix:         { en: 'Key Prefix',     ja: 'キーのプレフィックス' },
+  s3UsePathStyle:   { en: 'Path-Style Addressing', ja: 'パススタイルのアドレス指定' },
+  s3UsePathStyleHelp: { en: 'Use endpoint/bucket/key URLs. Required by MinIO in most setups', ja: 'エンドポイント/バケット/キー形式の URL を使用します。多くの MinIO 環境で必要です' },
   paperlessBaseUrl: { en: 'Paperless-ngx base URL', ja: 'Paperless-ngx のベース URL' },
   apiToken:         { en: 'API Token',      ja: 'API トークン' },
   apiTokenHelp:     { en: 'Get from Settings > API Token', ja: '設定 > API トークン から取得' },
+  smbAddress:       { en: 'SMB Server',     ja: 'SMB サーバー' },
+  smbHostHelp:      { en: 'hostname:port (default port 445)', ja: 'ホスト名:ポート（ポート省略時は 445）' },
+  smbShare:         { en: 'Share Name',     ja: '共有名' },
+  smbPath:          { en: 'Folder in Share', ja: '共有内のフォルダ' },
+  smbPathHelp:      { en: 'Created if missing. Empty = share root', ja: '存在しない場合は作成します。空欄 = 共有のルート' },
+  smbUserHelp:      { en: 'user or DOMAIN\\user (empty = guest)', ja: 'ユーザー名または DOMAIN\\ユーザー名（空欄 = guest）' },
+  fifoPath:         { en: 'FIFO Path',      ja: 'FIFO のパス' },
+  fifoPathHelp:     { en: 'Named pipe created with mkfifo. Each scan is written to it as a PDF; the scan fails if no process is reading', ja: 'mkfifo で作成した名前付きパイプ。スキャンごとに PDF を書き込みます。読み取るプロセスがない場合はスキャンが失敗します' },
+  progressEstimate:     { en: 'Estimated Progress', ja: '推定進捗' },
+  progressEstimateHelp: { en: 'Show a progress bar estimated from the feeder capacity (50 sheets). The scanner does not report remaining sheets', ja: '給紙容量 (50 枚) から推定した進捗バーを表示します。スキャナーは残り枚数を報告しません' },
+  destinationEnabled:      { en: 'Destination Enabled', ja: '保存先を有効化' },
+  destinationEnabledHelp:  { en: 'OFF ignores the scan button for this destination but keeps its settings', ja: 'OFF にするとこの保存先ではスキャンボタンを無視します。設定は保持されます' },
+  requireCompleteScan:     { en: 'Discard Incomplete Scans', ja: '不完全なスキャンを破棄' },
+  requireCompleteScanHelp: { en: 'When a scan stops midway (e.g. paper jam), do not save the pages read so far. Turn off to save them as an incomplete document', ja: 'スキャンが途中で止まった場合（紙詰まりなど）、それまでに読み取ったページを保存しません。オフにすると不完全な文書として保存します' },
+  ecoMode:          { en: 'Eco Mode',     ja: 'エコモード' },
+  ecoModeHelp:      { en: 'Release the scanner after this many idle minutes (default 10) so it can sleep. The next scan from an app or this page pairs again; the scan button does not work while released', ja: 'この分数 (既定 10) 操作がないとスキャナーを解放し、スリープできるようにします。次にアプリやこのページからスキャンすると再接続します。解放中はスキャンボタンは使えません' },
+  startMode:        { en: 'Scan Button Mode', ja: 'スキャンボタンのモード' },
+  startMode_keep:   { en: 'Keep',         ja: '変更しない' },
+  startMode_normal: { en: 'Normal',       ja: '通常' },
+  startMode_quick:  { en: 'Quick',        ja: 'クイック' },
+  startModeHelp:    { en: 'What the scanner button starts, set on the scanner after pairing. Keep = leave the scanner setting. Experimental', ja: 'スキャナーのボタンで開始するスキャンの種類です。ペアリング後にスキャナーへ設定します。変更しない = スキャナーの設定のまま（実験的）' },
+  ignoreEmptyScan:     { en: 'Ignore Empty Scans', ja: '空のスキャンを無視' },
+  ignoreEmptyScanHelp: { en: 'When the button is pressed with no paper in the feeder, do nothing instead of reporting an error', ja: '給紙トレイに用紙がない状態でボタンを押したとき、エラーにせず何もしません' },
+  saveRetries:      { en: 'Save Retries', ja: '保存の再試行回数' },
+  saveRetriesHelp:  { en: 'Retry a failed save or upload this many times without rescanning. 0 = no retry', ja: '保存やアップロードに失敗した場合、再スキャンせずにこの回数まで再試行します。0 = 再試行なし' },
+  uploadConcurrency:     { en: 'Parallel Uploads', ja: '同時アップロード数' },
+  uploadConcurrencyHelp: { en: 'Number of page images uploaded at once. 0 = default (4)', ja: '同時にアップロードするページ画像の数。0 = 既定 (4)' },
+  webhookUrl:       { en: 'Notification Webhook', ja: '通知 Webhook' },
+  webhookUrlHelp:   { en: 'POST a JSON event (result, pages, destination, error) to this URL when a button scan finishes. Empty = off', ja: 'ボタンスキャンの完了時にこの URL へ JSON イベント（結果・ページ数・保存先・エラー）を POST します。空欄 = 無効' },
+  pushService:      { en: 'Push Notification', ja: 'プッシュ通知' },
+  pushUrl:          { en: 'Topic / Server URL', ja: 'トピック / サーバー URL' },
+  pushToken:        { en: 'Token',          ja: 'トークン' },
+  pushTokenHelp:    { en: 'ntfy: access token (optional). Gotify: application token', ja: 'ntfy：アクセストークン（任意）。Gotify：アプリケーショントークン' },
+  pushTitle:        { en: 'Title Template', ja: 'タイトルのテンプレート' },
+  pushMessage:      { en: 'Message Template', ja: 'メッセージのテンプレート' },
+  pushTemplateHelp: { en: 'Go template with .Result, .Pages, .Destination, .Target, .Error and .Time. Empty = default', ja: '.Result, .Pages, .Destination, .Target, .Error, .Time を使える Go テンプレート。空欄 = 既定' },
+  pushAttachPdf:    { en: 'Attach PDF',     ja: 'PDF を添付' },
+  includeSerialInFilename:     { en: 'Include Serial in File Name', ja: 'ファイル名にシリアル番号を含める' },
+  filenameTemplate:            { en: 'File Name Template', ja: 'ファイル名テンプレート' },
+  filenameTemplateHelp:        { en: 'Placeholders: {date} {time} {datetime} {n} {total} {host} {serial} {ext}. / creates folders. Empty = scan_<date>_<time>', ja: '使える値: {date} {time} {datetime} {n} {total} {host} {serial} {ext}。/ でフォルダを作成します。空欄 = scan_<日付>_<時刻>' },
+  includeSerialInFilenameHelp: { en: 'Prefix saved files with the scanner serial, e.g. scan_<serial>_<date>.pdf', ja: '保存ファイル名の先頭にスキャナーのシリアル番号を付けます (例: scan_<シリアル>_<日時>.pdf)' },
+  originalPageNumbers:         { en: 'Number Pages as Fed', ja: '給紙順のページ番号' },
+  originalPageNumbersHelp:     { en: 'Number page files by sheet and side, so removed blank pages leave gaps instead of shifting the numbers. Duplex: front of sheet 2 = 003', ja: 'ページのファイルを用紙と面の順に番号付けし、除外された白紙ページの番号を詰めずに残します。両面: 2 枚目の表 = 003' },
+  bwPdfEmbedding:     { en: 'B&W PDF Encoding', ja: '白黒 PDF の画像形式' },
+  bwPdfSmallest:      { en: 'Smallest', ja: '最小サイズ' },
+  bwPdfEmbeddingHelp: { en: 'PNG and G4 (CCITT fax compression, usually much smaller for text) are lossless. Smallest tries both and grayscale JPEG and keeps the smallest', ja: 'PNG と G4 (CCITT ファクス圧縮。文書では多くの場合かなり小さくなります) は劣化しません。最小サイズは両方とグレースケール JPEG を試し、最も小さいものを使います' },
+  maxPdfSize:       { en: 'Max PDF Size (MB)', ja: 'PDF 最大サイズ (MB)' },
+  maxPdfSizeHelp:   { en: 'Larger PDFs are recompressed at lower quality to fit. 0 = no limit', ja: '超過した PDF は画質を下げて再圧縮します。0 = 制限なし' },
+  pdfMargin:        { en: 'PDF Page Margin (mm)', ja: 'PDF ページ余白 (mm)' },
+  pdfMarginHelp:    { en: 'Blank border added around each page image. 0 = none', ja: '各ページの画像の周囲に追加する余白。0 = なし' },
+  longPageSplit:    { en: 'Split Long Pages (mm)', ja: '長尺ページの分割 (mm)' },
+  longPageSplitHelp: { en: 'Pages longer than this, such as long receipts, are split into pages of this length with a 5 mm overlap. 297 = A4 length, 0 = off', ja: 'これより長いページ (長いレシートなど) をこの長さのページに 5 mm 重ねて分割します。297 = A4 の長さ、0 = 分割しない' },
+  pdfA:             { en: 'PDF/A (Archive)', ja: 'PDF/A (長期保存)' },
+  pdfAHelp:         { en: 'Save as PDF/A-2b for long-term archiving, e.g. in Paperless-ngx', ja: 'Paperless-ngx などでの長期保存向けに PDF/A-2b で保存します' },
+  pdfTitle:         { en: 'PDF Title', ja: 'PDF タイトル' },
+  pdfTitleHelp:     { en: 'Document title shown by PDF viewers and document managers. Empty = file name', ja: 'PDF ビューアや文書管理で表示される文書タイトル。空欄 = ファイル名' },
+  pdfAuthor:        { en: 'PDF Author', ja: 'PDF 作成者' },
+  pdfSubject:       { en: 'PDF Subject', ja: 'PDF サブタイトル' },
+  pdfKeywords:      { en: 'PDF Keywords', ja: 'PDF キーワード' },
+  pdfKeywordsHelp:  { en: 'Space-separated keywords for searching', ja: '検索用のキーワード (スペース区切り)' },
+  ocr:              { en: 'OCR (Searchable PDF)', ja: 'OCR (検索可能な PDF)' },
+  ocrHelp:          { en: 'Add a selectable text layer with tesseract. Skipped when tesseract is not installed', ja: 'tesseract で選択可能なテキストレイヤーを追加します。tesseract がインストールされていない場合はスキップされます' },
+  ocrLanguage:      { en: 'OCR Language', ja: 'OCR 言語' },
+  ocrLanguageHelp:  { en: 'tesseract language codes joined with +. Empty = eng', ja: '+ でつないだ tesseract の言語コード。空欄 = eng' },
+  ocrDualPdf:       { en: 'Also Save Image-only PDF', ja: '画像のみの PDF も保存' },
+  ocrDualPdfHelp:   { en: 'Save the searchable PDF as <name>_ocr.pdf next to an image-only <name>.pdf', ja: '検索可能な PDF を <name>_ocr.pdf として、画像のみの <name>.pdf と並べて保存します' },
 
   // Scan job
   scanning:         { en: 'Scanning...',   ja: 'スキャン中...' },
+  pagesScanned:     { en: ' pages scanned', ja: ' ページ読み取り済み' },
+  progressEstimateNote: { en: '(estimate based on feeder capacity)', ja: '(給紙容量からの推定)' },
   pagesSaved:       { en: ' pages saved',  ja: ' ページ保存完了' },
   scanFailed:       { en: 'Scan failed',   ja: 'スキャン失敗' },
+  downloadDocument: { en: 'Download',      ja: 'ダウンロード' },
+  savedFiles:       { en: 'Saved Files',   ja: '保存したファイル' },
+  noSavedFiles:     { en: 'No scans saved yet', ja: '保存したスキャンはまだありません' },
+  reload:           { en: 'Reload',        ja: '再読み込み' },
+
+  // Profiles
+  profile:          { en: 'Profile',       ja: 'プロファイル' },
+  profileHelp:      { en: 'Each profile keeps its own settings, e.g. "Receipts" in B&W 150 dpi and "Photos" in color 300 dpi. The selected profile is edited here and used by AirScan scans. A new profile starts as a copy of the selected one.', ja: 'プロファイルごとに設定を保存できます（例: 白黒 150 dpi の「レシート」、カラー 300 dpi の「写真」）。選択中のプロファイルをここで編集し、AirScan のスキャンにも使います。新しいプロファイルは選択中のプロファイルのコピーから始まります。' },
+  newProfileName:   { en: 'New profile name', ja: '新しいプロファイル名' },
+  addProfile:       { en: 'Add',           ja: '追加' },
+  deleteProfile:    { en: 'Delete',        ja: '削除' },
+  deleteProfileConfirm: { en: 'Delete profile "{name}"?', ja: 'プロファイル「{name}」を削除しますか？' },
+  buttonProfile:    { en: 'Scan button profile', ja: 'スキャンボタンのプロファイル' },
+  buttonProfileHelp: { en: 'Profile used when scanning with the scanner button.', ja: 'スキャナーのボタンでスキャンするときに使うプロファイル。' },
+  buttonProfileActive: { en: 'Selected profile', ja: '選択中のプロファイル' },
 
   // eSCL
   esclHelp:         { en: 'Available from Linux SANE / macOS Image Capture / Windows WSD', ja: 'Linux SANE / macOS Image Capture / Windows WSD から利用できます' },
+  debugBundle:      { en: 'Download diagnostics for bug reports', ja: '不具合報告用の診断情報をダウンロード' },
 
   // Color modes
   modeAuto:         { en: 'Auto',        ja: '自動' },
@@ -85,22 +225,44 @@ const MESSAGES = {
   paper_auto:       { en: 'Auto',          ja: '自動' },
   paper_a4:         { en: 'A4',            ja: 'A4' },
   paper_a5:         { en: 'A5',            ja: 'A5' },
+  paper_a6:         { en: 'A6',            ja: 'A6' },
+  paper_b5:         { en: 'B5 (JIS)',      ja: 'B5' },
   paper_business_card: { en: 'Biz Card',   ja: '名刺' },
   paper_postcard:   { en: 'Postcard',      ja: 'はがき' },
+  paper_letter:     { en: 'Letter',        ja: 'レター' },
+  paper_legal:      { en: 'Legal',         ja: 'リーガル' },
 
   // AirScan settings
   airscanSettings:           { en: 'AirScan Settings',        ja: 'AirScan 設定' },
   airscanForcePaperAuto:     { en: 'Auto paper size detect',  ja: '用紙サイズ自動検出' },
   airscanForcePaperAutoHelp: { en: 'Ignore paper size specified by AirScan clients and always use auto-detect. Takes effect on the next scan.', ja: 'AirScan クライアントが指定した用紙サイズを無視し、常に自動検出を使用する。次回のスキャンから反映されます。' },
+  defaultDuplex:             { en: 'Duplex by default', ja: 'デフォルトで両面' },
+  defaultDuplexHelp:         { en: 'Scan both sides when the AirScan client does not specify simplex or duplex.', ja: 'AirScan クライアントが片面・両面を指定しない場合に両面スキャンする。' },
   airscanBleedThrough:       { en: 'Bleed-through reduction', ja: '裏写り軽減' },
   airscanBleedThroughHelp:   { en: 'Apply bleed-through reduction to AirScan scans.', ja: 'AirScan スキャンに裏写り軽減を適用する。' },
   airscanBwDensity:          { en: 'B&W Density',             ja: '白黒濃度' },
   airscanBwDensityHelp:      { en: 'Default B&W density for AirScan clients that don\'t specify threshold.', ja: 'Threshold を指定しない AirScan クライアント用の白黒濃度デフォルト値。' },
+  airscanColorSpace:         { en: 'Color space',             ja: '色空間' },
+  airscanColorSpaceHelp:     { en: 'Color space advertised to AirScan clients. sRGB embeds an sRGB ICC profile in color JPEG pages; Raw leaves pages untagged.', ja: 'AirScan クライアントに通知する色空間。sRGB ではカラーの JPEG ページに sRGB の ICC プロファイルを埋め込みます。Raw ではタグを付けません。' },
+  colorSpaceRaw:             { en: 'Raw (untagged)',          ja: 'Raw (タグなし)' },
+  airscanForceColorMode:     { en: 'Force color mode',        ja: 'カラーモードを固定' },
+  airscanForceColorModeHelp: { en: 'Always scan in this color mode regardless of the client request. Clients are only offered the forced mode.', ja: 'クライアントの指定に関わらず、常にこのカラーモードでスキャンします。クライアントには固定したモードのみを通知します。' },
+  forceColorModeOff:         { en: 'Use client request',      ja: 'クライアントの指定に従う' },
 
   // Browser scan
   scanNow:          { en: 'Scan & Preview',                 ja: 'スキャンしてプレビュー' },
+  pagesReceived:    { en: ' pages received',                ja: 'ページ受信' },
   scanResult:       { en: 'Scan Result',                    ja: 'スキャン結果' },
+  thisScanOnly:     { en: 'For this scan only', ja: 'このスキャンのみ' },
+  previewCached:    { en: 'Showing the previous preview. Change a setting or wait a minute to scan again.', ja: '前回のプレビューを表示しています。設定を変更するか、1分後に再度スキャンしてください。' },
   previewUnsupported: { en: 'This image format cannot be previewed in your browser. Please download to view.', ja: 'この画像形式はブラウザでプレビューできません。ダウンロードして確認してください。' },
   downloadPage:     { en: 'Download Page',                  ja: 'ページをダウンロード' },
+  rotatePage:       { en: 'Rotate',                         ja: '回転' },
+  removePage:       { en: 'Remove',                         ja: '削除' },
+  movePageEarlier:  { en: 'Move earlier',                   ja: '前へ移動' },
+  movePageLater:    { en: 'Move later',                     ja: '後ろへ移動' },
+  savePreview:      { en: 'Save',                           ja: '保存' },
+  previewSaved:     { en: 'Saved {n} page(s).',             ja: '{n} ページを保存しました。' },
+  fastPreviewNoSave: { en: 'Fast preview pages are 150 dpi single-sided and cannot be saved. Turn off fast preview and preview again to save.', ja: '高速プレビューのページは 150 dpi の片面のため保存できません。保存するには高速プレビューをオフにして再度プレビューしてください。' },
   close:            { en: 'Close',                          ja: '閉じる' },
 };